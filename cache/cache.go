@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+/* Cache keeps byte values under string keys for a limited time. A failing
+* cache must never fail a request, so callers treat errors like misses. Every
+* implementation counts its hits and misses. */
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Stats() Stats
+}
+
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRatio returns the share of lookups which were hits, or zero before the
+// first lookup.
+func (stats Stats) HitRatio() float64 {
+	lookups := stats.Hits + stats.Misses
+
+	if lookups == 0 {
+		return 0
+	}
+
+	return float64(stats.Hits) / float64(lookups)
+}
+
+type statsCounter struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (counter *statsCounter) record(hits int, misses int) {
+	counter.hits.Add(uint64(hits))
+	counter.misses.Add(uint64(misses))
+}
+
+func (counter *statsCounter) Stats() Stats {
+	return Stats{
+		Hits:   counter.hits.Load(),
+		Misses: counter.misses.Load(),
+	}
+}
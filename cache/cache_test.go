@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// forEachCache runs the test against every cache implementation which stores
+// entries.
+func forEachCache(t *testing.T, test func(t *testing.T, cache Cache)) {
+	t.Run("lru", func(t *testing.T) {
+		test(t, InitLRUCache(100))
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+
+		cache, err := InitRedisCache(context.Background(), &RedisConfig{
+			Addr:   server.Addr(),
+			Prefix: "test:",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, cache)
+
+		if !server.Exists("test:a") {
+			t.Errorf("expected keys to be prefixed")
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	forEachCache(t, func(t *testing.T, cache Cache) {
+		ctx := context.Background()
+
+		if _, found, err := cache.Get(ctx, "a"); found || err != nil {
+			t.Fatalf("expected a miss on an empty cache, got %v, %v", found, err)
+		}
+
+		for _, key := range []string{"a", "b", "c"} {
+			if err := cache.Set(ctx, key, []byte(key+"-value"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		value, found, err := cache.Get(ctx, "a")
+
+		if err != nil || !found || string(value) != "a-value" {
+			t.Fatalf("expected a hit, got %q, %v, %v", value, found, err)
+		}
+
+		if err := cache.Delete(ctx, "b", "missing"); err != nil {
+			t.Fatal(err)
+		}
+
+		values, err := cache.GetMany(ctx, []string{"a", "b", "c"})
+
+		if err != nil || len(values) != 2 || string(values["c"]) != "c-value" {
+			t.Fatalf("expected a and c, got %q, %v", values, err)
+		}
+
+		if stats := cache.Stats(); stats.Hits != 3 || stats.Misses != 2 || stats.HitRatio() != 0.6 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := newLRUCache(2, time.Now)
+
+	cache.Set(ctx, "a", []byte("a"), time.Minute)
+	cache.Set(ctx, "b", []byte("b"), time.Minute)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", []byte("c"), time.Minute)
+
+	if _, found, _ := cache.Get(ctx, "b"); found {
+		t.Errorf("expected b to be evicted")
+	}
+
+	if _, found, _ := cache.Get(ctx, "a"); !found {
+		t.Errorf("expected a to be kept after its use")
+	}
+
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Len())
+	}
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := newLRUCache(10, func() time.Time { return now })
+
+	cache.Set(ctx, "a", []byte("a"), time.Minute)
+
+	value, _, _ := cache.Get(ctx, "a")
+	value[0] = 'x'
+
+	if value, _, _ := cache.Get(ctx, "a"); string(value) != "a" {
+		t.Errorf("expected cached values to be copied, got %q", value)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, found, _ := cache.Get(ctx, "a"); found || cache.Len() != 0 {
+		t.Errorf("expected a to expire")
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+/* LRUCache keeps up to a fixed number of entries in process memory, evicting
+* the least recently used entry when it is full. Expired entries are dropped
+* when they are looked up or reach the end of the eviction order. Values are
+* copied on the way in and out, so callers can not modify cached values. */
+type LRUCache struct {
+	statsCounter
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+func InitLRUCache(capacity int) Cache {
+	return newLRUCache(capacity, time.Now)
+}
+
+func newLRUCache(capacity int, now func() time.Time) *LRUCache {
+	return &LRUCache{
+		capacity: max(capacity, 1),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      now,
+	}
+}
+
+func (cache *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	value, found := cache.get(key)
+
+	if found {
+		cache.record(1, 0)
+	} else {
+		cache.record(0, 1)
+	}
+
+	return value, found, nil
+}
+
+func (cache *LRUCache) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	values := make(map[string][]byte, len(keys))
+
+	for _, key := range keys {
+		if value, found := cache.get(key); found {
+			values[key] = value
+		}
+	}
+
+	cache.record(len(values), len(keys)-len(values))
+
+	return values, nil
+}
+
+func (cache *LRUCache) get(key string) ([]byte, bool) {
+	element, found := cache.entries[key]
+
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+
+	if !cache.now().Before(entry.expiresAt) {
+		cache.remove(element)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+
+	return append([]byte(nil), entry.value...), true
+}
+
+func (cache *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry := &lruEntry{
+		key:       key,
+		value:     append([]byte(nil), value...),
+		expiresAt: cache.now().Add(ttl),
+	}
+
+	if element, found := cache.entries[key]; found {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+
+		return nil
+	}
+
+	cache.entries[key] = cache.order.PushFront(entry)
+
+	for cache.order.Len() > cache.capacity {
+		cache.remove(cache.order.Back())
+	}
+
+	return nil
+}
+
+func (cache *LRUCache) Delete(ctx context.Context, keys ...string) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, key := range keys {
+		if element, found := cache.entries[key]; found {
+			cache.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of entries, including expired ones which were not
+// dropped yet.
+func (cache *LRUCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.order.Len()
+}
+
+func (cache *LRUCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*lruEntry).key)
+}
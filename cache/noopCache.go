@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// NoopCache stores nothing, every lookup is a miss. It stands in for a cache
+// when caching is turned off.
+type NoopCache struct {
+	statsCounter
+}
+
+func InitNoopCache() Cache {
+	return &NoopCache{}
+}
+
+func (cache *NoopCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cache.record(0, 1)
+	return nil, false, nil
+}
+
+func (cache *NoopCache) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	cache.record(0, len(keys))
+	return map[string][]byte{}, nil
+}
+
+func (cache *NoopCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (cache *NoopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
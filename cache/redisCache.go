@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is put in front of every key, so that several applications can
+	// share a database.
+	Prefix string
+}
+
+/* RedisCache keeps entries in a server speaking the Redis protocol, such as
+* Redis, Valkey or KeyDB, so that several instances of the application share
+* one cache and see each others invalidations. */
+type RedisCache struct {
+	statsCounter
+
+	Client *redis.Client
+	Prefix string
+}
+
+// InitRedisCache connects to the server and checks that it responds.
+func InitRedisCache(ctx context.Context, config *RedisConfig) (Cache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Addr,
+		Password: config.Password,
+		DB:       config.DB,
+	})
+
+	err := client.Ping(ctx).Err()
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisCache{
+		Client: client,
+		Prefix: config.Prefix,
+	}, nil
+}
+
+func (cache *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := cache.Client.Get(ctx, cache.Prefix+key).Bytes()
+
+	if errors.Is(err, redis.Nil) {
+		cache.record(0, 1)
+		return nil, false, nil
+	}
+
+	if err != nil {
+		cache.record(0, 1)
+		return nil, false, err
+	}
+
+	cache.record(1, 0)
+
+	return value, true, nil
+}
+
+func (cache *RedisCache) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	prefixed := make([]string, len(keys))
+
+	for i, key := range keys {
+		prefixed[i] = cache.Prefix + key
+	}
+
+	results, err := cache.Client.MGet(ctx, prefixed...).Result()
+
+	if err != nil {
+		cache.record(0, len(keys))
+		return values, err
+	}
+
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[keys[i]] = []byte(value)
+		}
+	}
+
+	cache.record(len(values), len(keys)-len(values))
+
+	return values, nil
+}
+
+func (cache *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return cache.Client.Set(ctx, cache.Prefix+key, value, ttl).Err()
+}
+
+func (cache *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+
+	for i, key := range keys {
+		prefixed[i] = cache.Prefix + key
+	}
+
+	return cache.Client.Del(ctx, prefixed...).Err()
+}
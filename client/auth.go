@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+)
+
+type AuthClient struct {
+	client *Client
+}
+
+func (auth *AuthClient) Register(ctx context.Context, user *dtos.UserDTO) (uint, error) {
+	var response dtos.CreatedResponseDTO
+
+	err := auth.client.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/api/auth/register",
+		body:   user,
+	}, &response)
+
+	return response.ID, err
+}
+
+// Login exchanges the credentials for an access token, which the client uses
+// for all subsequent requests.
+func (auth *AuthClient) Login(ctx context.Context, username string, password string) (string, error) {
+	var response dtos.LoginReponseDTO
+
+	err := auth.client.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/api/auth/login",
+		body: &dtos.LoginDTO{
+			Username: username,
+			Password: password,
+		},
+	}, &response)
+
+	if err != nil {
+		return "", err
+	}
+
+	auth.client.setToken(response.AccessToken)
+
+	return response.AccessToken, nil
+}
+
+func (auth *AuthClient) Me(ctx context.Context) (*dtos.UserResponseDto, error) {
+	user, _, err := auth.MeWithETag(ctx)
+	return user, err
+}
+
+// MeWithETag also returns the ETag of the logged in user, which
+// Users.UpdateCurrent requires.
+func (auth *AuthClient) MeWithETag(ctx context.Context) (*dtos.UserResponseDto, string, error) {
+	var user dtos.UserResponseDto
+	var etag string
+
+	err := auth.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/api/auth/me/",
+		authenticated: true,
+		etag:          &etag,
+	}, &user)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &user, etag, nil
+}
@@ -0,0 +1,332 @@
+/*
+Package client is a typed Go client for the webstore API.
+
+	c, err := client.New("http://localhost:8080", client.WithCredentials("user", "pass"))
+	product, err := c.Products.Get(ctx, 1)
+
+When credentials are configured the client logs in on first use and logs in
+again whenever the access token is rejected. Idempotent requests are retried
+with exponential backoff on network errors and 5xx responses. Requests which
+create resources are sent with a random Idempotency-Key, so that they can be
+retried as well without creating duplicates.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+
+	mu       sync.Mutex
+	token    string
+	username string
+	password string
+
+	Auth     *AuthClient
+	Users    *UsersClient
+	Products *ProductsClient
+	Comments *CommentsClient
+}
+
+type Option func(client *Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithCredentials makes the client log in automatically and refresh the
+// access token when it expires.
+func WithCredentials(username string, password string) Option {
+	return func(client *Client) {
+		client.username = username
+		client.password = password
+	}
+}
+
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// WithRetries configures how many times idempotent requests are retried and
+// the delay before the first retry, which doubles with every attempt.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.retryBackoff = backoff
+	}
+}
+
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsedURL, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		baseURL:      parsedURL,
+		httpClient:   http.DefaultClient,
+		maxRetries:   DefaultMaxRetries,
+		retryBackoff: DefaultRetryBackoff,
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	client.Auth = &AuthClient{client: client}
+	client.Users = &UsersClient{client: client}
+	client.Products = &ProductsClient{client: client}
+	client.Comments = &CommentsClient{client: client}
+
+	return client, nil
+}
+
+// Token returns the access token currently used by the client.
+func (client *Client) Token() string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.token
+}
+
+func (client *Client) setToken(token string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.token = token
+}
+
+func (client *Client) hasCredentials() bool {
+	return client.username != ""
+}
+
+type request struct {
+	method        string
+	path          string
+	query         url.Values
+	body          any
+	authenticated bool
+	// idempotencyKey is sent as the Idempotency-Key header and makes the
+	// request safe to retry.
+	idempotencyKey string
+	// contentType of the body defaults to application/json.
+	contentType string
+	// ifMatch is sent as the If-Match header, while the ETag of a successful
+	// response is stored in etag.
+	ifMatch string
+	etag    *string
+}
+
+/* do sends the request and decodes a successful JSON response into out. For
+* authenticated requests a missing or rejected token is refreshed once using
+* the configured credentials. */
+func (client *Client) do(ctx context.Context, req *request, out any) error {
+	var payload []byte
+
+	if req.body != nil {
+		var err error
+		payload, err = json.Marshal(req.body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	refreshed := false
+
+	if req.authenticated && client.Token() == "" && client.hasCredentials() {
+		if err := client.refreshToken(ctx); err != nil {
+			return err
+		}
+
+		refreshed = true
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := client.send(ctx, req, payload)
+
+		if err != nil {
+			if client.shouldRetry(ctx, req, attempt) {
+				if err := client.wait(ctx, attempt); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			return err
+		}
+
+		if response.StatusCode == http.StatusUnauthorized &&
+			req.authenticated && !refreshed && client.hasCredentials() {
+
+			drainAndClose(response)
+
+			if err := client.refreshToken(ctx); err != nil {
+				return err
+			}
+
+			refreshed = true
+			attempt--
+
+			continue
+		}
+
+		if response.StatusCode >= http.StatusInternalServerError &&
+			client.shouldRetry(ctx, req, attempt) {
+
+			drainAndClose(response)
+
+			if err := client.wait(ctx, attempt); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if req.etag != nil && response.StatusCode < http.StatusBadRequest {
+			*req.etag = response.Header.Get("ETag")
+		}
+
+		return decodeResponse(response, out)
+	}
+}
+
+func (client *Client) send(ctx context.Context, req *request, payload []byte) (*http.Response, error) {
+	target := *client.baseURL
+	target.Path += req.path
+	target.RawQuery = req.query.Encode()
+
+	var body io.Reader
+
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, target.String(), body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest.Header.Set("Accept", "application/json")
+
+	if payload != nil && req.contentType != "" {
+		httpRequest.Header.Set("Content-Type", req.contentType)
+	} else if payload != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+
+	if req.ifMatch != "" {
+		httpRequest.Header.Set("If-Match", req.ifMatch)
+	}
+
+	if req.idempotencyKey != "" {
+		httpRequest.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+
+	if token := client.Token(); req.authenticated && token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return client.httpClient.Do(httpRequest)
+}
+
+func (client *Client) refreshToken(ctx context.Context) error {
+	_, err := client.Auth.Login(ctx, client.username, client.password)
+
+	if err != nil {
+		return fmt.Errorf("could not refresh access token: %w", err)
+	}
+
+	return nil
+}
+
+func (client *Client) shouldRetry(ctx context.Context, req *request, attempt int) bool {
+	if attempt >= client.maxRetries || ctx.Err() != nil {
+		return false
+	}
+
+	if req.idempotencyKey != "" {
+		return true
+	}
+
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// newIdempotencyKey returns a random key for a request creating a resource.
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	return hex.EncodeToString(key)
+}
+
+func (client *Client) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(client.retryBackoff << attempt)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func decodeResponse(response *http.Response, out any) error {
+	defer drainAndClose(response)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return newAPIError(response)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err := json.NewDecoder(response.Body).Decode(out)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not decode response body: %w", err)
+	}
+
+	return nil
+}
+
+func drainAndClose(response *http.Response) {
+	_, _ = io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+}
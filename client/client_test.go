@@ -0,0 +1,391 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/client"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/router"
+	"github.com/brunohradec/go-webstore/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const testSecret = "client-test-secret"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	env := &infrastructure.Env{
+		JWT: infrastructure.JWTEnv{
+			AccessTokenSecret: testSecret,
+			AccessTokenTTL:    60,
+		},
+		Media: infrastructure.MediaEnv{
+			BaseURL:        "/media",
+			MaxUploadBytes: 1 << 20,
+		},
+		Idempotency: infrastructure.IdempotencyEnv{
+			TTL:   time.Minute,
+			Lease: time.Minute,
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	products := repositories.InitMemoryProductRepository()
+
+	r := router.New(env, logger, &router.Repositories{
+		User:    repositories.InitMemoryUserRepository(),
+		Product: products,
+		Comment: repositories.InitMemoryCommentRepository(products),
+		Review:  repositories.InitMemoryReviewRepository(products),
+
+		ProductImage:   repositories.InitMemoryProductImageRepository(),
+		IdempotencyKey: repositories.InitMemoryIdempotencyKeyRepository(),
+		AuditEvent:     repositories.InitMemoryAuditEventRepository(),
+		OutboxEvent:    repositories.InitMemoryOutboxEventRepository(),
+		Webhook:        repositories.InitMemoryWebhookRepository(),
+		Job:            repositories.InitMemoryJobRepository(),
+		Transactor:     repositories.InitMemoryTransactor(),
+
+		Notification:            repositories.InitMemoryNotificationRepository(),
+		NotificationPreferences: repositories.InitMemoryNotificationPreferencesRepository(),
+	}, storage.InitMemoryBlobStore("/media"), cache.InitNoopCache(), events.InitBus())
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newRegisteredClient(t *testing.T, baseURL string, username string) *client.Client {
+	t.Helper()
+
+	ctx := context.Background()
+
+	c, err := client.New(baseURL, client.WithCredentials(username, "secret"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Auth.Register(ctx, &dtos.UserDTO{
+		Email:    username + "@example.com",
+		Username: username,
+		Password: "secret",
+	})
+
+	if err != nil {
+		t.Fatalf("could not register %s: %v", username, err)
+	}
+
+	return c
+}
+
+func TestProductLifecycle(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	c := newRegisteredClient(t, server.URL, "alice")
+
+	me, err := c.Auth.Me(ctx)
+
+	if err != nil {
+		t.Fatalf("Me: %v", err)
+	}
+
+	if me.Username != "alice" {
+		t.Errorf("expected username alice, got %q", me.Username)
+	}
+
+	id, err := c.Products.Create(ctx, &dtos.ProductDTO{Name: "Lamp", Price: 1999})
+
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, etag, err := c.Products.GetWithETag(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetWithETag: %v", err)
+	}
+
+	etag, err = c.Products.Update(ctx, id, etag, &dtos.ProductDTO{Name: "Desk lamp", Price: 1999})
+
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	_, err = c.Products.Patch(ctx, id, etag, map[string]any{"price": 2499})
+
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	_, err = c.Products.Update(ctx, id, etag, &dtos.ProductDTO{Name: "Floor lamp", Price: 2999})
+
+	if !client.IsPreconditionFailed(err) {
+		t.Errorf("expected a stale update to fail its precondition, got %v", err)
+	}
+
+	product, err := c.Products.Get(ctx, id)
+
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if product.Name != "Desk lamp" || product.Price != 2499 || product.UserID != me.ID {
+		t.Errorf("unexpected product %+v", product)
+	}
+
+	if err := c.Products.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err = c.Products.Get(ctx, id)
+
+	if !client.IsNotFound(err) {
+		t.Errorf("expected not found error after delete, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	alice := newRegisteredClient(t, server.URL, "alice")
+	bob := newRegisteredClient(t, server.URL, "bob")
+
+	id, err := alice.Products.Create(ctx, &dtos.ProductDTO{Name: "Chair"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, etag, err := bob.Products.GetWithETag(ctx, id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bob.Products.Update(ctx, id, etag, &dtos.ProductDTO{Name: "Stolen chair"})
+
+	if !client.IsForbidden(err) {
+		t.Errorf("expected forbidden error, got %v", err)
+	}
+
+	_, err = bob.Auth.Register(ctx, &dtos.UserDTO{Email: "a@example.com", Username: "alice", Password: "x"})
+
+	if !client.IsConflict(err) {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+
+	_, err = alice.Products.Create(ctx, &dtos.ProductDTO{})
+
+	apiErr, ok := err.(*client.APIError)
+
+	if !ok || apiErr.Code != "validation_failed" || len(apiErr.Problem.Errors) != 1 {
+		t.Errorf("expected validation error with one field error, got %#v", err)
+	}
+
+	anonymous, _ := client.New(server.URL)
+
+	_, err = anonymous.Products.List(ctx, paging.Page{})
+
+	if !client.IsUnauthorized(err) {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	newRegisteredClient(t, server.URL, "alice")
+
+	expired, err := authutils.GenerateToken(1, testSecret, -60)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := client.New(server.URL, client.WithToken(expired), client.WithCredentials("alice", "secret"))
+
+	if _, err := c.Auth.Me(ctx); err != nil {
+		t.Fatalf("expected request to succeed after token refresh, got %v", err)
+	}
+
+	if c.Token() == expired {
+		t.Errorf("expected expired token to be replaced")
+	}
+}
+
+func TestIterator(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	c := newRegisteredClient(t, server.URL, "alice")
+
+	for i := 0; i < 25; i++ {
+		if _, err := c.Products.Create(ctx, &dtos.ProductDTO{Name: "Product"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it := c.Products.Iterate(10)
+	seen := map[uint]bool{}
+
+	for it.Next(ctx) {
+		seen[it.Value().ID] = true
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 25 {
+		t.Errorf("expected to iterate over 25 distinct products, got %d", len(seen))
+	}
+}
+
+func TestIteratorBeyondMaxPageSize(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	c := newRegisteredClient(t, server.URL, "alice")
+	count := paging.MaxPageSize + 30
+
+	for i := 0; i < count; i++ {
+		if _, err := c.Products.Create(ctx, &dtos.ProductDTO{Name: "Product"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it := c.Products.Iterate(2 * paging.MaxPageSize)
+	seen := map[uint]bool{}
+
+	for it.Next(ctx) {
+		seen[it.Value().ID] = true
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != count {
+		t.Errorf("expected to iterate over %d distinct products, got %d", count, len(seen))
+	}
+}
+
+func TestIteratorBelowServerMaxPageSize(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	// The proxy stands in for a server which caps the page size below the
+	// one the client asks for.
+	const serverMaxPageSize = 5
+
+	capped := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if pageSize, err := strconv.Atoi(query.Get("pageSize")); err == nil && pageSize > serverMaxPageSize {
+			query.Set("pageSize", strconv.Itoa(serverMaxPageSize))
+			r.URL.RawQuery = query.Encode()
+		}
+
+		forward(w, r, server.URL)
+	}))
+	t.Cleanup(capped.Close)
+
+	c := newRegisteredClient(t, capped.URL, "alice")
+	count := 2*serverMaxPageSize + 2
+
+	for i := 0; i < count; i++ {
+		if _, err := c.Products.Create(ctx, &dtos.ProductDTO{Name: "Product"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it := c.Products.Iterate(4 * serverMaxPageSize)
+	seen := map[uint]bool{}
+
+	for it.Next(ctx) {
+		seen[it.Value().ID] = true
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != count {
+		t.Errorf("expected to iterate over %d distinct products, got %d", count, len(seen))
+	}
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	var failures atomic.Int32
+	failures.Store(2)
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		forward(w, r, server.URL)
+	}))
+	t.Cleanup(flaky.Close)
+
+	newRegisteredClient(t, server.URL, "alice")
+
+	c, _ := client.New(
+		flaky.URL,
+		client.WithCredentials("alice", "secret"),
+		client.WithRetries(2, time.Millisecond),
+	)
+
+	if _, err := c.Auth.Me(ctx); err != nil {
+		t.Fatalf("expected request to succeed after retries, got %v", err)
+	}
+}
+
+// forward proxies the request to the server at targetURL and copies its
+// response back.
+func forward(w http.ResponseWriter, r *http.Request, targetURL string) {
+	proxy, _ := http.NewRequestWithContext(r.Context(), r.Method, targetURL+r.URL.String(), r.Body)
+	proxy.Header = r.Header
+
+	response, err := http.DefaultClient.Do(proxy)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	defer response.Body.Close()
+
+	for key, values := range response.Header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(response.StatusCode)
+	_, _ = io.Copy(w, response.Body)
+}
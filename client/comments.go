@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+)
+
+type CommentsClient struct {
+	client *Client
+}
+
+func (comments *CommentsClient) Create(ctx context.Context, comment *dtos.CommentDTO) (uint, error) {
+	var response dtos.CreatedResponseDTO
+
+	err := comments.client.do(ctx, &request{
+		method:         http.MethodPost,
+		path:           "/api/comments/",
+		idempotencyKey: newIdempotencyKey(),
+		body:           comment,
+		authenticated:  true,
+	}, &response)
+
+	return response.ID, err
+}
+
+func (comments *CommentsClient) Get(ctx context.Context, ID uint) (*dtos.CommentResponseDto, error) {
+	comment, _, err := comments.GetWithETag(ctx, ID)
+	return comment, err
+}
+
+// GetWithETag also returns the ETag of the comment, which Update requires.
+func (comments *CommentsClient) GetWithETag(ctx context.Context, ID uint) (*dtos.CommentResponseDto, string, error) {
+	var comment dtos.CommentResponseDto
+	var etag string
+
+	err := comments.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("/api/comments/%d", ID),
+		authenticated: true,
+		etag:          &etag,
+	}, &comment)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &comment, etag, nil
+}
+
+func (comments *CommentsClient) ListByProduct(
+	ctx context.Context,
+	productID uint,
+	page paging.Page) ([]dtos.CommentResponseDto, error) {
+
+	var response []dtos.CommentResponseDto
+
+	err := comments.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("/api/comments/product/%d", productID),
+		query:         pageQuery(page),
+		authenticated: true,
+	}, &response)
+
+	return response, err
+}
+
+func (comments *CommentsClient) IterateByProduct(productID uint, pageSize int) *Iterator[dtos.CommentResponseDto] {
+	return newIterator(pageSize, func(ctx context.Context, page paging.Page) ([]dtos.CommentResponseDto, error) {
+		return comments.ListByProduct(ctx, productID, page)
+	})
+}
+
+// Update replaces the comment if it is still as it was when etag was read, and
+// returns the ETag of the updated comment.
+func (comments *CommentsClient) Update(ctx context.Context, ID uint, etag string, comment *dtos.CommentDTO) (string, error) {
+	var updatedETag string
+
+	err := comments.client.do(ctx, &request{
+		method:        http.MethodPut,
+		path:          fmt.Sprintf("/api/comments/%d", ID),
+		body:          comment,
+		authenticated: true,
+		ifMatch:       etag,
+		etag:          &updatedETag,
+	}, nil)
+
+	return updatedETag, err
+}
+
+func (comments *CommentsClient) Delete(ctx context.Context, ID uint) error {
+	return comments.client.do(ctx, &request{
+		method:        http.MethodDelete,
+		path:          fmt.Sprintf("/api/comments/%d", ID),
+		authenticated: true,
+	}, nil)
+}
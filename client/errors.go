@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+)
+
+/* APIError is returned for every response with a 4xx or 5xx status. When the
+* server answered with a problem details document it is available in Problem,
+* and Code holds its stable error code. */
+type APIError struct {
+	StatusCode int
+	Code       string
+	Problem    *dtos.ProblemDTO
+}
+
+func (err *APIError) Error() string {
+	if err.Problem != nil && err.Problem.Detail != "" {
+		return fmt.Sprintf("webstore API: %d %s: %s", err.StatusCode, err.Code, err.Problem.Detail)
+	}
+
+	return fmt.Sprintf("webstore API: %d %s", err.StatusCode, http.StatusText(err.StatusCode))
+}
+
+func newAPIError(response *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: response.StatusCode}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+
+	if err != nil {
+		return apiErr
+	}
+
+	var problem dtos.ProblemDTO
+
+	if json.Unmarshal(body, &problem) == nil && problem.Code != "" {
+		apiErr.Problem = &problem
+		apiErr.Code = problem.Code
+	}
+
+	return apiErr
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsPreconditionFailed reports whether an update was rejected because the
+// resource changed since its ETag was read.
+func IsPreconditionFailed(err error) bool {
+	return hasStatus(err, http.StatusPreconditionFailed)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/brunohradec/go-webstore/paging"
+)
+
+type pageFetcher[T any] func(ctx context.Context, page paging.Page) ([]T, error)
+
+/*
+	 Iterator walks over all items of a paginated listing, fetching pages lazily.
+
+		it := c.Products.Iterate(10)
+		for it.Next(ctx) {
+			product := it.Value()
+		}
+		if err := it.Err(); err != nil {
+			...
+		}
+*/
+type Iterator[T any] struct {
+	fetch    pageFetcher[T]
+	pageSize int
+	page     int
+	buffer   []T
+	index    int
+	current  T
+	done     bool
+	err      error
+}
+
+func newIterator[T any](pageSize int, fetch pageFetcher[T]) *Iterator[T] {
+	// The server caps the page size, so there is no use asking for more.
+	switch {
+	case pageSize > paging.MaxPageSize:
+		pageSize = paging.MaxPageSize
+	case pageSize <= 0:
+		pageSize = paging.DefaultPageSize
+	}
+
+	return &Iterator[T]{
+		fetch:    fetch,
+		pageSize: pageSize,
+	}
+}
+
+// Next advances to the next item and reports whether there is one.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.index >= len(it.buffer) {
+		if it.done {
+			return false
+		}
+
+		it.page++
+
+		items, err := it.fetch(ctx, paging.Page{Page: it.page, PageSize: it.pageSize})
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.buffer = items
+		it.index = 0
+
+		// A short first page may be a server capping the page size below
+		// ours rather than the end of the listing, so its length becomes the
+		// page size and only the next page tells whether there are more.
+		if it.page == 1 && len(items) > 0 && len(items) < it.pageSize {
+			it.pageSize = len(items)
+		} else {
+			it.done = len(items) < it.pageSize
+		}
+
+		if len(items) == 0 {
+			return false
+		}
+	}
+
+	it.current = it.buffer[it.index]
+	it.index++
+
+	return true
+}
+
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+func pageQuery(page paging.Page) url.Values {
+	query := url.Values{}
+
+	if page.Page > 0 {
+		query.Set("page", strconv.Itoa(page.Page))
+	}
+
+	if page.PageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(page.PageSize))
+	}
+
+	return query
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+)
+
+type ProductsClient struct {
+	client *Client
+}
+
+func (products *ProductsClient) Create(ctx context.Context, product *dtos.ProductDTO) (uint, error) {
+	var response dtos.CreatedResponseDTO
+
+	err := products.client.do(ctx, &request{
+		method:         http.MethodPost,
+		path:           "/api/products/",
+		idempotencyKey: newIdempotencyKey(),
+		body:           product,
+		authenticated:  true,
+	}, &response)
+
+	return response.ID, err
+}
+
+func (products *ProductsClient) Get(ctx context.Context, ID uint) (*dtos.ProductResponseDTO, error) {
+	product, _, err := products.GetWithETag(ctx, ID)
+	return product, err
+}
+
+// GetWithETag also returns the ETag of the product, which Update requires.
+func (products *ProductsClient) GetWithETag(ctx context.Context, ID uint) (*dtos.ProductResponseDTO, string, error) {
+	var product dtos.ProductResponseDTO
+	var etag string
+
+	err := products.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("/api/products/%d", ID),
+		authenticated: true,
+		etag:          &etag,
+	}, &product)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &product, etag, nil
+}
+
+func (products *ProductsClient) List(ctx context.Context, page paging.Page) ([]dtos.ProductResponseDTO, error) {
+	var response []dtos.ProductResponseDTO
+
+	err := products.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/api/products/",
+		query:         pageQuery(page),
+		authenticated: true,
+	}, &response)
+
+	return response, err
+}
+
+func (products *ProductsClient) ListByUser(
+	ctx context.Context,
+	userID uint,
+	page paging.Page) ([]dtos.ProductResponseDTO, error) {
+
+	var response []dtos.ProductResponseDTO
+
+	err := products.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("/api/products/user/%d", userID),
+		query:         pageQuery(page),
+		authenticated: true,
+	}, &response)
+
+	return response, err
+}
+
+// Iterate returns an iterator over all products, fetching pageSize products
+// per request.
+func (products *ProductsClient) Iterate(pageSize int) *Iterator[dtos.ProductResponseDTO] {
+	return newIterator(pageSize, products.List)
+}
+
+func (products *ProductsClient) IterateByUser(userID uint, pageSize int) *Iterator[dtos.ProductResponseDTO] {
+	return newIterator(pageSize, func(ctx context.Context, page paging.Page) ([]dtos.ProductResponseDTO, error) {
+		return products.ListByUser(ctx, userID, page)
+	})
+}
+
+/* Update replaces the product if it is still as it was when etag was read,
+* and returns the ETag of the updated product. When it was changed in the
+* meantime the update fails with an error for which IsPreconditionFailed
+* reports true. */
+func (products *ProductsClient) Update(ctx context.Context, ID uint, etag string, product *dtos.ProductDTO) (string, error) {
+	var updatedETag string
+
+	err := products.client.do(ctx, &request{
+		method:        http.MethodPut,
+		path:          fmt.Sprintf("/api/products/%d", ID),
+		body:          product,
+		authenticated: true,
+		ifMatch:       etag,
+		etag:          &updatedETag,
+	}, nil)
+
+	return updatedETag, err
+}
+
+/* Patch changes only the members of the product set in patch, following JSON
+* Merge Patch (RFC 7396). A nil member resets the detail. Like Update it needs
+* the ETag of the product and returns the ETag of the changed product. */
+func (products *ProductsClient) Patch(ctx context.Context, ID uint, etag string, patch map[string]any) (string, error) {
+	var updatedETag string
+
+	err := products.client.do(ctx, &request{
+		method:        http.MethodPatch,
+		path:          fmt.Sprintf("/api/products/%d", ID),
+		body:          patch,
+		authenticated: true,
+		contentType:   "application/merge-patch+json",
+		ifMatch:       etag,
+		etag:          &updatedETag,
+	}, nil)
+
+	return updatedETag, err
+}
+
+func (products *ProductsClient) Delete(ctx context.Context, ID uint) error {
+	return products.client.do(ctx, &request{
+		method:        http.MethodDelete,
+		path:          fmt.Sprintf("/api/products/%d", ID),
+		authenticated: true,
+	}, nil)
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+)
+
+type UsersClient struct {
+	client *Client
+}
+
+func (users *UsersClient) Get(ctx context.Context, ID uint) (*dtos.UserResponseDto, error) {
+	var user dtos.UserResponseDto
+
+	err := users.client.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("/api/users/%d", ID),
+		authenticated: true,
+	}, &user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+/* UpdateCurrent replaces the details of the logged in user if they are still
+* as they were when etag was read, and returns the ETag of the updated user.
+* When they were changed in the meantime the update fails with an error for
+* which IsPreconditionFailed reports true. */
+func (users *UsersClient) UpdateCurrent(ctx context.Context, etag string, user *dtos.UserUpdateDTO) (string, error) {
+	var updatedETag string
+
+	err := users.client.do(ctx, &request{
+		method:        http.MethodPut,
+		path:          "/api/users/",
+		body:          user,
+		authenticated: true,
+		ifMatch:       etag,
+		etag:          &updatedETag,
+	}, nil)
+
+	return updatedETag, err
+}
+
+func (users *UsersClient) ChangePassword(ctx context.Context, currentPassword string, newPassword string) error {
+	return users.client.do(ctx, &request{
+		method: http.MethodPut,
+		path:   "/api/users/password",
+		body: &dtos.UserPasswordDTO{
+			CurrentPassword: currentPassword,
+			NewPassword:     newPassword,
+		},
+		authenticated: true,
+	}, nil)
+}
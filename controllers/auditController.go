@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController interface {
+	FindEvents(c *gin.Context)
+}
+
+type AuditControllerImpl struct {
+	AuditService services.AuditService
+}
+
+func InitAuditController(auditService services.AuditService) AuditController {
+	return &AuditControllerImpl{
+		AuditService: auditService,
+	}
+}
+
+// FindEvents returns a page of the audit log, newest first, filtered by the
+// actor, entity and time range in the query string.
+func (controller *AuditControllerImpl) FindEvents(c *gin.Context) {
+	var query dtos.AuditEventQueryDTO
+
+	err := c.ShouldBindQuery(&query)
+
+	if err != nil {
+		_ = c.Error(services.ErrInvalidAuditQuery.Wrap(err))
+		return
+	}
+
+	page := paging.ParsePageFromQuery(c)
+
+	events := controller.AuditService.Find(c.Request.Context(), services.AuditEventFilter{
+		ActorID:    query.ActorID,
+		EntityType: query.EntityType,
+		EntityID:   query.EntityID,
+		From:       query.From,
+		To:         query.To,
+	}, page)
+	eventDTOs := make([]*dtos.AuditEventResponseDTO, len(events))
+
+	for i, event := range events {
+		eventDTOs[i] = dtos.AuditEventModelToDTO(&event)
+	}
+
+	c.JSON(http.StatusOK, eventDTOs)
+}
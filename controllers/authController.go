@@ -1,14 +1,13 @@
 package controllers
 
 import (
-	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/dtos"
 	"github.com/brunohradec/go-webstore/services"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type AuthController interface {
@@ -20,74 +19,53 @@ type AuthController interface {
 type AuthControllerImpl struct {
 	AuthService services.AuthService
 	UserService services.UserService
+	Logger      *slog.Logger
 }
 
 func InitAuthController(
 	authService services.AuthService,
-	userService services.UserService) AuthController {
+	userService services.UserService,
+	logger *slog.Logger) AuthController {
 
 	return &AuthControllerImpl{
 		AuthService: authService,
 		UserService: userService,
+		Logger:      logger,
 	}
 }
 
 func (controller *AuthControllerImpl) Register(c *gin.Context) {
 	var userDTO dtos.UserDTO
 
-	err := c.BindJSON(&userDTO)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to user DTO",
-		})
-
+	if !bindJSON(c, &userDTO) {
 		return
 	}
 
-	id, err := controller.AuthService.Register(dtos.UserDTOToModel(&userDTO))
+	id, err := controller.AuthService.Register(c.Request.Context(), dtos.UserDTOToModel(&userDTO))
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) {
-			c.JSON(http.StatusConflict, gin.H{
-				"message": "User with the given username already exists",
-			})
-
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"mesage": "Could not save new user",
-			})
-
-			return
-		}
+		controller.Logger.DebugContext(c.Request.Context(), "could not register user", "username", userDTO.Username, "error", err)
+		_ = c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id": id,
+	c.JSON(http.StatusCreated, dtos.CreatedResponseDTO{
+		ID: id,
 	})
 }
 
 func (controller *AuthControllerImpl) Login(c *gin.Context) {
 	var loginDTO dtos.LoginDTO
 
-	err := c.BindJSON(&loginDTO)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"mesage": "Could not bind JSON to DTO",
-		})
-
+	if !bindJSON(c, &loginDTO) {
 		return
 	}
 
-	token, err := controller.AuthService.Login(loginDTO.Username, loginDTO.Password)
+	token, err := controller.AuthService.Login(c.Request.Context(), loginDTO.Username, loginDTO.Password)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"mesage": "Could not generate access token",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not log in user", "username", loginDTO.Username, "error", err)
+		_ = c.Error(err)
 		return
 	}
 
@@ -99,13 +77,14 @@ func (controller *AuthControllerImpl) Login(c *gin.Context) {
 func (controller *AuthControllerImpl) Me(c *gin.Context) {
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
-	user, err := controller.UserService.FindByID(principalID)
+	user, err := controller.UserService.FindByID(c.Request.Context(), principalID)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"mesage": "Could not find user with the ID extracted from JSON web token",
-		})
+		_ = c.Error(err)
+		return
+	}
 
+	if notModified(c, userRepresentation(user)) {
 		return
 	}
 
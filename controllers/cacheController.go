@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/gin-gonic/gin"
+)
+
+type CacheController interface {
+	Stats(c *gin.Context)
+}
+
+type CacheControllerImpl struct {
+	Cache cache.Cache
+}
+
+func InitCacheController(cache cache.Cache) CacheController {
+	return &CacheControllerImpl{
+		Cache: cache,
+	}
+}
+
+// Stats reports the hits and misses of the cache since the application
+// started.
+func (controller *CacheControllerImpl) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, dtos.CacheStatsToResponseDTO(controller.Cache.Stats()))
+}
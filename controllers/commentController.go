@@ -1,11 +1,12 @@
 package controllers
 
 import (
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/paging"
 	"github.com/brunohradec/go-webstore/services"
 	"github.com/gin-gonic/gin"
@@ -13,36 +14,36 @@ import (
 
 type CommentController interface {
 	Save(c *gin.Context)
+	FindByID(c *gin.Context)
 	FindByProductID(c *gin.Context)
 	UpdateByID(c *gin.Context)
+	Patch(c *gin.Context)
 	DeleteByID(c *gin.Context)
+	Report(c *gin.Context)
 }
 
 type CommentControllerImpl struct {
 	CommentService services.CommentService
 	UserService    services.UserService
+	Logger         *slog.Logger
 }
 
 func InitCommentController(
 	commentService services.CommentService,
 	userService services.UserService,
+	logger *slog.Logger,
 ) CommentController {
 	return &CommentControllerImpl{
 		CommentService: commentService,
 		UserService:    userService,
+		Logger:         logger,
 	}
 }
 
 func (controller *CommentControllerImpl) Save(c *gin.Context) {
 	var commentDTO dtos.CommentDTO
 
-	err := c.BindJSON(&commentDTO)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to DTO",
-		})
-
+	if !bindJSON(c, &commentDTO) {
 		return
 	}
 
@@ -51,150 +52,261 @@ func (controller *CommentControllerImpl) Save(c *gin.Context) {
 	newComment := dtos.CommentDTOToModel(&commentDTO)
 	newComment.UserID = principalID
 
-	id, err := controller.CommentService.Save(newComment)
+	id, err := controller.CommentService.Save(c.Request.Context(), newComment)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Could not save new comment",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not save new comment", "error", err)
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id": id,
+	c.JSON(http.StatusCreated, dtos.CreatedResponseDTO{
+		ID: id,
 	})
 }
 
-func (controller *CommentControllerImpl) FindByProductID(c *gin.Context) {
-	page := paging.ParsePageFromQuery(c)
+func (controller *CommentControllerImpl) FindByID(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	productIdStr := c.Param("productId")
-	productId, err := strconv.ParseUint(productIdStr, 10, 64)
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+	comment, err := controller.CommentService.FindVisibleByID(c.Request.Context(), id, principalID)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get product ID from path params",
-		})
+		_ = c.Error(err)
+		return
+	}
 
+	loader := userLoaderFor(c, controller.UserService)
+	loader.Load(c.Request.Context(), comment.UserID)
+
+	if notModified(c, commentRepresentation(comment, loader)) {
 		return
 	}
 
-	comments := controller.CommentService.FindByProductID(uint(productId), page)
-	commentDTOs := make([]*dtos.CommentResponseDto, len(comments))
+	commentDTO := dtos.CommentModelToResponseDTO(comment)
+	commentDTO.Username = loader.Username(comment.UserID)
+
+	c.JSON(http.StatusOK, commentDTO)
+}
 
-	for i, comment := range comments {
-		/* As userID commes from Comment entity and userID is a foreign key,
-		* the user with the given ID must always exist and no error handling is
-		* necessary. */
-		user, _ := controller.UserService.FindByID(comment.UserID)
+func (controller *CommentControllerImpl) FindByProductID(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
 
-		commentDTOs[i] = dtos.CommentModelToResponseDTO(&comment)
-		commentDTOs[i].Username = user.Username
+	productID, err := parseIDParam(c, "productId")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, commentDTOs)
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+	threads := controller.CommentService.FindThreadsByProductID(c.Request.Context(), productID, principalID, page)
+
+	c.JSON(http.StatusOK, controller.threadsToResponseDTOs(c, threads))
 }
 
 func (controller *CommentControllerImpl) UpdateByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	controller.update(c, func(comment *entities.Comment) (*entities.Comment, bool) {
+		var commentDTO dtos.CommentDTO
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get comment ID form path params",
-		})
+		if !bindJSON(c, &commentDTO) {
+			return nil, false
+		}
+
+		return dtos.CommentDTOToModel(&commentDTO), true
+	})
+}
+
+// Patch applies a merge patch to the content of a comment.
+func (controller *CommentControllerImpl) Patch(c *gin.Context) {
+	controller.update(c, func(comment *entities.Comment) (*entities.Comment, bool) {
+		commentDTO := &dtos.CommentUpdateDTO{Content: comment.Content}
+
+		if !bindMergePatch(c, commentDTO) {
+			return nil, false
+		}
+
+		return dtos.CommentUpdateDTOToModel(commentDTO), true
+	})
+}
+
+// update replaces a comment with the content bound from the request, if it was
+// written by the user and is unchanged since the client read it.
+func (controller *CommentControllerImpl) update(c *gin.Context, bind func(comment *entities.Comment) (*entities.Comment, bool)) {
+	id, err := parseIDParam(c, "id")
 
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	comment, err := controller.CommentService.FindByID(uint(id))
+	comment, err := controller.CommentService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "Could not find comment with the given ID",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	var commentDTO dtos.CommentDTO
-
-	if err := c.BindJSON(&commentDTO); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to DTO",
-		})
+	updatedComment, ok := bind(comment)
 
+	if !ok {
 		return
 	}
 
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
 	if comment.UserID != principalID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"message": "Comment user ID and logged in user ID do not match",
-		})
+		_ = c.Error(services.ErrCommentNotOwned)
+		return
+	}
+
+	loader := userLoaderFor(c, controller.UserService)
+	loader.Load(c.Request.Context(), comment.UserID)
 
+	version, err := requireMatch(c, commentRepresentation(comment, loader))
+
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	updatedComment := dtos.CommentDTOToModel(&commentDTO)
 	updatedComment.UserID = principalID
+	updatedComment.Version = version
 
-	err = controller.CommentService.UpdateByID(uint(id), updatedComment)
+	err = controller.CommentService.UpdateByID(c.Request.Context(), id, updatedComment)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Could not update comment",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not update comment", "comment_id", id, "error", err)
+		_ = c.Error(err)
 		return
 	}
 
+	setETag(c, commentRepresentation(updatedComment, loader))
 	c.Status(http.StatusOK)
 }
 
 func (controller *CommentControllerImpl) DeleteByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	id, err := parseIDParam(c, "id")
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get comment ID from path params",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	comment, err := controller.CommentService.FindByID(uint(id))
+	comment, err := controller.CommentService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "Could not find comment with the given ID",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
 	if comment.UserID != principalID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"message": "Comment user ID and logged in user ID do not match",
-		})
+		_ = c.Error(services.ErrCommentNotOwned)
+		return
+	}
+
+	err = controller.CommentService.DeleteByID(c.Request.Context(), id)
 
+	if err != nil {
+		controller.Logger.DebugContext(c.Request.Context(), "could not delete comment", "comment_id", id, "error", err)
+		_ = c.Error(err)
 		return
 	}
 
-	err = controller.UserService.DeleteByID(uint(id))
+	c.Status(http.StatusOK)
+}
+
+func (controller *CommentControllerImpl) Report(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Error deleting comment",
-		})
+		_ = c.Error(err)
+		return
+	}
+
+	var reportDTO dtos.CommentReportDTO
 
+	if !bindJSON(c, &reportDTO) {
 		return
 	}
 
-	c.Status(http.StatusOK)
+	report := dtos.CommentReportDTOToModel(&reportDTO)
+	report.CommentID = id
+	report.UserID = authutils.GetPrincipalIDFromRequest(c)
+
+	err = controller.CommentService.Report(c.Request.Context(), report)
+
+	if err != nil {
+		controller.Logger.DebugContext(c.Request.Context(), "could not report comment", "comment_id", id, "error", err)
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+func (controller *CommentControllerImpl) threadsToResponseDTOs(c *gin.Context, threads []*services.CommentThread) []*dtos.CommentResponseDto {
+	loader := userLoaderFor(c, controller.UserService)
+	loader.Load(c.Request.Context(), threadAuthorIDs(threads, nil)...)
+
+	return threadsToResponseDTOs(threads, loader)
+}
+
+// threadAuthorIDs appends the authors of the comments in the threads which are
+// not tombstones to IDs.
+func threadAuthorIDs(threads []*services.CommentThread, IDs []uint) []uint {
+	for _, thread := range threads {
+		if !thread.Tombstone {
+			IDs = append(IDs, thread.Comment.UserID)
+		}
+
+		IDs = threadAuthorIDs(thread.Replies, IDs)
+	}
+
+	return IDs
+}
+
+func threadsToResponseDTOs(threads []*services.CommentThread, loader *services.UserLoader) []*dtos.CommentResponseDto {
+	commentDTOs := make([]*dtos.CommentResponseDto, len(threads))
+
+	for i, thread := range threads {
+		if thread.Tombstone {
+			commentDTOs[i] = &dtos.CommentResponseDto{
+				ID:        thread.Comment.ID,
+				ProductID: thread.Comment.ProductID,
+				ParentID:  thread.Comment.ParentID,
+				Deleted:   true,
+				CreatedAt: thread.Comment.CreatedAt,
+			}
+		} else {
+			commentDTOs[i] = dtos.CommentModelToResponseDTO(&thread.Comment)
+
+			// Comments of deleted users are shown without a username.
+			commentDTOs[i].Username = loader.Username(thread.Comment.UserID)
+		}
+
+		commentDTOs[i].ReplyCount = thread.ReplyCount
+		commentDTOs[i].Replies = threadsToResponseDTOs(thread.Replies, loader)
+	}
+
+	return commentDTOs
+}
+
+// commentRepresentation covers the author as well, whose username is part of
+// the response.
+func commentRepresentation(comment *entities.Comment, loader *services.UserLoader) representation {
+	versions := representation{{ID: comment.ID, UpdatedAt: comment.UpdatedAt, Version: comment.Version}}
+
+	if author, found := loader.Get(comment.UserID); found {
+		versions = append(versions, resourceVersion{ID: author.ID, UpdatedAt: author.UpdatedAt})
+	}
+
+	return versions
 }
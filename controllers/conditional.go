@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// resourceVersion identifies one state of an entity which is part of a
+// response. Version is the optimistic lock version of entities which have one.
+type resourceVersion struct {
+	ID        uint
+	UpdatedAt time.Time
+	Version   uint
+}
+
+/* representation describes the entities a response is built from, the one
+* the response is about first. Its ETag changes whenever any of them is
+* updated, added or removed, and it was last modified when the most recent of
+* them was. */
+type representation []resourceVersion
+
+// etag starts with the version of the first entity, as in
+// "3-9f86d081884c7d659a2feaa0", so that the version a client read comes back
+// to the server in If-Match.
+func (versions representation) etag() string {
+	var lockVersion uint
+
+	if len(versions) > 0 {
+		lockVersion = versions[0].Version
+	}
+
+	hash := sha256.New()
+
+	for _, version := range versions {
+		hash.Write([]byte(strconv.FormatUint(uint64(version.ID), 10)))
+		hash.Write([]byte{':'})
+		// Postgres keeps timestamps to the microsecond, so anything finer would
+		// not survive a round trip through the database.
+		hash.Write([]byte(strconv.FormatInt(version.UpdatedAt.UnixMicro(), 10)))
+		hash.Write([]byte{';'})
+	}
+
+	return `"` + strconv.FormatUint(uint64(lockVersion), 10) + "-" + hex.EncodeToString(hash.Sum(nil)[:12]) + `"`
+}
+
+func (versions representation) lastModified() time.Time {
+	var latest time.Time
+
+	for _, version := range versions {
+		if version.UpdatedAt.After(latest) {
+			latest = version.UpdatedAt
+		}
+	}
+
+	return latest
+}
+
+/* notModified sets the ETag and Last-Modified headers of the response and
+* reports whether the client already has the current representation, in
+* which case 304 Not Modified has been written. If-None-Match takes precedence
+* over If-Modified-Since, as in RFC 9110. */
+func notModified(c *gin.Context, versions representation) bool {
+	etag := versions.etag()
+	lastModified := versions.lastModified().UTC().Truncate(time.Second)
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if !etagListMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else {
+		ifModifiedSince, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+
+		if err != nil || lastModified.After(ifModifiedSince) {
+			return false
+		}
+	}
+
+	c.Status(http.StatusNotModified)
+
+	return true
+}
+
+/* requireMatch checks the If-Match header of a request which changes the
+* resource, so that clients can not overwrite changes they have not seen, and
+* returns the version the client read. The update has to find the entity
+* still at that version, which catches writers racing between this check and
+* the update. If-Match: * accepts whatever version is current. */
+func requireMatch(c *gin.Context, versions representation) (uint, error) {
+	ifMatch := c.GetHeader("If-Match")
+
+	if ifMatch == "" {
+		return 0, services.ErrPreconditionRequired
+	}
+
+	etag := versions.etag()
+
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		switch candidate = strings.TrimSpace(candidate); candidate {
+		case "*":
+			return versions[0].Version, nil
+		case etag:
+			return etagVersion(candidate), nil
+		}
+	}
+
+	return 0, services.ErrPreconditionFailed
+}
+
+// etagVersion reads the version an ETag of a representation starts with.
+func etagVersion(etag string) uint {
+	version, _, _ := strings.Cut(strings.Trim(etag, `"`), "-")
+	parsed, _ := strconv.ParseUint(version, 10, 0)
+
+	return uint(parsed)
+}
+
+// setETag sets the ETag header, for responses to requests which changed the
+// resource.
+func setETag(c *gin.Context, versions representation) {
+	c.Header("ETag", versions.etag())
+}
+
+// etagListMatches compares an ETag with the list of an If-None-Match header,
+// using the weak comparison.
+func etagListMatches(list string, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
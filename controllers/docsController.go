@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/brunohradec/go-webstore/openapi"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// swaggerUIAssets are the files of the Swagger UI distribution the docs page
+// loads. They are embedded in the binary, at the version pinned in go.mod, so
+// the page does not run scripts from a third party CDN.
+var swaggerUIAssets = map[string]bool{
+	"swagger-ui.css":       true,
+	"swagger-ui-bundle.js": true,
+}
+
+type DocsController interface {
+	Spec(c *gin.Context)
+	UI(c *gin.Context)
+	Asset(c *gin.Context)
+}
+
+type DocsControllerImpl struct {
+	GenerateSpec func() (*openapi.Document, error)
+	SpecURL      string
+	AssetsURL    string
+
+	once sync.Once
+	spec *openapi.Document
+	err  error
+}
+
+/* InitDocsController creates a controller serving the OpenAPI document and a
+* Swagger UI page for it, whose assets are served under assetsURL. The
+* document is generated on first request, once the router is fully set up. */
+func InitDocsController(generateSpec func() (*openapi.Document, error), specURL string, assetsURL string) DocsController {
+	return &DocsControllerImpl{
+		GenerateSpec: generateSpec,
+		SpecURL:      specURL,
+		AssetsURL:    assetsURL,
+	}
+}
+
+func (controller *DocsControllerImpl) Spec(c *gin.Context) {
+	controller.once.Do(func() {
+		controller.spec, controller.err = controller.GenerateSpec()
+	})
+
+	if controller.err != nil {
+		_ = c.Error(controller.err)
+		return
+	}
+
+	c.JSON(http.StatusOK, controller.spec)
+}
+
+func (controller *DocsControllerImpl) UI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>go-webstore API</title>
+	<link rel="stylesheet" href="`+controller.AssetsURL+`/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="`+controller.AssetsURL+`/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({ url: "`+controller.SpecURL+`", dom_id: "#swagger-ui" });
+	</script>
+</body>
+</html>`))
+}
+
+func (controller *DocsControllerImpl) Asset(c *gin.Context) {
+	name := c.Param("name")
+
+	if !swaggerUIAssets[name] {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.FileFromFS(name, http.FS(swaggerFiles.FS))
+}
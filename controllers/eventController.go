@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// EventController lets admins look into the domain events which could not be
+// delivered and send them again.
+type EventController interface {
+	FindDead(c *gin.Context)
+	Retry(c *gin.Context)
+}
+
+type EventControllerImpl struct {
+	OutboxService services.OutboxService
+}
+
+func InitEventController(outboxService services.OutboxService) EventController {
+	return &EventControllerImpl{
+		OutboxService: outboxService,
+	}
+}
+
+func (controller *EventControllerImpl) FindDead(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+
+	outboxEvents := controller.OutboxService.FindDead(c.Request.Context(), page)
+	eventDTOs := make([]*dtos.DeadEventResponseDTO, len(outboxEvents))
+
+	for i, outboxEvent := range outboxEvents {
+		eventDTOs[i] = dtos.OutboxEventModelToDeadDTO(&outboxEvent)
+	}
+
+	c.JSON(http.StatusOK, eventDTOs)
+}
+
+func (controller *EventControllerImpl) Retry(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = controller.OutboxService.Retry(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
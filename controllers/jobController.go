@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// JobController lets admins look into the background jobs and retry the ones
+// which failed.
+type JobController interface {
+	FindJobs(c *gin.Context)
+	FindByID(c *gin.Context)
+	Retry(c *gin.Context)
+}
+
+type JobControllerImpl struct {
+	JobService services.JobService
+}
+
+func InitJobController(jobService services.JobService) JobController {
+	return &JobControllerImpl{
+		JobService: jobService,
+	}
+}
+
+// FindJobs returns a page of the jobs, newest first, filtered by the status,
+// queue and type in the query string.
+func (controller *JobControllerImpl) FindJobs(c *gin.Context) {
+	var query dtos.JobQueryDTO
+
+	err := c.ShouldBindQuery(&query)
+
+	if err != nil {
+		_ = c.Error(services.ErrInvalidJobQuery.Wrap(err))
+		return
+	}
+
+	page := paging.ParsePageFromQuery(c)
+
+	jobs := controller.JobService.Find(c.Request.Context(), services.JobFilter{
+		Status: entities.JobStatus(query.Status),
+		Queue:  query.Queue,
+		Type:   query.Type,
+	}, page)
+	jobDTOs := make([]*dtos.JobResponseDTO, len(jobs))
+
+	for i, job := range jobs {
+		jobDTOs[i] = dtos.JobModelToResponseDTO(&job)
+	}
+
+	c.JSON(http.StatusOK, jobDTOs)
+}
+
+func (controller *JobControllerImpl) FindByID(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	job, err := controller.JobService.FindByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.JobModelToResponseDTO(job))
+}
+
+func (controller *JobControllerImpl) Retry(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = controller.JobService.Retry(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
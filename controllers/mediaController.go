@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/brunohradec/go-webstore/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type MediaController interface {
+	Get(c *gin.Context)
+}
+
+type MediaControllerImpl struct {
+	BlobStore storage.BlobStore
+}
+
+func InitMediaController(blobStore storage.BlobStore) MediaController {
+	return &MediaControllerImpl{
+		BlobStore: blobStore,
+	}
+}
+
+/* Get serves a stored blob. Keys are never reused, a changed image is stored
+* under a new key, so responses may be cached indefinitely. */
+func (controller *MediaControllerImpl) Get(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	content, contentType, err := controller.BlobStore.Get(c.Request.Context(), key)
+
+	if errors.Is(err, storage.ErrBlobNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		_ = c.Error(services.ErrMediaNotFound.Wrap(err))
+		return
+	}
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, -1, contentType, content, map[string]string{
+		"Cache-Control":          "public, max-age=31536000, immutable",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/brunohradec/go-webstore/openapi"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+/* bindMergePatch applies the RFC 7396 merge patch in the request body to dto,
+* which holds the current state of the resource. Members set to null are
+* reset to their zero value and members left out keep their value. Only the
+* fields set by the patch are validated, so that a patch does not have to
+* repeat the rest of the resource. On failure the error is recorded on the
+* context, like bindJSON does. */
+func bindMergePatch(c *gin.Context, dto any) bool {
+	err := applyMergePatch(c, dto)
+
+	if err != nil {
+		var serviceErr *services.Error
+
+		if errors.As(err, &serviceErr) {
+			_ = c.Error(err)
+		} else {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func applyMergePatch(c *gin.Context, dto any) error {
+	contentType, _, _ := mime.ParseMediaType(c.ContentType())
+
+	if contentType != openapi.MergePatchContentType && contentType != binding.MIMEJSON {
+		return services.ErrUnsupportedPatchType
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+
+	if err != nil {
+		return err
+	}
+
+	var patch any
+
+	err = json.Unmarshal(body, &patch)
+
+	if err != nil {
+		return err
+	}
+
+	patchMembers, ok := patch.(map[string]any)
+
+	if !ok {
+		return services.ErrInvalidPatch
+	}
+
+	current, err := json.Marshal(dto)
+
+	if err != nil {
+		return err
+	}
+
+	var target any
+
+	err = json.Unmarshal(current, &target)
+
+	if err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+
+	if err != nil {
+		return err
+	}
+
+	// Reset the DTO, so that members removed by the patch end up as zero
+	// values, and reject members the DTO does not have.
+	value := reflect.ValueOf(dto).Elem()
+	value.Set(reflect.Zero(value.Type()))
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(dto)
+
+	if err != nil {
+		return err
+	}
+
+	fields := patchedFields(value.Type(), patchMembers)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+
+	if !ok {
+		return binding.Validator.ValidateStruct(dto)
+	}
+
+	return validate.StructPartial(dto, fields...)
+}
+
+// mergePatch implements the MergePatch function of RFC 7396.
+func mergePatch(target any, patch any) any {
+	patchMembers, ok := patch.(map[string]any)
+
+	if !ok {
+		return patch
+	}
+
+	targetMembers, ok := target.(map[string]any)
+
+	if !ok {
+		targetMembers = map[string]any{}
+	}
+
+	for name, value := range patchMembers {
+		if value == nil {
+			delete(targetMembers, name)
+		} else {
+			targetMembers[name] = mergePatch(targetMembers[name], value)
+		}
+	}
+
+	return targetMembers
+}
+
+// patchedFields returns the names of the struct fields behind the JSON members
+// of the patch.
+func patchedFields(structType reflect.Type, patchMembers map[string]any) []string {
+	var fields []string
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if _, found := patchMembers[name]; found {
+			fields = append(fields, field.Name)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ModerationController interface {
+	FindQueue(c *gin.Context)
+	Approve(c *gin.Context)
+	Hide(c *gin.Context)
+	DeleteByID(c *gin.Context)
+}
+
+type ModerationControllerImpl struct {
+	ModerationService services.ModerationService
+	UserService       services.UserService
+}
+
+func InitModerationController(
+	moderationService services.ModerationService,
+	userService services.UserService,
+) ModerationController {
+	return &ModerationControllerImpl{
+		ModerationService: moderationService,
+		UserService:       userService,
+	}
+}
+
+func (controller *ModerationControllerImpl) FindQueue(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+
+	comments := controller.ModerationService.FindQueue(c.Request.Context(), page)
+	itemDTOs := make([]*dtos.ModerationQueueItemDTO, len(comments))
+
+	loader := userLoaderFor(c, controller.UserService)
+	authorIDs := make([]uint, len(comments))
+
+	for i, comment := range comments {
+		authorIDs[i] = comment.UserID
+	}
+
+	loader.Load(c.Request.Context(), authorIDs...)
+
+	for i, comment := range comments {
+		itemDTOs[i] = dtos.CommentModelToModerationQueueItemDTO(&comment)
+		itemDTOs[i].Comment.Username = loader.Username(comment.UserID)
+	}
+
+	c.JSON(http.StatusOK, itemDTOs)
+}
+
+func (controller *ModerationControllerImpl) Approve(c *gin.Context) {
+	controller.moderate(c, controller.ModerationService.Approve)
+}
+
+func (controller *ModerationControllerImpl) Hide(c *gin.Context) {
+	controller.moderate(c, controller.ModerationService.Hide)
+}
+
+func (controller *ModerationControllerImpl) DeleteByID(c *gin.Context) {
+	controller.moderate(c, controller.ModerationService.DeleteByID)
+}
+
+// moderate applies a moderation action to the comment with the ID from the
+// path.
+func (controller *ModerationControllerImpl) moderate(c *gin.Context, action func(ctx context.Context, commentID uint) error) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = action(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
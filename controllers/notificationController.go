@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// notificationStreamHeartbeat is how often an idle stream sends a comment,
+	// which keeps proxies from closing the connection, and looks for
+	// notifications created by other instances of the application.
+	notificationStreamHeartbeat = 15 * time.Second
+	// notificationStreamRetry is how long clients wait before reconnecting
+	// when the stream drops.
+	notificationStreamRetry = 3 * time.Second
+)
+
+// NotificationController serves the notification inbox of the logged in user
+// and lets them choose how they are notified.
+type NotificationController interface {
+	FindNotifications(c *gin.Context)
+	MarkRead(c *gin.Context)
+	MarkAllRead(c *gin.Context)
+	Stream(c *gin.Context)
+	FindPreferences(c *gin.Context)
+	UpdatePreferences(c *gin.Context)
+}
+
+type NotificationControllerImpl struct {
+	NotificationService services.NotificationService
+}
+
+func InitNotificationController(notificationService services.NotificationService) NotificationController {
+	return &NotificationControllerImpl{
+		NotificationService: notificationService,
+	}
+}
+
+// FindNotifications returns a page of the notifications of the logged in user,
+// newest first, with the number of their unread notifications.
+func (controller *NotificationControllerImpl) FindNotifications(c *gin.Context) {
+	var query dtos.NotificationQueryDTO
+
+	err := c.ShouldBindQuery(&query)
+
+	if err != nil {
+		_ = c.Error(services.ErrInvalidNotificationQuery.Wrap(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+	page := paging.ParsePageFromQuery(c)
+
+	notifications := controller.NotificationService.Find(ctx, principalID, query.Unread, page)
+	notificationDTOs := make([]*dtos.NotificationResponseDTO, len(notifications))
+
+	for i, notification := range notifications {
+		notificationDTOs[i] = dtos.NotificationModelToResponseDTO(&notification)
+	}
+
+	c.JSON(http.StatusOK, dtos.NotificationListResponseDTO{
+		UnreadCount:   controller.NotificationService.CountUnread(ctx, principalID),
+		Notifications: notificationDTOs,
+	})
+}
+
+func (controller *NotificationControllerImpl) MarkRead(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = controller.NotificationService.MarkRead(c.Request.Context(), authutils.GetPrincipalIDFromRequest(c), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *NotificationControllerImpl) MarkAllRead(c *gin.Context) {
+	err := controller.NotificationService.MarkAllRead(c.Request.Context(), authutils.GetPrincipalIDFromRequest(c))
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+/* Stream pushes the notifications of the logged in user as Server-Sent Events
+* named "notification", with the notification as data and its ID as the event
+* ID. A client reconnecting with Last-Event-ID first receives what it missed,
+* otherwise the stream starts with the next notification. Browsers can not
+* set headers on an EventSource, so they pass the access token in the token
+* query parameter. */
+func (controller *NotificationControllerImpl) Stream(c *gin.Context) {
+	ctx := c.Request.Context()
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	// Subscribing first means a notification created while the stream starts
+	// is not missed.
+	wake, unsubscribe := controller.NotificationService.Subscribe(principalID)
+	defer unsubscribe()
+
+	afterID, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 0)
+
+	if err != nil {
+		afterID = 0
+
+		latest := controller.NotificationService.Find(ctx, principalID, false, paging.Page{Page: 1, PageSize: 1})
+
+		if len(latest) > 0 {
+			afterID = uint64(latest[0].ID)
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	_, err = fmt.Fprintf(c.Writer, "retry: %d\n\n", notificationStreamRetry.Milliseconds())
+
+	heartbeat := time.NewTicker(notificationStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for err == nil {
+		for {
+			notifications := controller.NotificationService.FindAfter(ctx, principalID, uint(afterID))
+
+			for _, notification := range notifications {
+				if err = writeNotificationEvent(c.Writer, &notification); err != nil {
+					return
+				}
+
+				afterID = uint64(notification.ID)
+			}
+
+			if len(notifications) < paging.MaxPageSize {
+				break
+			}
+		}
+
+		c.Writer.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			_, err = io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+	}
+}
+
+func writeNotificationEvent(w io.Writer, notification *entities.Notification) error {
+	data, err := json.Marshal(dtos.NotificationModelToResponseDTO(notification))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", notification.ID, data)
+
+	return err
+}
+
+func (controller *NotificationControllerImpl) FindPreferences(c *gin.Context) {
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	preferences, err := controller.NotificationService.FindPreferences(c.Request.Context(), principalID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NotificationPreferencesModelToResponseDTO(preferences))
+}
+
+func (controller *NotificationControllerImpl) UpdatePreferences(c *gin.Context) {
+	var preferencesDTO dtos.NotificationPreferencesDTO
+
+	if !bindJSON(c, &preferencesDTO) {
+		return
+	}
+
+	preferences := dtos.NotificationPreferencesDTOToModel(&preferencesDTO)
+	preferences.UserID = authutils.GetPrincipalIDFromRequest(c)
+
+	err := controller.NotificationService.UpdatePreferences(c.Request.Context(), preferences)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NotificationPreferencesModelToResponseDTO(preferences))
+}
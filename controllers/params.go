@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+func parseIDParam(c *gin.Context, name string) (uint, error) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+
+	if err != nil {
+		return 0, services.ErrInvalidID.Wrap(err)
+	}
+
+	return uint(id), nil
+}
+
+// bindJSON binds the request body and, on failure, records the error on the
+// context so that the error middleware can report it.
+func bindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	return true
+}
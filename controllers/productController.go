@@ -1,16 +1,16 @@
 package controllers
 
 import (
-	"errors"
+	"context"
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/paging"
 	"github.com/brunohradec/go-webstore/services"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type ProductController interface {
@@ -19,229 +19,241 @@ type ProductController interface {
 	FindAll(c *gin.Context)
 	FindByUserID(c *gin.Context)
 	UpdateByID(c *gin.Context)
+	Patch(c *gin.Context)
 	DeleteByID(c *gin.Context)
 }
 
 type ProductControllerImpl struct {
-	ProductService services.ProductService
+	ProductService      services.ProductService
+	ProductImageService services.ProductImageService
+	Logger              *slog.Logger
 }
 
-func InitProductController(productService services.ProductService) ProductController {
+func InitProductController(
+	productService services.ProductService,
+	productImageService services.ProductImageService,
+	logger *slog.Logger,
+) ProductController {
 	return &ProductControllerImpl{
-		ProductService: productService,
+		ProductService:      productService,
+		ProductImageService: productImageService,
+		Logger:              logger,
 	}
 }
 
 func (controller *ProductControllerImpl) Save(c *gin.Context) {
 	var productDTO dtos.ProductDTO
 
-	err := c.BindJSON(&productDTO)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to product DTO",
-		})
-
+	if !bindJSON(c, &productDTO) {
 		return
 	}
 
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Could not get current user ID",
-		})
-
-		return
-	}
-
 	newProduct := dtos.ProductDTOToModel(&productDTO)
 	newProduct.UserID = principalID
 
-	id, err := controller.ProductService.Save(newProduct)
+	id, err := controller.ProductService.Save(c.Request.Context(), newProduct)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Could not save new product",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not save new product", "error", err)
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id": id,
+	c.JSON(http.StatusCreated, dtos.CreatedResponseDTO{
+		ID: id,
 	})
 }
 
 func (controller *ProductControllerImpl) FindByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	id, err := parseIDParam(c, "id")
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get product ID from path params",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	product, err := controller.ProductService.FindByID(uint(id))
+	product, err := controller.ProductService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"message": "Could not find product with the given ID",
-			})
+		_ = c.Error(err)
+		return
+	}
 
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Could not find product by ID",
-			})
+	images := controller.ProductImageService.FindByProductID(c.Request.Context(), product.ID)
 
-			return
-		}
+	if notModified(c, productRepresentation(product, images)) {
+		return
 	}
 
-	c.JSON(http.StatusOK, dtos.ProductModelToResponseDTO(product))
+	productDTO := dtos.ProductModelToResponseDTO(product)
+	productDTO.Images = dtos.ProductImageModelsToResponseDTOs(images, controller.ProductImageService.URL)
+
+	c.JSON(http.StatusOK, productDTO)
 }
 
 func (controller *ProductControllerImpl) FindAll(c *gin.Context) {
 	page := paging.ParsePageFromQuery(c)
+	sort, ok := paging.ParseSortFromQuery(c, paging.SortRating)
 
-	products := controller.ProductService.FindAll(page)
-	productDTOs := make([]*dtos.ProductResponseDTO, len(products))
-
-	for i, product := range products {
-		productDTOs[i] = dtos.ProductModelToResponseDTO(&product)
+	if !ok {
+		_ = c.Error(services.ErrInvalidSort)
+		return
 	}
 
-	c.JSON(http.StatusOK, productDTOs)
+	products := controller.ProductService.FindAll(c.Request.Context(), page, sort)
+
+	c.JSON(http.StatusOK, controller.productsToResponseDTOs(c.Request.Context(), products))
 }
 
 func (controller *ProductControllerImpl) FindByUserID(c *gin.Context) {
 	page := paging.ParsePageFromQuery(c)
 
-	userIDStr := c.Param("userId")
-	userID, err := strconv.ParseUint(userIDStr, 10, 64)
+	userID, err := parseIDParam(c, "userId")
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get user ID form path params",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	products := controller.ProductService.FindByUserID(uint(userID), page)
-	productDTOs := make([]*dtos.ProductResponseDTO, len(products))
-
-	for i, product := range products {
-		productDTOs[i] = dtos.ProductModelToResponseDTO(&product)
-	}
+	products := controller.ProductService.FindByUserID(c.Request.Context(), userID, page)
 
-	c.JSON(http.StatusOK, productDTOs)
+	c.JSON(http.StatusOK, controller.productsToResponseDTOs(c.Request.Context(), products))
 }
 
 func (controller *ProductControllerImpl) UpdateByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	controller.update(c, func(product *entities.Product) (*dtos.ProductDTO, bool) {
+		var productDTO dtos.ProductDTO
+		return &productDTO, bindJSON(c, &productDTO)
+	})
+}
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get product ID from path params",
-		})
+// Patch applies a merge patch to the details of a product.
+func (controller *ProductControllerImpl) Patch(c *gin.Context) {
+	controller.update(c, func(product *entities.Product) (*dtos.ProductDTO, bool) {
+		productDTO := dtos.ProductModelToDTO(product)
+		return productDTO, bindMergePatch(c, productDTO)
+	})
+}
+
+// update replaces a product with the details bound from the request, if it is
+// owned by the user and unchanged since the client read it.
+func (controller *ProductControllerImpl) update(c *gin.Context, bind func(product *entities.Product) (*dtos.ProductDTO, bool)) {
+	id, err := parseIDParam(c, "id")
 
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	product, err := controller.ProductService.FindByID(uint(id))
+	product, err := controller.ProductService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "Could not find product with the given ID",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	var productDTO dtos.ProductDTO
-
-	if err := c.BindJSON(&productDTO); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to product",
-		})
+	productDTO, ok := bind(product)
 
+	if !ok {
 		return
 	}
 
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
 	if product.UserID != principalID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"message": "Product user ID and logged in user ID do not match",
-		})
+		_ = c.Error(services.ErrProductNotOwned)
+		return
+	}
+
+	images := controller.ProductImageService.FindByProductID(c.Request.Context(), product.ID)
+
+	version, err := requireMatch(c, productRepresentation(product, images))
 
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	updatedProduct := dtos.ProductDTOToModel(&productDTO)
+	updatedProduct := dtos.ProductDTOToModel(productDTO)
 	updatedProduct.UserID = principalID
+	updatedProduct.Version = version
 
-	err = controller.ProductService.UpdateByID(uint(id), updatedProduct)
+	err = controller.ProductService.UpdateByID(c.Request.Context(), id, updatedProduct)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Error updating product",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not update product", "product_id", id, "error", err)
+		_ = c.Error(err)
 		return
 	}
 
+	setETag(c, productRepresentation(updatedProduct, images))
 	c.Status(http.StatusOK)
 }
 
 func (controller *ProductControllerImpl) DeleteByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	id, err := parseIDParam(c, "id")
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get product ID from path params",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	product, err := controller.ProductService.FindByID(uint(id))
+	product, err := controller.ProductService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "Could not find product with the given ID",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
 	if product.UserID != principalID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"message": "Product user ID and logged in user ID do not match",
-		})
-
+		_ = c.Error(services.ErrProductNotOwned)
 		return
 	}
 
-	err = controller.ProductService.DeleteByID(uint(id))
+	err = controller.ProductService.DeleteByID(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Error deleting product",
-		})
-
+		controller.Logger.DebugContext(c.Request.Context(), "could not delete product", "product_id", id, "error", err)
+		_ = c.Error(err)
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
+
+// productsToResponseDTOs converts a page of products, loading the images of
+// all of them with a single lookup.
+func (controller *ProductControllerImpl) productsToResponseDTOs(ctx context.Context, products []entities.Product) []*dtos.ProductResponseDTO {
+	productIDs := make([]uint, len(products))
+
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+
+	imagesByProductID := controller.ProductImageService.FindByProductIDs(ctx, productIDs)
+	productDTOs := make([]*dtos.ProductResponseDTO, len(products))
+
+	for i, product := range products {
+		productDTOs[i] = dtos.ProductModelToResponseDTO(&product)
+		productDTOs[i].Images = dtos.ProductImageModelsToResponseDTOs(imagesByProductID[product.ID], controller.ProductImageService.URL)
+	}
+
+	return productDTOs
+}
+
+// productRepresentation covers the images of the product as well, as they are
+// part of its response.
+func productRepresentation(product *entities.Product, images []entities.ProductImage) representation {
+	versions := make(representation, 0, len(images)+1)
+	versions = append(versions, resourceVersion{ID: product.ID, UpdatedAt: product.UpdatedAt, Version: product.Version})
+
+	for _, image := range images {
+		versions = append(versions, resourceVersion{ID: image.ID, UpdatedAt: image.UpdatedAt})
+	}
+
+	return versions
+}
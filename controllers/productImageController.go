@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverheadBytes is allowed on top of the maximum image size for the
+// multipart boundaries and part headers of an upload request.
+const multipartOverheadBytes = 64 << 10
+
+type ProductImageController interface {
+	Upload(c *gin.Context)
+	CreateUpload(c *gin.Context)
+	ConfirmUpload(c *gin.Context)
+	FindByProductID(c *gin.Context)
+	Reorder(c *gin.Context)
+	SetPrimary(c *gin.Context)
+	DeleteByID(c *gin.Context)
+}
+
+type ProductImageControllerImpl struct {
+	ProductService      services.ProductService
+	ProductImageService services.ProductImageService
+	MaxUploadBytes      int64
+}
+
+func InitProductImageController(
+	productService services.ProductService,
+	productImageService services.ProductImageService,
+	maxUploadBytes int64,
+) ProductImageController {
+	return &ProductImageControllerImpl{
+		ProductService:      productService,
+		ProductImageService: productImageService,
+		MaxUploadBytes:      maxUploadBytes,
+	}
+}
+
+func (controller *ProductImageControllerImpl) Upload(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, controller.MaxUploadBytes+multipartOverheadBytes)
+
+	var uploadDTO dtos.ProductImageUploadDTO
+
+	err := c.ShouldBind(&uploadDTO)
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			_ = c.Error(services.ErrImageTooLarge)
+		} else {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		}
+
+		return
+	}
+
+	if uploadDTO.Image.Size > controller.MaxUploadBytes {
+		_ = c.Error(services.ErrImageTooLarge)
+		return
+	}
+
+	file, err := uploadDTO.Image.Open()
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	defer file.Close()
+
+	image, err := controller.ProductImageService.Upload(c.Request.Context(), productID, file)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dtos.ProductImageModelToResponseDTO(image, controller.ProductImageService.URL))
+}
+
+func (controller *ProductImageControllerImpl) CreateUpload(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	upload, err := controller.ProductImageService.CreateUpload(c.Request.Context(), productID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dtos.ProductImageUploadResponseDTO{
+		Key:       upload.Key,
+		URL:       upload.URL,
+		Method:    http.MethodPut,
+		ExpiresAt: upload.ExpiresAt,
+	})
+}
+
+func (controller *ProductImageControllerImpl) ConfirmUpload(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	var confirmDTO dtos.ProductImageConfirmDTO
+
+	if !bindJSON(c, &confirmDTO) {
+		return
+	}
+
+	image, err := controller.ProductImageService.ConfirmUpload(c.Request.Context(), productID, confirmDTO.Key)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dtos.ProductImageModelToResponseDTO(image, controller.ProductImageService.URL))
+}
+
+func (controller *ProductImageControllerImpl) FindByProductID(c *gin.Context) {
+	productID, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	_, err = controller.ProductService.FindByID(c.Request.Context(), productID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	images := controller.ProductImageService.FindByProductID(c.Request.Context(), productID)
+
+	c.JSON(http.StatusOK, dtos.ProductImageModelsToResponseDTOs(images, controller.ProductImageService.URL))
+}
+
+func (controller *ProductImageControllerImpl) Reorder(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	var orderDTO dtos.ProductImageOrderDTO
+
+	if !bindJSON(c, &orderDTO) {
+		return
+	}
+
+	err := controller.ProductImageService.Reorder(c.Request.Context(), productID, orderDTO.ImageIDs)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *ProductImageControllerImpl) SetPrimary(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	imageID, err := parseIDParam(c, "imageId")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = controller.ProductImageService.SetPrimary(c.Request.Context(), productID, imageID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *ProductImageControllerImpl) DeleteByID(c *gin.Context) {
+	productID, ok := controller.ownedProductID(c)
+
+	if !ok {
+		return
+	}
+
+	imageID, err := parseIDParam(c, "imageId")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = controller.ProductImageService.DeleteByID(c.Request.Context(), productID, imageID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ownedProductID returns the product ID from the path once it is confirmed
+// that the product belongs to the logged in user.
+func (controller *ProductImageControllerImpl) ownedProductID(c *gin.Context) (uint, bool) {
+	productID, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return 0, false
+	}
+
+	product, err := controller.ProductService.FindByID(c.Request.Context(), productID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return 0, false
+	}
+
+	if product.UserID != authutils.GetPrincipalIDFromRequest(c) {
+		_ = c.Error(services.ErrProductNotOwned)
+		return 0, false
+	}
+
+	return productID, true
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ReviewController interface {
+	Save(c *gin.Context)
+	FindByID(c *gin.Context)
+	FindByProductID(c *gin.Context)
+	UpdateByID(c *gin.Context)
+	DeleteByID(c *gin.Context)
+	Vote(c *gin.Context)
+	DeleteVote(c *gin.Context)
+}
+
+type ReviewControllerImpl struct {
+	ReviewService services.ReviewService
+	UserService   services.UserService
+}
+
+func InitReviewController(
+	reviewService services.ReviewService,
+	userService services.UserService,
+) ReviewController {
+	return &ReviewControllerImpl{
+		ReviewService: reviewService,
+		UserService:   userService,
+	}
+}
+
+func (controller *ReviewControllerImpl) Save(c *gin.Context) {
+	var reviewDTO dtos.ReviewDTO
+
+	if !bindJSON(c, &reviewDTO) {
+		return
+	}
+
+	newReview := dtos.ReviewDTOToModel(&reviewDTO)
+	newReview.UserID = authutils.GetPrincipalIDFromRequest(c)
+
+	id, err := controller.ReviewService.Save(c.Request.Context(), newReview)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dtos.CreatedResponseDTO{
+		ID: id,
+	})
+}
+
+func (controller *ReviewControllerImpl) FindByID(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	review, err := controller.ReviewService.FindByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, controller.reviewsToResponseDTOs(c, []entities.Review{*review})[0])
+}
+
+func (controller *ReviewControllerImpl) FindByProductID(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+
+	productID, err := parseIDParam(c, "productId")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	reviews := controller.ReviewService.FindByProductID(c.Request.Context(), productID, page)
+
+	c.JSON(http.StatusOK, controller.reviewsToResponseDTOs(c, reviews))
+}
+
+func (controller *ReviewControllerImpl) UpdateByID(c *gin.Context) {
+	id, ok := controller.ownedReviewID(c)
+
+	if !ok {
+		return
+	}
+
+	var reviewDTO dtos.ReviewUpdateDTO
+
+	if !bindJSON(c, &reviewDTO) {
+		return
+	}
+
+	err := controller.ReviewService.UpdateByID(c.Request.Context(), id, dtos.ReviewUpdateDTOToModel(&reviewDTO))
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *ReviewControllerImpl) DeleteByID(c *gin.Context) {
+	id, ok := controller.ownedReviewID(c)
+
+	if !ok {
+		return
+	}
+
+	err := controller.ReviewService.DeleteByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *ReviewControllerImpl) Vote(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var voteDTO dtos.ReviewVoteDTO
+
+	if !bindJSON(c, &voteDTO) {
+		return
+	}
+
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	err = controller.ReviewService.Vote(c.Request.Context(), id, principalID, *voteDTO.Helpful)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *ReviewControllerImpl) DeleteVote(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	err = controller.ReviewService.DeleteVote(c.Request.Context(), id, principalID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ownedReviewID returns the review ID from the path once it is confirmed that
+// the review was written by the logged in user.
+func (controller *ReviewControllerImpl) ownedReviewID(c *gin.Context) (uint, bool) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return 0, false
+	}
+
+	review, err := controller.ReviewService.FindByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return 0, false
+	}
+
+	if review.UserID != authutils.GetPrincipalIDFromRequest(c) {
+		_ = c.Error(services.ErrReviewNotOwned)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (controller *ReviewControllerImpl) reviewsToResponseDTOs(c *gin.Context, reviews []entities.Review) []*dtos.ReviewResponseDTO {
+	loader := userLoaderFor(c, controller.UserService)
+	authorIDs := make([]uint, len(reviews))
+
+	for i, review := range reviews {
+		authorIDs[i] = review.UserID
+	}
+
+	loader.Load(c.Request.Context(), authorIDs...)
+
+	reviewDTOs := make([]*dtos.ReviewResponseDTO, len(reviews))
+
+	for i, review := range reviews {
+		reviewDTOs[i] = dtos.ReviewModelToResponseDTO(&review)
+
+		// The author may have been deleted since, the review is shown without
+		// a username then.
+		reviewDTOs[i].Username = loader.Username(review.UserID)
+	}
+
+	return reviewDTOs
+}
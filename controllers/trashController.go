@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// TrashController serves the products and comments the logged in user has
+// deleted. Only the owner of an item can see, restore or purge it.
+type TrashController interface {
+	FindProducts(c *gin.Context)
+	FindComments(c *gin.Context)
+	RestoreProduct(c *gin.Context)
+	RestoreComment(c *gin.Context)
+	PurgeProduct(c *gin.Context)
+	PurgeComment(c *gin.Context)
+}
+
+type TrashControllerImpl struct {
+	TrashService services.TrashService
+	Retention    time.Duration
+}
+
+func InitTrashController(trashService services.TrashService, retention time.Duration) TrashController {
+	return &TrashControllerImpl{
+		TrashService: trashService,
+		Retention:    retention,
+	}
+}
+
+func (controller *TrashControllerImpl) FindProducts(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	products := controller.TrashService.FindProducts(c.Request.Context(), principalID, page)
+	productDTOs := make([]*dtos.TrashedProductResponseDTO, len(products))
+
+	for i, product := range products {
+		productDTOs[i] = dtos.ProductModelToTrashedDTO(&product, controller.Retention)
+	}
+
+	c.JSON(http.StatusOK, productDTOs)
+}
+
+func (controller *TrashControllerImpl) FindComments(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	comments := controller.TrashService.FindComments(c.Request.Context(), principalID, page)
+	commentDTOs := make([]*dtos.TrashedCommentResponseDTO, len(comments))
+
+	for i, comment := range comments {
+		commentDTOs[i] = dtos.CommentModelToTrashedDTO(&comment, controller.Retention)
+	}
+
+	c.JSON(http.StatusOK, commentDTOs)
+}
+
+func (controller *TrashControllerImpl) RestoreProduct(c *gin.Context) {
+	controller.productAction(c, controller.TrashService.RestoreProduct)
+}
+
+func (controller *TrashControllerImpl) PurgeProduct(c *gin.Context) {
+	controller.productAction(c, controller.TrashService.PurgeProduct)
+}
+
+func (controller *TrashControllerImpl) RestoreComment(c *gin.Context) {
+	controller.commentAction(c, controller.TrashService.RestoreComment)
+}
+
+func (controller *TrashControllerImpl) PurgeComment(c *gin.Context) {
+	controller.commentAction(c, controller.TrashService.PurgeComment)
+}
+
+// productAction applies an action to the deleted product with the ID from the
+// path, if it is owned by the user.
+func (controller *TrashControllerImpl) productAction(c *gin.Context, action func(ctx context.Context, ID uint) error) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	product, err := controller.TrashService.FindProductByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if product.UserID != authutils.GetPrincipalIDFromRequest(c) {
+		_ = c.Error(services.ErrProductNotOwned)
+		return
+	}
+
+	err = action(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// commentAction applies an action to the deleted comment with the ID from the
+// path, if it was written by the user. Comments deleted by a moderator are not
+// found, so their authors can neither restore nor purge them.
+func (controller *TrashControllerImpl) commentAction(c *gin.Context, action func(ctx context.Context, ID uint) error) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	comment, err := controller.TrashService.FindCommentByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if comment.UserID != authutils.GetPrincipalIDFromRequest(c) {
+		_ = c.Error(services.ErrCommentNotOwned)
+		return
+	}
+
+	err = action(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
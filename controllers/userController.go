@@ -1,103 +1,158 @@
 package controllers
 
 import (
-	"errors"
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/services"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type UserController interface {
 	FindByID(c *gin.Context)
 	UpdateCurrent(c *gin.Context)
+	PatchCurrent(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	UpdateRole(c *gin.Context)
 }
 
 type UserControllerImpl struct {
 	UserService services.UserService
+	Logger      *slog.Logger
 }
 
-func InitUserController(userService services.UserService) UserController {
+func InitUserController(userService services.UserService, logger *slog.Logger) UserController {
 	return &UserControllerImpl{
 		UserService: userService,
+		Logger:      logger,
 	}
 }
 
 func (controller *UserControllerImpl) FindByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+	id, err := parseIDParam(c, "id")
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not get user ID from path params",
-		})
-
+		_ = c.Error(err)
 		return
 	}
 
-	user, err := controller.UserService.FindByID(uint(id))
+	user, err := controller.UserService.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"message": "Could not find user with the given ID",
-			})
-
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Could not find user by ID",
-			})
-
-			return
-		}
+		_ = c.Error(err)
+		return
+	}
+
+	if notModified(c, userRepresentation(user)) {
+		return
 	}
 
 	c.JSON(http.StatusOK, dtos.UserModelToResponseDto(user))
 }
 
 func (controller *UserControllerImpl) UpdateCurrent(c *gin.Context) {
+	controller.updateCurrent(c, func(user *entities.User) (*dtos.UserUpdateDTO, bool) {
+		var userDTO dtos.UserUpdateDTO
+		return &userDTO, bindJSON(c, &userDTO)
+	})
+}
+
+// PatchCurrent applies a merge patch to the details of the current user.
+func (controller *UserControllerImpl) PatchCurrent(c *gin.Context) {
+	controller.updateCurrent(c, func(user *entities.User) (*dtos.UserUpdateDTO, bool) {
+		userDTO := dtos.UserModelToUpdateDTO(user)
+		return userDTO, bindMergePatch(c, userDTO)
+	})
+}
+
+// updateCurrent replaces the details of the current user with the ones bound
+// from the request, if they are unchanged since the client read them.
+func (controller *UserControllerImpl) updateCurrent(c *gin.Context, bind func(user *entities.User) (*dtos.UserUpdateDTO, bool)) {
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	user, err := controller.UserService.FindByID(c.Request.Context(), principalID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	userDTO, ok := bind(user)
+
+	if !ok {
+		return
+	}
+
+	version, err := requireMatch(c, userRepresentation(user))
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	updatedUser := dtos.UserUpdateDTOToModel(userDTO)
+	updatedUser.Version = version
+
+	err = controller.UserService.UpdateByID(c.Request.Context(), principalID, updatedUser)
+
+	if err != nil {
+		controller.Logger.DebugContext(c.Request.Context(), "could not update user", "error", err)
+		_ = c.Error(err)
+		return
+	}
+
+	setETag(c, userRepresentation(updatedUser))
+	c.Status(http.StatusOK)
+}
+
+func (controller *UserControllerImpl) ChangePassword(c *gin.Context) {
 	principalID := authutils.GetPrincipalIDFromRequest(c)
 
-	var userDTO dtos.UserDTO
+	var passwordDTO dtos.UserPasswordDTO
+
+	if !bindJSON(c, &passwordDTO) {
+		return
+	}
+
+	err := controller.UserService.ChangePassword(c.Request.Context(), principalID, passwordDTO.CurrentPassword, passwordDTO.NewPassword)
+
+	if err != nil {
+		controller.Logger.DebugContext(c.Request.Context(), "could not change password", "error", err)
+		_ = c.Error(err)
+		return
+	}
 
-	if err := c.BindJSON(&userDTO); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Could not bind JSON to DTO",
-		})
+	c.Status(http.StatusOK)
+}
+
+func (controller *UserControllerImpl) UpdateRole(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
 
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	updatedUser := dtos.UserDTOToModel(&userDTO)
+	var roleDTO dtos.UserRoleDTO
 
-	err := controller.UserService.UpdateByID(principalID, updatedUser)
+	if !bindJSON(c, &roleDTO) {
+		return
+	}
+
+	err = controller.UserService.UpdateRoleByID(c.Request.Context(), id, entities.Role(roleDTO.Role))
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "User with the given ID not found.",
-			})
-
-			return
-		} else if errors.Is(err, gorm.ErrDuplicatedKey) {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "User with the given username already exists.",
-			})
-
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Could not update user",
-			})
-
-			return
-		}
+		controller.Logger.DebugContext(c.Request.Context(), "could not update user role", "user_id", id, "error", err)
+		_ = c.Error(err)
+		return
 	}
 
 	c.Status(http.StatusOK)
 }
+
+func userRepresentation(user *entities.User) representation {
+	return representation{{ID: user.ID, UpdatedAt: user.UpdatedAt, Version: user.Version}}
+}
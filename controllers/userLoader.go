@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+const userLoaderKey = "request-user-loader"
+
+// userLoaderFor returns the user loader of the request, creating it on first
+// use, so that every user embedded in a response is looked up only once.
+func userLoaderFor(c *gin.Context, userService services.UserService) *services.UserLoader {
+	if loader, found := c.Get(userLoaderKey); found {
+		return loader.(*services.UserLoader)
+	}
+
+	loader := services.InitUserLoader(userService)
+	c.Set(userLoaderKey, loader)
+
+	return loader
+}
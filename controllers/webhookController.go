@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookController lets users manage the endpoints their product events are
+// sent to. Users only ever see their own endpoints.
+type WebhookController interface {
+	Save(c *gin.Context)
+	FindAll(c *gin.Context)
+	FindByID(c *gin.Context)
+	UpdateByID(c *gin.Context)
+	DeleteByID(c *gin.Context)
+	SendTest(c *gin.Context)
+	FindDeliveries(c *gin.Context)
+}
+
+type WebhookControllerImpl struct {
+	WebhookService services.WebhookService
+}
+
+func InitWebhookController(webhookService services.WebhookService) WebhookController {
+	return &WebhookControllerImpl{
+		WebhookService: webhookService,
+	}
+}
+
+func (controller *WebhookControllerImpl) Save(c *gin.Context) {
+	var endpointDTO dtos.WebhookEndpointDTO
+
+	if !bindJSON(c, &endpointDTO) {
+		return
+	}
+
+	newEndpoint := dtos.WebhookEndpointDTOToModel(&endpointDTO)
+	newEndpoint.UserID = authutils.GetPrincipalIDFromRequest(c)
+
+	endpoint, err := controller.WebhookService.Save(c.Request.Context(), newEndpoint)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dtos.WebhookEndpointCreatedResponseDTO{
+		ID:     endpoint.ID,
+		Secret: endpoint.Secret,
+	})
+}
+
+func (controller *WebhookControllerImpl) FindAll(c *gin.Context) {
+	principalID := authutils.GetPrincipalIDFromRequest(c)
+
+	endpoints := controller.WebhookService.FindByUserID(c.Request.Context(), principalID)
+	endpointDTOs := make([]*dtos.WebhookEndpointResponseDTO, len(endpoints))
+
+	for i, endpoint := range endpoints {
+		endpointDTOs[i] = dtos.WebhookEndpointModelToResponseDTO(&endpoint)
+	}
+
+	c.JSON(http.StatusOK, endpointDTOs)
+}
+
+func (controller *WebhookControllerImpl) FindByID(c *gin.Context) {
+	endpoint, ok := controller.ownedEndpoint(c)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.WebhookEndpointModelToResponseDTO(endpoint))
+}
+
+func (controller *WebhookControllerImpl) UpdateByID(c *gin.Context) {
+	endpoint, ok := controller.ownedEndpoint(c)
+
+	if !ok {
+		return
+	}
+
+	var endpointDTO dtos.WebhookEndpointDTO
+
+	if !bindJSON(c, &endpointDTO) {
+		return
+	}
+
+	err := controller.WebhookService.UpdateByID(c.Request.Context(), endpoint.ID, dtos.WebhookEndpointDTOToModel(&endpointDTO))
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (controller *WebhookControllerImpl) DeleteByID(c *gin.Context) {
+	endpoint, ok := controller.ownedEndpoint(c)
+
+	if !ok {
+		return
+	}
+
+	err := controller.WebhookService.DeleteByID(c.Request.Context(), endpoint.ID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SendTest responds with the delivery of the test event whether or not the
+// endpoint accepted it, the outcome is part of the delivery.
+func (controller *WebhookControllerImpl) SendTest(c *gin.Context) {
+	endpoint, ok := controller.ownedEndpoint(c)
+
+	if !ok {
+		return
+	}
+
+	delivery, err := controller.WebhookService.SendTest(c.Request.Context(), endpoint.ID)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.WebhookDeliveryModelToResponseDTO(delivery))
+}
+
+func (controller *WebhookControllerImpl) FindDeliveries(c *gin.Context) {
+	page := paging.ParsePageFromQuery(c)
+
+	endpoint, ok := controller.ownedEndpoint(c)
+
+	if !ok {
+		return
+	}
+
+	deliveries, err := controller.WebhookService.FindDeliveries(c.Request.Context(), endpoint.ID, page)
+
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	deliveryDTOs := make([]*dtos.WebhookDeliveryResponseDTO, len(deliveries))
+
+	for i, delivery := range deliveries {
+		deliveryDTOs[i] = dtos.WebhookDeliveryModelToResponseDTO(&delivery)
+	}
+
+	c.JSON(http.StatusOK, deliveryDTOs)
+}
+
+// ownedEndpoint returns the endpoint from the path once it is confirmed that
+// it belongs to the logged in user.
+func (controller *WebhookControllerImpl) ownedEndpoint(c *gin.Context) (*entities.WebhookEndpoint, bool) {
+	id, err := parseIDParam(c, "id")
+
+	if err != nil {
+		_ = c.Error(err)
+		return nil, false
+	}
+
+	endpoint, err := controller.WebhookService.FindByID(c.Request.Context(), id)
+
+	if err != nil {
+		_ = c.Error(err)
+		return nil, false
+	}
+
+	if endpoint.UserID != authutils.GetPrincipalIDFromRequest(c) {
+		_ = c.Error(services.ErrWebhookNotOwned)
+		return nil, false
+	}
+
+	return endpoint, true
+}
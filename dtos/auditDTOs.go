@@ -0,0 +1,50 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// AuditEventQueryDTO filters the audit log. Times are given in RFC 3339
+// format, from is inclusive and to is exclusive.
+type AuditEventQueryDTO struct {
+	ActorID    *uint     `form:"actorID"`
+	EntityType string    `form:"entityType" binding:"omitempty,oneof=product comment user"`
+	EntityID   *uint     `form:"entityID"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type AuditEventResponseDTO struct {
+	ID         uint                            `json:"ID"`
+	CreatedAt  time.Time                       `json:"createdAt"`
+	ActorID    uint                            `json:"actorID"`
+	Action     entities.AuditAction            `json:"action"`
+	EntityType string                          `json:"entityType"`
+	EntityID   uint                            `json:"entityID"`
+	Changes    map[string]entities.AuditChange `json:"changes"`
+	RequestID  string                          `json:"requestID"`
+	IP         string                          `json:"IP"`
+}
+
+func AuditEventModelToDTO(model *entities.AuditEvent) *AuditEventResponseDTO {
+	changes := map[string]entities.AuditChange{}
+
+	// Changes are always written by the audit service, so they are known to
+	// be a valid JSON object.
+	_ = json.Unmarshal([]byte(model.Changes), &changes)
+
+	return &AuditEventResponseDTO{
+		ID:         model.ID,
+		CreatedAt:  model.CreatedAt,
+		ActorID:    model.ActorID,
+		Action:     model.Action,
+		EntityType: model.EntityType,
+		EntityID:   model.EntityID,
+		Changes:    changes,
+		RequestID:  model.RequestID,
+		IP:         model.IP,
+	}
+}
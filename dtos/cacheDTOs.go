@@ -0,0 +1,17 @@
+package dtos
+
+import "github.com/brunohradec/go-webstore/cache"
+
+type CacheStatsResponseDTO struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+func CacheStatsToResponseDTO(stats cache.Stats) *CacheStatsResponseDTO {
+	return &CacheStatsResponseDTO{
+		Hits:     stats.Hits,
+		Misses:   stats.Misses,
+		HitRatio: stats.HitRatio(),
+	}
+}
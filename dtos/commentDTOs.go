@@ -9,30 +9,101 @@ import (
 type CommentDTO struct {
 	Content   string `json:"content" binding:"required"`
 	ProductID uint   `json:"productID" binding:"required"`
+	ParentID  *uint  `json:"parentID"`
 }
 
+/* CommentResponseDto is a comment with its replies. Deleted comments and
+* comments which are not visible to the viewer are returned as tombstones,
+* without content or author, while they still have replies. */
 type CommentResponseDto struct {
-	ID        uint      `json:"ID"`
-	Content   string    `json:"content"`
-	UserID    uint      `json:"userID"`
-	Username  string    `json:"username"`
-	ProductID uint      `json:"productID"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID             uint                  `json:"ID"`
+	Content        string                `json:"content"`
+	UserID         uint                  `json:"userID"`
+	Username       string                `json:"username"`
+	ProductID      uint                  `json:"productID"`
+	ParentID       *uint                 `json:"parentID"`
+	SellerResponse bool                  `json:"sellerResponse"`
+	Status         string                `json:"status,omitempty"`
+	Deleted        bool                  `json:"deleted"`
+	ReplyCount     int                   `json:"replyCount"`
+	Replies        []*CommentResponseDto `json:"replies"`
+	CreatedAt      time.Time             `json:"createdAt"`
+}
+
+// CommentUpdateDTO is the editable part of a comment, which merge patches are
+// applied to.
+type CommentUpdateDTO struct {
+	Content string `json:"content" binding:"required"`
+}
+
+func CommentUpdateDTOToModel(dto *CommentUpdateDTO) *entities.Comment {
+	return &entities.Comment{
+		Content: dto.Content,
+	}
 }
 
 func CommentDTOToModel(dto *CommentDTO) *entities.Comment {
 	return &entities.Comment{
 		Content:   dto.Content,
 		ProductID: dto.ProductID,
+		ParentID:  dto.ParentID,
 	}
 }
 
 func CommentModelToResponseDTO(model *entities.Comment) *CommentResponseDto {
 	return &CommentResponseDto{
-		ID:        model.ID,
-		Content:   model.Content,
-		UserID:    model.UserID,
-		ProductID: model.ProductID,
-		CreatedAt: model.CreatedAt,
+		ID:             model.ID,
+		Content:        model.Content,
+		UserID:         model.UserID,
+		ProductID:      model.ProductID,
+		ParentID:       model.ParentID,
+		SellerResponse: model.SellerResponse,
+		Status:         string(model.Status),
+		Replies:        []*CommentResponseDto{},
+		CreatedAt:      model.CreatedAt,
+	}
+}
+
+type CommentReportDTO struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type CommentReportResponseDTO struct {
+	ID        uint      `json:"ID"`
+	UserID    uint      `json:"userID"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ModerationQueueItemDTO is a comment awaiting moderation, with the reason the
+// content filter held it for and its open reports.
+type ModerationQueueItemDTO struct {
+	Comment          *CommentResponseDto         `json:"comment"`
+	ModerationReason string                      `json:"moderationReason"`
+	Reports          []*CommentReportResponseDTO `json:"reports"`
+}
+
+func CommentReportDTOToModel(dto *CommentReportDTO) *entities.CommentReport {
+	return &entities.CommentReport{
+		Reason: dto.Reason,
+	}
+}
+
+func CommentModelToModerationQueueItemDTO(model *entities.Comment) *ModerationQueueItemDTO {
+	reports := make([]*CommentReportResponseDTO, len(model.Reports))
+
+	for i, report := range model.Reports {
+		reports[i] = &CommentReportResponseDTO{
+			ID:        report.ID,
+			UserID:    report.UserID,
+			Reason:    report.Reason,
+			CreatedAt: report.CreatedAt,
+		}
+	}
+
+	return &ModerationQueueItemDTO{
+		Comment:          CommentModelToResponseDTO(model),
+		ModerationReason: model.ModerationReason,
+		Reports:          reports,
 	}
 }
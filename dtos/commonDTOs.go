@@ -0,0 +1,5 @@
+package dtos
+
+type CreatedResponseDTO struct {
+	ID uint `json:"id"`
+}
@@ -0,0 +1,45 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// JobQueryDTO filters the background jobs by status, queue and type.
+type JobQueryDTO struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending running succeeded failed"`
+	Queue  string `form:"queue"`
+	Type   string `form:"type"`
+}
+
+type JobResponseDTO struct {
+	ID          uint               `json:"ID"`
+	Queue       string             `json:"queue"`
+	Type        string             `json:"type"`
+	Payload     json.RawMessage    `json:"payload"`
+	Status      entities.JobStatus `json:"status"`
+	RunAt       time.Time          `json:"runAt"`
+	Attempts    int                `json:"attempts"`
+	MaxAttempts int                `json:"maxAttempts"`
+	LastError   string             `json:"lastError"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	FinishedAt  *time.Time         `json:"finishedAt"`
+}
+
+func JobModelToResponseDTO(model *entities.Job) *JobResponseDTO {
+	return &JobResponseDTO{
+		ID:          model.ID,
+		Queue:       model.Queue,
+		Type:        model.Type,
+		Payload:     json.RawMessage(model.Payload),
+		Status:      model.Status,
+		RunAt:       model.RunAt,
+		Attempts:    model.Attempts,
+		MaxAttempts: model.MaxAttempts,
+		LastError:   model.LastError,
+		CreatedAt:   model.CreatedAt,
+		FinishedAt:  model.FinishedAt,
+	}
+}
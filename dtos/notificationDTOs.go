@@ -0,0 +1,71 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// NotificationPreferencesDTO replaces the notification preferences of the
+// current user.
+type NotificationPreferencesDTO struct {
+	Locale        string `json:"locale" binding:"required,oneof=en hr"`
+	CommentEmails *bool  `json:"commentEmails" binding:"required"`
+}
+
+type NotificationPreferencesResponseDTO struct {
+	Locale        string `json:"locale"`
+	CommentEmails bool   `json:"commentEmails"`
+}
+
+func NotificationPreferencesDTOToModel(dto *NotificationPreferencesDTO) *entities.NotificationPreferences {
+	return &entities.NotificationPreferences{
+		Locale:        dto.Locale,
+		CommentEmails: *dto.CommentEmails,
+	}
+}
+
+func NotificationPreferencesModelToResponseDTO(model *entities.NotificationPreferences) *NotificationPreferencesResponseDTO {
+	return &NotificationPreferencesResponseDTO{
+		Locale:        model.Locale,
+		CommentEmails: model.CommentEmails,
+	}
+}
+
+// NotificationQueryDTO filters the notifications of the current user.
+type NotificationQueryDTO struct {
+	Unread bool `form:"unread"`
+}
+
+type NotificationResponseDTO struct {
+	ID        uint       `json:"ID"`
+	Type      string     `json:"type"`
+	ActorID   *uint      `json:"actorID"`
+	ProductID *uint      `json:"productID"`
+	CommentID *uint      `json:"commentID"`
+	Excerpt   string     `json:"excerpt"`
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// NotificationListResponseDTO is a page of notifications together with how
+// many notifications of the user are unread in total.
+type NotificationListResponseDTO struct {
+	UnreadCount   int64                      `json:"unreadCount"`
+	Notifications []*NotificationResponseDTO `json:"notifications"`
+}
+
+func NotificationModelToResponseDTO(model *entities.Notification) *NotificationResponseDTO {
+	return &NotificationResponseDTO{
+		ID:        model.ID,
+		Type:      string(model.Type),
+		ActorID:   model.ActorID,
+		ProductID: model.ProductID,
+		CommentID: model.CommentID,
+		Excerpt:   model.Excerpt,
+		Read:      model.IsRead(),
+		ReadAt:    model.ReadAt,
+		CreatedAt: model.CreatedAt,
+	}
+}
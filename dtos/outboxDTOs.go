@@ -0,0 +1,38 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// DeadEventResponseDTO is a domain event which could not be delivered.
+type DeadEventResponseDTO struct {
+	ID        uint            `json:"ID"`
+	Type      string          `json:"type"`
+	EntityID  uint            `json:"entityID"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError"`
+	CreatedAt time.Time       `json:"createdAt"`
+	DeadAt    time.Time       `json:"deadAt"`
+}
+
+func OutboxEventModelToDeadDTO(model *entities.OutboxEvent) *DeadEventResponseDTO {
+	dto := &DeadEventResponseDTO{
+		ID:        model.ID,
+		Type:      model.Type,
+		EntityID:  model.EntityID,
+		Payload:   json.RawMessage(model.Payload),
+		Attempts:  model.Attempts,
+		LastError: model.LastError,
+		CreatedAt: model.CreatedAt,
+	}
+
+	if model.DeadAt != nil {
+		dto.DeadAt = *model.DeadAt
+	}
+
+	return dto
+}
@@ -0,0 +1,19 @@
+package dtos
+
+// ProblemDTO is an RFC 7807 problem details object.
+type ProblemDTO struct {
+	Type      string           `json:"type"`
+	Title     string           `json:"title"`
+	Status    int              `json:"status"`
+	Detail    string           `json:"detail,omitempty"`
+	Instance  string           `json:"instance,omitempty"`
+	Code      string           `json:"code"`
+	RequestID string           `json:"requestID,omitempty"`
+	Errors    []*FieldErrorDTO `json:"errors,omitempty"`
+}
+
+type FieldErrorDTO struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
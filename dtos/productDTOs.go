@@ -14,6 +14,9 @@ type ProductResponseDTO struct {
 	Description string `json:"description"`
 	Price       int64  `json:"price"`
 	UserID      uint   `json:"userID"`
+
+	Rating *ProductRatingDTO          `json:"rating"`
+	Images []*ProductImageResponseDTO `json:"images"`
 }
 
 func ProductDTOToModel(dto *ProductDTO) *entities.Product {
@@ -24,6 +27,16 @@ func ProductDTOToModel(dto *ProductDTO) *entities.Product {
 	}
 }
 
+// ProductModelToDTO returns the editable details of a product, which merge
+// patches are applied to.
+func ProductModelToDTO(model *entities.Product) *ProductDTO {
+	return &ProductDTO{
+		Name:        model.Name,
+		Description: model.Description,
+		Price:       model.Price,
+	}
+}
+
 func ProductModelToResponseDTO(model *entities.Product) *ProductResponseDTO {
 	return &ProductResponseDTO{
 		ID:          model.ID,
@@ -31,5 +44,6 @@ func ProductModelToResponseDTO(model *entities.Product) *ProductResponseDTO {
 		Description: model.Description,
 		Price:       model.Price,
 		UserID:      model.UserID,
+		Rating:      ProductRatingModelToDTO(&model.Rating),
 	}
 }
@@ -0,0 +1,67 @@
+package dtos
+
+import (
+	"mime/multipart"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+type ProductImageUploadDTO struct {
+	Image *multipart.FileHeader `form:"image" binding:"required"`
+}
+
+type ProductImageOrderDTO struct {
+	ImageIDs []uint `json:"imageIDs" binding:"required,min=1"`
+}
+
+type ProductImageResponseDTO struct {
+	ID           uint   `json:"ID"`
+	Position     int    `json:"position"`
+	IsPrimary    bool   `json:"isPrimary"`
+	ContentType  string `json:"contentType"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+	MediumURL    string `json:"mediumURL"`
+	ThumbnailURL string `json:"thumbnailURL"`
+}
+
+// ProductImageModelToResponseDTO converts an image to its DTO, using urlFor to
+// turn the blob keys of its renditions into URLs.
+func ProductImageModelToResponseDTO(model *entities.ProductImage, urlFor func(key string) string) *ProductImageResponseDTO {
+	return &ProductImageResponseDTO{
+		ID:           model.ID,
+		Position:     model.Position,
+		IsPrimary:    model.IsPrimary,
+		ContentType:  model.ContentType,
+		Width:        model.Width,
+		Height:       model.Height,
+		Size:         model.Size,
+		URL:          urlFor(model.OriginalKey),
+		MediumURL:    urlFor(model.MediumKey),
+		ThumbnailURL: urlFor(model.ThumbnailKey),
+	}
+}
+
+func ProductImageModelsToResponseDTOs(models []entities.ProductImage, urlFor func(key string) string) []*ProductImageResponseDTO {
+	imageDTOs := make([]*ProductImageResponseDTO, len(models))
+
+	for i, model := range models {
+		imageDTOs[i] = ProductImageModelToResponseDTO(&model, urlFor)
+	}
+
+	return imageDTOs
+}
+
+type ProductImageUploadResponseDTO struct {
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type ProductImageConfirmDTO struct {
+	Key string `json:"key" binding:"required"`
+}
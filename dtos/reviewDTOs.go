@@ -0,0 +1,86 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+type ReviewDTO struct {
+	ProductID uint   `json:"productID" binding:"required"`
+	Rating    int    `json:"rating" binding:"required,min=1,max=5"`
+	Title     string `json:"title" binding:"required,max=120"`
+	Body      string `json:"body" binding:"max=5000"`
+}
+
+type ReviewUpdateDTO struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"required,max=120"`
+	Body   string `json:"body" binding:"max=5000"`
+}
+
+type ReviewVoteDTO struct {
+	Helpful *bool `json:"helpful" binding:"required"`
+}
+
+type ReviewResponseDTO struct {
+	ID               uint      `json:"ID"`
+	ProductID        uint      `json:"productID"`
+	UserID           uint      `json:"userID"`
+	Username         string    `json:"username"`
+	Rating           int       `json:"rating"`
+	Title            string    `json:"title"`
+	Body             string    `json:"body"`
+	VerifiedPurchase bool      `json:"verifiedPurchase"`
+	HelpfulCount     int64     `json:"helpfulCount"`
+	UnhelpfulCount   int64     `json:"unhelpfulCount"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+type ProductRatingDTO struct {
+	Average   float64       `json:"average"`
+	Count     int64         `json:"count"`
+	Histogram map[int]int64 `json:"histogram"`
+}
+
+func ReviewDTOToModel(dto *ReviewDTO) *entities.Review {
+	return &entities.Review{
+		ProductID: dto.ProductID,
+		Rating:    dto.Rating,
+		Title:     dto.Title,
+		Body:      dto.Body,
+	}
+}
+
+func ReviewUpdateDTOToModel(dto *ReviewUpdateDTO) *entities.Review {
+	return &entities.Review{
+		Rating: dto.Rating,
+		Title:  dto.Title,
+		Body:   dto.Body,
+	}
+}
+
+func ReviewModelToResponseDTO(model *entities.Review) *ReviewResponseDTO {
+	return &ReviewResponseDTO{
+		ID:               model.ID,
+		ProductID:        model.ProductID,
+		UserID:           model.UserID,
+		Rating:           model.Rating,
+		Title:            model.Title,
+		Body:             model.Body,
+		VerifiedPurchase: model.VerifiedPurchase,
+		HelpfulCount:     model.HelpfulCount,
+		UnhelpfulCount:   model.UnhelpfulCount,
+		CreatedAt:        model.CreatedAt,
+		UpdatedAt:        model.UpdatedAt,
+	}
+}
+
+func ProductRatingModelToDTO(model *entities.ProductRating) *ProductRatingDTO {
+	return &ProductRatingDTO{
+		Average:   model.Average,
+		Count:     model.Count,
+		Histogram: model.Histogram(),
+	}
+}
@@ -0,0 +1,51 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// TrashedProductResponseDTO is a deleted product, which is purged for good at
+// PurgeAt unless it is restored.
+type TrashedProductResponseDTO struct {
+	ID          uint      `json:"ID"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       int64     `json:"price"`
+	DeletedAt   time.Time `json:"deletedAt"`
+	PurgeAt     time.Time `json:"purgeAt"`
+}
+
+// TrashedCommentResponseDTO is a deleted comment, which is purged for good at
+// PurgeAt unless it is restored.
+type TrashedCommentResponseDTO struct {
+	ID        uint      `json:"ID"`
+	Content   string    `json:"content"`
+	ProductID uint      `json:"productID"`
+	ParentID  *uint     `json:"parentID"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+func ProductModelToTrashedDTO(model *entities.Product, retention time.Duration) *TrashedProductResponseDTO {
+	return &TrashedProductResponseDTO{
+		ID:          model.ID,
+		Name:        model.Name,
+		Description: model.Description,
+		Price:       model.Price,
+		DeletedAt:   model.DeletedAt.Time,
+		PurgeAt:     model.DeletedAt.Time.Add(retention),
+	}
+}
+
+func CommentModelToTrashedDTO(model *entities.Comment, retention time.Duration) *TrashedCommentResponseDTO {
+	return &TrashedCommentResponseDTO{
+		ID:        model.ID,
+		Content:   model.Content,
+		ProductID: model.ProductID,
+		ParentID:  model.ParentID,
+		DeletedAt: model.DeletedAt.Time,
+		PurgeAt:   model.DeletedAt.Time.Add(retention),
+	}
+}
@@ -10,12 +10,31 @@ type UserDTO struct {
 	Password  string `json:"password" binding:"required"`
 }
 
+// UserUpdateDTO holds the details users may change about themselves. The
+// password is changed separately with UserPasswordDTO.
+type UserUpdateDTO struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email" binding:"required"`
+	Username  string `json:"username" binding:"required"`
+}
+
+type UserPasswordDTO struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+type UserRoleDTO struct {
+	Role string `json:"role" binding:"required,oneof=user moderator admin"`
+}
+
 type UserResponseDto struct {
 	ID        uint   `json:"ID"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 	Email     string `json:"email"`
 	Username  string `json:"username"`
+	Role      string `json:"role"`
 }
 
 func UserDTOToModel(dto *UserDTO) *entities.User {
@@ -28,6 +47,24 @@ func UserDTOToModel(dto *UserDTO) *entities.User {
 	}
 }
 
+func UserUpdateDTOToModel(dto *UserUpdateDTO) *entities.User {
+	return &entities.User{
+		FirstName: dto.FirstName,
+		LastName:  dto.LastName,
+		Email:     dto.Email,
+		Username:  dto.Username,
+	}
+}
+
+func UserModelToUpdateDTO(model *entities.User) *UserUpdateDTO {
+	return &UserUpdateDTO{
+		FirstName: model.FirstName,
+		LastName:  model.LastName,
+		Email:     model.Email,
+		Username:  model.Username,
+	}
+}
+
 func UserModelToResponseDto(model *entities.User) *UserResponseDto {
 	return &UserResponseDto{
 		ID:        model.ID,
@@ -35,5 +72,6 @@ func UserModelToResponseDto(model *entities.User) *UserResponseDto {
 		LastName:  model.LastName,
 		Email:     model.LastName,
 		Username:  model.Username,
+		Role:      string(model.Role),
 	}
 }
@@ -0,0 +1,118 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+// WebhookEndpointDTO registers or replaces a webhook endpoint. Endpoints are
+// enabled unless Enabled is false.
+type WebhookEndpointDTO struct {
+	URL         string   `json:"url" binding:"required,http_url,max=2048"`
+	Description string   `json:"description" binding:"max=255"`
+	EventTypes  []string `json:"eventTypes" binding:"required,min=1,dive,oneof=product.created product.updated product.deleted product.restored comment.posted comment.updated comment.deleted comment.restored"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+type WebhookEndpointResponseDTO struct {
+	ID                  uint       `json:"ID"`
+	URL                 string     `json:"url"`
+	Description         string     `json:"description"`
+	EventTypes          []string   `json:"eventTypes"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+// WebhookEndpointCreatedResponseDTO is only returned when an endpoint is
+// registered, the secret can not be read again afterwards.
+type WebhookEndpointCreatedResponseDTO struct {
+	ID     uint   `json:"ID"`
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryResponseDTO struct {
+	ID             uint                         `json:"ID"`
+	EventID        *uint                        `json:"eventID"`
+	EventType      string                       `json:"eventType"`
+	Payload        json.RawMessage              `json:"payload"`
+	AttemptCount   int                          `json:"attemptCount"`
+	NextAttemptAt  *time.Time                   `json:"nextAttemptAt"`
+	LastStatusCode int                          `json:"lastStatusCode"`
+	LastError      string                       `json:"lastError"`
+	DeliveredAt    *time.Time                   `json:"deliveredAt"`
+	FailedAt       *time.Time                   `json:"failedAt"`
+	CreatedAt      time.Time                    `json:"createdAt"`
+	Attempts       []*WebhookAttemptResponseDTO `json:"attempts"`
+}
+
+type WebhookAttemptResponseDTO struct {
+	ID         uint      `json:"ID"`
+	StatusCode int       `json:"statusCode"`
+	Error      string    `json:"error"`
+	DurationMS int64     `json:"durationMS"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func WebhookEndpointDTOToModel(dto *WebhookEndpointDTO) *entities.WebhookEndpoint {
+	model := &entities.WebhookEndpoint{
+		URL:         dto.URL,
+		Description: dto.Description,
+		Enabled:     dto.Enabled == nil || *dto.Enabled,
+	}
+
+	model.SetEventTypes(dto.EventTypes)
+
+	return model
+}
+
+func WebhookEndpointModelToResponseDTO(model *entities.WebhookEndpoint) *WebhookEndpointResponseDTO {
+	return &WebhookEndpointResponseDTO{
+		ID:                  model.ID,
+		URL:                 model.URL,
+		Description:         model.Description,
+		EventTypes:          model.EventTypeList(),
+		Enabled:             model.Enabled,
+		ConsecutiveFailures: model.ConsecutiveFailures,
+		DisabledAt:          model.DisabledAt,
+		CreatedAt:           model.CreatedAt,
+		UpdatedAt:           model.UpdatedAt,
+	}
+}
+
+func WebhookDeliveryModelToResponseDTO(model *entities.WebhookDelivery) *WebhookDeliveryResponseDTO {
+	dto := &WebhookDeliveryResponseDTO{
+		ID:             model.ID,
+		EventID:        model.EventID,
+		EventType:      model.EventType,
+		Payload:        json.RawMessage(model.Payload),
+		AttemptCount:   model.AttemptCount,
+		LastStatusCode: model.LastStatusCode,
+		LastError:      model.LastError,
+		DeliveredAt:    model.DeliveredAt,
+		FailedAt:       model.FailedAt,
+		CreatedAt:      model.CreatedAt,
+		Attempts:       make([]*WebhookAttemptResponseDTO, len(model.Attempts)),
+	}
+
+	// Finished deliveries are not attempted again.
+	if !model.IsFinished() {
+		dto.NextAttemptAt = &model.NextAttemptAt
+	}
+
+	for i, attempt := range model.Attempts {
+		dto.Attempts[i] = &WebhookAttemptResponseDTO{
+			ID:         attempt.ID,
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMS: attempt.DurationMS,
+			CreatedAt:  attempt.CreatedAt,
+		}
+	}
+
+	return dto
+}
@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+	// AuditActionRestore and AuditActionPurge record entities being restored
+	// from the trash and permanently deleted from it.
+	AuditActionRestore AuditAction = "restore"
+	AuditActionPurge   AuditAction = "purge"
+)
+
+/* AuditEvent records a change made to a product, comment or user. Changes
+* holds a JSON object mapping each changed field to its value before and after
+* the change. ActorID is zero when the change was not made by a logged in
+* user, such as when registering. Audit events are never updated or deleted. */
+type AuditEvent struct {
+	ID         uint        `gorm:"primarykey"`
+	CreatedAt  time.Time   `gorm:"not null;index"`
+	ActorID    uint        `gorm:"not null;index"`
+	Action     AuditAction `gorm:"not null"`
+	EntityType string      `gorm:"not null;index:idx_audit_events_entity"`
+	EntityID   uint        `gorm:"not null;index:idx_audit_events_entity"`
+	Changes    string      `gorm:"type:text;not null"`
+	RequestID  string
+	IP         string
+}
+
+// AuditChange is the value of a field before and after a change. Fields which
+// did not exist before or after the change are nil.
+type AuditChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
@@ -1,10 +1,49 @@
 package entities
 
-import "gorm.io/gorm"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+type CommentStatus string
+
+/* Published comments are shown to everyone. Pending comments were held back
+* by the content filter and hidden comments by a moderator, both are only
+* shown to their authors. */
+const (
+	CommentStatusPublished CommentStatus = "published"
+	CommentStatusPending   CommentStatus = "pending"
+	CommentStatusHidden    CommentStatus = "hidden"
+)
+
+/* Comment is a comment on a product or a reply to another comment. Replies
+* keep the ID of the comment starting their thread in RootID, so that a whole
+* thread can be loaded at once, and their Depth below it. Comments deleted by
+* a moderator are marked with DeletedByModerator, which keeps them out of the
+* trash of their authors. */
 type Comment struct {
 	gorm.Model
-	Content   string `gorm:"not null"`
-	UserID    uint   `gorm:"not null"`
-	ProductID uint   `gorm:"not null"`
+	Content            string        `gorm:"not null"`
+	UserID             uint          `gorm:"not null;index"`
+	ProductID          uint          `gorm:"not null"`
+	ParentID           *uint         `gorm:"index"`
+	RootID             *uint         `gorm:"index"`
+	Depth              int           `gorm:"not null;default:0"`
+	SellerResponse     bool          `gorm:"not null;default:false"`
+	Status             CommentStatus `gorm:"not null;default:published;index"`
+	ModerationReason   string
+	Version            uint `gorm:"not null;default:1"`
+	DeletedByModerator bool `gorm:"not null;default:false"`
+	Reports            []CommentReport
+}
+
+// CommentReport is a report of a comment by a user. Reports stay open until a
+// moderator approves, hides or deletes the comment.
+type CommentReport struct {
+	gorm.Model
+	CommentID  uint   `gorm:"not null;uniqueIndex:idx_comment_reports_comment_user,where:resolved_at IS NULL AND deleted_at IS NULL"`
+	UserID     uint   `gorm:"not null;uniqueIndex:idx_comment_reports_comment_user,where:resolved_at IS NULL AND deleted_at IS NULL"`
+	Reason     string `gorm:"not null"`
+	ResolvedAt *time.Time
 }
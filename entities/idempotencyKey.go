@@ -0,0 +1,24 @@
+package entities
+
+import "time"
+
+/* IdempotencyKey records a request sent with an Idempotency-Key header. While
+* the request is being handled StatusCode is zero and CreatedAt is when
+* handling it started, afterwards the response is kept until ExpiresAt so that
+* retries of the request can be answered with it. Keys are scoped to the user
+* who sent them. */
+type IdempotencyKey struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key         string `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Fingerprint string `gorm:"not null"`
+	StatusCode  int    `gorm:"not null"`
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+func (key *IdempotencyKey) IsCompleted() bool {
+	return key.StatusCode != 0
+}
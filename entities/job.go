@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+/* Job is a unit of background work of the given type, with Payload as its
+* JSON encoded argument. Jobs are picked up from their queue once RunAt has
+* passed. While a job is running RunAt is its lease, after which a job whose
+* worker went away is picked up again. Attempts counts the times the job was
+* picked up, a job which fails MaxAttempts times is left failed. UniqueKey, when
+* set, keeps the same job from being queued twice. */
+type Job struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	UpdatedAt   time.Time
+	Queue       string     `gorm:"not null;index:idx_jobs_due,priority:1"`
+	Type        string     `gorm:"not null;index"`
+	Payload     string     `gorm:"type:text;not null"`
+	Status      JobStatus  `gorm:"not null;index:idx_jobs_due,priority:2"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_due,priority:3"`
+	Attempts    int        `gorm:"not null;default:0"`
+	MaxAttempts int        `gorm:"not null"`
+	LastError   string     `gorm:"type:text"`
+	FinishedAt  *time.Time `gorm:"index"`
+	UniqueKey   *string    `gorm:"uniqueIndex"`
+}
+
+func (job *Job) IsFinished() bool {
+	return job.Status == JobStatusSucceeded || job.Status == JobStatusFailed
+}
@@ -0,0 +1,31 @@
+package entities
+
+import "time"
+
+type NotificationType string
+
+const (
+	NotificationCommentPosted NotificationType = "comment_posted"
+)
+
+/* Notification tells a user about something which happened to their things,
+* such as another user commenting on their product. ActorID is the user who
+* did it and ProductID and CommentID what it concerns. EventID is the domain
+* event the notification was created from, so that it is not created twice
+* when the event is delivered again. */
+type Notification struct {
+	ID        uint             `gorm:"primarykey"`
+	CreatedAt time.Time        `gorm:"index"`
+	UserID    uint             `gorm:"not null;index;uniqueIndex:idx_notifications_event,priority:2"`
+	Type      NotificationType `gorm:"not null"`
+	ActorID   *uint
+	ProductID *uint
+	CommentID *uint
+	Excerpt   string `gorm:"type:text"`
+	ReadAt    *time.Time
+	EventID   *uint `gorm:"uniqueIndex:idx_notifications_event,priority:1"`
+}
+
+func (notification *Notification) IsRead() bool {
+	return notification.ReadAt != nil
+}
@@ -0,0 +1,26 @@
+package entities
+
+import "time"
+
+// DefaultLocale is the locale of users who have not chosen one.
+const DefaultLocale = "en"
+
+/* NotificationPreferences holds how a user wants to be notified. Users who
+* never changed them have no row and get DefaultNotificationPreferences. */
+type NotificationPreferences struct {
+	UserID        uint `gorm:"primarykey;autoIncrement:false"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Locale        string `gorm:"not null"`
+	CommentEmails bool   `gorm:"not null"`
+}
+
+// DefaultNotificationPreferences returns the preferences of a user who has
+// not changed them.
+func DefaultNotificationPreferences(userID uint) *NotificationPreferences {
+	return &NotificationPreferences{
+		UserID:        userID,
+		Locale:        DefaultLocale,
+		CommentEmails: true,
+	}
+}
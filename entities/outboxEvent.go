@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+/* OutboxEvent is a domain event waiting to be delivered. It is saved in the
+* same transaction as the change it describes, so that an event is recorded
+* if and only if the change is. Events which fail to be delivered are retried
+* at NextAttemptAt until they run out of attempts and are marked dead. */
+type OutboxEvent struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	Type          string     `gorm:"not null"`
+	EntityID      uint       `gorm:"not null"`
+	Payload       string     `gorm:"type:text;not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"not null;index"`
+	LastError     string     `gorm:"type:text"`
+	DispatchedAt  *time.Time `gorm:"index"`
+	DeadAt        *time.Time `gorm:"index"`
+}
+
+// IsPending reports whether the event still has to be delivered.
+func (event *OutboxEvent) IsPending() bool {
+	return event.DispatchedAt == nil && event.DeadAt == nil
+}
@@ -7,6 +7,10 @@ type Product struct {
 	Name        string `gorm:"not null"`
 	Description string
 	Price       int64
-	UserID      uint `gorm:"not null"`
+	UserID      uint          `gorm:"not null"`
+	Version     uint          `gorm:"not null;default:1"`
+	Rating      ProductRating `gorm:"embedded;embeddedPrefix:rating_"`
 	Comments    []Comment
+	Images      []ProductImage
+	Reviews     []Review
 }
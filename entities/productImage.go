@@ -0,0 +1,17 @@
+package entities
+
+import "gorm.io/gorm"
+
+type ProductImage struct {
+	gorm.Model
+	ProductID    uint `gorm:"not null;index"`
+	Position     int  `gorm:"not null"`
+	IsPrimary    bool `gorm:"not null"`
+	ContentType  string
+	Width        int
+	Height       int
+	Size         int64
+	OriginalKey  string `gorm:"not null"`
+	MediumKey    string `gorm:"not null"`
+	ThumbnailKey string `gorm:"not null"`
+}
@@ -0,0 +1,54 @@
+package entities
+
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+/* ProductRating aggregates the review ratings of a product. It is stored with
+* the product and kept up to date by the review repository, so that products
+* can be sorted by rating without scanning their reviews. */
+type ProductRating struct {
+	Count   int64   `gorm:"not null;default:0"`
+	Average float64 `gorm:"not null;default:0"`
+	Stars1  int64   `gorm:"not null;default:0"`
+	Stars2  int64   `gorm:"not null;default:0"`
+	Stars3  int64   `gorm:"not null;default:0"`
+	Stars4  int64   `gorm:"not null;default:0"`
+	Stars5  int64   `gorm:"not null;default:0"`
+}
+
+// Histogram returns the number of reviews per star rating.
+func (rating *ProductRating) Histogram() map[int]int64 {
+	return map[int]int64{
+		1: rating.Stars1,
+		2: rating.Stars2,
+		3: rating.Stars3,
+		4: rating.Stars4,
+		5: rating.Stars5,
+	}
+}
+
+// NewProductRating aggregates the number of reviews per star rating.
+func NewProductRating(histogram map[int]int64) ProductRating {
+	rating := ProductRating{
+		Stars1: histogram[1],
+		Stars2: histogram[2],
+		Stars3: histogram[3],
+		Stars4: histogram[4],
+		Stars5: histogram[5],
+	}
+
+	var sum int64
+
+	for stars := MinRating; stars <= MaxRating; stars++ {
+		rating.Count += histogram[stars]
+		sum += int64(stars) * histogram[stars]
+	}
+
+	if rating.Count > 0 {
+		rating.Average = float64(sum) / float64(rating.Count)
+	}
+
+	return rating
+}
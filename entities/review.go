@@ -0,0 +1,22 @@
+package entities
+
+import "gorm.io/gorm"
+
+type Review struct {
+	gorm.Model
+	ProductID        uint   `gorm:"not null;uniqueIndex:idx_reviews_product_user,where:deleted_at IS NULL"`
+	UserID           uint   `gorm:"not null;uniqueIndex:idx_reviews_product_user,where:deleted_at IS NULL"`
+	Rating           int    `gorm:"not null"`
+	Title            string `gorm:"not null"`
+	Body             string
+	VerifiedPurchase bool  `gorm:"not null"`
+	HelpfulCount     int64 `gorm:"not null"`
+	UnhelpfulCount   int64 `gorm:"not null"`
+}
+
+type ReviewVote struct {
+	gorm.Model
+	ReviewID uint `gorm:"not null;uniqueIndex:idx_review_votes_review_user,where:deleted_at IS NULL"`
+	UserID   uint `gorm:"not null;uniqueIndex:idx_review_votes_review_user,where:deleted_at IS NULL"`
+	Helpful  bool `gorm:"not null"`
+}
@@ -2,6 +2,17 @@ package entities
 
 import "gorm.io/gorm"
 
+type Role string
+
+/* Moderators review reported and held comments, admins can additionally
+* assign roles. Admins have every role, the first admin has to be appointed
+* in the database. */
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
 type User struct {
 	gorm.Model
 	FirstName string
@@ -9,6 +20,14 @@ type User struct {
 	Email     string `gorm:"not null"`
 	Username  string `gorm:"unique;not null"`
 	Password  string `gorm:"not null"`
+	Role      Role   `gorm:"not null;default:user"`
+	Version   uint   `gorm:"not null;default:1"`
 	Products  []Product
 	Comments  []Comment
+	Reviews   []Review
+}
+
+// HasRole reports whether the user has the given role.
+func (user *User) HasRole(role Role) bool {
+	return user.Role == role || user.Role == RoleAdmin
 }
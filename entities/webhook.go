@@ -0,0 +1,82 @@
+package entities
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* WebhookEndpoint is a URL of a user which is sent the events about their
+* products it subscribes to. Payloads are signed with Secret. Endpoints are
+* disabled after too many failed deliveries in a row and stay disabled until
+* their owner enables them again. */
+type WebhookEndpoint struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;index"`
+	URL         string `gorm:"not null"`
+	Description string
+	Secret      string `gorm:"not null"`
+	// EventTypes is a comma separated list of the subscribed event types.
+	EventTypes          string `gorm:"not null"`
+	Enabled             bool   `gorm:"not null"`
+	ConsecutiveFailures int    `gorm:"not null;default:0"`
+	DisabledAt          *time.Time
+}
+
+func (endpoint *WebhookEndpoint) EventTypeList() []string {
+	if endpoint.EventTypes == "" {
+		return []string{}
+	}
+
+	return strings.Split(endpoint.EventTypes, ",")
+}
+
+func (endpoint *WebhookEndpoint) SetEventTypes(eventTypes []string) {
+	endpoint.EventTypes = strings.Join(eventTypes, ",")
+}
+
+func (endpoint *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, subscribed := range endpoint.EventTypeList() {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* WebhookDelivery is an event on its way to an endpoint. Payload is the exact
+* body sent with every attempt. A delivery is finished once it is delivered
+* or has failed for good, until then it is attempted again at NextAttemptAt.
+* EventID is nil for test events, which are not tied to a domain event. */
+type WebhookDelivery struct {
+	ID             uint             `gorm:"primarykey"`
+	CreatedAt      time.Time        `gorm:"index"`
+	EndpointID     uint             `gorm:"not null;uniqueIndex:idx_webhook_deliveries_endpoint_event"`
+	EventID        *uint            `gorm:"uniqueIndex:idx_webhook_deliveries_endpoint_event"`
+	EventType      string           `gorm:"not null"`
+	Payload        string           `gorm:"type:text;not null"`
+	AttemptCount   int              `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time        `gorm:"not null;index"`
+	LastStatusCode int              `gorm:"not null;default:0"`
+	LastError      string           `gorm:"type:text"`
+	DeliveredAt    *time.Time       `gorm:"index"`
+	FailedAt       *time.Time       `gorm:"index"`
+	Attempts       []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+func (delivery *WebhookDelivery) IsFinished() bool {
+	return delivery.DeliveredAt != nil || delivery.FailedAt != nil
+}
+
+// WebhookAttempt is a single request sent for a delivery. StatusCode is zero
+// when no response was received.
+type WebhookAttempt struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	DeliveryID uint   `gorm:"not null;index"`
+	StatusCode int    `gorm:"not null;default:0"`
+	Error      string `gorm:"type:text"`
+	DurationMS int64  `gorm:"not null;default:0"`
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Handler reacts to an event. Returning an error makes the event be delivered
+// again later.
+type Handler func(ctx context.Context, event *Event) error
+
+type Bus interface {
+	// Subscribe registers a handler for events of the given types, or for
+	// every event when no types are given. The name identifies the subscriber
+	// in logs and errors.
+	Subscribe(name string, handler Handler, types ...Type)
+	// Deliver hands the event to every subscriber of its type and joins the
+	// errors of the subscribers which failed.
+	Deliver(ctx context.Context, event *Event) error
+}
+
+type subscriber struct {
+	name    string
+	types   map[Type]bool
+	handler Handler
+}
+
+type BusImpl struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+}
+
+func InitBus() Bus {
+	return &BusImpl{}
+}
+
+func (bus *BusImpl) Subscribe(name string, handler Handler, types ...Type) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	subscribed := make(map[Type]bool, len(types))
+
+	for _, eventType := range types {
+		subscribed[eventType] = true
+	}
+
+	bus.subscribers = append(bus.subscribers, subscriber{name: name, types: subscribed, handler: handler})
+}
+
+func (bus *BusImpl) Deliver(ctx context.Context, event *Event) error {
+	bus.mu.RLock()
+	subscribers := bus.subscribers
+	bus.mu.RUnlock()
+
+	var errs []error
+
+	for _, subscriber := range subscribers {
+		if len(subscriber.types) > 0 && !subscriber.types[event.Type] {
+			continue
+		}
+
+		err := subscriber.deliver(ctx, event)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("subscriber %s: %w", subscriber.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliver calls the handler, turning a panic into an error so that one
+// faulty subscriber can not stop the delivery of events.
+func (subscriber *subscriber) deliver(ctx context.Context, event *Event) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	return subscriber.handler(ctx, event)
+}
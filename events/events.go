@@ -0,0 +1,71 @@
+/* Package events defines the domain events emitted by the service layer when
+* products, comments and users change, and the bus delivering them to the
+* subscribers inside the application.
+*
+* Events are written to the outbox in the same transaction as the change they
+* describe and delivered afterwards, at least once. A subscriber may therefore
+* see an event again after a failure and has to handle repeats. */
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Type string
+
+const (
+	ProductCreated  Type = "product.created"
+	ProductUpdated  Type = "product.updated"
+	ProductDeleted  Type = "product.deleted"
+	ProductRestored Type = "product.restored"
+
+	CommentPosted   Type = "comment.posted"
+	CommentUpdated  Type = "comment.updated"
+	CommentDeleted  Type = "comment.deleted"
+	CommentRestored Type = "comment.restored"
+
+	UserRegistered      Type = "user.registered"
+	UserUpdated         Type = "user.updated"
+	UserPasswordChanged Type = "user.password_changed"
+	UserDeleted         Type = "user.deleted"
+)
+
+// Event is a change to an entity. Payload holds one of the payload types below
+// as JSON, depending on the type of the event.
+type Event struct {
+	ID         uint
+	Type       Type
+	EntityID   uint
+	OccurredAt time.Time
+	Payload    json.RawMessage
+}
+
+// Decode unmarshals the payload of the event into out.
+func (event *Event) Decode(out any) error {
+	return json.Unmarshal(event.Payload, out)
+}
+
+type ProductPayload struct {
+	ProductID   uint   `json:"productID"`
+	UserID      uint   `json:"userID"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       int64  `json:"price"`
+}
+
+type CommentPayload struct {
+	CommentID uint   `json:"commentID"`
+	UserID    uint   `json:"userID"`
+	ProductID uint   `json:"productID"`
+	ParentID  *uint  `json:"parentID"`
+	Content   string `json:"content"`
+	Status    string `json:"status"`
+}
+
+type UserPayload struct {
+	UserID   uint   `json:"userID"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
@@ -0,0 +1,35 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/brunohradec/go-webstore/cache"
+)
+
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+/* ConnectToCache opens the cache selected in the environment. The memory cache
+* is private to the process, so with several instances of the application
+* behind a load balancer the shared redis cache should be used instead. */
+func ConnectToCache(ctx context.Context, env *CacheEnv) (cache.Cache, error) {
+	switch env.Backend {
+	case CacheBackendNone:
+		return cache.InitNoopCache(), nil
+	case CacheBackendMemory:
+		return cache.InitLRUCache(env.Size), nil
+	case CacheBackendRedis:
+		return cache.InitRedisCache(ctx, &cache.RedisConfig{
+			Addr:     env.Redis.Addr,
+			Password: env.Redis.Password,
+			DB:       env.Redis.DB,
+			Prefix:   "go-webstore:",
+		})
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", env.Backend)
+	}
+}
@@ -2,39 +2,93 @@ package infrastructure
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/brunohradec/go-webstore/entities"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func ConnectToDB(
-	host string,
-	port string,
-	name string,
-	username string,
-	password string) (*gorm.DB, error) {
+const (
+	DBDriverPostgres = "postgres"
+	DBDriverSQLite   = "sqlite"
+)
+
+const SQLiteInMemoryPath = ":memory:"
 
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host,
-		username,
-		password,
-		name,
-		port,
-	)
+/* ConnectToDB opens a database connection using the driver selected in the
+* environment. SQLite databases are stored in the file at env.Path, or kept in
+* memory for the lifetime of the process when the path is ":memory:". */
+func ConnectToDB(env *DBEnv) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+
+	switch env.Driver {
+	case DBDriverPostgres:
+		dialector = postgres.Open(fmt.Sprintf(
+			"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+			env.Host,
+			env.Username,
+			env.Password,
+			env.Name,
+			env.Port,
+		))
+	case DBDriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(env.Path))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", env.Driver)
+	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		return nil, err
 	}
 
+	if env.Driver == DBDriverSQLite {
+		sqlDB, err := db.DB()
+
+		if err != nil {
+			return nil, err
+		}
+
+		/* SQLite allows a single writer at a time, and every connection to an
+		* in-memory database would otherwise open a new, empty database. */
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	return db, nil
 }
 
+func sqliteDSN(path string) string {
+	pragmas := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	if path == SQLiteInMemoryPath {
+		return "file::memory:?" + pragmas
+	}
+
+	if strings.Contains(path, "?") {
+		return "file:" + path + "&" + pragmas
+	}
+
+	return "file:" + path + "?" + pragmas
+}
+
 func AutomigrateDB(db *gorm.DB) {
 	db.AutoMigrate(&entities.User{})
 	db.AutoMigrate(&entities.Product{})
 	db.AutoMigrate(&entities.Comment{})
+	db.AutoMigrate(&entities.CommentReport{})
+	db.AutoMigrate(&entities.ProductImage{})
+	db.AutoMigrate(&entities.Review{})
+	db.AutoMigrate(&entities.ReviewVote{})
+	db.AutoMigrate(&entities.IdempotencyKey{})
+	db.AutoMigrate(&entities.AuditEvent{})
+	db.AutoMigrate(&entities.OutboxEvent{})
+	db.AutoMigrate(&entities.WebhookEndpoint{})
+	db.AutoMigrate(&entities.WebhookDelivery{})
+	db.AutoMigrate(&entities.WebhookAttempt{})
+	db.AutoMigrate(&entities.Job{})
+	db.AutoMigrate(&entities.NotificationPreferences{})
+	db.AutoMigrate(&entities.Notification{})
 }
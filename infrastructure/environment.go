@@ -1,13 +1,19 @@
 package infrastructure
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type DBEnv struct {
+	Driver   string
+	Path     string
 	Host     string
 	Port     string
 	Name     string
@@ -20,10 +26,140 @@ type JWTEnv struct {
 	AccessTokenTTL    int
 }
 
+type TracingEnv struct {
+	Exporter     string
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+type LoggingEnv struct {
+	Level  string
+	Format string
+}
+
+type S3Env struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+type MediaEnv struct {
+	Storage        string
+	StoragePath    string
+	BaseURL        string
+	MaxUploadBytes int64
+	S3             S3Env
+}
+
+type ModerationEnv struct {
+	BannedWords  []string
+	MaxLinks     int
+	RepeatWindow time.Duration
+}
+
+type RedisEnv struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+type CacheEnv struct {
+	Backend string
+	Size    int
+	TTL     time.Duration
+	Redis   RedisEnv
+}
+
+type IdempotencyEnv struct {
+	TTL   time.Duration
+	Lease time.Duration
+}
+
+type TrashEnv struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+/* OutboxEnv configures the delivery of domain events. Due events are looked
+* for every PollInterval, failed deliveries are retried after RetryDelay,
+* doubling with every attempt, until MaxAttempts is reached. Delivered events
+* are kept for Retention. */
+type OutboxEnv struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	Retention    time.Duration
+}
+
+/* WebhookEnv configures the delivery of webhooks. Deliveries are retried after
+* RetryDelay, doubling with every attempt, until MaxAttempts is reached, and
+* an endpoint is disabled after DisableAfter failed attempts in a row.
+* Requests to loopback and private addresses are refused unless
+* AllowPrivateNetworks is set. */
+type WebhookEnv struct {
+	PollInterval         time.Duration
+	MaxAttempts          int
+	RetryDelay           time.Duration
+	DisableAfter         int
+	Timeout              time.Duration
+	AllowPrivateNetworks bool
+}
+
+/* JobsEnv configures the background job runner. Every queue is polled every
+* PollInterval and runs as many jobs at once as its concurrency in Queues.
+* Running jobs are cancelled after Lease, failed jobs are retried after
+* RetryDelay, doubling with every attempt, until MaxAttempts is reached.
+* Finished jobs are kept for Retention. */
+type JobsEnv struct {
+	PollInterval time.Duration
+	Queues       map[string]int
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	Lease        time.Duration
+	Retention    time.Duration
+}
+
+type SMTPEnv struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+/* MailEnv configures the emails sent to users. Mailer is either smtp, which
+* sends them through the SMTP server, or file, which writes them to FilePath
+* instead. From is the sender of every email. */
+type MailEnv struct {
+	Mailer   string
+	From     string
+	FilePath string
+	SMTP     SMTPEnv
+}
+
 type Env struct {
-	Port string
-	DB   DBEnv
-	JWT  JWTEnv
+	Port       string
+	DB         DBEnv
+	JWT        JWTEnv
+	Tracing    TracingEnv
+	Logging    LoggingEnv
+	Media      MediaEnv
+	Moderation ModerationEnv
+	Cache      CacheEnv
+
+	Idempotency IdempotencyEnv
+	Trash       TrashEnv
+	Outbox      OutboxEnv
+	Webhook     WebhookEnv
+	Jobs        JobsEnv
+	Mail        MailEnv
+
+	// TrustedProxies are the addresses and CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For headers are believed. When empty, the client IP is
+	// always the address of the connection.
+	TrustedProxies []string
 }
 
 func Environment() (*Env, error) {
@@ -39,9 +175,186 @@ func Environment() (*Env, error) {
 		return nil, err
 	}
 
+	maxUploadBytes, err := strconv.ParseInt(getenvOrDefault("MEDIA_MAX_UPLOAD_BYTES", "10485760"), 10, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s3UseSSL, err := strconv.ParseBool(getenvOrDefault("S3_USE_SSL", "true"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxLinks, err := strconv.Atoi(getenvOrDefault("MODERATION_MAX_LINKS", "2"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	repeatWindow, err := time.ParseDuration(getenvOrDefault("MODERATION_REPEAT_WINDOW", "10m"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize, err := strconv.Atoi(getenvOrDefault("CACHE_SIZE", "10000"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := time.ParseDuration(getenvOrDefault("CACHE_TTL", "5m"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	redisDB, err := strconv.Atoi(getenvOrDefault("REDIS_DB", "0"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := time.ParseDuration(getenvOrDefault("IDEMPOTENCY_TTL", "24h"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyLease, err := time.ParseDuration(getenvOrDefault("IDEMPOTENCY_LEASE", "1m"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	trashRetention, err := time.ParseDuration(getenvOrDefault("TRASH_RETENTION", "720h"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	trashPurgeInterval, err := time.ParseDuration(getenvOrDefault("TRASH_PURGE_INTERVAL", "1h"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	outboxPollInterval, err := time.ParseDuration(getenvOrDefault("OUTBOX_POLL_INTERVAL", "1s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	outboxMaxAttempts, err := strconv.Atoi(getenvOrDefault("OUTBOX_MAX_ATTEMPTS", "10"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	outboxRetryDelay, err := time.ParseDuration(getenvOrDefault("OUTBOX_RETRY_DELAY", "5s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	outboxRetention, err := time.ParseDuration(getenvOrDefault("OUTBOX_RETENTION", "168h"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookPollInterval, err := time.ParseDuration(getenvOrDefault("WEBHOOK_POLL_INTERVAL", "1s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookMaxAttempts, err := strconv.Atoi(getenvOrDefault("WEBHOOK_MAX_ATTEMPTS", "8"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookRetryDelay, err := time.ParseDuration(getenvOrDefault("WEBHOOK_RETRY_DELAY", "30s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookDisableAfter, err := strconv.Atoi(getenvOrDefault("WEBHOOK_DISABLE_AFTER", "20"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookTimeout, err := time.ParseDuration(getenvOrDefault("WEBHOOK_TIMEOUT", "10s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhookAllowPrivateNetworks, err := strconv.ParseBool(getenvOrDefault("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "false"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsPollInterval, err := time.ParseDuration(getenvOrDefault("JOBS_POLL_INTERVAL", "1s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsQueues, err := parseQueues(getenvOrDefault("JOBS_QUEUES", "default:4,maintenance:1"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsMaxAttempts, err := strconv.Atoi(getenvOrDefault("JOBS_MAX_ATTEMPTS", "5"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsRetryDelay, err := time.ParseDuration(getenvOrDefault("JOBS_RETRY_DELAY", "10s"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsLease, err := time.ParseDuration(getenvOrDefault("JOBS_LEASE", "5m"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobsRetention, err := time.ParseDuration(getenvOrDefault("JOBS_RETENTION", "168h"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	smtpPort, err := strconv.Atoi(getenvOrDefault("SMTP_PORT", "587"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+	if err != nil {
+		return nil, err
+	}
+
 	env := Env{
-		Port: os.Getenv("PORT"),
+		Port:           os.Getenv("PORT"),
+		TrustedProxies: trustedProxies,
 		DB: DBEnv{
+			Driver:   getenvOrDefault("DB_DRIVER", DBDriverPostgres),
+			Path:     getenvOrDefault("DB_PATH", "go_webstore.db"),
 			Host:     os.Getenv("DB_HOST"),
 			Port:     os.Getenv("DB_PORT"),
 			Name:     os.Getenv("DB_NAME"),
@@ -52,7 +365,150 @@ func Environment() (*Env, error) {
 			AccessTokenSecret: os.Getenv("JWT_ACCESS_TOKEN_SECRET"),
 			AccessTokenTTL:    accessTokenTTL,
 		},
+		Tracing: TracingEnv{
+			Exporter:     getenvOrDefault("TRACING_EXPORTER", TracingExporterNone),
+			OTLPEndpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+			ServiceName:  getenvOrDefault("OTEL_SERVICE_NAME", "go-webstore"),
+		},
+		Logging: LoggingEnv{
+			Level:  getenvOrDefault("LOG_LEVEL", "info"),
+			Format: getenvOrDefault("LOG_FORMAT", LogFormatJSON),
+		},
+		Media: MediaEnv{
+			Storage:        getenvOrDefault("MEDIA_STORAGE", MediaStorageFileSystem),
+			StoragePath:    getenvOrDefault("MEDIA_STORAGE_PATH", "media"),
+			BaseURL:        os.Getenv("MEDIA_BASE_URL"),
+			MaxUploadBytes: maxUploadBytes,
+			S3: S3Env{
+				Endpoint:        os.Getenv("S3_ENDPOINT"),
+				Region:          os.Getenv("S3_REGION"),
+				Bucket:          os.Getenv("S3_BUCKET"),
+				AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+				UseSSL:          s3UseSSL,
+			},
+		},
+		Moderation: ModerationEnv{
+			BannedWords:  splitList(os.Getenv("MODERATION_BANNED_WORDS")),
+			MaxLinks:     maxLinks,
+			RepeatWindow: repeatWindow,
+		},
+		Cache: CacheEnv{
+			Backend: getenvOrDefault("CACHE_BACKEND", CacheBackendMemory),
+			Size:    cacheSize,
+			TTL:     cacheTTL,
+			Redis: RedisEnv{
+				Addr:     getenvOrDefault("REDIS_ADDR", "localhost:6379"),
+				Password: os.Getenv("REDIS_PASSWORD"),
+				DB:       redisDB,
+			},
+		},
+		Idempotency: IdempotencyEnv{
+			TTL:   idempotencyTTL,
+			Lease: idempotencyLease,
+		},
+		Trash: TrashEnv{
+			Retention:     trashRetention,
+			PurgeInterval: trashPurgeInterval,
+		},
+		Outbox: OutboxEnv{
+			PollInterval: outboxPollInterval,
+			MaxAttempts:  outboxMaxAttempts,
+			RetryDelay:   outboxRetryDelay,
+			Retention:    outboxRetention,
+		},
+		Webhook: WebhookEnv{
+			PollInterval:         webhookPollInterval,
+			MaxAttempts:          webhookMaxAttempts,
+			RetryDelay:           webhookRetryDelay,
+			DisableAfter:         webhookDisableAfter,
+			Timeout:              webhookTimeout,
+			AllowPrivateNetworks: webhookAllowPrivateNetworks,
+		},
+		Jobs: JobsEnv{
+			PollInterval: jobsPollInterval,
+			Queues:       jobsQueues,
+			MaxAttempts:  jobsMaxAttempts,
+			RetryDelay:   jobsRetryDelay,
+			Lease:        jobsLease,
+			Retention:    jobsRetention,
+		},
+		Mail: MailEnv{
+			Mailer:   getenvOrDefault("MAIL_MAILER", MailerFile),
+			From:     getenvOrDefault("MAIL_FROM", "go-webstore <no-reply@localhost>"),
+			FilePath: getenvOrDefault("MAIL_FILE_PATH", "mail"),
+			SMTP: SMTPEnv{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     smtpPort,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+			},
+		},
 	}
 
 	return &env, nil
 }
+
+func getenvOrDefault(key string, defaultValue string) string {
+	value, found := os.LookupEnv(key)
+
+	if !found || value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// parseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// ranges.
+func parseTrustedProxies(value string) ([]string, error) {
+	proxies := splitList(value)
+
+	for _, proxy := range proxies {
+		if net.ParseIP(proxy) != nil {
+			continue
+		}
+
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is neither an IP address nor a CIDR range", proxy)
+		}
+	}
+
+	return proxies, nil
+}
+
+// parseQueues parses a comma separated list of queue:concurrency pairs.
+func parseQueues(value string) (map[string]int, error) {
+	queues := make(map[string]int)
+
+	for _, item := range splitList(value) {
+		name, concurrency, found := strings.Cut(item, ":")
+
+		if !found {
+			return nil, fmt.Errorf("queue %q has no concurrency", item)
+		}
+
+		limit, err := strconv.Atoi(concurrency)
+
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("queue %q must have a concurrency of at least 1", name)
+		}
+
+		queues[strings.TrimSpace(name)] = limit
+	}
+
+	return queues, nil
+}
@@ -0,0 +1,86 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+/* NewLogger builds the application logger from the logging environment. Every
+* record logged with a context carries the attributes attached to that
+* context with ContextWithLogAttrs, as well as the active trace and span IDs. */
+func NewLogger(env *LoggingEnv, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(env.Level))
+
+	if err != nil {
+		return nil, fmt.Errorf("unknown log level %q", env.Level)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+
+	switch strings.ToLower(env.Format) {
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", env.Format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+type logAttrsKey struct{}
+
+// ContextWithLogAttrs returns a copy of ctx whose log records will include attrs.
+func ContextWithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+
+	combined := make([]slog.Attr, 0, len(existing)+len(attrs))
+	combined = append(combined, existing...)
+	combined = append(combined, attrs...)
+
+	return context.WithValue(ctx, logAttrsKey{}, combined)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+
+	spanContext := trace.SpanContextFromContext(ctx)
+
+	if spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,29 @@
+package infrastructure
+
+import (
+	"fmt"
+
+	"github.com/brunohradec/go-webstore/notifications"
+)
+
+const (
+	MailerSMTP = "smtp"
+	MailerFile = "file"
+)
+
+// ConnectToMailer returns the mailer selected in the environment.
+func ConnectToMailer(env *MailEnv) (notifications.Mailer, error) {
+	switch env.Mailer {
+	case MailerSMTP:
+		return notifications.InitSMTPMailer(&notifications.SMTPConfig{
+			Host:     env.SMTP.Host,
+			Port:     env.SMTP.Port,
+			Username: env.SMTP.Username,
+			Password: env.SMTP.Password,
+		}), nil
+	case MailerFile:
+		return notifications.InitFileMailer(env.FilePath)
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", env.Mailer)
+	}
+}
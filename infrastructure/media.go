@@ -0,0 +1,44 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/brunohradec/go-webstore/storage"
+)
+
+const (
+	MediaStorageFileSystem = "filesystem"
+	MediaStorageS3         = "s3"
+)
+
+const defaultMediaBaseURL = "/media"
+
+/* ConnectToBlobStore opens the media storage selected in the environment.
+* Files on the local file system are served by the application under /media,
+* while S3 objects are linked at the bucket itself unless a base URL, such as
+* a CDN, is configured. */
+func ConnectToBlobStore(ctx context.Context, env *MediaEnv) (storage.BlobStore, error) {
+	switch env.Storage {
+	case MediaStorageFileSystem:
+		baseURL := env.BaseURL
+
+		if baseURL == "" {
+			baseURL = defaultMediaBaseURL
+		}
+
+		return storage.InitFileSystemBlobStore(env.StoragePath, baseURL)
+	case MediaStorageS3:
+		return storage.InitS3BlobStore(ctx, &storage.S3Config{
+			Endpoint:        env.S3.Endpoint,
+			Region:          env.S3.Region,
+			Bucket:          env.S3.Bucket,
+			AccessKeyID:     env.S3.AccessKeyID,
+			SecretAccessKey: env.S3.SecretAccessKey,
+			UseSSL:          env.S3.UseSSL,
+			BaseURL:         env.BaseURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown media storage %q", env.Storage)
+	}
+}
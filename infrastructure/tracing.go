@@ -0,0 +1,165 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+/* InitTracing registers the global tracer provider and the W3C trace context
+* propagator. The returned function flushes pending spans and must be called
+* before the application exits. When tracing is disabled the global no-op
+* provider is left in place, but incoming trace context is still propagated. */
+func InitTracing(ctx context.Context, env *TracingEnv) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch env.Exporter {
+	case TracingExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case TracingExporterOTLP:
+		var options []otlptracehttp.Option
+
+		if env.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(env.OTLPEndpoint))
+		}
+
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", env.Exporter)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(env.ServiceName),
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+/* InstrumentDB registers GORM callbacks which wrap every SQL statement in a
+* client span. Spans are parented to the context passed with DB.WithContext. */
+func InstrumentDB(db *gorm.DB) error {
+	return db.Use(&tracingPlugin{
+		tracer: otel.Tracer("github.com/brunohradec/go-webstore/infrastructure"),
+	})
+}
+
+const tracingSpanKey = "otel:span"
+
+type tracingPlugin struct {
+	tracer trace.Tracer
+}
+
+func (plugin *tracingPlugin) Name() string {
+	return "otel-tracing"
+}
+
+func (plugin *tracingPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("otel:before_create", plugin.before("gorm.Create")),
+		callback.Create().After("gorm:create").Register("otel:after_create", plugin.after),
+		callback.Query().Before("gorm:query").Register("otel:before_query", plugin.before("gorm.Query")),
+		callback.Query().After("gorm:query").Register("otel:after_query", plugin.after),
+		callback.Update().Before("gorm:update").Register("otel:before_update", plugin.before("gorm.Update")),
+		callback.Update().After("gorm:update").Register("otel:after_update", plugin.after),
+		callback.Delete().Before("gorm:delete").Register("otel:before_delete", plugin.before("gorm.Delete")),
+		callback.Delete().After("gorm:delete").Register("otel:after_delete", plugin.after),
+		callback.Row().Before("gorm:row").Register("otel:before_row", plugin.before("gorm.Row")),
+		callback.Row().After("gorm:row").Register("otel:after_row", plugin.after),
+		callback.Raw().Before("gorm:raw").Register("otel:before_raw", plugin.before("gorm.Raw")),
+		callback.Raw().After("gorm:raw").Register("otel:after_raw", plugin.after),
+	)
+}
+
+func (plugin *tracingPlugin) before(spanName string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+
+		_, span := plugin.tracer.Start(
+			db.Statement.Context,
+			spanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+		)
+
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func (plugin *tracingPlugin) after(db *gorm.DB) {
+	value, found := db.InstanceGet(tracingSpanKey)
+
+	if !found {
+		return
+	}
+
+	span, ok := value.(trace.Span)
+
+	if !ok {
+		return
+	}
+
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBSystemKey.String(db.Dialector.Name()),
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
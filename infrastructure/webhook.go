@@ -0,0 +1,52 @@
+package infrastructure
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+)
+
+/* NewWebhookClient returns the HTTP client webhooks are delivered with. The
+* URLs are chosen by users, so unless private networks are allowed the client
+* refuses to connect to loopback, private and link local addresses, checking
+* the address actually dialed so that DNS can not be used to get around it. */
+func NewWebhookClient(env *WebhookEnv) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: env.Timeout,
+	}
+
+	if !env.AllowPrivateNetworks {
+		dialer.Control = refusePrivateAddresses
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   env.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refusePrivateAddresses(network string, address string, conn syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	addr := addrPort.Addr().Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("refusing to connect to non-public address %s", addr)
+	}
+
+	return nil
+}
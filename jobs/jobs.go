@@ -0,0 +1,176 @@
+/*
+Package jobs runs work in the background. Jobs are stored in the database and
+picked up by a Runner in every instance of the application, which claims them
+with SELECT ... FOR UPDATE SKIP LOCKED on Postgres, so that each job is run by
+one instance only. Failed jobs are retried with an exponential backoff, jobs
+may be delayed until a given time and recurring jobs are queued on a cron
+schedule.
+
+Jobs are queued with an Enqueuer. Called with the context of a transaction, a
+job is saved in that transaction and only runs if it commits.
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/repositories"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// DefaultQueue is the queue of jobs which do not name one.
+const DefaultQueue = "default"
+
+var tracer = otel.Tracer("github.com/brunohradec/go-webstore/jobs")
+
+// ErrDuplicate is returned when a job with the same unique key was already
+// queued.
+var ErrDuplicate = errors.New("a job with the same unique key was already queued")
+
+// Option changes how a job is queued.
+type Option func(job *entities.Job)
+
+// OnQueue puts the job on the given queue instead of the default one.
+func OnQueue(queue string) Option {
+	return func(job *entities.Job) {
+		job.Queue = queue
+	}
+}
+
+// RunAt delays the job until the given time.
+func RunAt(at time.Time) Option {
+	return func(job *entities.Job) {
+		job.RunAt = at
+	}
+}
+
+// RunIn delays the job by the given duration.
+func RunIn(delay time.Duration) Option {
+	return func(job *entities.Job) {
+		job.RunAt = time.Now().Add(delay)
+	}
+}
+
+// MaxAttempts overrides how many times the job is attempted.
+func MaxAttempts(attempts int) Option {
+	return func(job *entities.Job) {
+		job.MaxAttempts = attempts
+	}
+}
+
+// Unique keeps the job from being queued again under the same key for as long
+// as it is kept.
+func Unique(key string) Option {
+	return func(job *entities.Job) {
+		job.UniqueKey = &key
+	}
+}
+
+type Enqueuer interface {
+	// Enqueue queues a job of the given type with payload as its argument
+	// and returns its ID.
+	Enqueue(ctx context.Context, jobType string, payload any, options ...Option) (uint, error)
+}
+
+type EnqueuerImpl struct {
+	JobRepository repositories.JobRepository
+	MaxAttempts   int
+	Logger        *slog.Logger
+}
+
+func InitEnqueuer(jobRepository repositories.JobRepository, env *infrastructure.JobsEnv, logger *slog.Logger) Enqueuer {
+	return &EnqueuerImpl{
+		JobRepository: jobRepository,
+		MaxAttempts:   env.MaxAttempts,
+		Logger:        logger,
+	}
+}
+
+func (enqueuer *EnqueuerImpl) Enqueue(ctx context.Context, jobType string, payload any, options ...Option) (uint, error) {
+	ctx, span := tracer.Start(ctx, "Enqueuer.Enqueue")
+	defer span.End()
+
+	encoded, err := json.Marshal(payload)
+
+	if err != nil {
+		return 0, err
+	}
+
+	job := &entities.Job{
+		Queue:       DefaultQueue,
+		Type:        jobType,
+		Payload:     string(encoded),
+		Status:      entities.JobStatusPending,
+		RunAt:       time.Now(),
+		MaxAttempts: enqueuer.MaxAttempts,
+	}
+
+	for _, option := range options {
+		option(job)
+	}
+
+	err = enqueuer.JobRepository.Save(ctx, job)
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return 0, ErrDuplicate
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	enqueuer.Logger.DebugContext(ctx, "queued job", "job_id", job.ID, "type", jobType, "queue", job.Queue)
+
+	return job.ID, nil
+}
+
+// HandlerFunc runs a job. Returning an error makes the job be retried until
+// it runs out of attempts.
+type HandlerFunc func(ctx context.Context, job *entities.Job) error
+
+// Handle adapts a function taking the decoded payload of a job to a
+// HandlerFunc. A payload which can not be decoded fails the job for good.
+func Handle[T any](handler func(ctx context.Context, payload T) error) HandlerFunc {
+	return func(ctx context.Context, job *entities.Job) error {
+		var payload T
+
+		err := json.Unmarshal([]byte(job.Payload), &payload)
+
+		if err != nil {
+			return Permanent(fmt.Errorf("could not decode the payload: %w", err))
+		}
+
+		return handler(ctx, payload)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (err *permanentError) Error() string {
+	return err.err.Error()
+}
+
+func (err *permanentError) Unwrap() error {
+	return err.err
+}
+
+// Permanent marks an error of a handler as one which retrying the job does
+// not fix, so the job fails right away.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
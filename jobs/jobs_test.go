@@ -0,0 +1,249 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+func newTestRunner(t *testing.T, repository repositories.JobRepository, queues map[string]int) (Runner, Enqueuer) {
+	t.Helper()
+
+	env := &infrastructure.JobsEnv{
+		Queues:      queues,
+		MaxAttempts: 3,
+		Lease:       time.Minute,
+		Retention:   time.Hour,
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	enqueuer := InitEnqueuer(repository, env, logger)
+
+	return InitRunner(repository, enqueuer, env, logger), enqueuer
+}
+
+func TestParseSchedule(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	cases := []struct {
+		spec     string
+		after    string
+		expected string
+	}{
+		{"@hourly", "2026-03-01T10:15:00Z", "2026-03-01T11:00:00Z"},
+		{"@daily", "2026-03-01T10:15:00Z", "2026-03-02T00:00:00Z"},
+		{"@every 15m", "2026-03-01T10:15:00Z", "2026-03-01T10:30:00Z"},
+		{"*/20 * * * *", "2026-03-01T10:41:30Z", "2026-03-01T11:00:00Z"},
+		{"30 9-17 * * 1-5", "2026-03-06T17:45:00Z", "2026-03-09T09:30:00Z"},
+		{"0 0 29 2 *", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 12 1 * 7", "2026-03-02T00:00:00Z", "2026-03-08T12:00:00Z"},
+		{"5,10 3 * * *", "2026-03-01T03:05:00Z", "2026-03-01T03:10:00Z"},
+	}
+
+	for _, c := range cases {
+		schedule, err := ParseSchedule(c.spec)
+
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+
+		if next := schedule.Next(at(c.after)); !next.Equal(at(c.expected)) {
+			t.Errorf("%s after %s: expected %s, got %s", c.spec, c.after, c.expected, next.Format(time.RFC3339))
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every soon", "@every 1ms"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	repository := repositories.InitMemoryJobRepository()
+	runner, enqueuer := newTestRunner(t, repository, nil)
+
+	type greeting struct {
+		Name string `json:"name"`
+	}
+
+	var greeted []string
+	flaky := 2
+
+	runner.Register("greet", Handle(func(ctx context.Context, payload greeting) error {
+		greeted = append(greeted, payload.Name)
+		return nil
+	}))
+	runner.Register("flaky", func(ctx context.Context, job *entities.Job) error {
+		if flaky--; flaky >= 0 {
+			return errors.New("not yet")
+		}
+
+		return nil
+	})
+	runner.Register("broken", func(ctx context.Context, job *entities.Job) error {
+		return errors.New("always")
+	})
+	runner.Register("invalid", func(ctx context.Context, job *entities.Job) error {
+		return Permanent(errors.New("can not be fixed by retrying"))
+	})
+	runner.Register("panicking", func(ctx context.Context, job *entities.Job) error {
+		panic("oops")
+	})
+
+	greetID, _ := enqueuer.Enqueue(ctx, "greet", greeting{Name: "alice"})
+	laterID, _ := enqueuer.Enqueue(ctx, "greet", greeting{Name: "bob"}, RunIn(time.Hour))
+	flakyID, _ := enqueuer.Enqueue(ctx, "flaky", nil)
+	brokenID, _ := enqueuer.Enqueue(ctx, "broken", nil, MaxAttempts(2))
+	invalidID, _ := enqueuer.Enqueue(ctx, "invalid", nil)
+	panickingID, _ := enqueuer.Enqueue(ctx, "panicking", nil, MaxAttempts(1))
+	unknownID, _ := enqueuer.Enqueue(ctx, "unknown", nil)
+
+	if _, err := enqueuer.Enqueue(ctx, "greet", greeting{Name: "carol"}, Unique("carol")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enqueuer.Enqueue(ctx, "greet", greeting{Name: "carol"}, Unique("carol")); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a job with the same unique key to be rejected, got %v", err)
+	}
+
+	// There is no retry delay, so failing jobs are retried right away until
+	// they run out of attempts.
+	if _, err := runner.Work(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(greeted) != 2 || greeted[0] != "alice" || greeted[1] != "carol" {
+		t.Errorf("expected alice and carol to be greeted, got %v", greeted)
+	}
+
+	expected := map[uint]struct {
+		status   entities.JobStatus
+		attempts int
+	}{
+		greetID:     {entities.JobStatusSucceeded, 1},
+		laterID:     {entities.JobStatusPending, 0},
+		flakyID:     {entities.JobStatusSucceeded, 3},
+		brokenID:    {entities.JobStatusFailed, 2},
+		invalidID:   {entities.JobStatusFailed, 1},
+		panickingID: {entities.JobStatusFailed, 1},
+		unknownID:   {entities.JobStatusFailed, 1},
+	}
+
+	for ID, expected := range expected {
+		job, err := repository.FindByID(ctx, ID)
+
+		if err != nil || job.Status != expected.status || job.Attempts != expected.attempts {
+			t.Errorf("expected job %d to be %s after %d attempts, got %+v, %v", ID, expected.status, expected.attempts, job, err)
+		}
+	}
+
+	if job, _ := repository.FindByID(ctx, panickingID); job.LastError != "job panicked: oops" {
+		t.Errorf("expected the panic to be recorded, got %q", job.LastError)
+	}
+}
+
+func TestRunnerConcurrency(t *testing.T) {
+	ctx := context.Background()
+	repository := repositories.InitMemoryJobRepository()
+	runner, enqueuer := newTestRunner(t, repository, map[string]int{"images": 3})
+
+	var mu sync.Mutex
+	running, maxRunning, ran := 0, 0, 0
+
+	runner.Register("resize", func(ctx context.Context, job *entities.Job) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		ran++
+		mu.Unlock()
+
+		return nil
+	})
+
+	for i := 0; i < 10; i++ {
+		if _, err := enqueuer.Enqueue(ctx, "resize", i, OnQueue("images")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	worked, err := runner.Work(ctx)
+
+	if err != nil || worked != 10 || ran != 10 {
+		t.Fatalf("expected all ten jobs to run, got %d, %d, %v", worked, ran, err)
+	}
+
+	if maxRunning != 3 {
+		t.Errorf("expected three jobs of the queue to run at once, got %d", maxRunning)
+	}
+}
+
+func TestRecurringJobs(t *testing.T) {
+	ctx := context.Background()
+	repository := repositories.InitMemoryJobRepository()
+
+	// Two instances of the application schedule the same job.
+	first, _ := newTestRunner(t, repository, nil)
+	second, _ := newTestRunner(t, repository, nil)
+
+	for _, runner := range []Runner{first, second} {
+		if err := runner.Schedule("report", "@every 1h", "report", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+
+	for _, runner := range []Runner{first, second} {
+		if err := runner.EnqueueScheduled(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if jobs := repository.Find(ctx, repositories.JobFilter{Type: "report"}, paging.Page{}); len(jobs) != 0 {
+		t.Fatalf("expected no job before the first occurrence, got %+v", jobs)
+	}
+
+	for _, runner := range []Runner{first, second} {
+		if err := runner.EnqueueScheduled(ctx, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports := repository.Find(ctx, repositories.JobFilter{Type: "report"}, paging.Page{})
+
+	if len(reports) != 1 || !reports[0].RunAt.Equal(now.Truncate(time.Hour).Add(time.Hour)) {
+		t.Fatalf("expected one report on the hour, got %+v", reports)
+	}
+
+	purges := repository.Find(ctx, repositories.JobFilter{Type: PurgeJobType}, paging.Page{})
+
+	if len(purges) != 1 || purges[0].Queue != MaintenanceQueue {
+		t.Errorf("expected the built in purge on the maintenance queue, got %+v", purges)
+	}
+}
@@ -0,0 +1,367 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/repositories"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// MaintenanceQueue is the queue of the recurring clean up jobs, which
+	// should not hold up the jobs users wait for.
+	MaintenanceQueue = "maintenance"
+
+	// PurgeJobType is the recurring job deleting the finished jobs past
+	// their retention.
+	PurgeJobType = "jobs.purge"
+
+	maxRetryDelay = time.Hour
+)
+
+type Runner interface {
+	// Register sets the handler of the jobs of the given type.
+	Register(jobType string, handler HandlerFunc)
+	// Schedule queues a job of the given type on every occurrence of spec,
+	// as parsed by ParseSchedule. The name identifies the recurring job, so
+	// that instances of the application do not queue it more than once.
+	Schedule(name string, spec string, jobType string, payload any, options ...Option) error
+	// Run works the queues and queues the recurring jobs until ctx is done.
+	Run(ctx context.Context)
+	// Work runs the jobs of every queue which are due and returns how many
+	// were run.
+	Work(ctx context.Context) (int, error)
+	// EnqueueScheduled queues the recurring jobs which are due at now.
+	EnqueueScheduled(ctx context.Context, now time.Time) error
+}
+
+type recurringJob struct {
+	name     string
+	jobType  string
+	schedule Schedule
+	payload  any
+	options  []Option
+	next     time.Time
+}
+
+type RunnerImpl struct {
+	JobRepository repositories.JobRepository
+	Enqueuer      Enqueuer
+	// Queues holds how many jobs of each queue run at once. Jobs of queues
+	// which are not listed are not run.
+	Queues       map[string]int
+	PollInterval time.Duration
+	RetryDelay   time.Duration
+	Lease        time.Duration
+	Retention    time.Duration
+	Logger       *slog.Logger
+
+	mu        sync.Mutex
+	handlers  map[string]HandlerFunc
+	recurring []*recurringJob
+}
+
+/* InitRunner returns a runner of the queues in env. The default and the
+* maintenance queue run one job at a time unless configured otherwise. The
+* finished jobs past their retention are purged once an hour. */
+func InitRunner(
+	jobRepository repositories.JobRepository,
+	enqueuer Enqueuer,
+	env *infrastructure.JobsEnv,
+	logger *slog.Logger,
+) Runner {
+	queues := maps.Clone(env.Queues)
+
+	if queues == nil {
+		queues = make(map[string]int)
+	}
+
+	for _, queue := range []string{DefaultQueue, MaintenanceQueue} {
+		if queues[queue] < 1 {
+			queues[queue] = 1
+		}
+	}
+
+	runner := &RunnerImpl{
+		JobRepository: jobRepository,
+		Enqueuer:      enqueuer,
+		Queues:        queues,
+		PollInterval:  env.PollInterval,
+		RetryDelay:    env.RetryDelay,
+		Lease:         env.Lease,
+		Retention:     env.Retention,
+		Logger:        logger,
+		handlers:      make(map[string]HandlerFunc),
+	}
+
+	runner.Register(PurgeJobType, runner.purge)
+	_ = runner.Schedule(PurgeJobType, "@hourly", PurgeJobType, nil, OnQueue(MaintenanceQueue))
+
+	return runner
+}
+
+func (runner *RunnerImpl) Register(jobType string, handler HandlerFunc) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	runner.handlers[jobType] = handler
+}
+
+func (runner *RunnerImpl) Schedule(name string, spec string, jobType string, payload any, options ...Option) error {
+	schedule, err := ParseSchedule(spec)
+
+	if err != nil {
+		return err
+	}
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	runner.recurring = append(runner.recurring, &recurringJob{
+		name:     name,
+		jobType:  jobType,
+		schedule: schedule,
+		payload:  payload,
+		options:  options,
+		next:     schedule.Next(time.Now()),
+	})
+
+	return nil
+}
+
+func (runner *RunnerImpl) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for queue, concurrency := range runner.Queues {
+		wg.Add(1)
+
+		go func(queue string, concurrency int) {
+			defer wg.Done()
+
+			runner.every(ctx, func() {
+				_, err := runner.workQueue(ctx, queue, concurrency)
+
+				if err != nil && !errors.Is(err, context.Canceled) {
+					runner.Logger.ErrorContext(ctx, "could not work the job queue", "queue", queue, "error", err)
+				}
+			})
+		}(queue, concurrency)
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		runner.every(ctx, func() {
+			err := runner.EnqueueScheduled(ctx, time.Now())
+
+			if err != nil && !errors.Is(err, context.Canceled) {
+				runner.Logger.ErrorContext(ctx, "could not queue recurring jobs", "error", err)
+			}
+		})
+	}()
+
+	wg.Wait()
+}
+
+// every calls fn every poll interval until ctx is done.
+func (runner *RunnerImpl) every(ctx context.Context, fn func()) {
+	ticker := time.NewTicker(runner.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (runner *RunnerImpl) Work(ctx context.Context) (int, error) {
+	queues := make([]string, 0, len(runner.Queues))
+
+	for queue := range runner.Queues {
+		queues = append(queues, queue)
+	}
+
+	sort.Strings(queues)
+
+	worked := 0
+
+	for _, queue := range queues {
+		count, err := runner.workQueue(ctx, queue, runner.Queues[queue])
+		worked += count
+
+		if err != nil {
+			return worked, err
+		}
+	}
+
+	return worked, nil
+}
+
+// workQueue claims the due jobs of a queue in batches of its concurrency and
+// runs every batch at once, until no due jobs are left.
+func (runner *RunnerImpl) workQueue(ctx context.Context, queue string, concurrency int) (int, error) {
+	worked := 0
+
+	for {
+		claimed, err := runner.JobRepository.ClaimDue(ctx, queue, time.Now(), runner.Lease, concurrency)
+
+		if err != nil {
+			return worked, err
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(claimed))
+
+		for i := range claimed {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				errs[i] = runner.run(ctx, &claimed[i])
+			}(i)
+		}
+
+		wg.Wait()
+		worked += len(claimed)
+
+		if err := errors.Join(errs...); err != nil {
+			return worked, err
+		}
+
+		if len(claimed) < concurrency {
+			return worked, nil
+		}
+	}
+}
+
+/* run calls the handler of a claimed job and records the outcome. A job which
+* fails is retried with an exponential backoff until it runs out of attempts,
+* unless the error is permanent. The error returned is that of recording the
+* outcome, the error of the job is kept with it. */
+func (runner *RunnerImpl) run(ctx context.Context, job *entities.Job) error {
+	ctx, span := tracer.Start(ctx, "Job "+job.Type)
+	defer span.End()
+
+	runner.mu.Lock()
+	handler, found := runner.handlers[job.Type]
+	runner.mu.Unlock()
+
+	var jobErr error
+
+	if found {
+		jobErr = runner.call(ctx, handler, job)
+	} else {
+		jobErr = Permanent(fmt.Errorf("no handler is registered for jobs of type %q", job.Type))
+	}
+
+	// The outcome is recorded even when the runner is being stopped.
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+
+	if jobErr == nil {
+		runner.Logger.DebugContext(ctx, "ran job", "job_id", job.ID, "type", job.Type, "queue", job.Queue)
+
+		return runner.JobRepository.MarkSucceeded(ctx, job.ID, now)
+	}
+
+	span.RecordError(jobErr)
+	span.SetStatus(codes.Error, jobErr.Error())
+
+	if isPermanent(jobErr) || job.Attempts >= job.MaxAttempts {
+		runner.Logger.ErrorContext(ctx, "job failed",
+			"job_id", job.ID, "type", job.Type, "queue", job.Queue, "attempts", job.Attempts, "error", jobErr)
+
+		return runner.JobRepository.MarkFailed(ctx, job.ID, now, jobErr.Error())
+	}
+
+	runner.Logger.WarnContext(ctx, "job will be retried",
+		"job_id", job.ID, "type", job.Type, "queue", job.Queue, "attempts", job.Attempts, "error", jobErr)
+
+	return runner.JobRepository.MarkRetry(ctx, job.ID, now.Add(retryDelay(runner.RetryDelay, job.Attempts)), jobErr.Error())
+}
+
+// call runs the handler with a deadline of the lease of the job, after which
+// another worker may pick it up, and turns a panic into an error.
+func (runner *RunnerImpl) call(ctx context.Context, handler HandlerFunc, job *entities.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, runner.Lease)
+	defer cancel()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+func (runner *RunnerImpl) EnqueueScheduled(ctx context.Context, now time.Time) error {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	var errs []error
+
+	for _, recurring := range runner.recurring {
+		if recurring.next.After(now) {
+			continue
+		}
+
+		// Every instance queues the same occurrence under the same key, so
+		// only one of them succeeds.
+		options := append([]Option{
+			RunAt(recurring.next),
+			Unique(fmt.Sprintf("recurring:%s:%d", recurring.name, recurring.next.Unix())),
+		}, recurring.options...)
+
+		_, err := runner.Enqueuer.Enqueue(ctx, recurring.jobType, recurring.payload, options...)
+
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			errs = append(errs, fmt.Errorf("%s: %w", recurring.name, err))
+			continue
+		}
+
+		// Occurrences missed while no instance was running are skipped.
+		recurring.next = recurring.schedule.Next(now)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (runner *RunnerImpl) purge(ctx context.Context, job *entities.Job) error {
+	purged, err := runner.JobRepository.DeleteFinishedBefore(ctx, time.Now().Add(-runner.Retention))
+
+	if purged > 0 {
+		runner.Logger.InfoContext(ctx, "purged finished jobs", "count", purged)
+	}
+
+	return err
+}
+
+// retryDelay doubles the delay with every failed attempt, up to
+// maxRetryDelay.
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
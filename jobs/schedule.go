@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a recurring job runs next.
+type Schedule interface {
+	// Next returns the first time the job runs after the given time.
+	Next(after time.Time) time.Time
+}
+
+/* ParseSchedule parses the schedule of a recurring job. It is either a five
+* field cron expression of minute, hour, day of month, month and day of week,
+* with *, lists, ranges and steps, one of @hourly, @daily, @weekly and
+* @monthly, or @every followed by a duration. Cron expressions are evaluated
+* in UTC, @every schedules run at multiples of the duration since the Unix
+* epoch, so every instance of the application agrees on the times. */
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if every, found := strings.CutPrefix(spec, "@every "); found {
+		interval, err := time.ParseDuration(strings.TrimSpace(every))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+
+		if interval < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least a second", spec)
+		}
+
+		return everySchedule(interval), nil
+	}
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(spec)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected five fields", spec)
+	}
+
+	schedule := &cronSchedule{}
+	bounds := []struct {
+		set *uint64
+		min int
+		max int
+	}{
+		{&schedule.minutes, 0, 59},
+		{&schedule.hours, 0, 23},
+		{&schedule.days, 1, 31},
+		{&schedule.months, 1, 12},
+		{&schedule.weekdays, 0, 7},
+	}
+
+	for i, field := range fields {
+		set, err := parseField(field, bounds[i].min, bounds[i].max)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+
+		*bounds[i].set = set
+	}
+
+	// Both 0 and 7 are Sunday.
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	schedule.anyDay = fields[2] == "*"
+	schedule.anyWeekday = fields[4] == "*"
+
+	return schedule, nil
+}
+
+type everySchedule time.Duration
+
+func (schedule everySchedule) Next(after time.Time) time.Time {
+	interval := time.Duration(schedule)
+
+	return after.Truncate(interval).Add(interval)
+}
+
+// cronSchedule holds the allowed values of every field as bit sets.
+type cronSchedule struct {
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	anyDay     bool
+	anyWeekday bool
+}
+
+func (schedule *cronSchedule) Next(after time.Time) time.Time {
+	next := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every schedule matches at least once in eight years, which covers
+	// the 29th of February.
+	limit := next.AddDate(8, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case schedule.months&(1<<uint(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !schedule.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+		case schedule.hours&(1<<uint(next.Hour())) == 0:
+			next = next.Truncate(time.Hour).Add(time.Hour)
+		case schedule.minutes&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchesDay follows cron in running on either the day of month or the day of
+// week when both are restricted.
+func (schedule *cronSchedule) matchesDay(t time.Time) bool {
+	day := schedule.days&(1<<uint(t.Day())) != 0
+	weekday := schedule.weekdays&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case schedule.anyDay && schedule.anyWeekday:
+		return true
+	case schedule.anyDay:
+		return weekday
+	case schedule.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a
+// bit set.
+func parseField(field string, min int, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+
+		if hasStep {
+			var err error
+
+			step, err = strconv.Atoi(stepValue)
+
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		first, last := min, max
+
+		if valueRange != "*" {
+			start, end, isRange := strings.Cut(valueRange, "-")
+
+			var err error
+
+			first, err = strconv.Atoi(start)
+
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+
+			last = first
+
+			if isRange {
+				last, err = strconv.Atoi(end)
+
+				if err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if hasStep {
+				last = max
+			}
+		}
+
+		if first < min || last > max || first > last {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+
+		for value := first; value <= last; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+
+	return set, nil
+}
@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 
-	"github.com/brunohradec/go-webstore/controllers"
+	"github.com/brunohradec/go-webstore/events"
 	"github.com/brunohradec/go-webstore/infrastructure"
-	"github.com/brunohradec/go-webstore/middleware"
+	"github.com/brunohradec/go-webstore/jobs"
+	"github.com/brunohradec/go-webstore/notifications"
 	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/router"
 	"github.com/brunohradec/go-webstore/services"
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
@@ -21,88 +23,127 @@ func main() {
 		os.Exit(1)
 	}
 
-	DB, err := infrastructure.ConnectToDB(
-		env.DB.Host,
-		env.DB.Port,
-		env.DB.Name,
-		env.DB.Username,
-		env.DB.Password,
-	)
+	logger, err := infrastructure.NewLogger(&env.Logging, os.Stdout)
+
+	if err != nil {
+		log.Fatal("Error initializing logger: ", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := infrastructure.InitTracing(context.Background(), &env.Tracing)
+
+	if err != nil {
+		log.Fatal("Error initializing tracing: ", err)
+		os.Exit(1)
+	}
+
+	defer shutdownTracing(context.Background())
+
+	DB, err := infrastructure.ConnectToDB(&env.DB)
 
 	if err != nil {
 		log.Fatal("Error connecting to the database")
 		os.Exit(1)
 	}
 
+	err = infrastructure.InstrumentDB(DB)
+
+	if err != nil {
+		log.Fatal("Error instrumenting the database connection: ", err)
+		os.Exit(1)
+	}
+
 	infrastructure.AutomigrateDB(DB)
 
-	userRepository := repositories.InitUserRepository(DB)
-	productRepository := repositories.InitProductRepository(DB)
-	commentRepository := repositories.InitCommentRepository(DB)
-
-	userService := services.InitUserService(userRepository)
-	productService := services.InitProductService(productRepository)
-	commentService := services.InitCommentService(commentRepository)
-	authService := services.InitAuthService(userRepository, env)
-
-	userController := controllers.InitUserController(userService)
-	productController := controllers.InitProductController(productService)
-	commentController := controllers.InitCommentController(commentService, userService)
-	authController := controllers.InitAuthController(authService, userService)
-
-	r := gin.Default()
-
-	authMiddleware := middleware.JwtAuthMiddleware(env)
-
-	api := r.Group("/api")
-	{
-		api.GET("/ping", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"message": "pong",
-			})
-		})
-
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authController.Register)
-			auth.POST("/login", authController.Login)
-
-			me := auth.Group("/me")
-			me.Use(authMiddleware)
-
-			me.GET("/", authController.Me)
-		}
-
-		users := api.Group("/users")
-		users.Use(authMiddleware)
-
-		{
-			users.GET("/:id", userController.FindByID)
-			users.PUT("/", userController.UpdateCurrent)
-		}
-
-		products := api.Group("/products")
-		products.Use(authMiddleware)
-
-		{
-			products.POST("/", productController.Save)
-			products.GET("/", productController.FindAll)
-			products.GET("/:id", productController.FindByID)
-			products.GET("/user/:userId", productController.FindByUserID)
-			products.PUT("/:id", productController.UpdateByID)
-			products.DELETE("/:id", productController.DeleteByID)
-		}
-
-		comments := api.Group("/comments")
-		comments.Use(authMiddleware)
-
-		{
-			comments.POST("/", commentController.Save)
-			comments.GET("/product/:productId", commentController.FindByProductID)
-			comments.PUT("/:id", commentController.UpdateByID)
-			comments.DELETE("/:id", commentController.DeleteByID)
-		}
+	blobStore, err := infrastructure.ConnectToBlobStore(context.Background(), &env.Media)
+
+	if err != nil {
+		log.Fatal("Error initializing media storage: ", err)
+		os.Exit(1)
 	}
 
+	appCache, err := infrastructure.ConnectToCache(context.Background(), &env.Cache)
+
+	if err != nil {
+		log.Fatal("Error connecting to the cache: ", err)
+		os.Exit(1)
+	}
+
+	repos := &router.Repositories{
+		User:    repositories.InitUserRepository(DB, logger),
+		Product: repositories.InitProductRepository(DB, logger),
+		Comment: repositories.InitCommentRepository(DB, logger),
+		Review:  repositories.InitReviewRepository(DB, logger),
+
+		ProductImage:   repositories.InitProductImageRepository(DB, logger),
+		IdempotencyKey: repositories.InitIdempotencyKeyRepository(DB, logger),
+		AuditEvent:     repositories.InitAuditEventRepository(DB, logger),
+		OutboxEvent:    repositories.InitOutboxEventRepository(DB, logger),
+		Webhook:        repositories.InitWebhookRepository(DB, logger),
+		Job:            repositories.InitJobRepository(DB, logger),
+		Transactor:     repositories.InitTransactor(DB),
+
+		Notification:            repositories.InitNotificationRepository(DB, logger),
+		NotificationPreferences: repositories.InitNotificationPreferencesRepository(DB, logger),
+	}
+
+	bus := events.InitBus()
+	outboxService := services.InitOutboxService(repos.OutboxEvent, bus, &env.Outbox, logger)
+	go services.RunOutboxDispatcher(context.Background(), outboxService, env.Outbox.PollInterval, logger)
+
+	webhookService := services.InitWebhookService(
+		repos.Webhook, repos.Product, infrastructure.NewWebhookClient(&env.Webhook), &env.Webhook, logger,
+	)
+	go services.RunWebhookDispatcher(context.Background(), webhookService, env.Webhook.PollInterval, logger)
+
+	jobRunner := jobs.InitRunner(repos.Job, jobs.InitEnqueuer(repos.Job, &env.Jobs, logger), &env.Jobs, logger)
+
+	err = services.ScheduleMaintenanceJobs(
+		jobRunner,
+		services.InitTrashService(
+			repos.Product,
+			repos.Comment,
+			repos.ProductImage,
+			repos.Transactor,
+			outboxService,
+			services.InitAuditService(repos.AuditEvent, logger),
+			blobStore,
+			env.Trash.Retention,
+			logger,
+		),
+		outboxService,
+		services.InitIdempotencyService(repos.IdempotencyKey, env.Idempotency.TTL, env.Idempotency.Lease, logger),
+		env.Trash.PurgeInterval,
+	)
+
+	if err != nil {
+		log.Fatal("Error scheduling maintenance jobs: ", err)
+		os.Exit(1)
+	}
+
+	mailer, err := infrastructure.ConnectToMailer(&env.Mail)
+
+	if err != nil {
+		log.Fatal("Error initializing the mailer: ", err)
+		os.Exit(1)
+	}
+
+	renderer, err := notifications.InitRenderer()
+
+	if err != nil {
+		log.Fatal("Error parsing email templates: ", err)
+		os.Exit(1)
+	}
+
+	services.RegisterEmailJobs(jobRunner, services.InitEmailService(
+		repos.User, repos.Product, repos.NotificationPreferences, renderer, mailer, env.Mail.From, logger,
+	))
+
+	go jobRunner.Run(context.Background())
+
+	r := router.New(env, logger, repos, blobStore, appCache, bus)
+
 	r.Run(":" + env.Port)
 }
@@ -1,10 +1,11 @@
 package middleware
 
 import (
-	"net/http"
+	"log/slog"
 
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,9 +15,7 @@ func JwtAuthMiddleware(env *infrastructure.Env) gin.HandlerFunc {
 		token, err := authutils.ExtractTokenFromRequest(c)
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"message": "Could not extract token from request header or query",
-			})
+			_ = c.Error(services.ErrInvalidToken.Wrap(err))
 			c.Abort()
 
 			return
@@ -25,9 +24,7 @@ func JwtAuthMiddleware(env *infrastructure.Env) gin.HandlerFunc {
 		err = authutils.ValidateToken(token, secret)
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"message": "Provided JSON web token is not valid",
-			})
+			_ = c.Error(services.ErrInvalidToken.Wrap(err))
 			c.Abort()
 
 			return
@@ -36,9 +33,7 @@ func JwtAuthMiddleware(env *infrastructure.Env) gin.HandlerFunc {
 		principalID, err := authutils.ExtractUserIDFromToken(token, secret)
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"message": "Provided JSON web token is not valid",
-			})
+			_ = c.Error(services.ErrInvalidToken.Wrap(err))
 			c.Abort()
 
 			return
@@ -47,6 +42,16 @@ func JwtAuthMiddleware(env *infrastructure.Env) gin.HandlerFunc {
 		c.Set("request-token", token)
 		c.Set("request-principal-id", principalID)
 
+		ctx := infrastructure.ContextWithLogAttrs(
+			c.Request.Context(),
+			slog.Any("principal_id", principalID),
+		)
+
+		actor := services.ActorFromContext(ctx)
+		actor.PrincipalID = principalID
+		ctx = services.ContextWithActor(ctx, actor)
+		c.Request = c.Request.WithContext(ctx)
+
 		c.Next()
 	}
 }
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const ProblemContentType = "application/problem+json"
+
+const (
+	ProblemCodeValidation    = "validation_failed"
+	ProblemCodeMalformedBody = "malformed_body"
+	ProblemCodeInternal      = "internal_error"
+)
+
+const (
+	problemTypePrefix         = "/problems/"
+	problemDetailInternal     = "An unexpected error occurred while handling the request"
+	problemDetailMalformed    = "Request body could not be parsed as JSON"
+	problemDetailInvalidInput = "Request body failed validation"
+)
+
+var registerJSONFieldNames sync.Once
+
+/* ErrorMiddleware converts the last error attached to the gin context with
+* c.Error into an RFC 7807 problem details response. Service errors are mapped
+* by their kind, binding errors produce field level validation details and any
+* other error is reported as an internal server error without leaking its
+* message to the client. */
+func ErrorMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	registerJSONFieldNames.Do(useJSONFieldNames)
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		lastErr := c.Errors.Last()
+
+		if lastErr == nil || c.Writer.Written() {
+			return
+		}
+
+		problem := problemFromError(lastErr)
+
+		if problem.Status >= http.StatusInternalServerError {
+			logger.ErrorContext(c.Request.Context(), "internal error", "error", lastErr.Err)
+		}
+
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = c.GetString("request-id")
+
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
+
+func problemFromError(ginErr *gin.Error) *dtos.ProblemDTO {
+	var serviceErr *services.Error
+	var validationErrs validator.ValidationErrors
+
+	switch {
+	case errors.As(ginErr.Err, &serviceErr):
+		return newProblem(statusForKind(serviceErr.Kind), serviceErr.Code, serviceErr.Message)
+	case errors.As(ginErr.Err, &validationErrs):
+		problem := newProblem(http.StatusBadRequest, ProblemCodeValidation, problemDetailInvalidInput)
+		problem.Errors = make([]*dtos.FieldErrorDTO, len(validationErrs))
+
+		for i, fieldErr := range validationErrs {
+			problem.Errors[i] = fieldErrorToDTO(fieldErr)
+		}
+
+		return problem
+	case ginErr.IsType(gin.ErrorTypeBind):
+		return newProblem(http.StatusBadRequest, ProblemCodeMalformedBody, malformedBodyDetail(ginErr.Err))
+	default:
+		return newProblem(http.StatusInternalServerError, ProblemCodeInternal, problemDetailInternal)
+	}
+}
+
+func newProblem(status int, code string, detail string) *dtos.ProblemDTO {
+	return &dtos.ProblemDTO{
+		Type:   problemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func statusForKind(kind services.ErrorKind) int {
+	switch kind {
+	case services.ErrorKindInvalid:
+		return http.StatusBadRequest
+	case services.ErrorKindUnauthorized:
+		return http.StatusUnauthorized
+	case services.ErrorKindForbidden:
+		return http.StatusForbidden
+	case services.ErrorKindNotFound:
+		return http.StatusNotFound
+	case services.ErrorKindConflict:
+		return http.StatusConflict
+	case services.ErrorKindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case services.ErrorKindUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case services.ErrorKindNotImplemented:
+		return http.StatusNotImplemented
+	case services.ErrorKindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case services.ErrorKindPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case services.ErrorKindUnprocessable:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func malformedBodyDetail(err error) string {
+	var typeErr *json.UnmarshalTypeError
+
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("Field %q must be of type %s", typeErr.Field, typeErr.Type)
+	}
+
+	return problemDetailMalformed
+}
+
+func fieldErrorToDTO(fieldErr validator.FieldError) *dtos.FieldErrorDTO {
+	var message string
+
+	switch fieldErr.Tag() {
+	case "required":
+		message = "Field is required"
+	case "min", "gte":
+		message = fmt.Sprintf("Value must be at least %s", fieldErr.Param())
+	case "max", "lte":
+		message = fmt.Sprintf("Value must be at most %s", fieldErr.Param())
+	case "oneof":
+		message = fmt.Sprintf("Value must be one of: %s", fieldErr.Param())
+	case "email":
+		message = "Value must be a valid email address"
+	default:
+		message = fmt.Sprintf("Value failed the %q constraint", fieldErr.Tag())
+	}
+
+	return &dtos.FieldErrorDTO{
+		Field:   fieldErr.Field(),
+		Code:    fieldErr.Tag(),
+		Message: message,
+	}
+}
+
+// useJSONFieldNames makes validation errors report JSON field names instead
+// of Go struct field names.
+func useJSONFieldNames() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+
+	if !ok {
+		return
+	}
+
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "" || name == "-" {
+			return field.Name
+		}
+
+		return name
+	})
+}
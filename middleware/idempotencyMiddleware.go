@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+/* IdempotencyMiddleware makes requests sent with an Idempotency-Key header
+* safe to retry. The first request with a key is handled as usual and its
+* response is stored, retries with the same key and body are answered with
+* the stored response, while reusing the key for another request fails with
+* 422 and retrying while the first request is still being handled fails with
+* 409, until the lease of the first request runs out and the retry takes its
+* key over. Failed requests whose response is an error are not stored, so they
+* can be retried. It must run after JwtAuthMiddleware, as keys are per user. */
+func IdempotencyMiddleware(idempotencyService services.IdempotencyService, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			_ = c.Error(services.ErrInvalidIdempotencyKey)
+			c.Abort()
+
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+
+		if err != nil {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+			c.Abort()
+
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, replay, err := idempotencyService.Begin(
+			c.Request.Context(),
+			authutils.GetPrincipalIDFromRequest(c),
+			key,
+			requestFingerprint(c.Request, body),
+		)
+
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+
+			return
+		}
+
+		if replay {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(record.StatusCode, record.ContentType, record.Body)
+			c.Abort()
+
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		// The outcome is stored even when the client has gone away.
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		if recorder.Written() && recorder.Status() < http.StatusInternalServerError && len(c.Errors) == 0 {
+			err = idempotencyService.Complete(ctx, record, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		} else {
+			err = idempotencyService.Release(ctx, record)
+		}
+
+		if err != nil {
+			logger.ErrorContext(ctx, "could not store outcome of idempotent request", "error", err)
+		}
+	}
+}
+
+// requestFingerprint identifies a request by its method, path and body.
+func requestFingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteString(data string) (int, error) {
+	recorder.body.WriteString(data)
+	return recorder.ResponseWriter.WriteString(data)
+}
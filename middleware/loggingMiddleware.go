@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLoggingMiddleware writes one log record per handled request. The
+// record level follows the response status so that failed requests stand
+// out without raising the global log level.
+func RequestLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		/* The context is captured before the handlers run, as handlers further
+		* down the chain may attach fields such as the principal ID which are
+		* added explicitly below. */
+		ctx := c.Request.Context()
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+
+		if principalID, found := c.Get("request-principal-id"); found {
+			attrs = append(attrs, slog.Any("principal_id", principalID))
+		}
+
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(ctx, level, "handled request", attrs...)
+	}
+}
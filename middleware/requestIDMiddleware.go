@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware reuses the request ID sent by the client, or generates
+// a new one, echoes it in the response and attaches it to the request context
+// so that every log line and audit event written while handling the request
+// carries it.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+
+		if !isValidRequestID(requestID) {
+			requestID = generateRequestID()
+		}
+
+		c.Set("request-id", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := infrastructure.ContextWithLogAttrs(
+			c.Request.Context(),
+			slog.String("request_id", requestID),
+		)
+		ctx = services.ContextWithActor(ctx, services.Actor{
+			RequestID: requestID,
+			IP:        c.ClientIP(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range requestID {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateRequestID() string {
+	bytes := make([]byte, 16)
+
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(bytes)
+
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/brunohradec/go-webstore/authutils"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/gin-gonic/gin"
+)
+
+/* RoleMiddleware returns a middleware factory which only lets logged in users
+* with the given role through. The role is looked up on every request, so
+* role changes take effect immediately. It must run after JwtAuthMiddleware. */
+func RoleMiddleware(userService services.UserService) func(role entities.Role) gin.HandlerFunc {
+	return func(role entities.Role) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			user, err := userService.FindByID(c.Request.Context(), authutils.GetPrincipalIDFromRequest(c))
+
+			if err != nil {
+				_ = c.Error(err)
+				c.Abort()
+
+				return
+			}
+
+			if !user.HasRole(role) {
+				_ = c.Error(services.ErrRoleRequired)
+				c.Abort()
+
+				return
+			}
+
+			c.Next()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package notifications
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// FileMailer writes every message to a .eml file in a directory, where it can
+// be opened with an email client, instead of sending it.
+type FileMailer struct {
+	Dir string
+}
+
+func InitFileMailer(dir string) (Mailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		Dir: dir,
+	}, nil
+}
+
+func (mailer *FileMailer) Send(ctx context.Context, message *Message) error {
+	now := time.Now()
+
+	_, _, body, err := message.encode(now)
+
+	if err != nil {
+		return err
+	}
+
+	// The files sort in the order the messages were sent.
+	file, err := os.CreateTemp(mailer.Dir, now.UTC().Format("20060102-150405.000000")+"-*.eml")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(body)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,65 @@
+package notifications
+
+import "sync"
+
+/* Hub wakes up the open notification streams of a user when a notification is
+* created for them. It only carries the wake up, the streams read the new
+* notifications from the database. The hub is private to the process, so
+* streams on other instances of the application only notice a notification
+* the next time they check on their own. */
+type Hub interface {
+	// Subscribe returns a channel receiving a value whenever notifications
+	// are created for the user, and a function ending the subscription.
+	// Wake ups which arrive while the previous one is still unread are
+	// merged into it.
+	Subscribe(userID uint) (<-chan struct{}, func())
+	// Publish wakes up the subscribers of the user.
+	Publish(userID uint)
+}
+
+type HubImpl struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[chan struct{}]bool
+}
+
+func InitHub() Hub {
+	return &HubImpl{
+		subscribers: make(map[uint]map[chan struct{}]bool),
+	}
+}
+
+func (hub *HubImpl) Subscribe(userID uint) (<-chan struct{}, func()) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	wake := make(chan struct{}, 1)
+
+	if hub.subscribers[userID] == nil {
+		hub.subscribers[userID] = make(map[chan struct{}]bool)
+	}
+
+	hub.subscribers[userID][wake] = true
+
+	return wake, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+
+		delete(hub.subscribers[userID], wake)
+
+		if len(hub.subscribers[userID]) == 0 {
+			delete(hub.subscribers, userID)
+		}
+	}
+}
+
+func (hub *HubImpl) Publish(userID uint) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for wake := range hub.subscribers[userID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Package notifications sends the emails of the application. Emails are
+rendered from localized templates, with an HTML and a plain text version, and
+sent through a Mailer: SMTPMailer delivers them to an SMTP server, FileMailer
+writes them to a directory for development and MemoryMailer keeps them for
+tests.
+*/
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"time"
+)
+
+// Message is an email with an HTML and a plain text body. From and To are
+// addresses as in RFC 5322, optionally with a name.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+/* encode returns the addresses of the sender and the recipient of the message
+* and the message itself as a multipart/alternative MIME message. The
+* addresses are parsed, so that they can not smuggle in headers. */
+func (message *Message) encode(date time.Time) (string, string, []byte, error) {
+	from, err := mail.ParseAddress(message.From)
+
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid sender %q: %w", message.From, err)
+	}
+
+	to, err := mail.ParseAddress(message.To)
+
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+
+	var header, body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	fmt.Fprintf(&header, "From: %s\r\n", from)
+	fmt.Fprintf(&header, "To: %s\r\n", to)
+	fmt.Fprintf(&header, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&header, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&header, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&header, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+
+	// Clients show the last part they can display, so the HTML one goes
+	// last.
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return "", "", nil, err
+		}
+
+		if err := encoder.Close(); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return "", "", nil, err
+	}
+
+	return from.Address, to.Address, append(header.Bytes(), body.Bytes()...), nil
+}
@@ -0,0 +1,42 @@
+package notifications
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryMailer keeps the messages it is given, for tests to inspect.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func InitMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send checks that the message can be encoded, as the other mailers do, and
+// keeps a copy of it.
+func (mailer *MemoryMailer) Send(ctx context.Context, message *Message) error {
+	_, _, _, err := message.encode(time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	mailer.messages = append(mailer.messages, *message)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (mailer *MemoryMailer) Messages() []Message {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	return append([]Message(nil), mailer.messages...)
+}
@@ -0,0 +1,175 @@
+package notifications
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	renderer, err := InitRenderer()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &CommentPostedData{Username: "alice", Author: "bob", ProductName: "Lamp", Content: "<script>alert(1)</script>"}
+
+	for _, locale := range Locales {
+		message, err := renderer.Render(TemplateCommentPosted, locale, data)
+
+		if err != nil {
+			t.Fatalf("%s: %v", locale, err)
+		}
+
+		if !strings.Contains(message.Subject, "Lamp") || strings.Contains(message.Subject, "\n") {
+			t.Errorf("%s: expected a single line subject naming the product, got %q", locale, message.Subject)
+		}
+
+		if !strings.Contains(message.Text, "<script>alert(1)</script>") {
+			t.Errorf("%s: expected the comment as is in the text body, got %q", locale, message.Text)
+		}
+
+		if strings.Contains(message.HTML, "<script>") || !strings.Contains(message.HTML, "&lt;script&gt;") {
+			t.Errorf("%s: expected the comment to be escaped in the HTML body, got %q", locale, message.HTML)
+		}
+	}
+
+	message, err := renderer.Render(TemplateWelcome, "fr", &WelcomeData{Username: "alice"})
+
+	if err != nil || message.Subject != "Welcome to go-webstore, alice!" {
+		t.Errorf("expected unknown locales to fall back to English, got %+v, %v", message, err)
+	}
+
+	if _, err := renderer.Render("order_shipped", "en", nil); err == nil {
+		t.Error("expected an unknown template to be rejected")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := InitFileMailer(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mailer.Send(context.Background(), &Message{
+		From:    "go-webstore <no-reply@example.com>",
+		To:      "alice@example.com",
+		Subject: "Dobro došli",
+		Text:    "Pozdrav alice",
+		HTML:    "<p>Pozdrav alice</p>",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+
+	if len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v", files)
+	}
+
+	file, err := os.Open(files[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	parsed, err := mail.ReadMessage(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+
+	if parsed.Header.Get("To") != "<alice@example.com>" || subject != "Dobro došli" {
+		t.Errorf("expected the headers of the message, got %v", parsed.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative message, got %q, %v", mediaType, err)
+	}
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+
+	for {
+		part, err := parts.NextPart()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+": "+string(body))
+	}
+
+	if len(bodies) != 2 || bodies[0] != "text/plain; charset=utf-8: Pozdrav alice" || bodies[1] != "text/html; charset=utf-8: <p>Pozdrav alice</p>" {
+		t.Errorf("expected the text and the HTML part, got %q", bodies)
+	}
+}
+
+func TestMessageHeadersCanNotBeInjected(t *testing.T) {
+	mailer := InitMemoryMailer()
+
+	err := mailer.Send(context.Background(), &Message{
+		From: "no-reply@example.com",
+		To:   "alice@example.com\r\nBcc: everyone@example.com",
+	})
+
+	if err == nil || len(mailer.Messages()) != 0 {
+		t.Errorf("expected a recipient with a line break to be rejected, got %v", err)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := InitHub()
+
+	alice, unsubscribe := hub.Subscribe(1)
+	bob, _ := hub.Subscribe(2)
+
+	// Wake ups arriving before the stream reads them are merged.
+	hub.Publish(1)
+	hub.Publish(1)
+
+	select {
+	case <-alice:
+	default:
+		t.Fatal("expected alice to be woken up")
+	}
+
+	select {
+	case <-alice:
+		t.Error("expected the two wake ups to be merged")
+	case <-bob:
+		t.Error("expected bob not to be woken up")
+	default:
+	}
+
+	unsubscribe()
+	hub.Publish(1)
+
+	select {
+	case <-alice:
+		t.Error("expected no wake up after unsubscribing")
+	default:
+	}
+}
@@ -0,0 +1,107 @@
+package notifications
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+type SMTPMailer struct {
+	Config *SMTPConfig
+}
+
+func InitSMTPMailer(config *SMTPConfig) Mailer {
+	return &SMTPMailer{
+		Config: config,
+	}
+}
+
+/* Send opens a connection to the server for every message, upgrading it with
+* STARTTLS when the server offers it. Credentials are only sent over TLS or to
+* localhost. The connection is abandoned when ctx is done. */
+func (mailer *SMTPMailer) Send(ctx context.Context, message *Message) error {
+	from, to, body, err := message.encode(time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(mailer.Config.Host, strconv.Itoa(mailer.Config.Port)))
+
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, mailer.Config.Host)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: mailer.Config.Host})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if mailer.Config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", mailer.Config.Username, mailer.Config.Password, mailer.Config.Host))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from)
+
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to)
+
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(body)
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template names an email. Each is translated to every locale in Locales.
+type Template string
+
+const (
+	TemplateWelcome       Template = "welcome"
+	TemplateCommentPosted Template = "comment_posted"
+)
+
+// Locales are the languages the emails are written in. Other locales fall
+// back to the first one.
+var Locales = []string{"en", "hr"}
+
+var templates = []Template{TemplateWelcome, TemplateCommentPosted}
+
+//go:embed templates
+var templateFS embed.FS
+
+// WelcomeData is rendered by TemplateWelcome.
+type WelcomeData struct {
+	Username string
+}
+
+// CommentPostedData is rendered by TemplateCommentPosted.
+type CommentPostedData struct {
+	Username    string
+	Author      string
+	ProductName string
+	Content     string
+}
+
+type localizedTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type Renderer interface {
+	// Render returns the subject and the bodies of an email in the given
+	// locale. The sender and the recipient are left to the caller.
+	Render(name Template, locale string, data any) (*Message, error)
+}
+
+type RendererImpl struct {
+	templates map[string]map[Template]*localizedTemplate
+}
+
+/* InitRenderer parses the templates of every locale. Each email consists of
+* templates/<locale>/<name>.txt, defining the "subject" and the plain text
+* "body", and templates/<locale>/<name>.html, defining the "content" of the
+* HTML layout in templates/layout.html. */
+func InitRenderer() (Renderer, error) {
+	renderer := &RendererImpl{
+		templates: make(map[string]map[Template]*localizedTemplate),
+	}
+
+	for _, locale := range Locales {
+		renderer.templates[locale] = make(map[Template]*localizedTemplate)
+
+		for _, name := range templates {
+			base := fmt.Sprintf("templates/%s/%s", locale, name)
+
+			text, err := texttemplate.ParseFS(templateFS, base+".txt")
+
+			if err != nil {
+				return nil, err
+			}
+
+			html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", base+".html")
+
+			if err != nil {
+				return nil, err
+			}
+
+			renderer.templates[locale][name] = &localizedTemplate{text: text, html: html}
+		}
+	}
+
+	return renderer, nil
+}
+
+func (renderer *RendererImpl) Render(name Template, locale string, data any) (*Message, error) {
+	localized, found := renderer.templates[locale]
+
+	if !found {
+		localized = renderer.templates[Locales[0]]
+	}
+
+	template, found := localized[name]
+
+	if !found {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	err := template.text.ExecuteTemplate(&subject, "subject", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = template.text.ExecuteTemplate(&text, "body", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = template.html.ExecuteTemplate(&html, "layout.html", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,347 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const Version = "3.1.0"
+
+const MergePatchContentType = "application/merge-patch+json"
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// PathItem maps lower case HTTP methods to operations.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+/* Operation describes a single route of the API. Request and response bodies
+* are given as values of the DTO types which are reflected into JSON schemas;
+* a nil response body documents a response without content. */
+type Operation struct {
+	Method  string
+	Path    string
+	ID      string
+	Summary string
+	Tags    []string
+	Secured bool
+	Paged   bool
+	// Sorts lists the accepted values of the sort query parameter.
+	Sorts []string
+	// Query is a struct whose form tagged fields are documented as query
+	// parameters.
+	Query any
+	// Conditional operations accept If-None-Match and If-Modified-Since,
+	// while operations requiring a match must be sent with If-Match.
+	Conditional   bool
+	RequiresMatch bool
+	// Idempotent operations accept an Idempotency-Key header, which makes
+	// them safe to retry.
+	Idempotent bool
+	// MergePatch operations take an RFC 7396 merge patch of RequestBody, in
+	// which every member is optional.
+	MergePatch  bool
+	RequestBody any
+	Responses   map[int]any
+	// RequestContentType and ResponseContentType default to
+	// application/json.
+	RequestContentType  string
+	ResponseContentType string
+	// Undocumented operations are checked against the route table but left
+	// out of the generated document.
+	Undocumented bool
+}
+
+type Options struct {
+	Info Info
+	// ErrorBody is documented as the default response of every operation.
+	ErrorBody        any
+	ErrorContentType string
+}
+
+var pathParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+const bearerSchemeName = "bearerAuth"
+
+/* Generate builds the OpenAPI document for the given routes. It fails when a
+* route has no matching operation or an operation has no matching route, so
+* that the document can not silently drift apart from the router. */
+func Generate(routes gin.RoutesInfo, operations []Operation, options Options) (*Document, error) {
+	registered := make(map[string]bool, len(routes))
+
+	for _, route := range routes {
+		registered[routeKey(route.Method, route.Path)] = true
+	}
+
+	described := make(map[string]bool, len(operations))
+	var missing []string
+
+	for _, operation := range operations {
+		key := routeKey(operation.Method, operation.Path)
+		described[key] = true
+
+		if !registered[key] {
+			missing = append(missing, "no route for operation "+key)
+		}
+	}
+
+	for key := range registered {
+		if !described[key] {
+			missing = append(missing, "no operation for route "+key)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("routes and operations differ: %s", strings.Join(missing, "; "))
+	}
+
+	generator := newSchemaGenerator()
+
+	document := &Document{
+		OpenAPI: Version,
+		Info:    options.Info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerSchemeName: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+			},
+		},
+	}
+
+	var errorSchema *Schema
+
+	if options.ErrorBody != nil {
+		errorSchema = generator.schemaFor(reflect.TypeOf(options.ErrorBody))
+	}
+
+	for _, operation := range operations {
+		if operation.Undocumented {
+			continue
+		}
+
+		path := pathParamPattern.ReplaceAllString(operation.Path, "{$1}")
+
+		item, found := document.Paths[path]
+
+		if !found {
+			item = make(PathItem)
+			document.Paths[path] = item
+		}
+
+		item[strings.ToLower(operation.Method)] = buildOperation(
+			generator,
+			&operation,
+			errorSchema,
+			options.ErrorContentType,
+		)
+	}
+
+	document.Components.Schemas = generator.schemas
+
+	return document, nil
+}
+
+func buildOperation(
+	generator *schemaGenerator,
+	operation *Operation,
+	errorSchema *Schema,
+	errorContentType string) *OperationObject {
+
+	object := &OperationObject{
+		OperationID: operation.ID,
+		Summary:     operation.Summary,
+		Tags:        operation.Tags,
+		Responses:   make(map[string]*Response),
+		Security:    []map[string][]string{},
+	}
+
+	if operation.Secured {
+		object.Security = []map[string][]string{{bearerSchemeName: {}}}
+	}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(operation.Path, -1) {
+		object.Parameters = append(object.Parameters, &Parameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   pathParamSchema(match[1]),
+		})
+	}
+
+	if operation.Paged {
+		object.Parameters = append(object.Parameters,
+			&Parameter{Name: "page", In: "query", Schema: &Schema{Type: "integer", Minimum: float64Ptr(1)}},
+			&Parameter{Name: "pageSize", In: "query", Schema: &Schema{Type: "integer", Minimum: float64Ptr(1)}},
+		)
+	}
+
+	if len(operation.Sorts) > 0 {
+		enum := make([]any, len(operation.Sorts))
+
+		for i, sort := range operation.Sorts {
+			enum[i] = sort
+		}
+
+		object.Parameters = append(object.Parameters,
+			&Parameter{Name: "sort", In: "query", Schema: &Schema{Type: "string", Enum: enum}},
+		)
+	}
+
+	if operation.Query != nil {
+		object.Parameters = append(object.Parameters, generator.queryParameters(reflect.TypeOf(operation.Query))...)
+	}
+
+	if operation.Conditional {
+		object.Parameters = append(object.Parameters,
+			&Parameter{Name: "If-None-Match", In: "header", Schema: &Schema{Type: "string"}},
+			&Parameter{Name: "If-Modified-Since", In: "header", Schema: &Schema{Type: "string"}},
+		)
+	}
+
+	if operation.RequiresMatch {
+		object.Parameters = append(object.Parameters,
+			&Parameter{Name: "If-Match", In: "header", Required: true, Schema: &Schema{Type: "string"}},
+		)
+	}
+
+	if operation.Idempotent {
+		object.Parameters = append(object.Parameters,
+			&Parameter{Name: "Idempotency-Key", In: "header", Schema: &Schema{Type: "string"}},
+		)
+	}
+
+	if operation.RequestBody != nil && operation.MergePatch {
+		object.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				MergePatchContentType: {
+					Schema: generator.patchSchemaFor(reflect.TypeOf(operation.RequestBody)),
+				},
+			},
+		}
+	} else if operation.RequestBody != nil {
+		object.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				contentTypeOrJSON(operation.RequestContentType): {
+					Schema: generator.schemaFor(reflect.TypeOf(operation.RequestBody)),
+				},
+			},
+		}
+	}
+
+	for status, body := range operation.Responses {
+		response := &Response{Description: http.StatusText(status)}
+
+		if body != nil {
+			response.Content = map[string]*MediaType{
+				contentTypeOrJSON(operation.ResponseContentType): {
+					Schema: generator.schemaFor(reflect.TypeOf(body)),
+				},
+			}
+		}
+
+		object.Responses[fmt.Sprint(status)] = response
+	}
+
+	if errorSchema != nil {
+		object.Responses["default"] = &Response{
+			Description: "Error",
+			Content: map[string]*MediaType{
+				errorContentType: {Schema: errorSchema},
+			},
+		}
+	}
+
+	return object
+}
+
+// pathParamSchema documents ID parameters as integers and everything else,
+// such as wildcard keys, as strings.
+func pathParamSchema(name string) *Schema {
+	if strings.HasSuffix(strings.ToLower(name), "id") {
+		return &Schema{Type: "integer", Minimum: float64Ptr(0)}
+	}
+
+	return &Schema{Type: "string"}
+}
+
+func contentTypeOrJSON(contentType string) string {
+	if contentType == "" {
+		return "application/json"
+	}
+
+	return contentType
+}
+
+func routeKey(method string, path string) string {
+	return method + " " + path
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
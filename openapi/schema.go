@@ -0,0 +1,330 @@
+package openapi
+
+import (
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used to describe the API DTOs.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Binary documents a raw binary body, such as a downloaded file.
+type Binary []byte
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+	binaryType     = reflect.TypeOf(Binary{})
+)
+
+type schemaGenerator struct {
+	schemas map[string]*Schema
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		schemas: make(map[string]*Schema),
+	}
+}
+
+/* schemaFor returns the schema of the given type. Named struct types are
+* added to the component schemas once and referenced from everywhere else. */
+func (generator *schemaGenerator) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == fileHeaderType || t == binaryType:
+		return &Schema{Type: "string", Format: "binary"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := t.Name()
+
+		if _, found := generator.schemas[name]; !found {
+			// Registered before the properties are generated so that
+			// recursive types terminate.
+			generator.schemas[name] = &Schema{}
+			*generator.schemas[name] = *generator.structSchema(t)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.Struct:
+		return generator.structSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float64Ptr(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: generator.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generator.schemaFor(t.Elem())}
+	default:
+		return &Schema{}
+	}
+}
+
+// patchSchemaFor returns the schema of a merge patch of the given named struct
+// type, which is its schema without required members.
+func (generator *schemaGenerator) patchSchemaFor(t reflect.Type) *Schema {
+	t = derefType(t)
+	name := t.Name() + "Patch"
+
+	if _, found := generator.schemas[name]; !found {
+		generator.schemaFor(t)
+
+		patch := *generator.schemas[t.Name()]
+		patch.Required = nil
+		generator.schemas[name] = &patch
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (generator *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omit := jsonFieldName(field)
+
+		if omit {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := generator.structSchema(derefType(field.Type))
+
+			for key, value := range embedded.Properties {
+				schema.Properties[key] = value
+			}
+
+			schema.Required = append(schema.Required, embedded.Required...)
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := generator.schemaFor(field.Type)
+
+		required := applyBindingConstraints(fieldSchema, field.Tag.Get("binding"))
+
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = fieldSchema
+	}
+
+	return schema
+}
+
+// queryParameters documents the form tagged fields of a struct as query
+// parameters.
+func (generator *schemaGenerator) queryParameters(t reflect.Type) []*Parameter {
+	t = derefType(t)
+
+	var parameters []*Parameter
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		schema := generator.schemaFor(field.Type)
+		required := applyBindingConstraints(schema, field.Tag.Get("binding"))
+
+		parameters = append(parameters, &Parameter{
+			Name:     name,
+			In:       "query",
+			Required: required,
+			Schema:   schema,
+		})
+	}
+
+	return parameters
+}
+
+// jsonFieldName returns the name of the field in a JSON body, falling back to
+// the form tag for fields of multipart bodies.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag, found := field.Tag.Lookup("json")
+
+	if !found {
+		tag = field.Tag.Get("form")
+	}
+
+	if tag == "-" {
+		return "", true
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+
+	return name, false
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+/* applyBindingConstraints translates the validator rules of a binding tag to
+* JSON schema keywords and reports whether the field is required. Rules after
+* dive apply to the items of an array. Rules which have no schema equivalent
+* are ignored. */
+func applyBindingConstraints(schema *Schema, tag string) bool {
+	if tag == "" || schema.Ref != "" {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+
+	required := false
+
+	rules := strings.Split(tag, ",")
+
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "dive":
+			if schema.Items != nil {
+				applyBindingConstraints(schema.Items, strings.Join(rules[i+1:], ","))
+			}
+
+			return required
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "url", "uri", "http_url":
+			schema.Format = "uri"
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, enumValue(schema, value))
+			}
+		case "min", "gte":
+			applyLowerBound(schema, param, false)
+		case "gt":
+			applyLowerBound(schema, param, true)
+		case "max", "lte":
+			applyUpperBound(schema, param, false)
+		case "lt":
+			applyUpperBound(schema, param, true)
+		case "len":
+			applyLowerBound(schema, param, false)
+			applyUpperBound(schema, param, false)
+		}
+	}
+
+	return required
+}
+
+func applyLowerBound(schema *Schema, param string, exclusive bool) {
+	value, err := strconv.ParseFloat(param, 64)
+
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		length := int(value)
+		schema.MinLength = &length
+	case "array":
+		length := int(value)
+		schema.MinItems = &length
+	case "integer", "number":
+		if exclusive {
+			schema.ExclusiveMinimum = &value
+		} else {
+			schema.Minimum = &value
+		}
+	}
+}
+
+func applyUpperBound(schema *Schema, param string, exclusive bool) {
+	value, err := strconv.ParseFloat(param, 64)
+
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		length := int(value)
+		schema.MaxLength = &length
+	case "array":
+		length := int(value)
+		schema.MaxItems = &length
+	case "integer", "number":
+		if exclusive {
+			schema.ExclusiveMaximum = &value
+		} else {
+			schema.Maximum = &value
+		}
+	}
+}
+
+func enumValue(schema *Schema, value string) any {
+	if schema.Type == "integer" || schema.Type == "number" {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	}
+
+	return value
+}
@@ -1,7 +1,7 @@
 package paging
 
 import (
-	"log"
+	"log/slog"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -11,27 +11,41 @@ import (
 var DefaultPageSize = 10
 var MaxPageSize = 100
 
+// Sort selects the order of a listing. The zero value orders by ID.
+type Sort string
+
+const (
+	SortDefault Sort = ""
+	SortRating  Sort = "rating"
+)
+
 type Page struct {
 	Page     int
 	PageSize int
 }
 
-func Paginate(page Page) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		if page.Page <= 0 {
-			page.Page = 1
-		}
+// OffsetLimit returns the row offset and limit for the page, clamping the
+// page index and page size to their allowed ranges.
+func (page Page) OffsetLimit() (int, int) {
+	if page.Page <= 0 {
+		page.Page = 1
+	}
 
-		switch {
-		case page.PageSize > MaxPageSize:
-			page.PageSize = MaxPageSize
-		case page.PageSize <= 0:
-			page.PageSize = DefaultPageSize
-		}
+	switch {
+	case page.PageSize > MaxPageSize:
+		page.PageSize = MaxPageSize
+	case page.PageSize <= 0:
+		page.PageSize = DefaultPageSize
+	}
 
-		offset := (page.Page - 1) * page.PageSize
+	return (page.Page - 1) * page.PageSize, page.PageSize
+}
 
-		return db.Offset(offset).Limit(page.PageSize)
+func Paginate(page Page) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		offset, limit := page.OffsetLimit()
+
+		return db.Offset(offset).Limit(limit)
 	}
 }
 
@@ -39,16 +53,17 @@ func ParsePageFromQuery(c *gin.Context) Page {
 	page, err := strconv.Atoi(c.Query("page"))
 
 	if err != nil {
-		log.Printf("Page index could not be parsed from query string. Defaulting to 0")
+		slog.DebugContext(c.Request.Context(), "page index could not be parsed from query string, defaulting to 0")
 		page = 0
 	}
 
-	pageSize, err := strconv.Atoi(c.Query("page"))
+	pageSize, err := strconv.Atoi(c.Query("pageSize"))
 
 	if err != nil {
-		log.Printf(
-			"Page size could not be parsed from query string. Defaulting to %d",
-			DefaultPageSize,
+		slog.DebugContext(
+			c.Request.Context(),
+			"page size could not be parsed from query string, defaulting",
+			"page_size", DefaultPageSize,
 		)
 
 		pageSize = DefaultPageSize
@@ -59,3 +74,21 @@ func ParsePageFromQuery(c *gin.Context) Page {
 		PageSize: pageSize,
 	}
 }
+
+// ParseSortFromQuery reads the sort query parameter, reporting false when it
+// is not one of the allowed values.
+func ParseSortFromQuery(c *gin.Context, allowed ...Sort) (Sort, bool) {
+	sort := Sort(c.Query("sort"))
+
+	if sort == SortDefault {
+		return SortDefault, true
+	}
+
+	for _, allowedSort := range allowed {
+		if sort == allowedSort {
+			return sort, true
+		}
+	}
+
+	return SortDefault, false
+}
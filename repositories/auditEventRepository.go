@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+/* AuditEventFilter narrows down a listing of audit events. Nil IDs, an empty
+* entity type and zero times match every event. From is inclusive and To is
+* exclusive. */
+type AuditEventFilter struct {
+	ActorID    *uint
+	EntityType string
+	EntityID   *uint
+	From       time.Time
+	To         time.Time
+}
+
+// AuditEventRepository stores the audit log, which can only be appended to.
+type AuditEventRepository interface {
+	Save(ctx context.Context, event *entities.AuditEvent) error
+	// Find returns a page of the events matching the filter, newest first.
+	Find(ctx context.Context, filter AuditEventFilter, page paging.Page) []entities.AuditEvent
+}
+
+type PostgresAuditEventRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitAuditEventRepository(DB *gorm.DB, logger *slog.Logger) AuditEventRepository {
+	return &PostgresAuditEventRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresAuditEventRepository) Save(ctx context.Context, event *entities.AuditEvent) error {
+	err := dbFor(ctx, repository.DB).Create(event).Error
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save audit event", "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresAuditEventRepository) Find(ctx context.Context, filter AuditEventFilter, page paging.Page) []entities.AuditEvent {
+	var events []entities.AuditEvent
+
+	query := dbFor(ctx, repository.DB).Scopes(paging.Paginate(page))
+
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+
+	if filter.EntityID != nil {
+		query = query.Where("entity_id = ?", *filter.EntityID)
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	query.Order("created_at DESC, id DESC").Find(&events)
+
+	return events
+}
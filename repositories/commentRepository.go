@@ -1,86 +1,374 @@
 package repositories
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
 
 	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/paging"
 	"gorm.io/gorm"
 )
 
+/* CommentRepository stores comments and the reports of them. Reports are
+* resolved together with the comment they report, whenever its moderation
+* status changes or it is deleted. The deleted comments found by
+* FindDeletedByUserID and FindDeletedByID, which can be restored, are those
+* in the trash of their authors, so they leave out comments deleted by a
+* moderator. */
 type CommentRepository interface {
-	Save(comment *entities.Comment) (uint, error)
-	FindByID(ID uint) (*entities.Comment, error)
-	FindByProductID(productID uint, page paging.Page) []entities.Comment
-	UpdateByID(ID uint, updatedComment *entities.Comment) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, comment *entities.Comment) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Comment, error)
+	FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Comment
+	FindThreadsByProductID(ctx context.Context, productID uint, viewerID uint, page paging.Page) []entities.Comment
+	FindByUserIDSince(ctx context.Context, userID uint, since time.Time) []entities.Comment
+	FindModerationQueue(ctx context.Context, page paging.Page) []entities.Comment
+	UpdateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error
+	UpdateStatusByID(ctx context.Context, ID uint, status entities.CommentStatus, reason string) error
+	DeleteByID(ctx context.Context, ID uint) error
+	DeleteByIDAsModerator(ctx context.Context, ID uint) error
+	SaveReport(ctx context.Context, report *entities.CommentReport) error
+	FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Comment
+	FindDeletedByID(ctx context.Context, ID uint) (*entities.Comment, error)
+	FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Comment
+	RestoreByID(ctx context.Context, ID uint) error
+	PurgeByID(ctx context.Context, ID uint) error
 }
 
 type PostgresCommentRepository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Logger *slog.Logger
 }
 
-func InitCommentRepository(DB *gorm.DB) CommentRepository {
+func InitCommentRepository(DB *gorm.DB, logger *slog.Logger) CommentRepository {
 	return &PostgresCommentRepository{
-		DB: DB,
+		DB:     DB,
+		Logger: logger,
 	}
 }
 
-func (repository *PostgresCommentRepository) Save(comment *entities.Comment) (uint, error) {
-	result := repository.DB.Create(comment)
+func (repository *PostgresCommentRepository) Save(ctx context.Context, comment *entities.Comment) (uint, error) {
+	result := dbFor(ctx, repository.DB).Create(comment)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not save new comment", result.Error)
+		repository.Logger.ErrorContext(ctx, "could not save new comment", "error", result.Error)
 		return 0, result.Error
 	}
 
 	return comment.ID, nil
 }
 
-func (repository *PostgresCommentRepository) FindByID(ID uint) (*entities.Comment, error) {
+func (repository *PostgresCommentRepository) FindByID(ctx context.Context, ID uint) (*entities.Comment, error) {
 	var comment entities.Comment
 
-	result := repository.DB.First(&comment, ID)
+	result := dbFor(ctx, repository.DB).First(&comment, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not find comment with ID", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not find comment", "id", ID, "error", result.Error)
 		return nil, result.Error
 	}
 
 	return &comment, nil
 }
 
-func (repository *PostgresCommentRepository) FindByProductID(productID uint, page paging.Page) []entities.Comment {
+func (repository *PostgresCommentRepository) FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Comment {
 	var comments []entities.Comment
 
-	repository.DB.
+	dbFor(ctx, repository.DB).
 		Scopes(paging.Paginate(page)).
 		Where("product_id = ?", productID).
+		Order("id").
 		Find(&comments)
 
 	return comments
 }
 
-func (repository *PostgresCommentRepository) UpdateByID(ID uint, updatedComment *entities.Comment) error {
+/* FindThreadsByProductID returns a page of the top level comments of a product
+* together with all of their replies. Deleted and unpublished comments are
+* included, so that threads can be shown intact, but a page only holds top
+* level comments which are visible to the viewer or still have visible
+* replies. Comments are visible when they are published or written by the
+* viewer. */
+func (repository *PostgresCommentRepository) FindThreadsByProductID(ctx context.Context, productID uint, viewerID uint, page paging.Page) []entities.Comment {
+	var roots []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Scopes(paging.Paginate(page)).
+		Where("product_id = ? AND parent_id IS NULL", productID).
+		Where("(deleted_at IS NULL AND (status = ? OR user_id = ?)) OR EXISTS (?)",
+			entities.CommentStatusPublished,
+			viewerID,
+			repository.DB.
+				Table("comments AS replies").
+				Select("1").
+				Where("replies.root_id = comments.id AND replies.deleted_at IS NULL").
+				Where("(replies.status = ? OR replies.user_id = ?)", entities.CommentStatusPublished, viewerID)).
+		Order("id").
+		Find(&roots)
+
+	if len(roots) == 0 {
+		return roots
+	}
+
+	rootIDs := make([]uint, len(roots))
+
+	for i, root := range roots {
+		rootIDs[i] = root.ID
+	}
+
+	var replies []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Where("root_id IN ?", rootIDs).
+		Order("id").
+		Find(&replies)
+
+	return append(roots, replies...)
+}
+
+// FindByUserIDSince returns the comments a user has written since the given
+// time, for detecting repeated posts.
+func (repository *PostgresCommentRepository) FindByUserIDSince(ctx context.Context, userID uint, since time.Time) []entities.Comment {
+	var comments []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Order("id").
+		Find(&comments)
+
+	return comments
+}
+
+// FindModerationQueue returns a page of the comments which are held for review
+// or have open reports, with their open reports.
+func (repository *PostgresCommentRepository) FindModerationQueue(ctx context.Context, page paging.Page) []entities.Comment {
+	var comments []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Scopes(paging.Paginate(page)).
+		Preload("Reports", "resolved_at IS NULL", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("id")
+		}).
+		Where("status = ? OR EXISTS (?)", entities.CommentStatusPending, repository.DB.
+			Model(&entities.CommentReport{}).
+			Select("1").
+			Where("comment_reports.comment_id = comments.id AND comment_reports.resolved_at IS NULL")).
+		Order("id").
+		Find(&comments)
+
+	return comments
+}
+
+func (repository *PostgresCommentRepository) UpdateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error {
+	// The author, product and place in the thread never change.
+	updatedAt, err := updateVersioned(dbFor(ctx, repository.DB), &entities.Comment{}, ID, updatedComment.Version, map[string]any{
+		"content":           updatedComment.Content,
+		"status":            updatedComment.Status,
+		"moderation_reason": updatedComment.ModerationReason,
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update comment", "id", ID, "error", err)
+		return err
+	}
+
 	updatedComment.ID = ID
+	updatedComment.UpdatedAt = updatedAt
+	updatedComment.Version++
+
+	return nil
+}
+
+/* UpdateStatusByID sets the moderation status of a comment and resolves its
+* open reports. Moderators act on the current state of the comment, so the
+* version is not checked, but it is incremented so that an edit of the author
+* based on the earlier state can not undo the decision. */
+func (repository *PostgresCommentRepository) UpdateStatusByID(ctx context.Context, ID uint, status entities.CommentStatus, reason string) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entities.Comment{}).Where("id = ?", ID).Updates(map[string]any{
+			"status":            status,
+			"moderation_reason": reason,
+			"version":           gorm.Expr("version + 1"),
+		})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return resolveCommentReports(tx, ID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update comment status", "id", ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (repository *PostgresCommentRepository) DeleteByID(ctx context.Context, ID uint) error {
+	return repository.deleteByID(ctx, ID, false)
+}
+
+// DeleteByIDAsModerator deletes a comment and marks it as deleted by a
+// moderator, so that its author can not restore it.
+func (repository *PostgresCommentRepository) DeleteByIDAsModerator(ctx context.Context, ID uint) error {
+	return repository.deleteByID(ctx, ID, true)
+}
+
+func (repository *PostgresCommentRepository) deleteByID(ctx context.Context, ID uint, byModerator bool) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		if byModerator {
+			err := tx.Model(&entities.Comment{}).Where("id = ?", ID).Update("deleted_by_moderator", true).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Delete(&entities.Comment{}, ID).Error
+
+		if err != nil {
+			return err
+		}
 
-	result := repository.DB.Save(updatedComment)
+		return resolveCommentReports(tx, ID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete comment", "id", ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// SaveReport stores a report of a comment. A user can have one open report of
+// a comment at a time.
+func (repository *PostgresCommentRepository) SaveReport(ctx context.Context, report *entities.CommentReport) error {
+	result := dbFor(ctx, repository.DB).Create(report)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not update comment with ID", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not save comment report", "comment_id", report.CommentID, "error", result.Error)
 		return result.Error
 	}
 
 	return nil
 }
 
-func (repository *PostgresCommentRepository) DeleteByID(ID uint) error {
-	result := repository.DB.Delete(&entities.Comment{}, ID)
+func (repository *PostgresCommentRepository) FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Comment {
+	var comments []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Scopes(paging.Paginate(page)).
+		Where("user_id = ? AND deleted_at IS NOT NULL AND NOT deleted_by_moderator", userID).
+		Order("id").
+		Find(&comments)
+
+	return comments
+}
+
+func (repository *PostgresCommentRepository) FindDeletedByID(ctx context.Context, ID uint) (*entities.Comment, error) {
+	var comment entities.Comment
+
+	result := dbFor(ctx, repository.DB).Unscoped().Where("deleted_at IS NOT NULL AND NOT deleted_by_moderator").First(&comment, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not delete comment with ID", ID, result.Error)
+		return nil, result.Error
+	}
+
+	return &comment, nil
+}
+
+// FindDeletedBefore returns up to limit comments without replies which were
+// deleted before the given time, oldest first.
+func (repository *PostgresCommentRepository) FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Comment {
+	var comments []entities.Comment
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Where("deleted_at < ? AND NOT EXISTS (?)", before, repository.DB.
+			Table("comments AS replies").
+			Select("1").
+			Where("replies.parent_id = comments.id")).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&comments)
+
+	return comments
+}
+
+func (repository *PostgresCommentRepository) RestoreByID(ctx context.Context, ID uint) error {
+	result := dbFor(ctx, repository.DB).
+		Unscoped().
+		Model(&entities.Comment{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND NOT deleted_by_moderator", ID).
+		Update("deleted_at", nil)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not restore comment", "id", ID, "error", result.Error)
 		return result.Error
 	}
 
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
 	return nil
 }
+
+/* PurgeByID permanently deletes a deleted comment and its reports. Replies
+* keep their place in the thread through the comment, so a comment with
+* replies, deleted or not, fails with gorm.ErrForeignKeyViolated until they
+* are purged. */
+func (repository *PostgresCommentRepository) PurgeByID(ctx context.Context, ID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		var comment entities.Comment
+
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").Select("id").First(&comment, ID).Error
+
+		if err != nil {
+			return err
+		}
+
+		var replies int64
+
+		err = tx.Unscoped().Model(&entities.Comment{}).Where("parent_id = ?", ID).Count(&replies).Error
+
+		if err != nil {
+			return err
+		}
+
+		if replies > 0 {
+			return gorm.ErrForeignKeyViolated
+		}
+
+		err = tx.Unscoped().Where("comment_id = ?", ID).Delete(&entities.CommentReport{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&entities.Comment{}, ID).Error
+	})
+
+	if err != nil && !errors.Is(err, gorm.ErrForeignKeyViolated) {
+		repository.Logger.ErrorContext(ctx, "could not purge comment", "id", ID, "error", err)
+	}
+
+	return err
+}
+
+func resolveCommentReports(tx *gorm.DB, commentID uint) error {
+	return tx.Model(&entities.CommentReport{}).
+		Where("comment_id = ? AND resolved_at IS NULL", commentID).
+		Update("resolved_at", time.Now()).Error
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+)
+
+type IdempotencyKeyRepository interface {
+	// Reserve saves a new key, replacing it if it has expired or if its
+	// request is still not handled and was started before abandonedBefore. A
+	// key which is still in use makes it fail with gorm.ErrDuplicatedKey.
+	Reserve(ctx context.Context, key *entities.IdempotencyKey, abandonedBefore time.Time) error
+	FindByKey(ctx context.Context, userID uint, key string) (*entities.IdempotencyKey, error)
+	Complete(ctx context.Context, ID uint, statusCode int, contentType string, body []byte) error
+	DeleteByID(ctx context.Context, ID uint) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type PostgresIdempotencyKeyRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitIdempotencyKeyRepository(DB *gorm.DB, logger *slog.Logger) IdempotencyKeyRepository {
+	return &PostgresIdempotencyKeyRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresIdempotencyKeyRepository) Reserve(ctx context.Context, key *entities.IdempotencyKey, abandonedBefore time.Time) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Where(&entities.IdempotencyKey{UserID: key.UserID, Key: key.Key}).
+			Where("expires_at <= ? OR (status_code = 0 AND created_at < ?)", time.Now(), abandonedBefore).
+			Delete(&entities.IdempotencyKey{}).
+			Error
+
+		if err != nil {
+			return err
+		}
+
+		// A concurrent request with the same key makes this wait on the unique
+		// index until the other transaction commits, and then fail.
+		return tx.Create(key).Error
+	})
+
+	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		repository.Logger.ErrorContext(ctx, "could not reserve idempotency key", "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresIdempotencyKeyRepository) FindByKey(ctx context.Context, userID uint, key string) (*entities.IdempotencyKey, error) {
+	var found entities.IdempotencyKey
+
+	result := dbFor(ctx, repository.DB).
+		Where(&entities.IdempotencyKey{UserID: userID, Key: key}).
+		Take(&found)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &found, nil
+}
+
+func (repository *PostgresIdempotencyKeyRepository) Complete(ctx context.Context, ID uint, statusCode int, contentType string, body []byte) error {
+	result := dbFor(ctx, repository.DB).Model(&entities.IdempotencyKey{}).Where("id = ?", ID).Updates(map[string]any{
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"body":         body,
+	})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not complete idempotency key", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresIdempotencyKeyRepository) DeleteByID(ctx context.Context, ID uint) error {
+	result := dbFor(ctx, repository.DB).Delete(&entities.IdempotencyKey{}, ID)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete idempotency key", "id", ID, "error", result.Error)
+	}
+
+	return result.Error
+}
+
+func (repository *PostgresIdempotencyKeyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := dbFor(ctx, repository.DB).Where("expires_at <= ?", now).Delete(&entities.IdempotencyKey{})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete expired idempotency keys", "error", result.Error)
+	}
+
+	return result.RowsAffected, result.Error
+}
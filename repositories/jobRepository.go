@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobFilter narrows down the jobs returned by JobRepository.Find. Empty fields
+// do not filter.
+type JobFilter struct {
+	Status entities.JobStatus
+	Queue  string
+	Type   string
+}
+
+type JobRepository interface {
+	// Save queues a job. It fails with gorm.ErrDuplicatedKey when a job with
+	// the same unique key exists.
+	Save(ctx context.Context, job *entities.Job) error
+	FindByID(ctx context.Context, ID uint) (*entities.Job, error)
+	// Find returns a page of the jobs matching the filter, newest first.
+	Find(ctx context.Context, filter JobFilter, page paging.Page) []entities.Job
+	/* ClaimDue returns up to limit jobs of the queue which are due at now,
+	* longest waiting first. The jobs are marked running, their attempts are
+	* counted and they are leased until now plus lease, so no other worker
+	* picks them up in the meantime. */
+	ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]entities.Job, error)
+	MarkSucceeded(ctx context.Context, ID uint, at time.Time) error
+	// MarkRetry puts a job which failed back in its queue until runAt.
+	MarkRetry(ctx context.Context, ID uint, runAt time.Time, lastError string) error
+	MarkFailed(ctx context.Context, ID uint, at time.Time, lastError string) error
+	// Requeue gives a failed job a new set of attempts. Jobs which have not
+	// failed are not found.
+	Requeue(ctx context.Context, ID uint, now time.Time) error
+	// DeleteFinishedBefore deletes the jobs which succeeded or failed before
+	// the given time and returns how many were deleted.
+	DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type PostgresJobRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitJobRepository(DB *gorm.DB, logger *slog.Logger) JobRepository {
+	return &PostgresJobRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresJobRepository) Save(ctx context.Context, job *entities.Job) error {
+	err := dbFor(ctx, repository.DB).Create(job).Error
+
+	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		repository.Logger.ErrorContext(ctx, "could not save job", "type", job.Type, "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresJobRepository) FindByID(ctx context.Context, ID uint) (*entities.Job, error) {
+	var job entities.Job
+
+	result := dbFor(ctx, repository.DB).First(&job, ID)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &job, nil
+}
+
+func (repository *PostgresJobRepository) Find(ctx context.Context, filter JobFilter, page paging.Page) []entities.Job {
+	var jobs []entities.Job
+
+	query := dbFor(ctx, repository.DB).Scopes(paging.Paginate(page))
+
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if filter.Queue != "" {
+		query = query.Where("queue = ?", filter.Queue)
+	}
+
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	query.Order("id DESC").Find(&jobs)
+
+	return jobs
+}
+
+func (repository *PostgresJobRepository) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]entities.Job, error) {
+	var jobs []entities.Job
+
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		query := tx.
+			Where("queue = ? AND status IN ? AND run_at <= ?", queue, []entities.JobStatus{entities.JobStatusPending, entities.JobStatusRunning}, now).
+			Order("run_at, id").
+			Limit(limit)
+
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		err := query.Find(&jobs).Error
+
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		IDs := make([]uint, len(jobs))
+
+		for i := range jobs {
+			IDs[i] = jobs[i].ID
+			jobs[i].Status = entities.JobStatusRunning
+			jobs[i].RunAt = now.Add(lease)
+			jobs[i].Attempts++
+		}
+
+		return tx.Model(&entities.Job{}).Where("id IN ?", IDs).Updates(map[string]any{
+			"status":   entities.JobStatusRunning,
+			"run_at":   now.Add(lease),
+			"attempts": gorm.Expr("attempts + 1"),
+		}).Error
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not claim jobs", "queue", queue, "error", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (repository *PostgresJobRepository) MarkSucceeded(ctx context.Context, ID uint, at time.Time) error {
+	return repository.update(ctx, ID, map[string]any{
+		"status":      entities.JobStatusSucceeded,
+		"finished_at": at,
+		"last_error":  "",
+	})
+}
+
+func (repository *PostgresJobRepository) MarkRetry(ctx context.Context, ID uint, runAt time.Time, lastError string) error {
+	return repository.update(ctx, ID, map[string]any{
+		"status":     entities.JobStatusPending,
+		"run_at":     runAt,
+		"last_error": lastError,
+	})
+}
+
+func (repository *PostgresJobRepository) MarkFailed(ctx context.Context, ID uint, at time.Time, lastError string) error {
+	return repository.update(ctx, ID, map[string]any{
+		"status":      entities.JobStatusFailed,
+		"finished_at": at,
+		"last_error":  lastError,
+	})
+}
+
+func (repository *PostgresJobRepository) update(ctx context.Context, ID uint, columns map[string]any) error {
+	result := dbFor(ctx, repository.DB).Model(&entities.Job{}).Where("id = ?", ID).Updates(columns)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not update job", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresJobRepository) Requeue(ctx context.Context, ID uint, now time.Time) error {
+	result := dbFor(ctx, repository.DB).
+		Model(&entities.Job{}).
+		Where("id = ? AND status = ?", ID, entities.JobStatusFailed).
+		Updates(map[string]any{
+			"status":      entities.JobStatusPending,
+			"attempts":    0,
+			"run_at":      now,
+			"finished_at": nil,
+		})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not requeue job", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresJobRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := dbFor(ctx, repository.DB).
+		Where("status IN ? AND finished_at < ?", []entities.JobStatus{entities.JobStatusSucceeded, entities.JobStatusFailed}, before).
+		Delete(&entities.Job{})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete finished jobs", "error", result.Error)
+	}
+
+	return result.RowsAffected, result.Error
+}
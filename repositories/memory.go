@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+/* The in-memory repositories mirror the behaviour of their Postgres
+* counterparts closely enough to run the application without a database:
+* records are soft deleted, lookups return gorm.ErrRecordNotFound and unique
+* constraints return gorm.ErrDuplicatedKey. Returned entities are copies, so
+* callers can not modify the stored records. */
+
+func isDeleted(model *gorm.Model) bool {
+	return model.DeletedAt.Valid
+}
+
+func markDeleted(model *gorm.Model) {
+	model.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+// pageOf sorts items by ID and returns the requested page.
+func pageOf[T any](items []T, page paging.Page, id func(*T) uint) []T {
+	return sortedPageOf(items, page, func(a *T, b *T) bool {
+		return id(a) < id(b)
+	})
+}
+
+// sortedPageOf sorts items with less and returns the requested page.
+func sortedPageOf[T any](items []T, page paging.Page, less func(a *T, b *T) bool) []T {
+	sort.Slice(items, func(i, j int) bool {
+		return less(&items[i], &items[j])
+	})
+
+	offset, limit := page.OffsetLimit()
+
+	if offset >= len(items) {
+		return []T{}
+	}
+
+	return items[offset:min(offset+limit, len(items))]
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+)
+
+type MemoryAuditEventRepository struct {
+	mu     sync.RWMutex
+	events []entities.AuditEvent
+}
+
+func InitMemoryAuditEventRepository() AuditEventRepository {
+	return &MemoryAuditEventRepository{}
+}
+
+func (repository *MemoryAuditEventRepository) Save(ctx context.Context, event *entities.AuditEvent) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	event.ID = uint(len(repository.events)) + 1
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	repository.events = append(repository.events, *event)
+
+	return nil
+}
+
+func (repository *MemoryAuditEventRepository) Find(ctx context.Context, filter AuditEventFilter, page paging.Page) []entities.AuditEvent {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	events := []entities.AuditEvent{}
+
+	for _, event := range repository.events {
+		if auditEventMatches(&event, &filter) {
+			events = append(events, event)
+		}
+	}
+
+	return sortedPageOf(events, page, func(a *entities.AuditEvent, b *entities.AuditEvent) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+
+		return a.ID > b.ID
+	})
+}
+
+func auditEventMatches(event *entities.AuditEvent, filter *AuditEventFilter) bool {
+	switch {
+	case filter.ActorID != nil && event.ActorID != *filter.ActorID:
+		return false
+	case filter.EntityType != "" && event.EntityType != filter.EntityType:
+		return false
+	case filter.EntityID != nil && event.EntityID != *filter.EntityID:
+		return false
+	case !filter.From.IsZero() && event.CreatedAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !event.CreatedAt.Before(filter.To):
+		return false
+	default:
+		return true
+	}
+}
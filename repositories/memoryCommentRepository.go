@@ -0,0 +1,448 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type MemoryCommentRepository struct {
+	mu           sync.RWMutex
+	lastID       uint
+	lastReportID uint
+	comments     map[uint]*entities.Comment
+	reports      map[uint]*entities.CommentReport
+}
+
+/* InitMemoryCommentRepository returns a comment repository for the products in
+* the given repository. Like the database, it deletes, restores and purges the
+* comments of a product together with the product when it comes from a memory
+* product repository. */
+func InitMemoryCommentRepository(products ProductRepository) CommentRepository {
+	repository := &MemoryCommentRepository{
+		comments: make(map[uint]*entities.Comment),
+		reports:  make(map[uint]*entities.CommentReport),
+	}
+
+	if productStore, ok := products.(*MemoryProductRepository); ok {
+		productStore.comments = repository
+	}
+
+	return repository
+}
+
+func (repository *MemoryCommentRepository) Save(ctx context.Context, comment *entities.Comment) (uint, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	repository.lastID++
+
+	now := time.Now()
+
+	comment.ID = repository.lastID
+	comment.CreatedAt = now
+	comment.UpdatedAt = now
+	comment.Version = 1
+
+	// Like the column default.
+	if comment.Status == "" {
+		comment.Status = entities.CommentStatusPublished
+	}
+
+	stored := *comment
+	repository.comments[comment.ID] = &stored
+
+	return comment.ID, nil
+}
+
+func (repository *MemoryCommentRepository) FindByID(ctx context.Context, ID uint) (*entities.Comment, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comment, found := repository.comments[ID]
+
+	if !found || isDeleted(&comment.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *comment
+
+	return &copied, nil
+}
+
+func (repository *MemoryCommentRepository) FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comments := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if !isDeleted(&comment.Model) && comment.ProductID == productID {
+			comments = append(comments, *comment)
+		}
+	}
+
+	return pageOf(comments, page, func(comment *entities.Comment) uint {
+		return comment.ID
+	})
+}
+
+func (repository *MemoryCommentRepository) FindThreadsByProductID(ctx context.Context, productID uint, viewerID uint, page paging.Page) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	visible := func(comment *entities.Comment) bool {
+		return !isDeleted(&comment.Model) && (comment.Status == entities.CommentStatusPublished || comment.UserID == viewerID)
+	}
+
+	visibleReplies := make(map[uint]bool)
+
+	for _, comment := range repository.comments {
+		if comment.RootID != nil && visible(comment) {
+			visibleReplies[*comment.RootID] = true
+		}
+	}
+
+	roots := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if comment.ProductID == productID && comment.ParentID == nil && (visible(comment) || visibleReplies[comment.ID]) {
+			roots = append(roots, *comment)
+		}
+	}
+
+	roots = pageOf(roots, page, func(comment *entities.Comment) uint {
+		return comment.ID
+	})
+
+	inPage := make(map[uint]bool, len(roots))
+
+	for _, root := range roots {
+		inPage[root.ID] = true
+	}
+
+	replies := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if comment.RootID != nil && inPage[*comment.RootID] {
+			replies = append(replies, *comment)
+		}
+	}
+
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].ID < replies[j].ID
+	})
+
+	return append(roots, replies...)
+}
+
+func (repository *MemoryCommentRepository) FindByUserIDSince(ctx context.Context, userID uint, since time.Time) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comments := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if !isDeleted(&comment.Model) && comment.UserID == userID && !comment.CreatedAt.Before(since) {
+			comments = append(comments, *comment)
+		}
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].ID < comments[j].ID
+	})
+
+	return comments
+}
+
+func (repository *MemoryCommentRepository) FindModerationQueue(ctx context.Context, page paging.Page) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	reports := make(map[uint][]entities.CommentReport)
+
+	for _, report := range repository.reports {
+		if report.ResolvedAt == nil {
+			reports[report.CommentID] = append(reports[report.CommentID], *report)
+		}
+	}
+
+	comments := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if isDeleted(&comment.Model) || (comment.Status != entities.CommentStatusPending && len(reports[comment.ID]) == 0) {
+			continue
+		}
+
+		queued := *comment
+		queued.Reports = reports[comment.ID]
+
+		sort.Slice(queued.Reports, func(i, j int) bool {
+			return queued.Reports[i].ID < queued.Reports[j].ID
+		})
+
+		comments = append(comments, queued)
+	}
+
+	return pageOf(comments, page, func(comment *entities.Comment) uint {
+		return comment.ID
+	})
+}
+
+func (repository *MemoryCommentRepository) UpdateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	existing, found := repository.comments[ID]
+
+	if !found || isDeleted(&existing.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	if existing.Version != updatedComment.Version {
+		return ErrStaleVersion
+	}
+
+	// The author, product and place in the thread never change.
+	existing.Content = updatedComment.Content
+	existing.Status = updatedComment.Status
+	existing.ModerationReason = updatedComment.ModerationReason
+	existing.UpdatedAt = time.Now()
+	existing.Version++
+
+	updatedComment.ID = ID
+	updatedComment.UpdatedAt = existing.UpdatedAt
+	updatedComment.Version = existing.Version
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) UpdateStatusByID(ctx context.Context, ID uint, status entities.CommentStatus, reason string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	comment, found := repository.comments[ID]
+
+	if !found || isDeleted(&comment.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	comment.Status = status
+	comment.ModerationReason = reason
+	comment.UpdatedAt = time.Now()
+	comment.Version++
+
+	repository.resolveReports(ID)
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) DeleteByID(ctx context.Context, ID uint) error {
+	return repository.deleteByID(ID, false)
+}
+
+func (repository *MemoryCommentRepository) DeleteByIDAsModerator(ctx context.Context, ID uint) error {
+	return repository.deleteByID(ID, true)
+}
+
+func (repository *MemoryCommentRepository) deleteByID(ID uint, byModerator bool) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if comment, found := repository.comments[ID]; found {
+		if byModerator {
+			comment.DeletedByModerator = true
+		}
+
+		markDeleted(&comment.Model)
+	}
+
+	repository.resolveReports(ID)
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) SaveReport(ctx context.Context, report *entities.CommentReport) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	comment, found := repository.comments[report.CommentID]
+
+	if !found {
+		return gorm.ErrForeignKeyViolated
+	}
+
+	for _, existing := range repository.reports {
+		if existing.ResolvedAt == nil && existing.CommentID == comment.ID && existing.UserID == report.UserID {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	repository.lastReportID++
+
+	now := time.Now()
+
+	report.ID = repository.lastReportID
+	report.CreatedAt = now
+	report.UpdatedAt = now
+
+	stored := *report
+	repository.reports[report.ID] = &stored
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comments := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if isDeleted(&comment.Model) && !comment.DeletedByModerator && comment.UserID == userID {
+			comments = append(comments, *comment)
+		}
+	}
+
+	return pageOf(comments, page, func(comment *entities.Comment) uint {
+		return comment.ID
+	})
+}
+
+func (repository *MemoryCommentRepository) FindDeletedByID(ctx context.Context, ID uint) (*entities.Comment, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comment, found := repository.comments[ID]
+
+	if !found || !isDeleted(&comment.Model) || comment.DeletedByModerator {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *comment
+
+	return &copied, nil
+}
+
+func (repository *MemoryCommentRepository) FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Comment {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	comments := []entities.Comment{}
+
+	for _, comment := range repository.comments {
+		if isDeleted(&comment.Model) && comment.DeletedAt.Time.Before(before) && !repository.hasReplies(comment.ID) {
+			comments = append(comments, *comment)
+		}
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].DeletedAt.Time.Before(comments[j].DeletedAt.Time)
+	})
+
+	return comments[:min(limit, len(comments))]
+}
+
+func (repository *MemoryCommentRepository) RestoreByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	comment, found := repository.comments[ID]
+
+	if !found || !isDeleted(&comment.Model) || comment.DeletedByModerator {
+		return gorm.ErrRecordNotFound
+	}
+
+	comment.DeletedAt = gorm.DeletedAt{}
+	comment.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) PurgeByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	comment, found := repository.comments[ID]
+
+	if !found || !isDeleted(&comment.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	if repository.hasReplies(ID) {
+		return gorm.ErrForeignKeyViolated
+	}
+
+	repository.purge(ID)
+
+	return nil
+}
+
+func (repository *MemoryCommentRepository) deleteByProductID(productID uint, deletedAt time.Time) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, comment := range repository.comments {
+		if comment.ProductID == productID && !isDeleted(&comment.Model) {
+			comment.DeletedAt = gorm.DeletedAt{Time: deletedAt, Valid: true}
+		}
+	}
+}
+
+func (repository *MemoryCommentRepository) restoreByProductID(productID uint, deletedAt time.Time) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, comment := range repository.comments {
+		if comment.ProductID == productID && isDeleted(&comment.Model) && comment.DeletedAt.Time.Equal(deletedAt) {
+			comment.DeletedAt = gorm.DeletedAt{}
+		}
+	}
+}
+
+func (repository *MemoryCommentRepository) purgeByProductID(productID uint) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for ID, comment := range repository.comments {
+		if comment.ProductID == productID {
+			repository.purge(ID)
+		}
+	}
+}
+
+func (repository *MemoryCommentRepository) hasReplies(ID uint) bool {
+	for _, comment := range repository.comments {
+		if comment.ParentID != nil && *comment.ParentID == ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// purge removes a comment and its reports.
+func (repository *MemoryCommentRepository) purge(ID uint) {
+	delete(repository.comments, ID)
+
+	for reportID, report := range repository.reports {
+		if report.CommentID == ID {
+			delete(repository.reports, reportID)
+		}
+	}
+}
+
+func (repository *MemoryCommentRepository) resolveReports(commentID uint) {
+	now := time.Now()
+
+	for _, report := range repository.reports {
+		if report.CommentID == commentID && report.ResolvedAt == nil {
+			report.ResolvedAt = &now
+		}
+	}
+}
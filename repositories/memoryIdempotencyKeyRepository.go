@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+)
+
+type memoryIdempotencyKeyID struct {
+	userID uint
+	key    string
+}
+
+type MemoryIdempotencyKeyRepository struct {
+	mu     sync.Mutex
+	lastID uint
+	keys   map[memoryIdempotencyKeyID]*entities.IdempotencyKey
+}
+
+func InitMemoryIdempotencyKeyRepository() IdempotencyKeyRepository {
+	return &MemoryIdempotencyKeyRepository{
+		keys: make(map[memoryIdempotencyKeyID]*entities.IdempotencyKey),
+	}
+}
+
+func (repository *MemoryIdempotencyKeyRepository) Reserve(ctx context.Context, key *entities.IdempotencyKey, abandonedBefore time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now()
+	id := memoryIdempotencyKeyID{userID: key.UserID, key: key.Key}
+
+	if existing, found := repository.keys[id]; found && existing.ExpiresAt.After(now) {
+		if existing.IsCompleted() || !existing.CreatedAt.Before(abandonedBefore) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	repository.lastID++
+
+	key.ID = repository.lastID
+	key.CreatedAt = now
+
+	stored := *key
+	repository.keys[id] = &stored
+
+	return nil
+}
+
+func (repository *MemoryIdempotencyKeyRepository) FindByKey(ctx context.Context, userID uint, key string) (*entities.IdempotencyKey, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	found, ok := repository.keys[memoryIdempotencyKeyID{userID: userID, key: key}]
+
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *found
+
+	return &copied, nil
+}
+
+func (repository *MemoryIdempotencyKeyRepository) Complete(ctx context.Context, ID uint, statusCode int, contentType string, body []byte) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, key := range repository.keys {
+		if key.ID == ID {
+			key.StatusCode = statusCode
+			key.ContentType = contentType
+			key.Body = append([]byte(nil), body...)
+
+			return nil
+		}
+	}
+
+	return gorm.ErrRecordNotFound
+}
+
+func (repository *MemoryIdempotencyKeyRepository) DeleteByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for id, key := range repository.keys {
+		if key.ID == ID {
+			delete(repository.keys, id)
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryIdempotencyKeyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var deleted int64
+
+	for id, key := range repository.keys {
+		if !key.ExpiresAt.After(now) {
+			delete(repository.keys, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,191 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type MemoryJobRepository struct {
+	mu     sync.Mutex
+	lastID uint
+	jobs   map[uint]*entities.Job
+}
+
+func InitMemoryJobRepository() JobRepository {
+	return &MemoryJobRepository{
+		jobs: make(map[uint]*entities.Job),
+	}
+}
+
+func (repository *MemoryJobRepository) Save(ctx context.Context, job *entities.Job) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if job.UniqueKey != nil {
+		for _, existing := range repository.jobs {
+			if existing.UniqueKey != nil && *existing.UniqueKey == *job.UniqueKey {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+	}
+
+	repository.lastID++
+
+	now := time.Now()
+
+	job.ID = repository.lastID
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	stored := *job
+	repository.jobs[job.ID] = &stored
+
+	return nil
+}
+
+func (repository *MemoryJobRepository) FindByID(ctx context.Context, ID uint) (*entities.Job, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	job, found := repository.jobs[ID]
+
+	if !found {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *job
+
+	return &copied, nil
+}
+
+func (repository *MemoryJobRepository) Find(ctx context.Context, filter JobFilter, page paging.Page) []entities.Job {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	jobs := []entities.Job{}
+
+	for _, job := range repository.jobs {
+		if (filter.Status == "" || job.Status == filter.Status) &&
+			(filter.Queue == "" || job.Queue == filter.Queue) &&
+			(filter.Type == "" || job.Type == filter.Type) {
+			jobs = append(jobs, *job)
+		}
+	}
+
+	return sortedPageOf(jobs, page, func(a *entities.Job, b *entities.Job) bool {
+		return a.ID > b.ID
+	})
+}
+
+func (repository *MemoryJobRepository) ClaimDue(ctx context.Context, queue string, now time.Time, lease time.Duration, limit int) ([]entities.Job, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	due := []entities.Job{}
+
+	for _, job := range repository.jobs {
+		if job.Queue == queue && !job.IsFinished() && !job.RunAt.After(now) {
+			due = append(due, *job)
+		}
+	}
+
+	due = sortedPageOf(due, paging.Page{Page: 1, PageSize: limit}, func(a *entities.Job, b *entities.Job) bool {
+		if !a.RunAt.Equal(b.RunAt) {
+			return a.RunAt.Before(b.RunAt)
+		}
+
+		return a.ID < b.ID
+	})
+
+	for i := range due {
+		job := repository.jobs[due[i].ID]
+		job.Status = entities.JobStatusRunning
+		job.RunAt = now.Add(lease)
+		job.Attempts++
+		job.UpdatedAt = now
+
+		due[i] = *job
+	}
+
+	return due, nil
+}
+
+func (repository *MemoryJobRepository) MarkSucceeded(ctx context.Context, ID uint, at time.Time) error {
+	return repository.update(ID, func(job *entities.Job) {
+		job.Status = entities.JobStatusSucceeded
+		job.FinishedAt = &at
+		job.LastError = ""
+	})
+}
+
+func (repository *MemoryJobRepository) MarkRetry(ctx context.Context, ID uint, runAt time.Time, lastError string) error {
+	return repository.update(ID, func(job *entities.Job) {
+		job.Status = entities.JobStatusPending
+		job.RunAt = runAt
+		job.LastError = lastError
+	})
+}
+
+func (repository *MemoryJobRepository) MarkFailed(ctx context.Context, ID uint, at time.Time, lastError string) error {
+	return repository.update(ID, func(job *entities.Job) {
+		job.Status = entities.JobStatusFailed
+		job.FinishedAt = &at
+		job.LastError = lastError
+	})
+}
+
+func (repository *MemoryJobRepository) update(ID uint, apply func(*entities.Job)) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	job, found := repository.jobs[ID]
+
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+
+	apply(job)
+	job.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (repository *MemoryJobRepository) Requeue(ctx context.Context, ID uint, now time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	job, found := repository.jobs[ID]
+
+	if !found || job.Status != entities.JobStatusFailed {
+		return gorm.ErrRecordNotFound
+	}
+
+	job.Status = entities.JobStatusPending
+	job.Attempts = 0
+	job.RunAt = now
+	job.FinishedAt = nil
+	job.UpdatedAt = now
+
+	return nil
+}
+
+func (repository *MemoryJobRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var deleted int64
+
+	for ID, job := range repository.jobs {
+		if job.IsFinished() && job.FinishedAt != nil && job.FinishedAt.Before(before) {
+			delete(repository.jobs, ID)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+)
+
+type MemoryNotificationPreferencesRepository struct {
+	mu          sync.Mutex
+	preferences map[uint]*entities.NotificationPreferences
+}
+
+func InitMemoryNotificationPreferencesRepository() NotificationPreferencesRepository {
+	return &MemoryNotificationPreferencesRepository{
+		preferences: make(map[uint]*entities.NotificationPreferences),
+	}
+}
+
+func (repository *MemoryNotificationPreferencesRepository) FindByUserID(ctx context.Context, userID uint) (*entities.NotificationPreferences, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	found, ok := repository.preferences[userID]
+
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *found
+
+	return &copied, nil
+}
+
+func (repository *MemoryNotificationPreferencesRepository) Save(ctx context.Context, preferences *entities.NotificationPreferences) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now()
+	preferences.CreatedAt = now
+	preferences.UpdatedAt = now
+
+	if existing, found := repository.preferences[preferences.UserID]; found {
+		preferences.CreatedAt = existing.CreatedAt
+	}
+
+	stored := *preferences
+	repository.preferences[preferences.UserID] = &stored
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type MemoryNotificationRepository struct {
+	mu            sync.Mutex
+	lastID        uint
+	notifications map[uint]*entities.Notification
+}
+
+func InitMemoryNotificationRepository() NotificationRepository {
+	return &MemoryNotificationRepository{
+		notifications: make(map[uint]*entities.Notification),
+	}
+}
+
+func (repository *MemoryNotificationRepository) Save(ctx context.Context, notification *entities.Notification) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if notification.EventID != nil {
+		for _, existing := range repository.notifications {
+			if existing.EventID != nil && *existing.EventID == *notification.EventID && existing.UserID == notification.UserID {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+	}
+
+	repository.lastID++
+
+	notification.ID = repository.lastID
+	notification.CreatedAt = time.Now()
+
+	stored := *notification
+	repository.notifications[notification.ID] = &stored
+
+	return nil
+}
+
+func (repository *MemoryNotificationRepository) FindByUserID(ctx context.Context, userID uint, unreadOnly bool, page paging.Page) []entities.Notification {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	notifications := []entities.Notification{}
+
+	for _, notification := range repository.notifications {
+		if notification.UserID == userID && (!unreadOnly || !notification.IsRead()) {
+			notifications = append(notifications, *notification)
+		}
+	}
+
+	return sortedPageOf(notifications, page, func(a *entities.Notification, b *entities.Notification) bool {
+		return a.ID > b.ID
+	})
+}
+
+func (repository *MemoryNotificationRepository) FindByUserIDAfter(ctx context.Context, userID uint, afterID uint, limit int) []entities.Notification {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	notifications := []entities.Notification{}
+
+	for _, notification := range repository.notifications {
+		if notification.UserID == userID && notification.ID > afterID {
+			notifications = append(notifications, *notification)
+		}
+	}
+
+	return pageOf(notifications, paging.Page{Page: 1, PageSize: limit}, func(notification *entities.Notification) uint {
+		return notification.ID
+	})
+}
+
+func (repository *MemoryNotificationRepository) CountUnread(ctx context.Context, userID uint) int64 {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var count int64
+
+	for _, notification := range repository.notifications {
+		if notification.UserID == userID && !notification.IsRead() {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (repository *MemoryNotificationRepository) MarkRead(ctx context.Context, userID uint, ID uint, at time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	notification, found := repository.notifications[ID]
+
+	if !found || notification.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+
+	if !notification.IsRead() {
+		notification.ReadAt = &at
+	}
+
+	return nil
+}
+
+func (repository *MemoryNotificationRepository) MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var marked int64
+
+	for _, notification := range repository.notifications {
+		if notification.UserID == userID && !notification.IsRead() {
+			readAt := at
+			notification.ReadAt = &readAt
+			marked++
+		}
+	}
+
+	return marked, nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type MemoryOutboxEventRepository struct {
+	mu     sync.Mutex
+	lastID uint
+	events map[uint]*entities.OutboxEvent
+}
+
+func InitMemoryOutboxEventRepository() OutboxEventRepository {
+	return &MemoryOutboxEventRepository{
+		events: make(map[uint]*entities.OutboxEvent),
+	}
+}
+
+func (repository *MemoryOutboxEventRepository) Save(ctx context.Context, event *entities.OutboxEvent) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	repository.lastID++
+
+	event.ID = repository.lastID
+	event.CreatedAt = time.Now()
+
+	stored := *event
+	repository.events[event.ID] = &stored
+
+	return nil
+}
+
+func (repository *MemoryOutboxEventRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.OutboxEvent, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	due := []entities.OutboxEvent{}
+
+	for _, event := range repository.events {
+		if event.IsPending() && !event.NextAttemptAt.After(now) {
+			due = append(due, *event)
+		}
+	}
+
+	due = pageOf(due, paging.Page{Page: 1, PageSize: limit}, func(event *entities.OutboxEvent) uint {
+		return event.ID
+	})
+
+	for _, event := range due {
+		repository.events[event.ID].NextAttemptAt = now.Add(lease)
+	}
+
+	return due, nil
+}
+
+func (repository *MemoryOutboxEventRepository) MarkDispatched(ctx context.Context, ID uint, at time.Time) error {
+	return repository.update(ID, func(event *entities.OutboxEvent) {
+		event.DispatchedAt = &at
+		event.LastError = ""
+	})
+}
+
+func (repository *MemoryOutboxEventRepository) MarkFailed(ctx context.Context, ID uint, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return repository.update(ID, func(event *entities.OutboxEvent) {
+		event.Attempts = attempts
+		event.NextAttemptAt = nextAttemptAt
+		event.LastError = lastError
+	})
+}
+
+func (repository *MemoryOutboxEventRepository) MarkDead(ctx context.Context, ID uint, attempts int, at time.Time, lastError string) error {
+	return repository.update(ID, func(event *entities.OutboxEvent) {
+		event.Attempts = attempts
+		event.DeadAt = &at
+		event.LastError = lastError
+	})
+}
+
+func (repository *MemoryOutboxEventRepository) update(ID uint, apply func(*entities.OutboxEvent)) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	event, found := repository.events[ID]
+
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+
+	apply(event)
+
+	return nil
+}
+
+func (repository *MemoryOutboxEventRepository) FindDead(ctx context.Context, page paging.Page) []entities.OutboxEvent {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	dead := []entities.OutboxEvent{}
+
+	for _, event := range repository.events {
+		if event.DeadAt != nil {
+			dead = append(dead, *event)
+		}
+	}
+
+	return pageOf(dead, page, func(event *entities.OutboxEvent) uint {
+		return event.ID
+	})
+}
+
+func (repository *MemoryOutboxEventRepository) Requeue(ctx context.Context, ID uint, now time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	event, found := repository.events[ID]
+
+	if !found || event.DeadAt == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	event.Attempts = 0
+	event.NextAttemptAt = now
+	event.DeadAt = nil
+
+	return nil
+}
+
+func (repository *MemoryOutboxEventRepository) DeleteDispatchedBefore(ctx context.Context, before time.Time) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var deleted int64
+
+	for ID, event := range repository.events {
+		if event.DispatchedAt != nil && event.DispatchedAt.Before(before) {
+			delete(repository.events, ID)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
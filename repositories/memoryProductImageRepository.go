@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+)
+
+type MemoryProductImageRepository struct {
+	mu     sync.RWMutex
+	lastID uint
+	images map[uint]*entities.ProductImage
+}
+
+func InitMemoryProductImageRepository() ProductImageRepository {
+	return &MemoryProductImageRepository{
+		images: make(map[uint]*entities.ProductImage),
+	}
+}
+
+func (repository *MemoryProductImageRepository) Save(ctx context.Context, image *entities.ProductImage, limit int) (uint, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	count := 0
+	position := 0
+
+	for _, existing := range repository.images {
+		if !isDeleted(&existing.Model) && existing.ProductID == image.ProductID {
+			count++
+			position = max(position, existing.Position+1)
+		}
+	}
+
+	if count >= limit {
+		return 0, ErrImageLimitReached
+	}
+
+	image.Position = position
+	image.IsPrimary = count == 0
+
+	repository.lastID++
+
+	now := time.Now()
+
+	image.ID = repository.lastID
+	image.CreatedAt = now
+	image.UpdatedAt = now
+
+	stored := *image
+	repository.images[image.ID] = &stored
+
+	return image.ID, nil
+}
+
+func (repository *MemoryProductImageRepository) FindByID(ctx context.Context, ID uint) (*entities.ProductImage, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	image, found := repository.images[ID]
+
+	if !found || isDeleted(&image.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *image
+
+	return &copied, nil
+}
+
+func (repository *MemoryProductImageRepository) FindByProductID(ctx context.Context, productID uint) []entities.ProductImage {
+	return repository.FindByProductIDs(ctx, []uint{productID})
+}
+
+func (repository *MemoryProductImageRepository) FindByProductIDs(ctx context.Context, productIDs []uint) []entities.ProductImage {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(productIDs))
+
+	for _, productID := range productIDs {
+		wanted[productID] = true
+	}
+
+	images := []entities.ProductImage{}
+
+	for _, image := range repository.images {
+		if !isDeleted(&image.Model) && wanted[image.ProductID] {
+			images = append(images, *image)
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		a, b := &images[i], &images[j]
+
+		if a.ProductID != b.ProductID {
+			return a.ProductID < b.ProductID
+		}
+
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+
+		return a.ID < b.ID
+	})
+
+	return images
+}
+
+func (repository *MemoryProductImageRepository) UpdatePositions(ctx context.Context, productID uint, positions map[uint]int) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for ID, position := range positions {
+		if image, found := repository.images[ID]; found && image.ProductID == productID {
+			image.Position = position
+			image.UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductImageRepository) SetPrimary(ctx context.Context, productID uint, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, image := range repository.images {
+		if image.ProductID == productID {
+			image.IsPrimary = image.ID == ID
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductImageRepository) DeleteByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if image, found := repository.images[ID]; found {
+		markDeleted(&image.Model)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+// productCommentStore is implemented by MemoryCommentRepository, whose
+// comments are deleted, restored and purged together with their product.
+type productCommentStore interface {
+	deleteByProductID(productID uint, deletedAt time.Time)
+	restoreByProductID(productID uint, deletedAt time.Time)
+	purgeByProductID(productID uint)
+}
+
+type MemoryProductRepository struct {
+	mu       sync.RWMutex
+	lastID   uint
+	products map[uint]*entities.Product
+	comments productCommentStore
+}
+
+func InitMemoryProductRepository() ProductRepository {
+	return &MemoryProductRepository{
+		products: make(map[uint]*entities.Product),
+	}
+}
+
+func (repository *MemoryProductRepository) Save(ctx context.Context, product *entities.Product) (uint, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	repository.lastID++
+
+	now := time.Now()
+
+	product.ID = repository.lastID
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	product.Version = 1
+
+	stored := *product
+	repository.products[product.ID] = &stored
+
+	return product.ID, nil
+}
+
+func (repository *MemoryProductRepository) FindByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	product, found := repository.products[ID]
+
+	if !found || isDeleted(&product.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *product
+
+	return &copied, nil
+}
+
+func (repository *MemoryProductRepository) FindAll(ctx context.Context, page paging.Page, sort paging.Sort) []entities.Product {
+	products := repository.find(func(product *entities.Product) bool {
+		return true
+	})
+
+	if sort == paging.SortRating {
+		return sortedPageOf(products, page, func(a *entities.Product, b *entities.Product) bool {
+			if a.Rating.Average != b.Rating.Average {
+				return a.Rating.Average > b.Rating.Average
+			}
+
+			if a.Rating.Count != b.Rating.Count {
+				return a.Rating.Count > b.Rating.Count
+			}
+
+			return a.ID < b.ID
+		})
+	}
+
+	return productPage(products, page)
+}
+
+func (repository *MemoryProductRepository) FindByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product {
+	products := repository.find(func(product *entities.Product) bool {
+		return product.UserID == userID
+	})
+
+	return productPage(products, page)
+}
+
+func (repository *MemoryProductRepository) find(match func(*entities.Product) bool) []entities.Product {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	products := []entities.Product{}
+
+	for _, product := range repository.products {
+		if !isDeleted(&product.Model) && match(product) {
+			products = append(products, *product)
+		}
+	}
+
+	return products
+}
+
+func productPage(products []entities.Product, page paging.Page) []entities.Product {
+	return pageOf(products, page, func(product *entities.Product) uint {
+		return product.ID
+	})
+}
+
+func (repository *MemoryProductRepository) UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	existing, found := repository.products[ID]
+
+	if !found || isDeleted(&existing.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	if existing.Version != updatedProduct.Version {
+		return ErrStaleVersion
+	}
+
+	// The owner never changes and the rating is maintained by the review
+	// repository.
+	existing.Name = updatedProduct.Name
+	existing.Description = updatedProduct.Description
+	existing.Price = updatedProduct.Price
+	existing.UpdatedAt = time.Now()
+	existing.Version++
+
+	updatedProduct.ID = ID
+	updatedProduct.UpdatedAt = existing.UpdatedAt
+	updatedProduct.Version = existing.Version
+
+	return nil
+}
+
+// setRating stores the aggregated rating of a product, it is called by the
+// review repository whenever the reviews of the product change.
+func (repository *MemoryProductRepository) setRating(ID uint, rating entities.ProductRating) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if product, found := repository.products[ID]; found {
+		product.Rating = rating
+		product.UpdatedAt = time.Now()
+	}
+}
+
+func (repository *MemoryProductRepository) DeleteByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	product, found := repository.products[ID]
+
+	if !found || isDeleted(&product.Model) {
+		return nil
+	}
+
+	markDeleted(&product.Model)
+
+	if repository.comments != nil {
+		repository.comments.deleteByProductID(ID, product.DeletedAt.Time)
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	products := []entities.Product{}
+
+	for _, product := range repository.products {
+		if isDeleted(&product.Model) && product.UserID == userID {
+			products = append(products, *product)
+		}
+	}
+
+	return productPage(products, page)
+}
+
+func (repository *MemoryProductRepository) FindDeletedByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	product, found := repository.products[ID]
+
+	if !found || !isDeleted(&product.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *product
+
+	return &copied, nil
+}
+
+func (repository *MemoryProductRepository) FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Product {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	products := []entities.Product{}
+
+	for _, product := range repository.products {
+		if isDeleted(&product.Model) && product.DeletedAt.Time.Before(before) {
+			products = append(products, *product)
+		}
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].DeletedAt.Time.Before(products[j].DeletedAt.Time)
+	})
+
+	return products[:min(limit, len(products))]
+}
+
+func (repository *MemoryProductRepository) RestoreByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	product, found := repository.products[ID]
+
+	if !found || !isDeleted(&product.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	deletedAt := product.DeletedAt.Time
+	product.DeletedAt = gorm.DeletedAt{}
+	product.UpdatedAt = time.Now()
+
+	if repository.comments != nil {
+		repository.comments.restoreByProductID(ID, deletedAt)
+	}
+
+	return nil
+}
+
+func (repository *MemoryProductRepository) PurgeByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	product, found := repository.products[ID]
+
+	if !found || !isDeleted(&product.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(repository.products, ID)
+
+	if repository.comments != nil {
+		repository.comments.purgeByProductID(ID)
+	}
+
+	return nil
+}
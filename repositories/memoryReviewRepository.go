@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+// productRatingStore is implemented by MemoryProductRepository, whose ratings
+// the memory review repository keeps up to date.
+type productRatingStore interface {
+	setRating(ID uint, rating entities.ProductRating)
+}
+
+type MemoryReviewRepository struct {
+	mu           sync.RWMutex
+	lastID       uint
+	lastVoteID   uint
+	reviews      map[uint]*entities.Review
+	votes        map[uint]*entities.ReviewVote
+	productStore ProductRepository
+}
+
+/* InitMemoryReviewRepository returns a review repository for the products in
+* the given repository. Like the database, where reviews reference products,
+* it refuses reviews of unknown products and stores product ratings with the
+* products when they come from a memory product repository. */
+func InitMemoryReviewRepository(products ProductRepository) ReviewRepository {
+	return &MemoryReviewRepository{
+		reviews:      make(map[uint]*entities.Review),
+		votes:        make(map[uint]*entities.ReviewVote),
+		productStore: products,
+	}
+}
+
+func (repository *MemoryReviewRepository) Save(ctx context.Context, review *entities.Review) (uint, error) {
+	_, err := repository.productStore.FindByID(ctx, review.ProductID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, existing := range repository.reviews {
+		if !isDeleted(&existing.Model) && existing.ProductID == review.ProductID && existing.UserID == review.UserID {
+			return 0, gorm.ErrDuplicatedKey
+		}
+	}
+
+	repository.lastID++
+
+	now := time.Now()
+
+	review.ID = repository.lastID
+	review.CreatedAt = now
+	review.UpdatedAt = now
+
+	stored := *review
+	repository.reviews[review.ID] = &stored
+
+	repository.refreshProductRating(review.ProductID)
+
+	return review.ID, nil
+}
+
+func (repository *MemoryReviewRepository) FindByID(ctx context.Context, ID uint) (*entities.Review, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	review, found := repository.reviews[ID]
+
+	if !found || isDeleted(&review.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *review
+
+	return &copied, nil
+}
+
+func (repository *MemoryReviewRepository) FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Review {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	reviews := []entities.Review{}
+
+	for _, review := range repository.reviews {
+		if !isDeleted(&review.Model) && review.ProductID == productID {
+			reviews = append(reviews, *review)
+		}
+	}
+
+	return pageOf(reviews, page, func(review *entities.Review) uint {
+		return review.ID
+	})
+}
+
+func (repository *MemoryReviewRepository) UpdateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	existing, found := repository.reviews[ID]
+
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+
+	updatedReview.ID = ID
+	updatedReview.UpdatedAt = time.Now()
+
+	stored := *updatedReview
+
+	stored.CreatedAt = existing.CreatedAt
+
+	// Vote counts are maintained by SaveVote and DeleteVote.
+	stored.HelpfulCount = existing.HelpfulCount
+	stored.UnhelpfulCount = existing.UnhelpfulCount
+
+	repository.reviews[ID] = &stored
+
+	repository.refreshProductRating(stored.ProductID)
+
+	return nil
+}
+
+func (repository *MemoryReviewRepository) DeleteByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	review, found := repository.reviews[ID]
+
+	if !found || isDeleted(&review.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	markDeleted(&review.Model)
+
+	repository.refreshProductRating(review.ProductID)
+
+	return nil
+}
+
+func (repository *MemoryReviewRepository) SaveVote(ctx context.Context, vote *entities.ReviewVote) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	review, found := repository.reviews[vote.ReviewID]
+
+	if !found || isDeleted(&review.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+
+	if existing := repository.findVote(vote.ReviewID, vote.UserID); existing != nil {
+		vote.Model = existing.Model
+	} else {
+		repository.lastVoteID++
+
+		vote.ID = repository.lastVoteID
+		vote.CreatedAt = now
+	}
+
+	vote.UpdatedAt = now
+
+	stored := *vote
+	repository.votes[vote.ID] = &stored
+
+	repository.refreshVoteCounts(review)
+
+	return nil
+}
+
+func (repository *MemoryReviewRepository) DeleteVote(ctx context.Context, reviewID uint, userID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	review, found := repository.reviews[reviewID]
+
+	if !found || isDeleted(&review.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	if existing := repository.findVote(reviewID, userID); existing != nil {
+		markDeleted(&existing.Model)
+	}
+
+	repository.refreshVoteCounts(review)
+
+	return nil
+}
+
+func (repository *MemoryReviewRepository) findVote(reviewID uint, userID uint) *entities.ReviewVote {
+	for _, vote := range repository.votes {
+		if !isDeleted(&vote.Model) && vote.ReviewID == reviewID && vote.UserID == userID {
+			return vote
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryReviewRepository) refreshProductRating(productID uint) {
+	store, ok := repository.productStore.(productRatingStore)
+
+	if !ok {
+		return
+	}
+
+	histogram := make(map[int]int64)
+
+	for _, review := range repository.reviews {
+		if !isDeleted(&review.Model) && review.ProductID == productID {
+			histogram[review.Rating]++
+		}
+	}
+
+	store.setRating(productID, entities.NewProductRating(histogram))
+}
+
+func (repository *MemoryReviewRepository) refreshVoteCounts(review *entities.Review) {
+	review.HelpfulCount = 0
+	review.UnhelpfulCount = 0
+
+	for _, vote := range repository.votes {
+		if isDeleted(&vote.Model) || vote.ReviewID != review.ID {
+			continue
+		}
+
+		if vote.Helpful {
+			review.HelpfulCount++
+		} else {
+			review.UnhelpfulCount++
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	lastID uint
+	users  map[uint]*entities.User
+}
+
+func InitMemoryUserRepository() UserRepository {
+	return &MemoryUserRepository{
+		users: make(map[uint]*entities.User),
+	}
+}
+
+func (repository *MemoryUserRepository) Save(ctx context.Context, user *entities.User) (uint, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return 0, err
+	}
+
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if repository.usernameTaken(user.Username, 0) {
+		return 0, gorm.ErrDuplicatedKey
+	}
+
+	repository.lastID++
+
+	now := time.Now()
+
+	user.ID = repository.lastID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Version = 1
+	user.Password = string(passwordHash)
+
+	// Like the column default.
+	if user.Role == "" {
+		user.Role = entities.RoleUser
+	}
+
+	stored := *user
+	repository.users[user.ID] = &stored
+
+	return user.ID, nil
+}
+
+func (repository *MemoryUserRepository) FindByID(ctx context.Context, ID uint) (*entities.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	user, found := repository.users[ID]
+
+	if !found || isDeleted(&user.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	copied := *user
+
+	return &copied, nil
+}
+
+func (repository *MemoryUserRepository) FindByIDs(ctx context.Context, IDs []uint) []entities.User {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(IDs))
+
+	for _, ID := range IDs {
+		wanted[ID] = true
+	}
+
+	users := []entities.User{}
+
+	for _, user := range repository.users {
+		if wanted[user.ID] && !isDeleted(&user.Model) {
+			users = append(users, *user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users
+}
+
+func (repository *MemoryUserRepository) FindByUseraname(ctx context.Context, username string) (*entities.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, user := range repository.users {
+		if user.Username == username && !isDeleted(&user.Model) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (repository *MemoryUserRepository) UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	existing, found := repository.users[ID]
+
+	if !found || isDeleted(&existing.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	if existing.Version != updatedUser.Version {
+		return ErrStaleVersion
+	}
+
+	if repository.usernameTaken(updatedUser.Username, ID) {
+		return gorm.ErrDuplicatedKey
+	}
+
+	existing.FirstName = updatedUser.FirstName
+	existing.LastName = updatedUser.LastName
+	existing.Email = updatedUser.Email
+	existing.Username = updatedUser.Username
+	existing.Role = updatedUser.Role
+	existing.UpdatedAt = time.Now()
+	existing.Version++
+
+	updatedUser.ID = ID
+	updatedUser.UpdatedAt = existing.UpdatedAt
+	updatedUser.Version = existing.Version
+
+	return nil
+}
+
+func (repository *MemoryUserRepository) UpdatePasswordByID(ctx context.Context, ID uint, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return err
+	}
+
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	user, found := repository.users[ID]
+
+	if !found || isDeleted(&user.Model) {
+		return gorm.ErrRecordNotFound
+	}
+
+	user.Password = string(passwordHash)
+	user.UpdatedAt = time.Now()
+	user.Version++
+
+	return nil
+}
+
+func (repository *MemoryUserRepository) DeleteByID(ctx context.Context, ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if user, found := repository.users[ID]; found {
+		markDeleted(&user.Model)
+	}
+
+	return nil
+}
+
+// usernameTaken must be called with the lock held. Like the unique index in
+// Postgres it also considers soft deleted users.
+func (repository *MemoryUserRepository) usernameTaken(username string, exceptID uint) bool {
+	for ID, user := range repository.users {
+		if ID != exceptID && user.Username == username {
+			return true
+		}
+	}
+
+	return false
+}
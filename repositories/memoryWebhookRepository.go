@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type MemoryWebhookRepository struct {
+	mu             sync.Mutex
+	lastEndpointID uint
+	lastDeliveryID uint
+	lastAttemptID  uint
+	endpoints      map[uint]*entities.WebhookEndpoint
+	deliveries     map[uint]*entities.WebhookDelivery
+	attempts       map[uint][]entities.WebhookAttempt
+}
+
+func InitMemoryWebhookRepository() WebhookRepository {
+	return &MemoryWebhookRepository{
+		endpoints:  make(map[uint]*entities.WebhookEndpoint),
+		deliveries: make(map[uint]*entities.WebhookDelivery),
+		attempts:   make(map[uint][]entities.WebhookAttempt),
+	}
+}
+
+func (repository *MemoryWebhookRepository) SaveEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) (uint, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	repository.lastEndpointID++
+
+	now := time.Now()
+
+	endpoint.ID = repository.lastEndpointID
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+
+	stored := *endpoint
+	repository.endpoints[endpoint.ID] = &stored
+
+	return endpoint.ID, nil
+}
+
+func (repository *MemoryWebhookRepository) FindEndpointByID(ctx context.Context, ID uint) (*entities.WebhookEndpoint, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	endpoint, err := repository.findEndpoint(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := *endpoint
+
+	return &found, nil
+}
+
+func (repository *MemoryWebhookRepository) FindEndpointsByUserID(ctx context.Context, userID uint) []entities.WebhookEndpoint {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	endpoints := []entities.WebhookEndpoint{}
+
+	for _, endpoint := range repository.endpoints {
+		if !isDeleted(&endpoint.Model) && endpoint.UserID == userID {
+			endpoints = append(endpoints, *endpoint)
+		}
+	}
+
+	slices.SortFunc(endpoints, func(a entities.WebhookEndpoint, b entities.WebhookEndpoint) int {
+		return int(a.ID) - int(b.ID)
+	})
+
+	return endpoints
+}
+
+func (repository *MemoryWebhookRepository) UpdateEndpointByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error {
+	return repository.updateEndpoint(ID, func(endpoint *entities.WebhookEndpoint) {
+		endpoint.URL = updatedEndpoint.URL
+		endpoint.Description = updatedEndpoint.Description
+		endpoint.EventTypes = updatedEndpoint.EventTypes
+		endpoint.Enabled = updatedEndpoint.Enabled
+		endpoint.ConsecutiveFailures = updatedEndpoint.ConsecutiveFailures
+		endpoint.DisabledAt = updatedEndpoint.DisabledAt
+	})
+}
+
+func (repository *MemoryWebhookRepository) DeleteEndpointByID(ctx context.Context, ID uint) error {
+	return repository.updateEndpoint(ID, func(endpoint *entities.WebhookEndpoint) {
+		markDeleted(&endpoint.Model)
+	})
+}
+
+func (repository *MemoryWebhookRepository) RecordEndpointFailure(ctx context.Context, ID uint, disableAfter int, at time.Time) (bool, error) {
+	var disabled bool
+
+	err := repository.updateEndpoint(ID, func(endpoint *entities.WebhookEndpoint) {
+		endpoint.ConsecutiveFailures++
+
+		if endpoint.Enabled && endpoint.ConsecutiveFailures >= disableAfter {
+			endpoint.Enabled = false
+			endpoint.DisabledAt = &at
+			disabled = true
+		}
+	})
+
+	return disabled, err
+}
+
+func (repository *MemoryWebhookRepository) ResetEndpointFailures(ctx context.Context, ID uint) error {
+	return repository.updateEndpoint(ID, func(endpoint *entities.WebhookEndpoint) {
+		endpoint.ConsecutiveFailures = 0
+	})
+}
+
+func (repository *MemoryWebhookRepository) findEndpoint(ID uint) (*entities.WebhookEndpoint, error) {
+	endpoint, found := repository.endpoints[ID]
+
+	if !found || isDeleted(&endpoint.Model) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return endpoint, nil
+}
+
+func (repository *MemoryWebhookRepository) updateEndpoint(ID uint, apply func(*entities.WebhookEndpoint)) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	endpoint, err := repository.findEndpoint(ID)
+
+	if err != nil {
+		return err
+	}
+
+	apply(endpoint)
+	endpoint.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (repository *MemoryWebhookRepository) SaveDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if delivery.EventID != nil {
+		for _, existing := range repository.deliveries {
+			if existing.EndpointID == delivery.EndpointID && existing.EventID != nil && *existing.EventID == *delivery.EventID {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+	}
+
+	repository.lastDeliveryID++
+
+	delivery.ID = repository.lastDeliveryID
+	delivery.CreatedAt = time.Now()
+
+	stored := *delivery
+	stored.Attempts = nil
+	repository.deliveries[delivery.ID] = &stored
+
+	return nil
+}
+
+func (repository *MemoryWebhookRepository) SaveAttempt(ctx context.Context, attempt *entities.WebhookAttempt) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if _, found := repository.deliveries[attempt.DeliveryID]; !found {
+		return gorm.ErrForeignKeyViolated
+	}
+
+	repository.lastAttemptID++
+
+	attempt.ID = repository.lastAttemptID
+	attempt.CreatedAt = time.Now()
+
+	repository.attempts[attempt.DeliveryID] = append(repository.attempts[attempt.DeliveryID], *attempt)
+
+	return nil
+}
+
+func (repository *MemoryWebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	due := []entities.WebhookDelivery{}
+
+	for _, delivery := range repository.deliveries {
+		if !delivery.IsFinished() && !delivery.NextAttemptAt.After(now) {
+			due = append(due, *delivery)
+		}
+	}
+
+	due = pageOf(due, paging.Page{Page: 1, PageSize: limit}, func(delivery *entities.WebhookDelivery) uint {
+		return delivery.ID
+	})
+
+	for _, delivery := range due {
+		repository.deliveries[delivery.ID].NextAttemptAt = now.Add(lease)
+	}
+
+	return due, nil
+}
+
+func (repository *MemoryWebhookRepository) UpdateDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	stored, found := repository.deliveries[delivery.ID]
+
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+
+	stored.AttemptCount = delivery.AttemptCount
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastStatusCode = delivery.LastStatusCode
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+	stored.FailedAt = delivery.FailedAt
+
+	return nil
+}
+
+func (repository *MemoryWebhookRepository) FindDeliveriesByEndpointID(ctx context.Context, endpointID uint, page paging.Page) []entities.WebhookDelivery {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	deliveries := []entities.WebhookDelivery{}
+
+	for _, delivery := range repository.deliveries {
+		if delivery.EndpointID == endpointID {
+			found := *delivery
+			found.Attempts = slices.Clone(repository.attempts[delivery.ID])
+			deliveries = append(deliveries, found)
+		}
+	}
+
+	return sortedPageOf(deliveries, page, func(a *entities.WebhookDelivery, b *entities.WebhookDelivery) bool {
+		return a.ID > b.ID
+	})
+}
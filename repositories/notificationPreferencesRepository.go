@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationPreferencesRepository interface {
+	FindByUserID(ctx context.Context, userID uint) (*entities.NotificationPreferences, error)
+	// Save creates the preferences of a user or replaces the existing ones.
+	Save(ctx context.Context, preferences *entities.NotificationPreferences) error
+}
+
+type PostgresNotificationPreferencesRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitNotificationPreferencesRepository(DB *gorm.DB, logger *slog.Logger) NotificationPreferencesRepository {
+	return &PostgresNotificationPreferencesRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresNotificationPreferencesRepository) FindByUserID(ctx context.Context, userID uint) (*entities.NotificationPreferences, error) {
+	var preferences entities.NotificationPreferences
+
+	result := dbFor(ctx, repository.DB).Take(&preferences, userID)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &preferences, nil
+}
+
+func (repository *PostgresNotificationPreferencesRepository) Save(ctx context.Context, preferences *entities.NotificationPreferences) error {
+	result := dbFor(ctx, repository.DB).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "locale", "comment_emails"}),
+		}).
+		Create(preferences)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not save notification preferences", "user_id", preferences.UserID, "error", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+)
+
+type NotificationRepository interface {
+	// Save creates a notification. A notification of the same event for the
+	// same user makes it fail with gorm.ErrDuplicatedKey.
+	Save(ctx context.Context, notification *entities.Notification) error
+	// FindByUserID returns a page of the notifications of a user, newest
+	// first, only the unread ones if unreadOnly is set.
+	FindByUserID(ctx context.Context, userID uint, unreadOnly bool, page paging.Page) []entities.Notification
+	// FindByUserIDAfter returns up to limit notifications of a user with an ID
+	// greater than afterID, oldest first.
+	FindByUserIDAfter(ctx context.Context, userID uint, afterID uint, limit int) []entities.Notification
+	CountUnread(ctx context.Context, userID uint) int64
+	// MarkRead marks a notification of a user as read, keeping the time it
+	// was first read.
+	MarkRead(ctx context.Context, userID uint, ID uint, at time.Time) error
+	// MarkAllRead marks every unread notification of a user as read and
+	// returns how many there were.
+	MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error)
+}
+
+type PostgresNotificationRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitNotificationRepository(DB *gorm.DB, logger *slog.Logger) NotificationRepository {
+	return &PostgresNotificationRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresNotificationRepository) Save(ctx context.Context, notification *entities.Notification) error {
+	err := dbFor(ctx, repository.DB).Create(notification).Error
+
+	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		repository.Logger.ErrorContext(ctx, "could not save notification", "user_id", notification.UserID, "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresNotificationRepository) FindByUserID(ctx context.Context, userID uint, unreadOnly bool, page paging.Page) []entities.Notification {
+	var notifications []entities.Notification
+
+	query := dbFor(ctx, repository.DB).Scopes(paging.Paginate(page)).Where("user_id = ?", userID)
+
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	query.Order("id DESC").Find(&notifications)
+
+	return notifications
+}
+
+func (repository *PostgresNotificationRepository) FindByUserIDAfter(ctx context.Context, userID uint, afterID uint, limit int) []entities.Notification {
+	var notifications []entities.Notification
+
+	dbFor(ctx, repository.DB).
+		Where("user_id = ? AND id > ?", userID, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&notifications)
+
+	return notifications
+}
+
+func (repository *PostgresNotificationRepository) CountUnread(ctx context.Context, userID uint) int64 {
+	var count int64
+
+	dbFor(ctx, repository.DB).
+		Model(&entities.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count)
+
+	return count
+}
+
+func (repository *PostgresNotificationRepository) MarkRead(ctx context.Context, userID uint, ID uint, at time.Time) error {
+	db := dbFor(ctx, repository.DB)
+
+	result := db.
+		Model(&entities.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", ID, userID).
+		Update("read_at", at)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not mark notification read", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing was updated, either because the notification was already read
+	// or because the user has no such notification.
+	return db.Where("id = ? AND user_id = ?", ID, userID).Take(&entities.Notification{}).Error
+}
+
+func (repository *PostgresNotificationRepository) MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error) {
+	result := dbFor(ctx, repository.DB).
+		Model(&entities.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", at)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not mark notifications read", "user_id", userID, "error", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
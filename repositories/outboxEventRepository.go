@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxEventRepository interface {
+	Save(ctx context.Context, event *entities.OutboxEvent) error
+	/* ClaimDue returns up to limit pending events due at now, oldest first,
+	* and postpones their next attempt by lease. Dispatchers running at the
+	* same time claim different events, and events claimed by a dispatcher
+	* which stopped before finishing them become due again once the lease
+	* runs out. */
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.OutboxEvent, error)
+	MarkDispatched(ctx context.Context, ID uint, at time.Time) error
+	MarkFailed(ctx context.Context, ID uint, attempts int, nextAttemptAt time.Time, lastError string) error
+	MarkDead(ctx context.Context, ID uint, attempts int, at time.Time, lastError string) error
+	FindDead(ctx context.Context, page paging.Page) []entities.OutboxEvent
+	// Requeue makes a dead event pending again with all of its attempts. It
+	// fails with gorm.ErrRecordNotFound when there is no such dead event.
+	Requeue(ctx context.Context, ID uint, now time.Time) error
+	DeleteDispatchedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type PostgresOutboxEventRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitOutboxEventRepository(DB *gorm.DB, logger *slog.Logger) OutboxEventRepository {
+	return &PostgresOutboxEventRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresOutboxEventRepository) Save(ctx context.Context, event *entities.OutboxEvent) error {
+	err := dbFor(ctx, repository.DB).Create(event).Error
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save outbox event", "type", event.Type, "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresOutboxEventRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.OutboxEvent, error) {
+	var events []entities.OutboxEvent
+
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		query := tx.
+			Where("dispatched_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").
+			Limit(limit)
+
+		// SQLite has a single writer and no row locks to skip.
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		err := query.Find(&events).Error
+
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		IDs := make([]uint, len(events))
+
+		for i, event := range events {
+			IDs[i] = event.ID
+		}
+
+		return tx.Model(&entities.OutboxEvent{}).Where("id IN ?", IDs).Update("next_attempt_at", now.Add(lease)).Error
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not claim outbox events", "error", err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (repository *PostgresOutboxEventRepository) MarkDispatched(ctx context.Context, ID uint, at time.Time) error {
+	return repository.update(ctx, ID, map[string]any{
+		"dispatched_at": at,
+		"last_error":    "",
+	})
+}
+
+func (repository *PostgresOutboxEventRepository) MarkFailed(ctx context.Context, ID uint, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return repository.update(ctx, ID, map[string]any{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	})
+}
+
+func (repository *PostgresOutboxEventRepository) MarkDead(ctx context.Context, ID uint, attempts int, at time.Time, lastError string) error {
+	return repository.update(ctx, ID, map[string]any{
+		"attempts":   attempts,
+		"dead_at":    at,
+		"last_error": lastError,
+	})
+}
+
+func (repository *PostgresOutboxEventRepository) update(ctx context.Context, ID uint, columns map[string]any) error {
+	result := dbFor(ctx, repository.DB).Model(&entities.OutboxEvent{}).Where("id = ?", ID).Updates(columns)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not update outbox event", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresOutboxEventRepository) FindDead(ctx context.Context, page paging.Page) []entities.OutboxEvent {
+	var events []entities.OutboxEvent
+
+	dbFor(ctx, repository.DB).
+		Scopes(paging.Paginate(page)).
+		Where("dead_at IS NOT NULL").
+		Order("id").
+		Find(&events)
+
+	return events
+}
+
+func (repository *PostgresOutboxEventRepository) Requeue(ctx context.Context, ID uint, now time.Time) error {
+	result := dbFor(ctx, repository.DB).
+		Model(&entities.OutboxEvent{}).
+		Where("id = ? AND dead_at IS NOT NULL", ID).
+		Updates(map[string]any{
+			"attempts":        0,
+			"next_attempt_at": now,
+			"dead_at":         nil,
+		})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not requeue outbox event", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresOutboxEventRepository) DeleteDispatchedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := dbFor(ctx, repository.DB).Where("dispatched_at < ?", before).Delete(&entities.OutboxEvent{})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete dispatched outbox events", "error", result.Error)
+	}
+
+	return result.RowsAffected, result.Error
+}
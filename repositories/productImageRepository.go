@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"gorm.io/gorm"
+)
+
+// ErrImageLimitReached is returned by Save when the product already has as many
+// images as it may.
+var ErrImageLimitReached = errors.New("product has reached its image limit")
+
+type ProductImageRepository interface {
+	/* Save adds the image after the last image of its product, making it the
+	* primary image when it is the first one, unless the product already has
+	* limit images. The images are counted and the new one inserted while the
+	* product is locked, so concurrent uploads can not go over the limit. */
+	Save(ctx context.Context, image *entities.ProductImage, limit int) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.ProductImage, error)
+	FindByProductID(ctx context.Context, productID uint) []entities.ProductImage
+	FindByProductIDs(ctx context.Context, productIDs []uint) []entities.ProductImage
+	UpdatePositions(ctx context.Context, productID uint, positions map[uint]int) error
+	SetPrimary(ctx context.Context, productID uint, ID uint) error
+	DeleteByID(ctx context.Context, ID uint) error
+}
+
+type PostgresProductImageRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitProductImageRepository(DB *gorm.DB, logger *slog.Logger) ProductImageRepository {
+	return &PostgresProductImageRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresProductImageRepository) Save(ctx context.Context, image *entities.ProductImage, limit int) (uint, error) {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := lockProduct(tx, image.ProductID)
+
+		if err != nil {
+			return err
+		}
+
+		var existing struct {
+			Count        int
+			LastPosition *int
+		}
+
+		err = tx.Model(&entities.ProductImage{}).
+			Select("COUNT(*) AS count, MAX(position) AS last_position").
+			Where("product_id = ?", image.ProductID).
+			Scan(&existing).Error
+
+		if err != nil {
+			return err
+		}
+
+		if existing.Count >= limit {
+			return ErrImageLimitReached
+		}
+
+		image.Position = 0
+		image.IsPrimary = existing.Count == 0
+
+		if existing.LastPosition != nil {
+			image.Position = *existing.LastPosition + 1
+		}
+
+		return tx.Create(image).Error
+	})
+
+	if errors.Is(err, ErrImageLimitReached) {
+		return 0, err
+	}
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save new product image", "error", err)
+		return 0, err
+	}
+
+	return image.ID, nil
+}
+
+func (repository *PostgresProductImageRepository) FindByID(ctx context.Context, ID uint) (*entities.ProductImage, error) {
+	var image entities.ProductImage
+
+	result := dbFor(ctx, repository.DB).First(&image, ID)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not find product image", "id", ID, "error", result.Error)
+		return nil, result.Error
+	}
+
+	return &image, nil
+}
+
+func (repository *PostgresProductImageRepository) FindByProductID(ctx context.Context, productID uint) []entities.ProductImage {
+	var images []entities.ProductImage
+
+	dbFor(ctx, repository.DB).
+		Where("product_id = ?", productID).
+		Order("position, id").
+		Find(&images)
+
+	return images
+}
+
+func (repository *PostgresProductImageRepository) FindByProductIDs(ctx context.Context, productIDs []uint) []entities.ProductImage {
+	var images []entities.ProductImage
+
+	if len(productIDs) == 0 {
+		return images
+	}
+
+	dbFor(ctx, repository.DB).
+		Where("product_id IN ?", productIDs).
+		Order("product_id, position, id").
+		Find(&images)
+
+	return images
+}
+
+func (repository *PostgresProductImageRepository) UpdatePositions(ctx context.Context, productID uint, positions map[uint]int) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		for ID, position := range positions {
+			result := tx.Model(&entities.ProductImage{}).
+				Where("id = ? AND product_id = ?", ID, productID).
+				Update("position", position)
+
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not reorder product images", "product_id", productID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (repository *PostgresProductImageRepository) SetPrimary(ctx context.Context, productID uint, ID uint) error {
+	result := dbFor(ctx, repository.DB).
+		Model(&entities.ProductImage{}).
+		Where("product_id = ?", productID).
+		Update("is_primary", gorm.Expr("id = ?", ID))
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not set primary product image", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (repository *PostgresProductImageRepository) DeleteByID(ctx context.Context, ID uint) error {
+	result := dbFor(ctx, repository.DB).Delete(&entities.ProductImage{}, ID)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete product image", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
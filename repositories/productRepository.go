@@ -1,7 +1,9 @@
 package repositories
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"time"
 
 	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/paging"
@@ -9,86 +11,244 @@ import (
 )
 
 type ProductRepository interface {
-	Save(product *entities.Product) (uint, error)
-	FindByID(ID uint) (*entities.Product, error)
-	FindAll(page paging.Page) []entities.Product
-	FindByUserID(userID uint, page paging.Page) []entities.Product
-	UpdateByID(ID uint, updatedProduct *entities.Product) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, product *entities.Product) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Product, error)
+	FindAll(ctx context.Context, page paging.Page, sort paging.Sort) []entities.Product
+	FindByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product
+	UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error
+	DeleteByID(ctx context.Context, ID uint) error
+	FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product
+	FindDeletedByID(ctx context.Context, ID uint) (*entities.Product, error)
+	FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Product
+	RestoreByID(ctx context.Context, ID uint) error
+	PurgeByID(ctx context.Context, ID uint) error
 }
 
 type PostgresProductRepository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Logger *slog.Logger
 }
 
-func InitProductRepository(DB *gorm.DB) ProductRepository {
+func InitProductRepository(DB *gorm.DB, logger *slog.Logger) ProductRepository {
 	return &PostgresProductRepository{
-		DB: DB,
+		DB:     DB,
+		Logger: logger,
 	}
 }
 
-func (repository *PostgresProductRepository) Save(product *entities.Product) (uint, error) {
-	result := repository.DB.Create(product)
+func (repository *PostgresProductRepository) Save(ctx context.Context, product *entities.Product) (uint, error) {
+	result := dbFor(ctx, repository.DB).Create(product)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not save new product", result.Error)
+		repository.Logger.ErrorContext(ctx, "could not save new product", "error", result.Error)
 		return 0, result.Error
 	}
 
 	return product.ID, nil
 }
 
-func (repository *PostgresProductRepository) FindByID(ID uint) (*entities.Product, error) {
+func (repository *PostgresProductRepository) FindByID(ctx context.Context, ID uint) (*entities.Product, error) {
 	var product entities.Product
 
-	result := repository.DB.First(&product, ID)
+	result := dbFor(ctx, repository.DB).First(&product, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not find product with ID", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not find product", "id", ID, "error", result.Error)
 		return nil, result.Error
 	}
 
 	return &product, nil
 }
 
-func (repository *PostgresProductRepository) FindAll(page paging.Page) []entities.Product {
+func (repository *PostgresProductRepository) FindAll(ctx context.Context, page paging.Page, sort paging.Sort) []entities.Product {
 	var products []entities.Product
 
-	repository.DB.Scopes(paging.Paginate(page)).Find(&products)
+	query := dbFor(ctx, repository.DB).Scopes(paging.Paginate(page))
+
+	if sort == paging.SortRating {
+		query = query.Order("rating_average DESC, rating_count DESC")
+	}
+
+	query.Order("id").Find(&products)
 
 	return products
 }
 
-func (repository *PostgresProductRepository) FindByUserID(userID uint, page paging.Page) []entities.Product {
+func (repository *PostgresProductRepository) FindByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product {
 	var products []entities.Product
 
-	repository.DB.
+	dbFor(ctx, repository.DB).
 		Scopes(paging.Paginate(page)).
 		Where("user_id = ?", userID).
+		Order("id").
 		Find(&products)
 
 	return products
 }
 
-func (repository *PostgresProductRepository) UpdateByID(ID uint, updatedProduct *entities.Product) error {
+func (repository *PostgresProductRepository) UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error {
+	// The owner never changes and the rating is maintained by the review
+	// repository.
+	updatedAt, err := updateVersioned(dbFor(ctx, repository.DB), &entities.Product{}, ID, updatedProduct.Version, map[string]any{
+		"name":        updatedProduct.Name,
+		"description": updatedProduct.Description,
+		"price":       updatedProduct.Price,
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update product", "id", ID, "error", err)
+		return err
+	}
+
 	updatedProduct.ID = ID
+	updatedProduct.UpdatedAt = updatedAt
+	updatedProduct.Version++
+
+	return nil
+}
 
-	result := repository.DB.Save(updatedProduct)
+/* DeleteByID soft deletes a product together with its comments. The comments
+* are marked with the same deletion time as the product, which tells them apart
+* from comments deleted before and lets RestoreByID bring back just them. */
+func (repository *PostgresProductRepository) DeleteByID(ctx context.Context, ID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
 
-	if result.Error != nil {
-		log.Println("ERROR: could not update product with ID", ID, result.Error)
-		return result.Error
+		result := tx.Model(&entities.Product{}).Where("id = ?", ID).Update("deleted_at", now)
+
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&entities.Comment{}).Where("product_id = ?", ID).Update("deleted_at", now).Error
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete product", "id", ID, "error", err)
+		return err
 	}
 
 	return nil
 }
 
-func (repository *PostgresProductRepository) DeleteByID(ID uint) error {
-	result := repository.DB.Delete(&entities.Product{}, ID)
+func (repository *PostgresProductRepository) FindDeletedByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product {
+	var products []entities.Product
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Scopes(paging.Paginate(page)).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("id").
+		Find(&products)
+
+	return products
+}
+
+func (repository *PostgresProductRepository) FindDeletedByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	var product entities.Product
+
+	result := dbFor(ctx, repository.DB).Unscoped().Where("deleted_at IS NOT NULL").First(&product, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not delete product with ID", ID, result.Error)
-		return result.Error
+		return nil, result.Error
+	}
+
+	return &product, nil
+}
+
+// FindDeletedBefore returns up to limit products which were deleted before the
+// given time, oldest first.
+func (repository *PostgresProductRepository) FindDeletedBefore(ctx context.Context, before time.Time, limit int) []entities.Product {
+	var products []entities.Product
+
+	dbFor(ctx, repository.DB).
+		Unscoped().
+		Where("deleted_at < ?", before).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&products)
+
+	return products
+}
+
+// RestoreByID restores a deleted product together with the comments deleted
+// with it.
+func (repository *PostgresProductRepository) RestoreByID(ctx context.Context, ID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&entities.Comment{}).
+			Where("product_id = ? AND deleted_at = (?)", ID, tx.Unscoped().Model(&entities.Product{}).Select("deleted_at").Where("id = ?", ID)).
+			Update("deleted_at", nil).
+			Error
+
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&entities.Product{}).Where("id = ? AND deleted_at IS NOT NULL", ID).Update("deleted_at", nil)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not restore product", "id", ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+/* PurgeByID permanently deletes a deleted product with everything referencing
+* it: its comments and their reports, its reviews and their votes and its
+* images. The blobs of the images are left to the caller. */
+func (repository *PostgresProductRepository) PurgeByID(ctx context.Context, ID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		var product entities.Product
+
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").Select("id").First(&product, ID).Error
+
+		if err != nil {
+			return err
+		}
+
+		comments := tx.Unscoped().Model(&entities.Comment{}).Select("id").Where("product_id = ?", ID)
+		reviews := tx.Unscoped().Model(&entities.Review{}).Select("id").Where("product_id = ?", ID)
+
+		// Referencing rows go first.
+		purges := []struct {
+			model any
+			query string
+			arg   any
+		}{
+			{&entities.CommentReport{}, "comment_id IN (?)", comments},
+			{&entities.Comment{}, "product_id = ?", ID},
+			{&entities.ReviewVote{}, "review_id IN (?)", reviews},
+			{&entities.Review{}, "product_id = ?", ID},
+			{&entities.ProductImage{}, "product_id = ?", ID},
+			{&entities.Product{}, "id = ?", ID},
+		}
+
+		for _, purge := range purges {
+			err := tx.Unscoped().Where(purge.query, purge.arg).Delete(purge.model).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not purge product", "id", ID, "error", err)
+		return err
 	}
 
 	return nil
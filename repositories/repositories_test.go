@@ -0,0 +1,1346 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+type backend struct {
+	user    repositories.UserRepository
+	product repositories.ProductRepository
+	comment repositories.CommentRepository
+	review  repositories.ReviewRepository
+
+	productImage   repositories.ProductImageRepository
+	idempotencyKey repositories.IdempotencyKeyRepository
+	auditEvent     repositories.AuditEventRepository
+	outboxEvent    repositories.OutboxEventRepository
+	webhook        repositories.WebhookRepository
+	job            repositories.JobRepository
+	transactor     repositories.Transactor
+
+	notification            repositories.NotificationRepository
+	notificationPreferences repositories.NotificationPreferencesRepository
+}
+
+/* forEachBackend runs the test against every repository implementation. The
+* Postgres backend only runs when TEST_POSTGRES_HOST is set, for example
+* against the database from docker-compose.yml:
+*
+*	TEST_POSTGRES_HOST=localhost go test ./repositories
+ */
+func forEachBackend(t *testing.T, test func(t *testing.T, b *backend)) {
+	t.Run("memory", func(t *testing.T) {
+		products := repositories.InitMemoryProductRepository()
+
+		test(t, &backend{
+			user:    repositories.InitMemoryUserRepository(),
+			product: products,
+			comment: repositories.InitMemoryCommentRepository(products),
+			review:  repositories.InitMemoryReviewRepository(products),
+
+			productImage:   repositories.InitMemoryProductImageRepository(),
+			idempotencyKey: repositories.InitMemoryIdempotencyKeyRepository(),
+			auditEvent:     repositories.InitMemoryAuditEventRepository(),
+			outboxEvent:    repositories.InitMemoryOutboxEventRepository(),
+			webhook:        repositories.InitMemoryWebhookRepository(),
+			job:            repositories.InitMemoryJobRepository(),
+			transactor:     repositories.InitMemoryTransactor(),
+
+			notification:            repositories.InitMemoryNotificationRepository(),
+			notificationPreferences: repositories.InitMemoryNotificationPreferencesRepository(),
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, gormBackend(t, &infrastructure.DBEnv{
+			Driver: infrastructure.DBDriverSQLite,
+			Path:   infrastructure.SQLiteInMemoryPath,
+		}))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		host := os.Getenv("TEST_POSTGRES_HOST")
+
+		if host == "" {
+			t.Skip("TEST_POSTGRES_HOST not set")
+		}
+
+		test(t, gormBackend(t, &infrastructure.DBEnv{
+			Driver:   infrastructure.DBDriverPostgres,
+			Host:     host,
+			Port:     getenvOrDefault("TEST_POSTGRES_PORT", "5432"),
+			Name:     getenvOrDefault("TEST_POSTGRES_DB", "go_webstore_db"),
+			Username: getenvOrDefault("TEST_POSTGRES_USER", "postgres"),
+			Password: getenvOrDefault("TEST_POSTGRES_PASSWORD", "postgres_pass"),
+		}))
+	})
+}
+
+func gormBackend(t *testing.T, env *infrastructure.DBEnv) *backend {
+	t.Helper()
+
+	db, err := infrastructure.ConnectToDB(env)
+
+	if err != nil {
+		t.Fatalf("could not connect to %s: %v", env.Driver, err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	infrastructure.AutomigrateDB(db)
+
+	if env.Driver == infrastructure.DBDriverPostgres {
+		db.Exec("TRUNCATE users, products, product_images, comments, comment_reports, reviews, review_votes, idempotency_keys, audit_events, outbox_events, webhook_endpoints, webhook_deliveries, webhook_attempts, jobs, notification_preferences, notifications RESTART IDENTITY CASCADE")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return &backend{
+		user:    repositories.InitUserRepository(db, logger),
+		product: repositories.InitProductRepository(db, logger),
+		comment: repositories.InitCommentRepository(db, logger),
+		review:  repositories.InitReviewRepository(db, logger),
+
+		productImage:   repositories.InitProductImageRepository(db, logger),
+		idempotencyKey: repositories.InitIdempotencyKeyRepository(db, logger),
+		auditEvent:     repositories.InitAuditEventRepository(db, logger),
+		outboxEvent:    repositories.InitOutboxEventRepository(db, logger),
+		webhook:        repositories.InitWebhookRepository(db, logger),
+		job:            repositories.InitJobRepository(db, logger),
+		transactor:     repositories.InitTransactor(db),
+
+		notification:            repositories.InitNotificationRepository(db, logger),
+		notificationPreferences: repositories.InitNotificationPreferencesRepository(db, logger),
+	}
+}
+
+func getenvOrDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+func saveUser(t *testing.T, b *backend, username string) *entities.User {
+	t.Helper()
+
+	user := &entities.User{Email: username + "@example.com", Username: username, Password: "secret"}
+
+	if _, err := b.user.Save(context.Background(), user); err != nil {
+		t.Fatalf("could not save user %s: %v", username, err)
+	}
+
+	return user
+}
+
+func TestUserRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+
+		if alice.ID == 0 {
+			t.Fatalf("expected saved user to have an ID")
+		}
+
+		if alice.Password == "secret" {
+			t.Errorf("expected password to be hashed")
+		}
+
+		found, err := b.user.FindByUseraname(ctx, "alice")
+
+		if err != nil || found.ID != alice.ID {
+			t.Fatalf("expected to find alice by username, got %v, %v", found, err)
+		}
+
+		if err := b.user.UpdatePasswordByID(ctx, alice.ID, "changed"); err != nil {
+			t.Fatal(err)
+		}
+
+		changed, err := b.user.FindByID(ctx, alice.ID)
+
+		if err != nil || changed.Password == found.Password || changed.Password == "changed" || changed.Version != found.Version+1 {
+			t.Errorf("expected a new hashed password and version, got %+v, %v", changed, err)
+		}
+
+		if err := b.user.UpdatePasswordByID(ctx, 999, "changed"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected changing the password of a missing user to fail, got %v", err)
+		}
+
+		_, err = b.user.Save(ctx, &entities.User{Email: "x@example.com", Username: "alice", Password: "x"})
+
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected duplicate username to fail with ErrDuplicatedKey, got %v", err)
+		}
+
+		bob := saveUser(t, b, "bob")
+		bob.Username = "alice"
+
+		if err := b.user.UpdateByID(ctx, bob.ID, bob); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected update to a taken username to fail with ErrDuplicatedKey, got %v", err)
+		}
+
+		if err := b.user.DeleteByID(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.user.FindByID(ctx, alice.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected deleted user to be missing, got %v", err)
+		}
+
+		if users := b.user.FindByIDs(ctx, []uint{bob.ID, alice.ID, bob.ID, 999}); len(users) != 1 || users[0].ID != bob.ID {
+			t.Errorf("expected only bob among existing users, got %+v", users)
+		}
+	})
+}
+
+func TestProductRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+		bob := saveUser(t, b, "bob")
+
+		var first *entities.Product
+
+		for i := 0; i < 15; i++ {
+			owner := alice
+
+			if i%3 == 0 {
+				owner = bob
+			}
+
+			product := &entities.Product{Name: "Product", Price: int64(i), UserID: owner.ID}
+
+			if _, err := b.product.Save(ctx, product); err != nil {
+				t.Fatal(err)
+			}
+
+			if first == nil {
+				first = product
+			}
+		}
+
+		page := b.product.FindAll(ctx, paging.Page{Page: 2, PageSize: 10}, paging.SortDefault)
+
+		if len(page) != 5 || page[0].Price != 10 {
+			t.Errorf("expected second page to hold the last 5 products in order, got %d items", len(page))
+		}
+
+		if products := b.product.FindByUserID(ctx, bob.ID, paging.Page{PageSize: 100}); len(products) != 5 {
+			t.Errorf("expected bob to own 5 products, got %d", len(products))
+		}
+
+		first.Name = "Renamed"
+
+		if err := b.product.UpdateByID(ctx, first.ID, first); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := b.product.FindByID(ctx, first.ID)
+
+		if err != nil || found.Name != "Renamed" {
+			t.Fatalf("expected updated product, got %v, %v", found, err)
+		}
+
+		if err := b.product.DeleteByID(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.product.FindByID(ctx, first.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected deleted product to be missing, got %v", err)
+		}
+
+		if products := b.product.FindAll(ctx, paging.Page{PageSize: 100}, paging.SortDefault); len(products) != 14 {
+			t.Errorf("expected deleted product to be excluded from listings, got %d products", len(products))
+		}
+	})
+}
+
+func TestVersionedUpdates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+		bob := saveUser(t, b, "bob")
+
+		lamp := &entities.Product{Name: "Lamp", UserID: alice.ID}
+
+		if _, err := b.product.Save(ctx, lamp); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := b.product.FindByID(ctx, lamp.ID)
+
+		if err != nil || stored.Version != 1 {
+			t.Fatalf("expected a new product to start at version 1, got %+v, %v", stored, err)
+		}
+
+		update := &entities.Product{Name: "Desk lamp", UserID: bob.ID, Version: 1}
+
+		if err := b.product.UpdateByID(ctx, lamp.ID, update); err != nil || update.Version != 2 {
+			t.Fatalf("expected the update to move to version 2, got %d, %v", update.Version, err)
+		}
+
+		found, err := b.product.FindByID(ctx, lamp.ID)
+
+		if err != nil || found.Name != "Desk lamp" || found.Version != 2 || found.UserID != alice.ID || !found.CreatedAt.Equal(stored.CreatedAt) {
+			t.Errorf("expected the update to keep the owner and creation time, got %+v, %v", found, err)
+		}
+
+		stale := &entities.Product{Name: "Floor lamp", Version: 1}
+
+		if err := b.product.UpdateByID(ctx, lamp.ID, stale); !errors.Is(err, repositories.ErrStaleVersion) {
+			t.Errorf("expected an update of an old version to fail with ErrStaleVersion, got %v", err)
+		}
+
+		if err := b.product.UpdateByID(ctx, 999, &entities.Product{Name: "Ghost", Version: 1}); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected an update of a missing product to fail with ErrRecordNotFound, got %v", err)
+		}
+
+		comment := &entities.Comment{Content: "Nice", UserID: bob.ID, ProductID: lamp.ID}
+
+		if _, err := b.comment.Save(ctx, comment); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.UpdateStatusByID(ctx, comment.ID, entities.CommentStatusHidden, "rude"); err != nil {
+			t.Fatal(err)
+		}
+
+		edit := &entities.Comment{Content: "Very nice", Status: entities.CommentStatusPublished, Version: comment.Version}
+
+		if err := b.comment.UpdateByID(ctx, comment.ID, edit); !errors.Is(err, repositories.ErrStaleVersion) {
+			t.Errorf("expected an edit from before a moderator decision to fail with ErrStaleVersion, got %v", err)
+		}
+
+		alice.FirstName = "Alice"
+
+		if err := b.user.UpdateByID(ctx, alice.ID, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		alice.LastName = "Stale"
+		alice.Version = 1
+
+		if err := b.user.UpdateByID(ctx, alice.ID, alice); !errors.Is(err, repositories.ErrStaleVersion) {
+			t.Errorf("expected an update of an old user version to fail with ErrStaleVersion, got %v", err)
+		}
+	})
+}
+
+func TestCommentRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+
+		product := &entities.Product{Name: "Lamp", UserID: alice.ID}
+
+		if _, err := b.product.Save(ctx, product); err != nil {
+			t.Fatal(err)
+		}
+
+		var IDs []uint
+
+		for i := 0; i < 7; i++ {
+			comment := &entities.Comment{Content: "Comment", UserID: alice.ID, ProductID: product.ID}
+
+			ID, err := b.comment.Save(ctx, comment)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			IDs = append(IDs, ID)
+		}
+
+		comments := b.comment.FindByProductID(ctx, product.ID, paging.Page{Page: 2, PageSize: 5})
+
+		if len(comments) != 2 || comments[0].ID != IDs[5] {
+			t.Errorf("expected second page to hold the last 2 comments, got %+v", comments)
+		}
+
+		if err := b.comment.DeleteByID(ctx, IDs[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.comment.FindByID(ctx, IDs[0]); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected deleted comment to be missing, got %v", err)
+		}
+
+		if comments := b.comment.FindByProductID(ctx, product.ID, paging.Page{PageSize: 100}); len(comments) != 6 {
+			t.Errorf("expected 6 remaining comments, got %d", len(comments))
+		}
+
+		reply := &entities.Comment{Content: "Reply", UserID: alice.ID, ProductID: product.ID, ParentID: &IDs[1], RootID: &IDs[1], Depth: 1}
+
+		if _, err := b.comment.Save(ctx, reply); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.DeleteByID(ctx, IDs[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		// The deleted first comment has no replies and is left out, the
+		// deleted second comment is kept for its reply.
+		threads := b.comment.FindThreadsByProductID(ctx, product.ID, alice.ID, paging.Page{PageSize: 2})
+
+		if len(threads) != 3 || threads[0].ID != IDs[1] || !threads[0].DeletedAt.Valid || threads[1].ID != IDs[2] || threads[2].ID != reply.ID {
+			t.Errorf("expected the deleted parent, the next comment and the reply, got %+v", threads)
+		}
+
+		bob := saveUser(t, b, "bob")
+		held := &entities.Comment{Content: "Held", UserID: bob.ID, ProductID: product.ID, Status: entities.CommentStatusPending, ModerationReason: "spam"}
+
+		if _, err := b.comment.Save(ctx, held); err != nil {
+			t.Fatal(err)
+		}
+
+		containsHeld := func(comments []entities.Comment) bool {
+			for _, comment := range comments {
+				if comment.ID == held.ID {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if containsHeld(b.comment.FindThreadsByProductID(ctx, product.ID, alice.ID, paging.Page{PageSize: 100})) {
+			t.Errorf("expected the held comment to be hidden from other users")
+		}
+
+		if !containsHeld(b.comment.FindThreadsByProductID(ctx, product.ID, bob.ID, paging.Page{PageSize: 100})) {
+			t.Errorf("expected the held comment to be shown to its author")
+		}
+
+		if err := b.comment.SaveReport(ctx, &entities.CommentReport{CommentID: IDs[2], UserID: bob.ID, Reason: "Rude"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.SaveReport(ctx, &entities.CommentReport{CommentID: IDs[2], UserID: bob.ID, Reason: "Rude"}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected ErrDuplicatedKey for a second open report, got %v", err)
+		}
+
+		queue := b.comment.FindModerationQueue(ctx, paging.Page{PageSize: 100})
+
+		if len(queue) != 2 || queue[0].ID != IDs[2] || len(queue[0].Reports) != 1 || queue[1].ID != held.ID {
+			t.Fatalf("expected the reported and the held comment in the queue, got %+v", queue)
+		}
+
+		if err := b.comment.UpdateStatusByID(ctx, IDs[2], entities.CommentStatusHidden, "rude"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.DeleteByID(ctx, held.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if queue := b.comment.FindModerationQueue(ctx, paging.Page{PageSize: 100}); len(queue) != 0 {
+			t.Errorf("expected the queue to be empty after moderation, got %+v", queue)
+		}
+
+		if err := b.comment.SaveReport(ctx, &entities.CommentReport{CommentID: IDs[2], UserID: bob.ID, Reason: "Still rude"}); err != nil {
+			t.Errorf("expected a new report once the earlier one was resolved, got %v", err)
+		}
+
+		if err := b.comment.UpdateStatusByID(ctx, 999, entities.CommentStatusHidden, ""); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected ErrRecordNotFound for an unknown comment, got %v", err)
+		}
+	})
+}
+
+func TestReviewRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+		bob := saveUser(t, b, "bob")
+
+		lamp := &entities.Product{Name: "Lamp", UserID: alice.ID}
+		chair := &entities.Product{Name: "Chair", UserID: alice.ID}
+
+		for _, product := range []*entities.Product{lamp, chair} {
+			if _, err := b.product.Save(ctx, product); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := b.review.Save(ctx, &entities.Review{ProductID: 999, UserID: bob.ID, Rating: 5, Title: "x"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected ErrRecordNotFound for a review of an unknown product, got %v", err)
+		}
+
+		bobsReview := &entities.Review{ProductID: chair.ID, UserID: bob.ID, Rating: 4, Title: "Comfy"}
+
+		if _, err := b.review.Save(ctx, bobsReview); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.review.Save(ctx, &entities.Review{ProductID: chair.ID, UserID: alice.ID, Rating: 1, Title: "Meh"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.review.Save(ctx, &entities.Review{ProductID: chair.ID, UserID: bob.ID, Rating: 5, Title: "Again"}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected ErrDuplicatedKey for a second review, got %v", err)
+		}
+
+		if _, err := b.review.Save(ctx, &entities.Review{ProductID: lamp.ID, UserID: bob.ID, Rating: 3, Title: "Fine"}); err != nil {
+			t.Fatal(err)
+		}
+
+		chairFound, err := b.product.FindByID(ctx, chair.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if chairFound.Rating.Count != 2 || chairFound.Rating.Average != 2.5 || chairFound.Rating.Stars4 != 1 || chairFound.Rating.Stars1 != 1 {
+			t.Errorf("unexpected chair rating %+v", chairFound.Rating)
+		}
+
+		// Updating the product must not reset its rating.
+		if err := b.product.UpdateByID(ctx, chair.ID, &entities.Product{Name: "Armchair", UserID: alice.ID, Version: chairFound.Version}); err != nil {
+			t.Fatal(err)
+		}
+
+		bobsReview.Rating = 5
+
+		if err := b.review.UpdateByID(ctx, bobsReview.ID, bobsReview); err != nil {
+			t.Fatal(err)
+		}
+
+		products := b.product.FindAll(ctx, paging.Page{Page: 1, PageSize: 10}, paging.SortRating)
+
+		// Both average 3 stars, the chair has more reviews and comes first.
+		if len(products) != 2 || products[0].ID != chair.ID || products[1].ID != lamp.ID {
+			t.Errorf("expected chair before lamp, got %+v", products)
+		}
+
+		if err := b.review.SaveVote(ctx, &entities.ReviewVote{ReviewID: bobsReview.ID, UserID: alice.ID, Helpful: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.review.SaveVote(ctx, &entities.ReviewVote{ReviewID: bobsReview.ID, UserID: alice.ID, Helpful: false}); err != nil {
+			t.Fatal(err)
+		}
+
+		review, err := b.review.FindByID(ctx, bobsReview.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if review.HelpfulCount != 0 || review.UnhelpfulCount != 1 {
+			t.Errorf("expected the second vote to replace the first, got %d/%d", review.HelpfulCount, review.UnhelpfulCount)
+		}
+
+		if err := b.review.DeleteVote(ctx, bobsReview.ID, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.review.DeleteByID(ctx, bobsReview.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		chairFound, err = b.product.FindByID(ctx, chair.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if chairFound.Rating.Count != 1 || chairFound.Rating.Average != 1 {
+			t.Errorf("expected the deleted review to leave the rating, got %+v", chairFound.Rating)
+		}
+
+		// A deleted review does not block a new one.
+		if _, err := b.review.Save(ctx, &entities.Review{ProductID: chair.ID, UserID: bob.ID, Rating: 2, Title: "Again"}); err != nil {
+			t.Errorf("could not review again after deleting: %v", err)
+		}
+	})
+}
+
+func TestProductImageRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+
+		lamp := &entities.Product{Name: "Lamp", UserID: alice.ID}
+
+		if _, err := b.product.Save(ctx, lamp); err != nil {
+			t.Fatal(err)
+		}
+
+		var images []*entities.ProductImage
+
+		for i := 0; i < 3; i++ {
+			image := &entities.ProductImage{ProductID: lamp.ID, OriginalKey: fmt.Sprint(i)}
+
+			if _, err := b.productImage.Save(ctx, image, 3); err != nil {
+				t.Fatal(err)
+			}
+
+			images = append(images, image)
+		}
+
+		if images[0].Position != 0 || !images[0].IsPrimary || images[2].Position != 2 || images[2].IsPrimary {
+			t.Errorf("expected the images in order with the first one primary, got %+v", images)
+		}
+
+		if _, err := b.productImage.Save(ctx, &entities.ProductImage{ProductID: lamp.ID}, 3); !errors.Is(err, repositories.ErrImageLimitReached) {
+			t.Errorf("expected ErrImageLimitReached for a fourth image, got %v", err)
+		}
+
+		// A new image goes after the last one, not into the gap left by a
+		// deleted one.
+		if err := b.productImage.DeleteByID(ctx, images[1].ID); err != nil {
+			t.Fatal(err)
+		}
+
+		added := &entities.ProductImage{ProductID: lamp.ID}
+
+		if _, err := b.productImage.Save(ctx, added, 3); err != nil {
+			t.Fatal(err)
+		}
+
+		if added.Position != 3 || added.IsPrimary {
+			t.Errorf("expected the new image to be last, got %+v", added)
+		}
+
+		chair := &entities.Product{Name: "Chair", UserID: alice.ID}
+
+		if _, err := b.product.Save(ctx, chair); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var saved atomic.Int32
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if _, err := b.productImage.Save(ctx, &entities.ProductImage{ProductID: chair.ID}, 5); err == nil {
+					saved.Add(1)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if count := len(b.productImage.FindByProductID(ctx, chair.ID)); saved.Load() != 5 || count != 5 {
+			t.Errorf("expected concurrent uploads to stop at the limit, got %d saved and %d stored", saved.Load(), count)
+		}
+	})
+}
+
+func TestIdempotencyKeyRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		now := time.Now()
+
+		first := &entities.IdempotencyKey{UserID: 1, Key: "retry-me", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}
+
+		if err := b.idempotencyKey.Reserve(ctx, first, time.Time{}); err != nil || first.ID == 0 {
+			t.Fatalf("expected the key to be reserved, got %v", err)
+		}
+
+		duplicate := &entities.IdempotencyKey{UserID: 1, Key: "retry-me", Fingerprint: "b", ExpiresAt: now.Add(time.Hour)}
+
+		if err := b.idempotencyKey.Reserve(ctx, duplicate, time.Time{}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a key in use to fail with ErrDuplicatedKey, got %v", err)
+		}
+
+		if err := b.idempotencyKey.Reserve(ctx, &entities.IdempotencyKey{UserID: 2, Key: "retry-me", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}, time.Time{}); err != nil {
+			t.Errorf("expected keys to be scoped to their user, got %v", err)
+		}
+
+		if err := b.idempotencyKey.Complete(ctx, first.ID, 201, "application/json", []byte(`{"ID":1}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := b.idempotencyKey.FindByKey(ctx, 1, "retry-me")
+
+		if err != nil || !found.IsCompleted() || found.StatusCode != 201 || string(found.Body) != `{"ID":1}` || found.Fingerprint != "a" {
+			t.Errorf("expected the stored response, got %+v, %v", found, err)
+		}
+
+		if err := b.idempotencyKey.DeleteByID(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.idempotencyKey.FindByKey(ctx, 1, "retry-me"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected a released key to be missing, got %v", err)
+		}
+
+		expired := &entities.IdempotencyKey{UserID: 1, Key: "expired", Fingerprint: "a", ExpiresAt: now.Add(-time.Minute)}
+
+		if err := b.idempotencyKey.Reserve(ctx, expired, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.idempotencyKey.Reserve(ctx, &entities.IdempotencyKey{UserID: 1, Key: "expired", Fingerprint: "b", ExpiresAt: now.Add(-time.Second)}, time.Time{}); err != nil {
+			t.Errorf("expected an expired key to be replaced, got %v", err)
+		}
+
+		if deleted, err := b.idempotencyKey.DeleteExpired(ctx, now); err != nil || deleted != 1 {
+			t.Errorf("expected the expired key to be deleted, got %d, %v", deleted, err)
+		}
+
+		stuck := &entities.IdempotencyKey{UserID: 1, Key: "stuck", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}
+
+		if err := b.idempotencyKey.Reserve(ctx, stuck, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.idempotencyKey.Reserve(ctx, &entities.IdempotencyKey{UserID: 1, Key: "stuck", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}, now.Add(-time.Minute)); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a key within its lease to fail with ErrDuplicatedKey, got %v", err)
+		}
+
+		takeover := &entities.IdempotencyKey{UserID: 1, Key: "stuck", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}
+
+		if err := b.idempotencyKey.Reserve(ctx, takeover, time.Now().Add(time.Minute)); err != nil || takeover.ID == stuck.ID {
+			t.Fatalf("expected an abandoned key to be taken over, got %v", err)
+		}
+
+		if err := b.idempotencyKey.Complete(ctx, stuck.ID, 201, "application/json", nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the abandoned request not to complete the key, got %v", err)
+		}
+
+		if err := b.idempotencyKey.Complete(ctx, takeover.ID, 201, "application/json", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.idempotencyKey.Reserve(ctx, &entities.IdempotencyKey{UserID: 1, Key: "stuck", Fingerprint: "a", ExpiresAt: now.Add(time.Hour)}, time.Now().Add(time.Minute)); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a completed key not to be taken over, got %v", err)
+		}
+	})
+}
+
+func TestAuditEventRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		start := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+
+		events := []*entities.AuditEvent{
+			{CreatedAt: start, ActorID: 1, Action: entities.AuditActionCreate, EntityType: "product", EntityID: 1, Changes: `{}`},
+			{CreatedAt: start.Add(time.Minute), ActorID: 2, Action: entities.AuditActionUpdate, EntityType: "product", EntityID: 1, Changes: `{}`},
+			{CreatedAt: start.Add(2 * time.Minute), ActorID: 1, Action: entities.AuditActionCreate, EntityType: "comment", EntityID: 1, Changes: `{}`},
+			{CreatedAt: start.Add(3 * time.Minute), ActorID: 1, Action: entities.AuditActionDelete, EntityType: "product", EntityID: 2, Changes: `{}`},
+		}
+
+		for _, event := range events {
+			if err := b.auditEvent.Save(ctx, event); err != nil || event.ID == 0 {
+				t.Fatalf("expected the event to be saved, got %v", err)
+			}
+		}
+
+		actorID := uint(1)
+		entityID := uint(1)
+
+		tests := []struct {
+			name     string
+			filter   repositories.AuditEventFilter
+			expected []uint
+		}{
+			{"everything newest first", repositories.AuditEventFilter{}, []uint{events[3].ID, events[2].ID, events[1].ID, events[0].ID}},
+			{"by actor", repositories.AuditEventFilter{ActorID: &actorID}, []uint{events[3].ID, events[2].ID, events[0].ID}},
+			{"by entity", repositories.AuditEventFilter{EntityType: "product", EntityID: &entityID}, []uint{events[1].ID, events[0].ID}},
+			{"by time range", repositories.AuditEventFilter{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)}, []uint{events[2].ID, events[1].ID}},
+		}
+
+		for _, test := range tests {
+			found := b.auditEvent.Find(ctx, test.filter, paging.Page{})
+			ids := make([]uint, len(found))
+
+			for i, event := range found {
+				ids[i] = event.ID
+			}
+
+			if !slices.Equal(ids, test.expected) {
+				t.Errorf("%s: expected events %v, got %v", test.name, test.expected, ids)
+			}
+		}
+
+		if found := b.auditEvent.Find(ctx, repositories.AuditEventFilter{}, paging.Page{Page: 2, PageSize: 3}); len(found) != 1 || found[0].ID != events[0].ID {
+			t.Errorf("expected the oldest event on the second page, got %+v", found)
+		}
+	})
+}
+
+func TestOutboxEventRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		now := time.Now()
+
+		first := &entities.OutboxEvent{Type: "product.created", EntityID: 1, Payload: `{}`, NextAttemptAt: now.Add(-time.Minute)}
+		second := &entities.OutboxEvent{Type: "product.updated", EntityID: 1, Payload: `{}`, NextAttemptAt: now.Add(-time.Minute)}
+		later := &entities.OutboxEvent{Type: "product.deleted", EntityID: 1, Payload: `{}`, NextAttemptAt: now.Add(time.Hour)}
+
+		for _, event := range []*entities.OutboxEvent{first, second, later} {
+			if err := b.outboxEvent.Save(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		claimed, err := b.outboxEvent.ClaimDue(ctx, now, time.Minute, 10)
+
+		if err != nil || len(claimed) != 2 || claimed[0].ID != first.ID || claimed[1].ID != second.ID {
+			t.Fatalf("expected the two due events oldest first, got %+v, %v", claimed, err)
+		}
+
+		if claimed, _ := b.outboxEvent.ClaimDue(ctx, now, time.Minute, 10); len(claimed) != 0 {
+			t.Errorf("expected claimed events to be leased, got %+v", claimed)
+		}
+
+		if err := b.outboxEvent.MarkDispatched(ctx, first.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.outboxEvent.MarkFailed(ctx, second.ID, 1, now, "subscriber failed"); err != nil {
+			t.Fatal(err)
+		}
+
+		claimed, _ = b.outboxEvent.ClaimDue(ctx, now, time.Minute, 10)
+
+		if len(claimed) != 1 || claimed[0].ID != second.ID || claimed[0].Attempts != 1 || claimed[0].LastError != "subscriber failed" {
+			t.Fatalf("expected the failed event to be due again, got %+v", claimed)
+		}
+
+		if err := b.outboxEvent.MarkDead(ctx, second.ID, 2, now, "subscriber failed again"); err != nil {
+			t.Fatal(err)
+		}
+
+		dead := b.outboxEvent.FindDead(ctx, paging.Page{})
+
+		if len(dead) != 1 || dead[0].ID != second.ID || dead[0].Attempts != 2 {
+			t.Fatalf("expected the dead event, got %+v", dead)
+		}
+
+		if err := b.outboxEvent.Requeue(ctx, first.ID, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected only dead events to be requeued, got %v", err)
+		}
+
+		if err := b.outboxEvent.Requeue(ctx, second.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		claimed, _ = b.outboxEvent.ClaimDue(ctx, now.Add(time.Minute), time.Minute, 10)
+
+		if len(claimed) != 1 || claimed[0].ID != second.ID || claimed[0].Attempts != 0 {
+			t.Errorf("expected the requeued event to be due with new attempts, got %+v", claimed)
+		}
+
+		if deleted, err := b.outboxEvent.DeleteDispatchedBefore(ctx, now.Add(time.Second)); err != nil || deleted != 1 {
+			t.Errorf("expected the dispatched event to be deleted, got %d, %v", deleted, err)
+		}
+	})
+}
+
+func TestWebhookRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		now := time.Now()
+		alice := saveUser(t, b, "alice")
+
+		endpoint := &entities.WebhookEndpoint{
+			UserID:     alice.ID,
+			URL:        "https://example.com/hooks",
+			Secret:     "whsec_test",
+			EventTypes: "comment.posted,product.updated",
+			Enabled:    true,
+		}
+
+		if _, err := b.webhook.SaveEndpoint(ctx, endpoint); err != nil {
+			t.Fatal(err)
+		}
+
+		for failure := 1; failure <= 3; failure++ {
+			disabled, err := b.webhook.RecordEndpointFailure(ctx, endpoint.ID, 3, now)
+
+			if err != nil || disabled != (failure == 3) {
+				t.Fatalf("expected only the third failure to disable the endpoint, got %v, %v at failure %d", disabled, err, failure)
+			}
+		}
+
+		found, err := b.webhook.FindEndpointByID(ctx, endpoint.ID)
+
+		if err != nil || found.Enabled || found.ConsecutiveFailures != 3 || found.DisabledAt == nil {
+			t.Fatalf("expected a disabled endpoint with three failures, got %+v, %v", found, err)
+		}
+
+		found.Enabled = true
+		found.ConsecutiveFailures = 0
+		found.DisabledAt = nil
+
+		if err := b.webhook.UpdateEndpointByID(ctx, endpoint.ID, found); err != nil {
+			t.Fatal(err)
+		}
+
+		if endpoints := b.webhook.FindEndpointsByUserID(ctx, alice.ID); len(endpoints) != 1 || !endpoints[0].Enabled ||
+			!endpoints[0].Subscribes("comment.posted") || endpoints[0].Subscribes("comment.deleted") {
+			t.Fatalf("expected the enabled endpoint of alice, got %+v", endpoints)
+		}
+
+		eventID := uint(7)
+		delivery := &entities.WebhookDelivery{EndpointID: endpoint.ID, EventID: &eventID, EventType: "comment.posted", Payload: `{}`, NextAttemptAt: now}
+
+		if err := b.webhook.SaveDelivery(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		duplicate := &entities.WebhookDelivery{EndpointID: endpoint.ID, EventID: &eventID, EventType: "comment.posted", Payload: `{}`, NextAttemptAt: now}
+
+		if err := b.webhook.SaveDelivery(ctx, duplicate); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a second delivery of the event to be rejected, got %v", err)
+		}
+
+		claimed, err := b.webhook.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+
+		if err != nil || len(claimed) != 1 || claimed[0].ID != delivery.ID {
+			t.Fatalf("expected the due delivery, got %+v, %v", claimed, err)
+		}
+
+		if claimed, _ := b.webhook.ClaimDueDeliveries(ctx, now, time.Minute, 10); len(claimed) != 0 {
+			t.Errorf("expected the claimed delivery to be leased, got %+v", claimed)
+		}
+
+		for _, statusCode := range []int{500, 200} {
+			if err := b.webhook.SaveAttempt(ctx, &entities.WebhookAttempt{DeliveryID: delivery.ID, StatusCode: statusCode}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		delivery.AttemptCount = 2
+		delivery.LastStatusCode = 200
+		delivery.DeliveredAt = &now
+
+		if err := b.webhook.UpdateDelivery(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		if claimed, _ := b.webhook.ClaimDueDeliveries(ctx, now.Add(time.Hour), time.Minute, 10); len(claimed) != 0 {
+			t.Errorf("expected delivered deliveries not to be claimed, got %+v", claimed)
+		}
+
+		deliveries := b.webhook.FindDeliveriesByEndpointID(ctx, endpoint.ID, paging.Page{})
+
+		if len(deliveries) != 1 || deliveries[0].AttemptCount != 2 || !deliveries[0].IsFinished() ||
+			len(deliveries[0].Attempts) != 2 || deliveries[0].Attempts[0].StatusCode != 500 {
+			t.Fatalf("expected the delivery with both attempts, got %+v", deliveries)
+		}
+
+		if err := b.webhook.DeleteEndpointByID(ctx, endpoint.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.webhook.FindEndpointByID(ctx, endpoint.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the deleted endpoint not to be found, got %v", err)
+		}
+	})
+}
+
+func TestJobRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		now := time.Now()
+		key := "weekly-report"
+
+		newJob := func(queue string, runAt time.Time) *entities.Job {
+			return &entities.Job{Queue: queue, Type: "report", Payload: `{}`, Status: entities.JobStatusPending, RunAt: runAt, MaxAttempts: 3}
+		}
+
+		first := newJob("default", now.Add(-2*time.Minute))
+		second := newJob("default", now.Add(-time.Minute))
+		second.UniqueKey = &key
+		later := newJob("default", now.Add(time.Hour))
+		other := newJob("images", now.Add(-time.Minute))
+
+		for _, job := range []*entities.Job{first, second, later, other} {
+			if err := b.job.Save(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		duplicate := newJob("default", now)
+		duplicate.UniqueKey = &key
+
+		if err := b.job.Save(ctx, duplicate); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a job with the same unique key to be rejected, got %v", err)
+		}
+
+		claimed, err := b.job.ClaimDue(ctx, "default", now, time.Minute, 1)
+
+		if err != nil || len(claimed) != 1 || claimed[0].ID != first.ID ||
+			claimed[0].Status != entities.JobStatusRunning || claimed[0].Attempts != 1 {
+			t.Fatalf("expected the longest waiting job of the queue to be claimed, got %+v, %v", claimed, err)
+		}
+
+		claimed, _ = b.job.ClaimDue(ctx, "default", now, time.Minute, 10)
+
+		if len(claimed) != 1 || claimed[0].ID != second.ID {
+			t.Fatalf("expected only the other due job of the queue to be left, got %+v", claimed)
+		}
+
+		// A running job whose worker went away is claimed again once its
+		// lease runs out.
+		claimed, _ = b.job.ClaimDue(ctx, "default", now.Add(2*time.Minute), time.Minute, 10)
+
+		if len(claimed) != 2 || claimed[0].ID != first.ID || claimed[0].Attempts != 2 {
+			t.Fatalf("expected the jobs with expired leases to be claimed again, got %+v", claimed)
+		}
+
+		if err := b.job.MarkSucceeded(ctx, first.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.job.MarkRetry(ctx, second.ID, now.Add(time.Hour), "timed out"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.job.MarkFailed(ctx, other.ID, now, "no such image"); err != nil {
+			t.Fatal(err)
+		}
+
+		failed := b.job.Find(ctx, repositories.JobFilter{Status: entities.JobStatusFailed}, paging.Page{})
+
+		if len(failed) != 1 || failed[0].ID != other.ID || failed[0].LastError != "no such image" || failed[0].FinishedAt == nil {
+			t.Fatalf("expected the failed job, got %+v", failed)
+		}
+
+		if jobs := b.job.Find(ctx, repositories.JobFilter{Queue: "default"}, paging.Page{}); len(jobs) != 3 || jobs[0].ID != later.ID {
+			t.Errorf("expected the jobs of the default queue newest first, got %+v", jobs)
+		}
+
+		if err := b.job.Requeue(ctx, second.ID, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected only failed jobs to be requeued, got %v", err)
+		}
+
+		if err := b.job.Requeue(ctx, other.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		claimed, _ = b.job.ClaimDue(ctx, "images", now, time.Minute, 10)
+
+		if len(claimed) != 1 || claimed[0].ID != other.ID || claimed[0].Attempts != 1 {
+			t.Errorf("expected the requeued job to be due with new attempts, got %+v", claimed)
+		}
+
+		if deleted, err := b.job.DeleteFinishedBefore(ctx, now.Add(time.Second)); err != nil || deleted != 1 {
+			t.Errorf("expected the succeeded job to be deleted, got %d, %v", deleted, err)
+		}
+	})
+}
+
+func TestNotificationRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		now := time.Now()
+
+		notify := func(userID uint, eventID uint) (*entities.Notification, error) {
+			notification := &entities.Notification{UserID: userID, Type: entities.NotificationCommentPosted, EventID: &eventID}
+			return notification, b.notification.Save(ctx, notification)
+		}
+
+		first, _ := notify(1, 10)
+		second, _ := notify(1, 11)
+		third, _ := notify(1, 12)
+
+		if _, err := notify(2, 10); err != nil {
+			t.Errorf("expected one event to notify several users, got %v", err)
+		}
+
+		if _, err := notify(1, 10); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("expected a user to be notified of an event once, got %v", err)
+		}
+
+		if err := b.notification.MarkRead(ctx, 1, second.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.notification.MarkRead(ctx, 1, second.ID, now.Add(time.Hour)); err != nil {
+			t.Errorf("expected marking a read notification read to succeed, got %v", err)
+		}
+
+		if err := b.notification.MarkRead(ctx, 2, first.ID, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the notification of another user to be missing, got %v", err)
+		}
+
+		if count := b.notification.CountUnread(ctx, 1); count != 2 {
+			t.Errorf("expected two unread notifications, got %d", count)
+		}
+
+		unread := b.notification.FindByUserID(ctx, 1, true, paging.Page{})
+
+		if len(unread) != 2 || unread[0].ID != third.ID || unread[1].ID != first.ID {
+			t.Errorf("expected the unread notifications, newest first, got %+v", unread)
+		}
+
+		read := b.notification.FindByUserID(ctx, 1, false, paging.Page{})
+
+		if len(read) != 3 || read[1].ReadAt == nil || read[1].ReadAt.Sub(now).Abs() > time.Millisecond {
+			t.Errorf("expected the second notification to keep the time it was first read, got %+v", read)
+		}
+
+		if after := b.notification.FindByUserIDAfter(ctx, 1, first.ID, 10); len(after) != 2 || after[0].ID != second.ID || after[1].ID != third.ID {
+			t.Errorf("expected the newer notifications, oldest first, got %+v", after)
+		}
+
+		if marked, err := b.notification.MarkAllRead(ctx, 1, now); err != nil || marked != 2 {
+			t.Errorf("expected the two unread notifications to be marked, got %d, %v", marked, err)
+		}
+
+		if count := b.notification.CountUnread(ctx, 2); count != 1 {
+			t.Errorf("expected the notification of another user to stay unread, got %d", count)
+		}
+	})
+}
+
+func TestNotificationPreferencesRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+
+		if _, err := b.notificationPreferences.FindByUserID(ctx, 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected no preferences before they are saved, got %v", err)
+		}
+
+		if err := b.notificationPreferences.Save(ctx, &entities.NotificationPreferences{UserID: 1, Locale: "hr", CommentEmails: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Saving again replaces the preferences, turning an email off included.
+		if err := b.notificationPreferences.Save(ctx, &entities.NotificationPreferences{UserID: 1, Locale: "en", CommentEmails: false}); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := b.notificationPreferences.FindByUserID(ctx, 1)
+
+		if err != nil || found.Locale != "en" || found.CommentEmails {
+			t.Errorf("expected the replaced preferences, got %+v, %v", found, err)
+		}
+
+		if _, err := b.notificationPreferences.FindByUserID(ctx, 2); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected preferences to be scoped to their user, got %v", err)
+		}
+	})
+}
+
+func TestTransactor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		if _, ok := b.transactor.(*repositories.MemoryTransactor); ok {
+			t.Skip("the in-memory repositories have no transactions")
+		}
+
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+		failure := errors.New("publishing failed")
+
+		var productID uint
+
+		err := b.transactor.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+
+			productID, err = b.product.Save(ctx, &entities.Product{Name: "Lamp", UserID: alice.ID})
+
+			if err != nil {
+				return err
+			}
+
+			return failure
+		})
+
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected the error of the transaction, got %v", err)
+		}
+
+		if _, err := b.product.FindByID(ctx, productID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the product to be rolled back, got %v", err)
+		}
+
+		err = b.transactor.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+
+			productID, err = b.product.Save(ctx, &entities.Product{Name: "Lamp", UserID: alice.ID})
+
+			if err != nil {
+				return err
+			}
+
+			return b.outboxEvent.Save(ctx, &entities.OutboxEvent{Type: "product.created", EntityID: productID, Payload: `{}`, NextAttemptAt: time.Now()})
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.product.FindByID(ctx, productID); err != nil {
+			t.Errorf("expected the product to be committed, got %v", err)
+		}
+
+		if claimed, _ := b.outboxEvent.ClaimDue(ctx, time.Now(), time.Minute, 10); len(claimed) != 1 || claimed[0].EntityID != productID {
+			t.Errorf("expected the event to be committed with the product, got %+v", claimed)
+		}
+	})
+}
+
+func TestTrash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		ctx := context.Background()
+		alice := saveUser(t, b, "alice")
+		bob := saveUser(t, b, "bob")
+
+		lamp := &entities.Product{Name: "Lamp", UserID: alice.ID}
+
+		if _, err := b.product.Save(ctx, lamp); err != nil {
+			t.Fatal(err)
+		}
+
+		saveComment := func(userID uint, parentID *uint) uint {
+			ID, err := b.comment.Save(ctx, &entities.Comment{Content: "Comment", UserID: userID, ProductID: lamp.ID, ParentID: parentID, RootID: parentID})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return ID
+		}
+
+		questionID := saveComment(alice.ID, nil)
+		answerID := saveComment(bob.ID, &questionID)
+		retractedID := saveComment(bob.ID, nil)
+
+		if err := b.comment.DeleteByID(ctx, retractedID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Comments deleted at different times must be told apart.
+		time.Sleep(time.Millisecond)
+
+		if err := b.product.DeleteByID(ctx, lamp.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.comment.FindByID(ctx, answerID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the comments to be deleted with the product, got %v", err)
+		}
+
+		if products := b.product.FindDeletedByUserID(ctx, alice.ID, paging.Page{Page: 1, PageSize: 10}); len(products) != 1 || products[0].ID != lamp.ID || !products[0].DeletedAt.Valid {
+			t.Errorf("expected the lamp in the trash of alice, got %+v", products)
+		}
+
+		if comments := b.comment.FindDeletedByUserID(ctx, bob.ID, paging.Page{Page: 1, PageSize: 10}); len(comments) != 2 {
+			t.Errorf("expected both comments of bob in his trash, got %+v", comments)
+		}
+
+		if err := b.product.RestoreByID(ctx, lamp.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.product.RestoreByID(ctx, lamp.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected restoring a product which is not deleted to fail, got %v", err)
+		}
+
+		for _, ID := range []uint{questionID, answerID} {
+			if _, err := b.comment.FindByID(ctx, ID); err != nil {
+				t.Errorf("expected comment %d to be restored with the product, got %v", ID, err)
+			}
+		}
+
+		if _, err := b.comment.FindDeletedByID(ctx, retractedID); err != nil {
+			t.Errorf("expected the comment deleted before the product to stay deleted, got %v", err)
+		}
+
+		if err := b.comment.DeleteByID(ctx, questionID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.PurgeByID(ctx, questionID); !errors.Is(err, gorm.ErrForeignKeyViolated) {
+			t.Errorf("expected purging a comment with replies to fail, got %v", err)
+		}
+
+		if comments := b.comment.FindDeletedBefore(ctx, time.Now().Add(time.Second), 10); len(comments) != 1 || comments[0].ID != retractedID {
+			t.Errorf("expected only the retracted comment to be purgeable, got %+v", comments)
+		}
+
+		if err := b.comment.RestoreByID(ctx, questionID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.comment.PurgeByID(ctx, questionID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected purging a comment which is not deleted to fail, got %v", err)
+		}
+
+		if err := b.comment.PurgeByID(ctx, retractedID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.comment.FindDeletedByID(ctx, retractedID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the purged comment to be gone, got %v", err)
+		}
+
+		moderatedID := saveComment(bob.ID, nil)
+
+		if err := b.comment.DeleteByIDAsModerator(ctx, moderatedID); err != nil {
+			t.Fatal(err)
+		}
+
+		if comments := b.comment.FindDeletedByUserID(ctx, bob.ID, paging.Page{Page: 1, PageSize: 10}); len(comments) != 0 {
+			t.Errorf("expected the comment deleted by a moderator to stay out of the trash of bob, got %+v", comments)
+		}
+
+		if _, err := b.comment.FindDeletedByID(ctx, moderatedID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the comment deleted by a moderator to be hidden from the trash, got %v", err)
+		}
+
+		if err := b.comment.RestoreByID(ctx, moderatedID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected restoring a comment deleted by a moderator to fail, got %v", err)
+		}
+
+		if comments := b.comment.FindDeletedBefore(ctx, time.Now().Add(time.Second), 10); len(comments) != 1 || comments[0].ID != moderatedID {
+			t.Errorf("expected the comment deleted by a moderator to still be purgeable, got %+v", comments)
+		}
+
+		if err := b.product.PurgeByID(ctx, lamp.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected purging a product which is not deleted to fail, got %v", err)
+		}
+
+		if err := b.product.DeleteByID(ctx, lamp.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if products := b.product.FindDeletedBefore(ctx, time.Now().Add(time.Second), 10); len(products) != 1 || products[0].ID != lamp.ID {
+			t.Errorf("expected the lamp to be purgeable, got %+v", products)
+		}
+
+		if err := b.product.PurgeByID(ctx, lamp.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.product.FindDeletedByID(ctx, lamp.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the purged product to be gone, got %v", err)
+		}
+
+		if _, err := b.comment.FindDeletedByID(ctx, answerID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected the comments to be purged with the product, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/* ReviewRepository stores product reviews and the helpful votes on them. Every
+* change to the reviews of a product also refreshes the aggregated rating
+* stored with the product, and every vote refreshes the vote counts of its
+* review, within the same transaction. */
+type ReviewRepository interface {
+	Save(ctx context.Context, review *entities.Review) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Review, error)
+	FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Review
+	UpdateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error
+	DeleteByID(ctx context.Context, ID uint) error
+	SaveVote(ctx context.Context, vote *entities.ReviewVote) error
+	DeleteVote(ctx context.Context, reviewID uint, userID uint) error
+}
+
+type PostgresReviewRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitReviewRepository(DB *gorm.DB, logger *slog.Logger) ReviewRepository {
+	return &PostgresReviewRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresReviewRepository) Save(ctx context.Context, review *entities.Review) (uint, error) {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := lockProduct(tx, review.ProductID)
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(review).Error
+
+		if err != nil {
+			return err
+		}
+
+		return refreshProductRating(tx, review.ProductID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save new review", "product_id", review.ProductID, "error", err)
+		return 0, err
+	}
+
+	return review.ID, nil
+}
+
+func (repository *PostgresReviewRepository) FindByID(ctx context.Context, ID uint) (*entities.Review, error) {
+	var review entities.Review
+
+	result := dbFor(ctx, repository.DB).First(&review, ID)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not find review", "id", ID, "error", result.Error)
+		return nil, result.Error
+	}
+
+	return &review, nil
+}
+
+func (repository *PostgresReviewRepository) FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Review {
+	var reviews []entities.Review
+
+	dbFor(ctx, repository.DB).
+		Scopes(paging.Paginate(page)).
+		Where("product_id = ?", productID).
+		Order("id").
+		Find(&reviews)
+
+	return reviews
+}
+
+func (repository *PostgresReviewRepository) UpdateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error {
+	updatedReview.ID = ID
+
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := lockProduct(tx, updatedReview.ProductID)
+
+		if err != nil {
+			return err
+		}
+
+		// Vote counts are maintained by SaveVote and DeleteVote.
+		err = tx.Omit("CreatedAt", "HelpfulCount", "UnhelpfulCount").Save(updatedReview).Error
+
+		if err != nil {
+			return err
+		}
+
+		return refreshProductRating(tx, updatedReview.ProductID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update review", "id", ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (repository *PostgresReviewRepository) DeleteByID(ctx context.Context, ID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		var review entities.Review
+
+		err := tx.First(&review, ID).Error
+
+		if err != nil {
+			return err
+		}
+
+		err = lockProduct(tx, review.ProductID)
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&review).Error
+
+		if err != nil {
+			return err
+		}
+
+		return refreshProductRating(tx, review.ProductID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete review", "id", ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// SaveVote records the vote of a user on a review, replacing an earlier vote
+// of the same user.
+func (repository *PostgresReviewRepository) SaveVote(ctx context.Context, vote *entities.ReviewVote) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := lockReview(tx, vote.ReviewID)
+
+		if err != nil {
+			return err
+		}
+
+		var existing entities.ReviewVote
+
+		result := tx.Where("review_id = ? AND user_id = ?", vote.ReviewID, vote.UserID).Limit(1).Find(&existing)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			vote.Model = existing.Model
+			err = tx.Save(vote).Error
+		} else {
+			err = tx.Create(vote).Error
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return refreshVoteCounts(tx, vote.ReviewID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save review vote", "review_id", vote.ReviewID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (repository *PostgresReviewRepository) DeleteVote(ctx context.Context, reviewID uint, userID uint) error {
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := lockReview(tx, reviewID)
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("review_id = ? AND user_id = ?", reviewID, userID).Delete(&entities.ReviewVote{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return refreshVoteCounts(tx, reviewID)
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete review vote", "review_id", reviewID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+/* lockProduct locks the product row for the rest of the transaction, so that
+* concurrent review changes refresh its rating one after another and
+* concurrent uploads count its images one after another. It returns
+* gorm.ErrRecordNotFound when the product does not exist. SQLite ignores the
+* lock, it serializes writers anyway. */
+func lockProduct(tx *gorm.DB, productID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&entities.Product{}, productID).Error
+}
+
+func lockReview(tx *gorm.DB, reviewID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&entities.Review{}, reviewID).Error
+}
+
+func refreshProductRating(tx *gorm.DB, productID uint) error {
+	var rows []struct {
+		Rating int
+		Count  int64
+	}
+
+	err := tx.Model(&entities.Review{}).
+		Select("rating, COUNT(*) AS count").
+		Where("product_id = ?", productID).
+		Group("rating").
+		Scan(&rows).Error
+
+	if err != nil {
+		return err
+	}
+
+	histogram := make(map[int]int64, len(rows))
+
+	for _, row := range rows {
+		histogram[row.Rating] = row.Count
+	}
+
+	rating := entities.NewProductRating(histogram)
+
+	return tx.Model(&entities.Product{}).Where("id = ?", productID).Updates(map[string]any{
+		"rating_count":   rating.Count,
+		"rating_average": rating.Average,
+		"rating_stars1":  rating.Stars1,
+		"rating_stars2":  rating.Stars2,
+		"rating_stars3":  rating.Stars3,
+		"rating_stars4":  rating.Stars4,
+		"rating_stars5":  rating.Stars5,
+	}).Error
+}
+
+func refreshVoteCounts(tx *gorm.DB, reviewID uint) error {
+	var helpful, unhelpful int64
+
+	err := tx.Model(&entities.ReviewVote{}).Where("review_id = ? AND helpful", reviewID).Count(&helpful).Error
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&entities.ReviewVote{}).Where("review_id = ? AND NOT helpful", reviewID).Count(&unhelpful).Error
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&entities.Review{}).Where("id = ?", reviewID).UpdateColumns(map[string]any{
+		"helpful_count":   helpful,
+		"unhelpful_count": unhelpful,
+	}).Error
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+/* Transactor runs several repository calls in one database transaction. The
+* context passed to fn carries the transaction, and every repository method
+* called with it runs inside the transaction. The transaction is committed
+* when fn returns nil and rolled back otherwise. Transactions can be nested,
+* the inner one then becomes a savepoint of the outer one. */
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+type GormTransactor struct {
+	DB *gorm.DB
+}
+
+func InitTransactor(DB *gorm.DB) Transactor {
+	return &GormTransactor{
+		DB: DB,
+	}
+}
+
+func (transactor *GormTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return dbFor(ctx, transactor.DB).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// dbFor returns the transaction carried by ctx, or DB when there is none,
+// bound to ctx.
+func dbFor(ctx context.Context, DB *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+
+	return DB.WithContext(ctx)
+}
+
+/* MemoryTransactor runs fn without a transaction. The in-memory repositories
+* apply each change as soon as it is made, so a failing fn leaves the changes
+* made before the failure in place. */
+type MemoryTransactor struct{}
+
+func InitMemoryTransactor() Transactor {
+	return &MemoryTransactor{}
+}
+
+func (transactor *MemoryTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
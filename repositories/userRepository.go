@@ -1,7 +1,8 @@
 package repositories
 
 import (
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/brunohradec/go-webstore/entities"
 	"golang.org/x/crypto/bcrypt"
@@ -9,87 +10,143 @@ import (
 )
 
 type UserRepository interface {
-	Save(user *entities.User) (uint, error)
-	FindByID(ID uint) (*entities.User, error)
-	FindByUseraname(username string) (*entities.User, error)
-	UpdateByID(ID uint, updatedUser *entities.User) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, user *entities.User) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.User, error)
+	FindByIDs(ctx context.Context, IDs []uint) []entities.User
+	FindByUseraname(ctx context.Context, username string) (*entities.User, error)
+	UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error
+	UpdatePasswordByID(ctx context.Context, ID uint, password string) error
+	DeleteByID(ctx context.Context, ID uint) error
 }
 
 type PostgresUserRepository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Logger *slog.Logger
 }
 
-func InitUserRepository(DB *gorm.DB) UserRepository {
+func InitUserRepository(DB *gorm.DB, logger *slog.Logger) UserRepository {
 	return &PostgresUserRepository{
-		DB: DB,
+		DB:     DB,
+		Logger: logger,
 	}
 }
 
-func (repository *PostgresUserRepository) Save(user *entities.User) (uint, error) {
+func (repository *PostgresUserRepository) Save(ctx context.Context, user *entities.User) (uint, error) {
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 
 	if err != nil {
-		log.Println("ERROR: could not save new user. Error hashing password", err)
+		repository.Logger.ErrorContext(ctx, "could not save new user, error hashing password", "error", err)
 		return 0, err
 	}
 
 	user.Password = string(passwordHash)
 
-	result := repository.DB.Create(user)
+	result := dbFor(ctx, repository.DB).Create(user)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not save new user", result.Error)
+		repository.Logger.ErrorContext(ctx, "could not save new user", "error", result.Error)
 		return 0, result.Error
 	}
 
 	return user.ID, nil
 }
 
-func (repository *PostgresUserRepository) FindByID(ID uint) (*entities.User, error) {
+func (repository *PostgresUserRepository) FindByID(ctx context.Context, ID uint) (*entities.User, error) {
 	var user entities.User
 
-	result := repository.DB.First(&user, ID)
+	result := dbFor(ctx, repository.DB).First(&user, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not find user with id", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not find user", "id", ID, "error", result.Error)
 		return nil, result.Error
 	}
 
 	return &user, nil
 }
 
-func (repository *PostgresUserRepository) FindByUseraname(username string) (*entities.User, error) {
+// FindByIDs returns the users with the given IDs, leaving out IDs of users
+// which do not exist.
+func (repository *PostgresUserRepository) FindByIDs(ctx context.Context, IDs []uint) []entities.User {
+	var users []entities.User
+
+	if len(IDs) == 0 {
+		return users
+	}
+
+	dbFor(ctx, repository.DB).
+		Where("id IN ?", IDs).
+		Order("id").
+		Find(&users)
+
+	return users
+}
+
+func (repository *PostgresUserRepository) FindByUseraname(ctx context.Context, username string) (*entities.User, error) {
 	var user entities.User
 
-	result := repository.DB.Where("username = ?", username).First(&user)
+	result := dbFor(ctx, repository.DB).Where("username = ?", username).First(&user)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not find user with username", username, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not find user", "username", username, "error", result.Error)
 		return nil, result.Error
 	}
 
 	return &user, nil
 }
 
-func (repository *PostgresUserRepository) UpdateByID(ID uint, updatedUser *entities.User) error {
+// UpdateByID updates the details of a user. The password is only changed by
+// UpdatePasswordByID, which hashes it.
+func (repository *PostgresUserRepository) UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	updatedAt, err := updateVersioned(dbFor(ctx, repository.DB), &entities.User{}, ID, updatedUser.Version, map[string]any{
+		"first_name": updatedUser.FirstName,
+		"last_name":  updatedUser.LastName,
+		"email":      updatedUser.Email,
+		"username":   updatedUser.Username,
+		"role":       updatedUser.Role,
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update user", "id", ID, "error", err)
+		return err
+	}
+
 	updatedUser.ID = ID
+	updatedUser.UpdatedAt = updatedAt
+	updatedUser.Version++
 
-	result := repository.DB.Save(updatedUser)
+	return nil
+}
+
+func (repository *PostgresUserRepository) UpdatePasswordByID(ctx context.Context, ID uint, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not update password, error hashing password", "id", ID, "error", err)
+		return err
+	}
+
+	result := dbFor(ctx, repository.DB).Model(&entities.User{}).Where("id = ?", ID).Updates(map[string]any{
+		"password": string(passwordHash),
+		"version":  gorm.Expr("version + 1"),
+	})
 
 	if result.Error != nil {
-		log.Println("ERROR: could not update user with ID", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not update password", "id", ID, "error", result.Error)
 		return result.Error
 	}
 
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
 	return nil
 }
 
-func (repository *PostgresUserRepository) DeleteByID(ID uint) error {
-	result := repository.DB.Delete(&entities.User{}, ID)
+func (repository *PostgresUserRepository) DeleteByID(ctx context.Context, ID uint) error {
+	result := dbFor(ctx, repository.DB).Delete(&entities.User{}, ID)
 
 	if result.Error != nil {
-		log.Println("ERROR: could not delete user with ID", ID, result.Error)
+		repository.Logger.ErrorContext(ctx, "could not delete user", "id", ID, "error", result.Error)
 		return result.Error
 	}
 
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* Users, products and comments carry a version which every update increments.
+* An update states the version it is based on in the Version field of the
+* updated entity and fails with ErrStaleVersion when the stored entity has
+* moved on since, instead of overwriting the changes made in between. */
+var ErrStaleVersion = errors.New("record was changed by another update")
+
+/* updateVersioned sets the given columns of the record if it still has the
+* expected version and increments the version. Only the listed columns are
+* written, so the creation time and other fixed columns stay as they were. It
+* returns the new modification time of the record. */
+func updateVersioned(tx *gorm.DB, model any, ID uint, version uint, columns map[string]any) (time.Time, error) {
+	now := time.Now()
+
+	columns["version"] = gorm.Expr("version + 1")
+	columns["updated_at"] = now
+
+	result := tx.Model(model).Where("id = ? AND version = ?", ID, version).Updates(columns)
+
+	if result.Error != nil {
+		return now, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return now, nil
+	}
+
+	var count int64
+
+	err := tx.Model(model).Where("id = ?", ID).Count(&count).Error
+
+	if err != nil {
+		return now, err
+	}
+
+	if count == 0 {
+		return now, gorm.ErrRecordNotFound
+	}
+
+	return now, ErrStaleVersion
+}
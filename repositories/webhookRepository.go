@@ -0,0 +1,252 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository interface {
+	SaveEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) (uint, error)
+	FindEndpointByID(ctx context.Context, ID uint) (*entities.WebhookEndpoint, error)
+	FindEndpointsByUserID(ctx context.Context, userID uint) []entities.WebhookEndpoint
+	// UpdateEndpointByID writes the URL, description, event types and the
+	// enabled state of the endpoint, including its failure count.
+	UpdateEndpointByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error
+	DeleteEndpointByID(ctx context.Context, ID uint) error
+	/* RecordEndpointFailure counts a failed delivery attempt against the
+	* endpoint and disables it once disableAfter attempts in a row have
+	* failed. It reports whether this failure disabled the endpoint. */
+	RecordEndpointFailure(ctx context.Context, ID uint, disableAfter int, at time.Time) (bool, error)
+	ResetEndpointFailures(ctx context.Context, ID uint) error
+
+	// SaveDelivery fails with gorm.ErrDuplicatedKey when the event already
+	// has a delivery to the endpoint.
+	SaveDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error
+	SaveAttempt(ctx context.Context, attempt *entities.WebhookAttempt) error
+	/* ClaimDueDeliveries returns up to limit unfinished deliveries due at
+	* now, oldest first, and postpones their next attempt by lease, in the
+	* same way as OutboxEventRepository.ClaimDue. */
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error)
+	// UpdateDelivery writes the outcome of the latest attempt of a delivery.
+	UpdateDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error
+	// FindDeliveriesByEndpointID returns a page of the deliveries to an
+	// endpoint, newest first, with their attempts.
+	FindDeliveriesByEndpointID(ctx context.Context, endpointID uint, page paging.Page) []entities.WebhookDelivery
+}
+
+type PostgresWebhookRepository struct {
+	DB     *gorm.DB
+	Logger *slog.Logger
+}
+
+func InitWebhookRepository(DB *gorm.DB, logger *slog.Logger) WebhookRepository {
+	return &PostgresWebhookRepository{
+		DB:     DB,
+		Logger: logger,
+	}
+}
+
+func (repository *PostgresWebhookRepository) SaveEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) (uint, error) {
+	result := dbFor(ctx, repository.DB).Create(endpoint)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not save webhook endpoint", "error", result.Error)
+		return 0, result.Error
+	}
+
+	return endpoint.ID, nil
+}
+
+func (repository *PostgresWebhookRepository) FindEndpointByID(ctx context.Context, ID uint) (*entities.WebhookEndpoint, error) {
+	var endpoint entities.WebhookEndpoint
+
+	result := dbFor(ctx, repository.DB).First(&endpoint, ID)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &endpoint, nil
+}
+
+func (repository *PostgresWebhookRepository) FindEndpointsByUserID(ctx context.Context, userID uint) []entities.WebhookEndpoint {
+	var endpoints []entities.WebhookEndpoint
+
+	dbFor(ctx, repository.DB).Where("user_id = ?", userID).Order("id").Find(&endpoints)
+
+	return endpoints
+}
+
+func (repository *PostgresWebhookRepository) UpdateEndpointByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error {
+	return repository.updateEndpoint(ctx, ID, map[string]any{
+		"url":                  updatedEndpoint.URL,
+		"description":          updatedEndpoint.Description,
+		"event_types":          updatedEndpoint.EventTypes,
+		"enabled":              updatedEndpoint.Enabled,
+		"consecutive_failures": updatedEndpoint.ConsecutiveFailures,
+		"disabled_at":          updatedEndpoint.DisabledAt,
+	})
+}
+
+func (repository *PostgresWebhookRepository) DeleteEndpointByID(ctx context.Context, ID uint) error {
+	result := dbFor(ctx, repository.DB).Delete(&entities.WebhookEndpoint{}, ID)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not delete webhook endpoint", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresWebhookRepository) RecordEndpointFailure(ctx context.Context, ID uint, disableAfter int, at time.Time) (bool, error) {
+	var disabled bool
+
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entities.WebhookEndpoint{}).
+			Where("id = ?", ID).
+			Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).
+			Error
+
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&entities.WebhookEndpoint{}).
+			Where("id = ? AND enabled AND consecutive_failures >= ?", ID, disableAfter).
+			Updates(map[string]any{"enabled": false, "disabled_at": at})
+
+		disabled = result.RowsAffected > 0
+
+		return result.Error
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not record webhook endpoint failure", "id", ID, "error", err)
+	}
+
+	return disabled, err
+}
+
+func (repository *PostgresWebhookRepository) ResetEndpointFailures(ctx context.Context, ID uint) error {
+	return repository.updateEndpoint(ctx, ID, map[string]any{"consecutive_failures": 0})
+}
+
+func (repository *PostgresWebhookRepository) updateEndpoint(ctx context.Context, ID uint, columns map[string]any) error {
+	result := dbFor(ctx, repository.DB).Model(&entities.WebhookEndpoint{}).Where("id = ?", ID).Updates(columns)
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not update webhook endpoint", "id", ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresWebhookRepository) SaveDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error {
+	err := dbFor(ctx, repository.DB).Omit("Attempts").Create(delivery).Error
+
+	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		repository.Logger.ErrorContext(ctx, "could not save webhook delivery", "endpoint_id", delivery.EndpointID, "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresWebhookRepository) SaveAttempt(ctx context.Context, attempt *entities.WebhookAttempt) error {
+	err := dbFor(ctx, repository.DB).Create(attempt).Error
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not save webhook attempt", "delivery_id", attempt.DeliveryID, "error", err)
+	}
+
+	return err
+}
+
+func (repository *PostgresWebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	var deliveries []entities.WebhookDelivery
+
+	err := dbFor(ctx, repository.DB).Transaction(func(tx *gorm.DB) error {
+		query := tx.
+			Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").
+			Limit(limit)
+
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		err := query.Find(&deliveries).Error
+
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		IDs := make([]uint, len(deliveries))
+
+		for i, delivery := range deliveries {
+			IDs[i] = delivery.ID
+		}
+
+		return tx.Model(&entities.WebhookDelivery{}).Where("id IN ?", IDs).Update("next_attempt_at", now.Add(lease)).Error
+	})
+
+	if err != nil {
+		repository.Logger.ErrorContext(ctx, "could not claim webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (repository *PostgresWebhookRepository) UpdateDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error {
+	result := dbFor(ctx, repository.DB).Model(&entities.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]any{
+		"attempt_count":    delivery.AttemptCount,
+		"next_attempt_at":  delivery.NextAttemptAt,
+		"last_status_code": delivery.LastStatusCode,
+		"last_error":       delivery.LastError,
+		"delivered_at":     delivery.DeliveredAt,
+		"failed_at":        delivery.FailedAt,
+	})
+
+	if result.Error != nil {
+		repository.Logger.ErrorContext(ctx, "could not update webhook delivery", "id", delivery.ID, "error", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repository *PostgresWebhookRepository) FindDeliveriesByEndpointID(ctx context.Context, endpointID uint, page paging.Page) []entities.WebhookDelivery {
+	var deliveries []entities.WebhookDelivery
+
+	dbFor(ctx, repository.DB).
+		Scopes(paging.Paginate(page)).
+		Preload("Attempts", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Where("endpoint_id = ?", endpointID).
+		Order("id DESC").
+		Find(&deliveries)
+
+	return deliveries
+}
@@ -0,0 +1,717 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/middleware"
+	"github.com/brunohradec/go-webstore/openapi"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/gin-gonic/gin"
+)
+
+var apiOperations = []openapi.Operation{
+	{
+		Method:              http.MethodGet,
+		Path:                "/media/*key",
+		ID:                  "getMedia",
+		Summary:             "Download a stored image rendition",
+		Tags:                []string{"media"},
+		Responses:           map[int]any{http.StatusOK: openapi.Binary{}},
+		ResponseContentType: "application/octet-stream",
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/ping",
+		ID:        "ping",
+		Summary:   "Check that the server is running",
+		Tags:      []string{"health"},
+		Responses: map[int]any{http.StatusOK: map[string]string{}},
+	},
+	{
+		Method:       http.MethodGet,
+		Path:         "/api/openapi.json",
+		Undocumented: true,
+	},
+	{
+		Method:       http.MethodGet,
+		Path:         "/api/docs",
+		Undocumented: true,
+	},
+	{
+		Method:       http.MethodGet,
+		Path:         "/api/docs/assets/:name",
+		Undocumented: true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/auth/register",
+		ID:          "register",
+		Summary:     "Register a new user",
+		Tags:        []string{"auth"},
+		RequestBody: dtos.UserDTO{},
+		Responses:   map[int]any{http.StatusCreated: dtos.CreatedResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/auth/login",
+		ID:          "login",
+		Summary:     "Exchange username and password for an access token",
+		Tags:        []string{"auth"},
+		RequestBody: dtos.LoginDTO{},
+		Responses:   map[int]any{http.StatusOK: dtos.LoginReponseDTO{}},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/auth/me/",
+		ID:          "getCurrentUser",
+		Summary:     "Get the logged in user",
+		Tags:        []string{"auth"},
+		Secured:     true,
+		Conditional: true,
+		Responses: map[int]any{
+			http.StatusOK:          dtos.UserResponseDto{},
+			http.StatusNotModified: nil,
+		},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/users/:id",
+		ID:          "getUser",
+		Summary:     "Get a user by ID",
+		Tags:        []string{"users"},
+		Secured:     true,
+		Conditional: true,
+		Responses: map[int]any{
+			http.StatusOK:          dtos.UserResponseDto{},
+			http.StatusNotModified: nil,
+		},
+	},
+	{
+		Method:        http.MethodPut,
+		Path:          "/api/users/",
+		ID:            "updateCurrentUser",
+		Summary:       "Update the logged in user",
+		Tags:          []string{"users"},
+		Secured:       true,
+		RequestBody:   dtos.UserUpdateDTO{},
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:        http.MethodPatch,
+		Path:          "/api/users/",
+		ID:            "patchCurrentUser",
+		Summary:       "Change some details of the logged in user",
+		Tags:          []string{"users"},
+		Secured:       true,
+		RequestBody:   dtos.UserUpdateDTO{},
+		MergePatch:    true,
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/users/password",
+		ID:          "changePassword",
+		Summary:     "Change the password of the logged in user",
+		Tags:        []string{"users"},
+		Secured:     true,
+		RequestBody: dtos.UserPasswordDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/users/:id/role",
+		ID:          "updateUserRole",
+		Summary:     "Assign a role to a user, admins only",
+		Tags:        []string{"users"},
+		Secured:     true,
+		RequestBody: dtos.UserRoleDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/products/",
+		ID:          "createProduct",
+		Summary:     "Create a product owned by the logged in user",
+		Tags:        []string{"products"},
+		Secured:     true,
+		RequestBody: dtos.ProductDTO{},
+		Idempotent:  true,
+		Responses:   map[int]any{http.StatusCreated: dtos.CreatedResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/products/",
+		ID:        "listProducts",
+		Summary:   "List products",
+		Tags:      []string{"products"},
+		Secured:   true,
+		Paged:     true,
+		Sorts:     []string{string(paging.SortRating)},
+		Responses: map[int]any{http.StatusOK: []dtos.ProductResponseDTO{}},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/products/:id",
+		ID:          "getProduct",
+		Summary:     "Get a product by ID",
+		Tags:        []string{"products"},
+		Secured:     true,
+		Conditional: true,
+		Responses: map[int]any{
+			http.StatusOK:          dtos.ProductResponseDTO{},
+			http.StatusNotModified: nil,
+		},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/products/user/:userId",
+		ID:        "listUserProducts",
+		Summary:   "List products of a user",
+		Tags:      []string{"products"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.ProductResponseDTO{}},
+	},
+	{
+		Method:        http.MethodPut,
+		Path:          "/api/products/:id",
+		ID:            "updateProduct",
+		Summary:       "Update a product owned by the logged in user",
+		Tags:          []string{"products"},
+		Secured:       true,
+		RequestBody:   dtos.ProductDTO{},
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:        http.MethodPatch,
+		Path:          "/api/products/:id",
+		ID:            "patchProduct",
+		Summary:       "Change some details of a product owned by the logged in user",
+		Tags:          []string{"products"},
+		Secured:       true,
+		RequestBody:   dtos.ProductDTO{},
+		MergePatch:    true,
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/products/:id",
+		ID:        "deleteProduct",
+		Summary:   "Delete a product owned by the logged in user",
+		Tags:      []string{"products"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:             http.MethodPost,
+		Path:               "/api/products/:id/images",
+		ID:                 "uploadProductImage",
+		Summary:            "Upload an image of a product owned by the logged in user",
+		Tags:               []string{"product images"},
+		Secured:            true,
+		RequestBody:        dtos.ProductImageUploadDTO{},
+		RequestContentType: "multipart/form-data",
+		Responses:          map[int]any{http.StatusCreated: dtos.ProductImageResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/api/products/:id/images/uploads",
+		ID:        "createProductImageUpload",
+		Summary:   "Presign a direct upload of a product image to the media storage",
+		Tags:      []string{"product images"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusCreated: dtos.ProductImageUploadResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/products/:id/images/uploads/confirm",
+		ID:          "confirmProductImageUpload",
+		Summary:     "Verify a directly uploaded image and attach it to the product",
+		Tags:        []string{"product images"},
+		Secured:     true,
+		RequestBody: dtos.ProductImageConfirmDTO{},
+		Responses:   map[int]any{http.StatusCreated: dtos.ProductImageResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/products/:id/images",
+		ID:        "listProductImages",
+		Summary:   "List the images of a product in display order",
+		Tags:      []string{"product images"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: []dtos.ProductImageResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/products/:id/images/order",
+		ID:          "reorderProductImages",
+		Summary:     "Reorder the images of a product owned by the logged in user",
+		Tags:        []string{"product images"},
+		Secured:     true,
+		RequestBody: dtos.ProductImageOrderDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/products/:id/images/:imageId/primary",
+		ID:        "setPrimaryProductImage",
+		Summary:   "Make an image the primary image of its product",
+		Tags:      []string{"product images"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/products/:id/images/:imageId",
+		ID:        "deleteProductImage",
+		Summary:   "Delete an image of a product owned by the logged in user",
+		Tags:      []string{"product images"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/comments/",
+		ID:          "createComment",
+		Summary:     "Comment on a product or reply to a comment",
+		Tags:        []string{"comments"},
+		Secured:     true,
+		RequestBody: dtos.CommentDTO{},
+		Idempotent:  true,
+		Responses:   map[int]any{http.StatusCreated: dtos.CreatedResponseDTO{}},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/comments/:id",
+		ID:          "getComment",
+		Summary:     "Get a comment by ID, without its replies",
+		Tags:        []string{"comments"},
+		Secured:     true,
+		Conditional: true,
+		Responses: map[int]any{
+			http.StatusOK:          dtos.CommentResponseDto{},
+			http.StatusNotModified: nil,
+		},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/comments/product/:productId",
+		ID:        "listProductComments",
+		Summary:   "List comment threads of a product",
+		Tags:      []string{"comments"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.CommentResponseDto{}},
+	},
+	{
+		Method:        http.MethodPut,
+		Path:          "/api/comments/:id",
+		ID:            "updateComment",
+		Summary:       "Update a comment written by the logged in user",
+		Tags:          []string{"comments"},
+		Secured:       true,
+		RequestBody:   dtos.CommentDTO{},
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:        http.MethodPatch,
+		Path:          "/api/comments/:id",
+		ID:            "patchComment",
+		Summary:       "Change the content of a comment written by the logged in user",
+		Tags:          []string{"comments"},
+		Secured:       true,
+		RequestBody:   dtos.CommentUpdateDTO{},
+		MergePatch:    true,
+		RequiresMatch: true,
+		Responses:     map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/comments/:id",
+		ID:        "deleteComment",
+		Summary:   "Delete a comment written by the logged in user",
+		Tags:      []string{"comments"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/comments/:id/report",
+		ID:          "reportComment",
+		Summary:     "Report a comment to the moderators",
+		Tags:        []string{"comments"},
+		Secured:     true,
+		RequestBody: dtos.CommentReportDTO{},
+		Responses:   map[int]any{http.StatusCreated: nil},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/trash/products",
+		ID:        "listTrashedProducts",
+		Summary:   "List the deleted products of the logged in user",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.TrashedProductResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/trash/products/:id/restore",
+		ID:        "restoreProduct",
+		Summary:   "Restore a deleted product with the comments deleted with it",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/trash/products/:id",
+		ID:        "purgeProduct",
+		Summary:   "Permanently delete a deleted product with its comments, reviews and images",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/trash/comments",
+		ID:        "listTrashedComments",
+		Summary:   "List the deleted comments of the logged in user",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.TrashedCommentResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/trash/comments/:id/restore",
+		ID:        "restoreComment",
+		Summary:   "Restore a deleted comment on a product which is not deleted",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/trash/comments/:id",
+		ID:        "purgeComment",
+		Summary:   "Permanently delete a deleted comment without replies",
+		Tags:      []string{"trash"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/moderation/comments",
+		ID:        "listModerationQueue",
+		Summary:   "List comments held for review or reported, moderators only",
+		Tags:      []string{"moderation"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.ModerationQueueItemDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/moderation/comments/:id/approve",
+		ID:        "approveComment",
+		Summary:   "Publish a comment and resolve its reports, moderators only",
+		Tags:      []string{"moderation"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/moderation/comments/:id/hide",
+		ID:        "hideComment",
+		Summary:   "Hide a comment and resolve its reports, moderators only",
+		Tags:      []string{"moderation"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/moderation/comments/:id",
+		ID:        "moderatorDeleteComment",
+		Summary:   "Delete a comment and resolve its reports, moderators only",
+		Tags:      []string{"moderation"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/admin/cache",
+		ID:        "getCacheStats",
+		Summary:   "Show the hits and misses of the cache, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.CacheStatsResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/admin/audit",
+		ID:        "listAuditEvents",
+		Summary:   "List changes to products, comments and users, newest first, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Paged:     true,
+		Query:     dtos.AuditEventQueryDTO{},
+		Responses: map[int]any{http.StatusOK: []dtos.AuditEventResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/admin/events/dead",
+		ID:        "listDeadEvents",
+		Summary:   "List domain events which ran out of delivery attempts, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.DeadEventResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/admin/events/:id/retry",
+		ID:        "retryDeadEvent",
+		Summary:   "Deliver a dead domain event again, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/admin/jobs",
+		ID:        "listJobs",
+		Summary:   "List background jobs, newest first, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Paged:     true,
+		Query:     dtos.JobQueryDTO{},
+		Responses: map[int]any{http.StatusOK: []dtos.JobResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/admin/jobs/:id",
+		ID:        "getJob",
+		Summary:   "Get a background job by ID, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.JobResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/admin/jobs/:id/retry",
+		ID:        "retryJob",
+		Summary:   "Run a failed background job again, admins only",
+		Tags:      []string{"admin"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/reviews/",
+		ID:          "createReview",
+		Summary:     "Review a product",
+		Tags:        []string{"reviews"},
+		Secured:     true,
+		RequestBody: dtos.ReviewDTO{},
+		Idempotent:  true,
+		Responses:   map[int]any{http.StatusCreated: dtos.CreatedResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/reviews/:id",
+		ID:        "getReview",
+		Summary:   "Get a review by ID",
+		Tags:      []string{"reviews"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.ReviewResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/reviews/product/:productId",
+		ID:        "listProductReviews",
+		Summary:   "List the reviews of a product",
+		Tags:      []string{"reviews"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.ReviewResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/reviews/:id",
+		ID:          "updateReview",
+		Summary:     "Update a review written by the logged in user",
+		Tags:        []string{"reviews"},
+		Secured:     true,
+		RequestBody: dtos.ReviewUpdateDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/reviews/:id",
+		ID:        "deleteReview",
+		Summary:   "Delete a review written by the logged in user",
+		Tags:      []string{"reviews"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/reviews/:id/vote",
+		ID:          "voteReview",
+		Summary:     "Vote a review helpful or unhelpful",
+		Tags:        []string{"reviews"},
+		Secured:     true,
+		RequestBody: dtos.ReviewVoteDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/reviews/:id/vote",
+		ID:        "deleteReviewVote",
+		Summary:   "Withdraw the vote of the logged in user on a review",
+		Tags:      []string{"reviews"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/webhooks/",
+		ID:          "createWebhook",
+		Summary:     "Register a webhook endpoint, the response holds its signing secret",
+		Tags:        []string{"webhooks"},
+		Secured:     true,
+		RequestBody: dtos.WebhookEndpointDTO{},
+		Responses:   map[int]any{http.StatusCreated: dtos.WebhookEndpointCreatedResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/webhooks/",
+		ID:        "listWebhooks",
+		Summary:   "List the webhook endpoints of the logged in user",
+		Tags:      []string{"webhooks"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: []dtos.WebhookEndpointResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/webhooks/:id",
+		ID:        "getWebhook",
+		Summary:   "Get a webhook endpoint of the logged in user",
+		Tags:      []string{"webhooks"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.WebhookEndpointResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/webhooks/:id",
+		ID:          "updateWebhook",
+		Summary:     "Update a webhook endpoint, enabling it again clears its failures",
+		Tags:        []string{"webhooks"},
+		Secured:     true,
+		RequestBody: dtos.WebhookEndpointDTO{},
+		Responses:   map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/api/webhooks/:id",
+		ID:        "deleteWebhook",
+		Summary:   "Delete a webhook endpoint of the logged in user",
+		Tags:      []string{"webhooks"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/api/webhooks/:id/test",
+		ID:        "testWebhook",
+		Summary:   "Send a test event to a webhook endpoint and return the delivery",
+		Tags:      []string{"webhooks"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.WebhookDeliveryResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/webhooks/:id/deliveries",
+		ID:        "listWebhookDeliveries",
+		Summary:   "List the deliveries to a webhook endpoint with their attempts, newest first",
+		Tags:      []string{"webhooks"},
+		Secured:   true,
+		Paged:     true,
+		Responses: map[int]any{http.StatusOK: []dtos.WebhookDeliveryResponseDTO{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/notifications/",
+		ID:        "listNotifications",
+		Summary:   "List the notifications of the logged in user, newest first, with their unread count",
+		Tags:      []string{"notifications"},
+		Secured:   true,
+		Paged:     true,
+		Query:     dtos.NotificationQueryDTO{},
+		Responses: map[int]any{http.StatusOK: dtos.NotificationListResponseDTO{}},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/notifications/read",
+		ID:        "markAllNotificationsRead",
+		Summary:   "Mark every notification of the logged in user as read",
+		Tags:      []string{"notifications"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:    http.MethodPut,
+		Path:      "/api/notifications/:id/read",
+		ID:        "markNotificationRead",
+		Summary:   "Mark a notification of the logged in user as read",
+		Tags:      []string{"notifications"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: nil},
+	},
+	{
+		Method:              http.MethodGet,
+		Path:                "/api/notifications/stream",
+		ID:                  "streamNotifications",
+		Summary:             "Receive new notifications of the logged in user as Server-Sent Events, resuming after Last-Event-ID",
+		Tags:                []string{"notifications"},
+		Secured:             true,
+		Responses:           map[int]any{http.StatusOK: ""},
+		ResponseContentType: "text/event-stream",
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/api/notifications/preferences",
+		ID:        "getNotificationPreferences",
+		Summary:   "Get the notification preferences of the logged in user",
+		Tags:      []string{"notifications"},
+		Secured:   true,
+		Responses: map[int]any{http.StatusOK: dtos.NotificationPreferencesResponseDTO{}},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/notifications/preferences",
+		ID:          "updateNotificationPreferences",
+		Summary:     "Choose the language of emails and which ones the logged in user receives",
+		Tags:        []string{"notifications"},
+		Secured:     true,
+		RequestBody: dtos.NotificationPreferencesDTO{},
+		Responses:   map[int]any{http.StatusOK: dtos.NotificationPreferencesResponseDTO{}},
+	},
+}
+
+func APIDocument(routes gin.RoutesInfo) (*openapi.Document, error) {
+	return openapi.Generate(routes, apiOperations, openapi.Options{
+		Info: openapi.Info{
+			Title:   "go-webstore API",
+			Version: "1.0.0",
+		},
+		ErrorBody:        dtos.ProblemDTO{},
+		ErrorContentType: middleware.ProblemContentType,
+	})
+}
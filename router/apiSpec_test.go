@@ -0,0 +1,120 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brunohradec/go-webstore/controllers"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/gin-gonic/gin"
+)
+
+func newDocumentedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+
+	RegisterRoutes(r, &Controllers{
+		Auth:    controllers.InitAuthController(nil, nil, nil),
+		User:    controllers.InitUserController(nil, nil),
+		Product: controllers.InitProductController(nil, nil, nil),
+		Comment: controllers.InitCommentController(nil, nil, nil),
+		Review:  controllers.InitReviewController(nil, nil),
+		Docs:    controllers.InitDocsController(nil, "", ""),
+
+		ProductImage: controllers.InitProductImageController(nil, nil, 0),
+		Media:        controllers.InitMediaController(nil),
+		Moderation:   controllers.InitModerationController(nil, nil),
+		Cache:        controllers.InitCacheController(nil),
+		Trash:        controllers.InitTrashController(nil, 0),
+		Audit:        controllers.InitAuditController(nil),
+		Event:        controllers.InitEventController(nil),
+		Webhook:      controllers.InitWebhookController(nil),
+		Job:          controllers.InitJobController(nil),
+		Notification: controllers.InitNotificationController(nil),
+	}, &Middlewares{
+		Auth: func(c *gin.Context) {},
+		RequireRole: func(role entities.Role) gin.HandlerFunc {
+			return func(c *gin.Context) {}
+		},
+		Idempotency: func(c *gin.Context) {},
+	})
+
+	return r
+}
+
+func TestAPIDocumentMatchesRoutes(t *testing.T) {
+	r := newDocumentedRouter()
+
+	document, err := APIDocument(r.Routes())
+
+	if err != nil {
+		t.Fatalf("OpenAPI document is out of date with the router: %v", err)
+	}
+
+	if _, found := document.Paths["/api/products/{id}"]["put"]; !found {
+		t.Errorf("expected PUT /api/products/{id} to be documented")
+	}
+}
+
+func TestAPIDocumentIncludesBindingConstraints(t *testing.T) {
+	r := newDocumentedRouter()
+
+	document, err := APIDocument(r.Routes())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, found := document.Components.Schemas["ProductDTO"]
+
+	if !found {
+		t.Fatalf("expected ProductDTO schema to be generated")
+	}
+
+	if len(schema.Required) != 1 || schema.Required[0] != "name" {
+		t.Errorf("expected ProductDTO to require only name, got %v", schema.Required)
+	}
+
+	if _, err := json.Marshal(document); err != nil {
+		t.Errorf("document could not be marshalled to JSON: %v", err)
+	}
+}
+
+func TestDocsServeEmbeddedAssets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	docs := controllers.InitDocsController(nil, "/api/openapi.json", "/api/docs/assets")
+	r.GET("/api/docs", docs.UI)
+	r.GET("/api/docs/assets/:name", docs.Asset)
+
+	request := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return response
+	}
+
+	response := request("/api/docs")
+
+	if body := response.Body.String(); response.Code != http.StatusOK || strings.Contains(body, "https://") ||
+		!strings.Contains(body, `src="/api/docs/assets/swagger-ui-bundle.js"`) {
+		t.Errorf("expected the docs page to load its assets from the application, got %d %s", response.Code, body)
+	}
+
+	for _, name := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		response := request("/api/docs/assets/" + name)
+
+		if response.Code != http.StatusOK || response.Body.Len() == 0 {
+			t.Errorf("expected %s to be served, got %d", name, response.Code)
+		}
+	}
+
+	if response := request("/api/docs/assets/index.html"); response.Code != http.StatusNotFound {
+		t.Errorf("expected files outside the Swagger UI assets to be hidden, got %d", response.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/storage"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// newTestS3BlobStore connects to an in-process S3 stand-in.
+func newTestS3BlobStore(t *testing.T) storage.BlobStore {
+	t.Helper()
+
+	backend := s3mem.New()
+
+	if err := backend.CreateBucket("media"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	endpoint, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.InitS3BlobStore(context.Background(), &storage.S3Config{
+		Endpoint:        endpoint.Host,
+		Region:          "us-east-1",
+		Bucket:          "media",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test-secret",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+
+	if err := png.Encode(&buffer, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func putPresigned(t *testing.T, presignedURL string, content []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, presignedURL, bytes.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("presigned upload failed with status %d", response.StatusCode)
+	}
+}
+
+func TestDirectImageUpload(t *testing.T) {
+	app := newTestAppWithBlobStore(t, newTestS3BlobStore(t))
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	aliceProduct := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	bobProduct := app.create("/api/products/", bobToken, dtos.ProductDTO{Name: "Chair"})
+
+	uploadsPath := fmt.Sprintf("/api/products/%d/images/uploads", aliceProduct)
+
+	expectProblem(t, app.request(http.MethodPost, uploadsPath, bobToken, nil), http.StatusForbidden, "product_not_owned")
+
+	response := app.request(http.MethodPost, uploadsPath, aliceToken, nil)
+
+	if response.Code != http.StatusCreated {
+		t.Fatalf("could not presign upload: %d %s", response.Code, response.Body)
+	}
+
+	var upload dtos.ProductImageUploadResponseDTO
+	decode(t, response, &upload)
+
+	confirm := dtos.ProductImageConfirmDTO{Key: upload.Key}
+
+	t.Run("confirm before upload", func(t *testing.T) {
+		response := app.request(http.MethodPost, uploadsPath+"/confirm", aliceToken, confirm)
+		expectProblem(t, response, http.StatusNotFound, "upload_not_found")
+	})
+
+	putPresigned(t, upload.URL, testPNG(t, 1200, 600))
+
+	t.Run("confirm on another product", func(t *testing.T) {
+		path := fmt.Sprintf("/api/products/%d/images/uploads/confirm", bobProduct)
+		response := app.request(http.MethodPost, path, bobToken, confirm)
+		expectProblem(t, response, http.StatusNotFound, "upload_not_found")
+	})
+
+	response = app.request(http.MethodPost, uploadsPath+"/confirm", aliceToken, confirm)
+
+	if response.Code != http.StatusCreated {
+		t.Fatalf("could not confirm upload: %d %s", response.Code, response.Body)
+	}
+
+	var image dtos.ProductImageResponseDTO
+	decode(t, response, &image)
+
+	if !image.IsPrimary || image.Width != 1200 || image.Height != 600 || image.ContentType != "image/png" {
+		t.Errorf("unexpected image %+v", image)
+	}
+
+	t.Run("confirm twice", func(t *testing.T) {
+		response := app.request(http.MethodPost, uploadsPath+"/confirm", aliceToken, confirm)
+		expectProblem(t, response, http.StatusNotFound, "upload_not_found")
+	})
+
+	t.Run("reject non image", func(t *testing.T) {
+		response := app.request(http.MethodPost, uploadsPath, aliceToken, nil)
+
+		var upload dtos.ProductImageUploadResponseDTO
+		decode(t, response, &upload)
+
+		putPresigned(t, upload.URL, []byte("not an image"))
+
+		response = app.request(http.MethodPost, uploadsPath+"/confirm", aliceToken, dtos.ProductImageConfirmDTO{Key: upload.Key})
+		expectProblem(t, response, http.StatusUnsupportedMediaType, "unsupported_image_type")
+	})
+
+	response = app.request(http.MethodGet, fmt.Sprintf("/api/products/%d", aliceProduct), aliceToken, nil)
+
+	var product dtos.ProductResponseDTO
+	decode(t, response, &product)
+
+	if len(product.Images) != 1 || product.Images[0].ThumbnailURL != image.ThumbnailURL {
+		t.Fatalf("expected the confirmed image on the product, got %+v", product.Images)
+	}
+
+	thumbnail, err := http.Get(image.ThumbnailURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer thumbnail.Body.Close()
+
+	config, err := png.DecodeConfig(thumbnail.Body)
+
+	if err != nil || config.Width != 200 || config.Height != 100 {
+		t.Errorf("unexpected thumbnail %dx%d: %v", config.Width, config.Height, err)
+	}
+}
+
+func TestDirectImageUploadUnsupported(t *testing.T) {
+	app := newTestApp(t)
+	_, token := app.register("alice")
+	productID := app.create("/api/products/", token, dtos.ProductDTO{Name: "Lamp"})
+
+	response := app.request(http.MethodPost, fmt.Sprintf("/api/products/%d/images/uploads", productID), token, nil)
+	expectProblem(t, response, http.StatusNotImplemented, "direct_upload_unsupported")
+}
@@ -0,0 +1,151 @@
+package router
+
+import (
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/controllers"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/jobs"
+	"github.com/brunohradec/go-webstore/middleware"
+	"github.com/brunohradec/go-webstore/notifications"
+	"github.com/brunohradec/go-webstore/openapi"
+	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/brunohradec/go-webstore/storage"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+type Repositories struct {
+	User    repositories.UserRepository
+	Product repositories.ProductRepository
+	Comment repositories.CommentRepository
+	Review  repositories.ReviewRepository
+
+	ProductImage   repositories.ProductImageRepository
+	IdempotencyKey repositories.IdempotencyKeyRepository
+	AuditEvent     repositories.AuditEventRepository
+	OutboxEvent    repositories.OutboxEventRepository
+	Webhook        repositories.WebhookRepository
+	Job            repositories.JobRepository
+	Transactor     repositories.Transactor
+
+	Notification            repositories.NotificationRepository
+	NotificationPreferences repositories.NotificationPreferencesRepository
+}
+
+/* New builds the application router on top of the given repositories, blob
+* store and cache, wiring up the services, controllers and middleware in
+* between. Domain events are published to the outbox, their delivery to the
+* subscribers of bus is left to the caller, and so is sending the webhooks
+* and running the email jobs which are queued from them. */
+func New(
+	env *infrastructure.Env,
+	logger *slog.Logger,
+	repos *Repositories,
+	blobStore storage.BlobStore,
+	appCache cache.Cache,
+	bus events.Bus,
+) *gin.Engine {
+	auditService := services.InitAuditService(repos.AuditEvent, logger)
+	outboxService := services.InitOutboxService(repos.OutboxEvent, bus, &env.Outbox, logger)
+	userService := services.InitCachedUserService(
+		services.InitUserService(repos.User, repos.Transactor, outboxService, auditService, logger),
+		appCache, env.Cache.TTL, logger,
+	)
+	productService := services.InitCachedProductService(
+		services.InitProductService(repos.Product, repos.Transactor, outboxService, auditService, logger),
+		appCache, env.Cache.TTL, logger,
+	)
+	commentService := services.InitCommentService(
+		repos.Comment,
+		repos.Product,
+		services.InitContentFilter(&env.Moderation, repos.Comment),
+		repos.Transactor,
+		outboxService,
+		auditService,
+		logger,
+	)
+	moderationService := services.InitModerationService(repos.Comment, repos.Transactor, outboxService, auditService, logger)
+	reviewService := services.InitReviewService(repos.Review, repos.Product, services.InitNoPurchaseVerifier(), appCache, logger)
+	authService := services.InitAuthService(userService, env, logger)
+	productImageService := services.InitProductImageService(repos.ProductImage, blobStore, env.Media.MaxUploadBytes, logger)
+	trashService := services.InitTrashService(
+		repos.Product,
+		repos.Comment,
+		repos.ProductImage,
+		repos.Transactor,
+		outboxService,
+		auditService,
+		blobStore,
+		env.Trash.Retention,
+		logger,
+	)
+	idempotencyService := services.InitIdempotencyService(repos.IdempotencyKey, env.Idempotency.TTL, env.Idempotency.Lease, logger)
+	webhookService := services.InitWebhookService(
+		repos.Webhook, repos.Product, infrastructure.NewWebhookClient(&env.Webhook), &env.Webhook, logger,
+	)
+
+	notificationService := services.InitNotificationService(
+		repos.Notification,
+		repos.NotificationPreferences,
+		repos.Product,
+		jobs.InitEnqueuer(repos.Job, &env.Jobs, logger),
+		notifications.InitHub(),
+		logger,
+	)
+
+	bus.Subscribe("webhooks", webhookService.Enqueue, services.WebhookEventTypes...)
+	bus.Subscribe("notifications", notificationService.Notify, services.NotificationEventTypes...)
+
+	r := gin.New()
+
+	// gin trusts X-Forwarded-For from everyone by default, which would let
+	// clients choose the IP recorded in the audit log.
+	err := r.SetTrustedProxies(env.TrustedProxies)
+
+	if err != nil {
+		logger.Error("invalid trusted proxies, trusting none", "error", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+
+	r.Use(
+		gin.Recovery(),
+		otelgin.Middleware(env.Tracing.ServiceName),
+		middleware.RequestIDMiddleware(),
+		middleware.RequestLoggingMiddleware(logger),
+		middleware.ErrorMiddleware(logger),
+	)
+
+	docsController := controllers.InitDocsController(func() (*openapi.Document, error) {
+		return APIDocument(r.Routes())
+	}, "/api/openapi.json", "/api/docs/assets")
+
+	RegisterRoutes(r, &Controllers{
+		Auth:    controllers.InitAuthController(authService, userService, logger),
+		User:    controllers.InitUserController(userService, logger),
+		Product: controllers.InitProductController(productService, productImageService, logger),
+		Comment: controllers.InitCommentController(commentService, userService, logger),
+		Review:  controllers.InitReviewController(reviewService, userService),
+		Docs:    docsController,
+
+		ProductImage: controllers.InitProductImageController(productService, productImageService, env.Media.MaxUploadBytes),
+		Media:        controllers.InitMediaController(blobStore),
+		Moderation:   controllers.InitModerationController(moderationService, userService),
+		Cache:        controllers.InitCacheController(appCache),
+		Trash:        controllers.InitTrashController(trashService, env.Trash.Retention),
+		Audit:        controllers.InitAuditController(auditService),
+		Event:        controllers.InitEventController(outboxService),
+		Webhook:      controllers.InitWebhookController(webhookService),
+		Job:          controllers.InitJobController(services.InitJobService(repos.Job, logger)),
+		Notification: controllers.InitNotificationController(notificationService),
+	}, &Middlewares{
+		Auth:        middleware.JwtAuthMiddleware(env),
+		RequireRole: middleware.RoleMiddleware(userService),
+		Idempotency: middleware.IdempotencyMiddleware(idempotencyService, logger),
+	})
+
+	return r
+}
@@ -0,0 +1,2076 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/dtos"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/jobs"
+	"github.com/brunohradec/go-webstore/middleware"
+	"github.com/brunohradec/go-webstore/notifications"
+	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/services"
+	"github.com/brunohradec/go-webstore/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type testApp struct {
+	t        *testing.T
+	router   *gin.Engine
+	repos    *Repositories
+	outbox   services.OutboxService
+	webhooks services.WebhookService
+	bus      events.Bus
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	return newTestAppWithBlobStore(t, storage.InitMemoryBlobStore("/media"))
+}
+
+func newTestAppWithBlobStore(t *testing.T, blobStore storage.BlobStore) *testApp {
+	t.Helper()
+
+	return newTestAppWithRepos(t, newMemoryRepositories(), blobStore)
+}
+
+func newMemoryRepositories() *Repositories {
+	products := repositories.InitMemoryProductRepository()
+
+	return &Repositories{
+		User:    repositories.InitMemoryUserRepository(),
+		Product: products,
+		Comment: repositories.InitMemoryCommentRepository(products),
+		Review:  repositories.InitMemoryReviewRepository(products),
+
+		ProductImage:   repositories.InitMemoryProductImageRepository(),
+		IdempotencyKey: repositories.InitMemoryIdempotencyKeyRepository(),
+		AuditEvent:     repositories.InitMemoryAuditEventRepository(),
+		OutboxEvent:    repositories.InitMemoryOutboxEventRepository(),
+		Webhook:        repositories.InitMemoryWebhookRepository(),
+		Job:            repositories.InitMemoryJobRepository(),
+		Transactor:     repositories.InitMemoryTransactor(),
+
+		Notification:            repositories.InitMemoryNotificationRepository(),
+		NotificationPreferences: repositories.InitMemoryNotificationPreferencesRepository(),
+	}
+}
+
+func newTestAppWithRepos(t *testing.T, repos *Repositories, blobStore storage.BlobStore) *testApp {
+	t.Helper()
+
+	return newTestAppWithEnv(t, newTestEnv(), repos, blobStore)
+}
+
+func newTestEnv() *infrastructure.Env {
+	return &infrastructure.Env{
+		JWT: infrastructure.JWTEnv{
+			AccessTokenSecret: "router-test-secret",
+			AccessTokenTTL:    60,
+		},
+		Media: infrastructure.MediaEnv{
+			BaseURL:        "/media",
+			MaxUploadBytes: 1 << 20,
+		},
+		Moderation: infrastructure.ModerationEnv{
+			BannedWords:  []string{"spam"},
+			MaxLinks:     1,
+			RepeatWindow: time.Minute,
+		},
+		Cache: infrastructure.CacheEnv{
+			TTL: time.Minute,
+		},
+		Idempotency: infrastructure.IdempotencyEnv{
+			TTL:   time.Minute,
+			Lease: time.Minute,
+		},
+		Trash: infrastructure.TrashEnv{
+			Retention: time.Hour,
+		},
+		Outbox: infrastructure.OutboxEnv{
+			MaxAttempts: 2,
+		},
+		Webhook: infrastructure.WebhookEnv{
+			MaxAttempts:          2,
+			DisableAfter:         3,
+			Timeout:              5 * time.Second,
+			AllowPrivateNetworks: true,
+		},
+	}
+}
+
+func newTestAppWithEnv(t *testing.T, env *infrastructure.Env, repos *Repositories, blobStore storage.BlobStore) *testApp {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := events.InitBus()
+
+	return &testApp{
+		t:      t,
+		router: New(env, logger, repos, blobStore, cache.InitLRUCache(1000), bus),
+		repos:  repos,
+		outbox: services.InitOutboxService(repos.OutboxEvent, bus, &env.Outbox, logger),
+		webhooks: services.InitWebhookService(
+			repos.Webhook, repos.Product, infrastructure.NewWebhookClient(&env.Webhook), &env.Webhook, logger,
+		),
+		bus: bus,
+	}
+}
+
+func (app *testApp) request(method string, path string, token string, body any) *httptest.ResponseRecorder {
+	app.t.Helper()
+
+	return app.requestWithHeaders(method, path, token, body, nil)
+}
+
+func (app *testApp) requestWithHeaders(
+	method string,
+	path string,
+	token string,
+	body any,
+	headers map[string]string) *httptest.ResponseRecorder {
+
+	app.t.Helper()
+
+	var payload io.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+
+		if err != nil {
+			app.t.Fatal(err)
+		}
+
+		payload = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, payload)
+	req.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	app.router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// register creates a user and returns its ID and an access token.
+func (app *testApp) register(username string) (uint, string) {
+	app.t.Helper()
+
+	response := app.request(http.MethodPost, "/api/auth/register", "", dtos.UserDTO{
+		Email:    username + "@example.com",
+		Username: username,
+		Password: "secret",
+	})
+
+	if response.Code != http.StatusCreated {
+		app.t.Fatalf("could not register %s: %d %s", username, response.Code, response.Body)
+	}
+
+	var created dtos.CreatedResponseDTO
+	decode(app.t, response, &created)
+
+	response = app.request(http.MethodPost, "/api/auth/login", "", dtos.LoginDTO{
+		Username: username,
+		Password: "secret",
+	})
+
+	if response.Code != http.StatusOK {
+		app.t.Fatalf("could not log in %s: %d %s", username, response.Code, response.Body)
+	}
+
+	var login dtos.LoginReponseDTO
+	decode(app.t, response, &login)
+
+	return created.ID, login.AccessToken
+}
+
+// appointAdmin makes the user an admin, which can only be done in the
+// database.
+func (app *testApp) appointAdmin(userID uint) {
+	app.t.Helper()
+
+	user, err := app.repos.User.FindByID(context.Background(), userID)
+
+	if err != nil {
+		app.t.Fatal(err)
+	}
+
+	user.Role = entities.RoleAdmin
+
+	if err := app.repos.User.UpdateByID(context.Background(), userID, user); err != nil {
+		app.t.Fatal(err)
+	}
+}
+
+// etag reads the current ETag of a resource.
+func (app *testApp) etag(path string, token string) string {
+	app.t.Helper()
+
+	response := app.request(http.MethodGet, path, token, nil)
+	etag := response.Header().Get("ETag")
+
+	if response.Code != http.StatusOK || etag == "" {
+		app.t.Fatalf("could not read the ETag of %s: %d %s", path, response.Code, response.Body)
+	}
+
+	return etag
+}
+
+// update replaces a resource which requires If-Match with its current ETag.
+func (app *testApp) update(path string, token string, body any) *httptest.ResponseRecorder {
+	app.t.Helper()
+
+	return app.requestWithHeaders(http.MethodPut, path, token, body, map[string]string{
+		"If-Match": app.etag(path, token),
+	})
+}
+
+func (app *testApp) create(path string, token string, body any) uint {
+	app.t.Helper()
+
+	response := app.request(http.MethodPost, path, token, body)
+
+	if response.Code != http.StatusCreated {
+		app.t.Fatalf("could not create %s: %d %s", path, response.Code, response.Body)
+	}
+
+	var created dtos.CreatedResponseDTO
+	decode(app.t, response, &created)
+
+	return created.ID
+}
+
+func decode(t *testing.T, response *httptest.ResponseRecorder, out any) {
+	t.Helper()
+
+	if err := json.Unmarshal(response.Body.Bytes(), out); err != nil {
+		t.Fatalf("could not decode response %q: %v", response.Body, err)
+	}
+}
+
+func expectProblem(t *testing.T, response *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if response.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, response.Code, response.Body)
+	}
+
+	if code == "" {
+		return
+	}
+
+	var problem dtos.ProblemDTO
+	decode(t, response, &problem)
+
+	if problem.Code != code {
+		t.Errorf("expected problem code %q, got %q", code, problem.Code)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	app := newTestApp(t)
+	_, token := app.register("alice")
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+	}{
+		{
+			name:   "register duplicate username",
+			method: http.MethodPost,
+			path:   "/api/auth/register",
+			body:   dtos.UserDTO{Email: "other@example.com", Username: "alice", Password: "x"},
+			status: http.StatusConflict,
+			code:   "username_taken",
+		},
+		{
+			name:   "register without password",
+			method: http.MethodPost,
+			path:   "/api/auth/register",
+			body:   dtos.UserDTO{Email: "bob@example.com", Username: "bob"},
+			status: http.StatusBadRequest,
+			code:   "validation_failed",
+		},
+		{
+			name:   "login with wrong password",
+			method: http.MethodPost,
+			path:   "/api/auth/login",
+			body:   dtos.LoginDTO{Username: "alice", Password: "wrong"},
+			status: http.StatusUnauthorized,
+			code:   "invalid_credentials",
+		},
+		{
+			name:   "login with unknown user",
+			method: http.MethodPost,
+			path:   "/api/auth/login",
+			body:   dtos.LoginDTO{Username: "nobody", Password: "secret"},
+			status: http.StatusUnauthorized,
+			code:   "invalid_credentials",
+		},
+		{
+			name:   "me without token",
+			method: http.MethodGet,
+			path:   "/api/auth/me/",
+			status: http.StatusUnauthorized,
+			code:   "invalid_token",
+		},
+		{
+			name:   "me with malformed token",
+			method: http.MethodGet,
+			path:   "/api/auth/me/",
+			token:  "not-a-jwt",
+			status: http.StatusUnauthorized,
+			code:   "invalid_token",
+		},
+		{
+			name:   "me with valid token",
+			method: http.MethodGet,
+			path:   "/api/auth/me/",
+			token:  token,
+			status: http.StatusOK,
+		},
+		{
+			name:   "protected route without token",
+			method: http.MethodGet,
+			path:   "/api/products/",
+			status: http.StatusUnauthorized,
+			code:   "invalid_token",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.request(tc.method, tc.path, tc.token, tc.body)
+			expectProblem(t, response, tc.status, tc.code)
+		})
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	productID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	commentID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Nice", ProductID: productID})
+
+	productPath := fmt.Sprintf("/api/products/%d", productID)
+	commentPath := fmt.Sprintf("/api/comments/%d", commentID)
+
+	productETag := app.etag(productPath, aliceToken)
+	commentETag := app.etag(commentPath, aliceToken)
+
+	// Cases run in order, the successful deletes come last.
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		token   string
+		body    any
+		ifMatch string
+		status  int
+		code    string
+	}{
+		{"update product of other user", http.MethodPut, productPath, bobToken, dtos.ProductDTO{Name: "Mine"}, "", http.StatusForbidden, "product_not_owned"},
+		{"delete product of other user", http.MethodDelete, productPath, bobToken, nil, "", http.StatusForbidden, "product_not_owned"},
+		{"update comment of other user", http.MethodPut, commentPath, bobToken, dtos.CommentDTO{Content: "Mine", ProductID: productID}, "", http.StatusForbidden, "comment_not_owned"},
+		{"delete comment of other user", http.MethodDelete, commentPath, bobToken, nil, "", http.StatusForbidden, "comment_not_owned"},
+		{"update own product", http.MethodPut, productPath, aliceToken, dtos.ProductDTO{Name: "Desk lamp"}, productETag, http.StatusOK, ""},
+		{"update own comment", http.MethodPut, commentPath, aliceToken, dtos.CommentDTO{Content: "Very nice", ProductID: productID}, commentETag, http.StatusOK, ""},
+		{"update missing product", http.MethodPut, "/api/products/999", aliceToken, dtos.ProductDTO{Name: "Ghost"}, "", http.StatusNotFound, "product_not_found"},
+		{"invalid product ID", http.MethodGet, "/api/products/abc", aliceToken, nil, "", http.StatusBadRequest, "invalid_id"},
+		{"delete own comment", http.MethodDelete, commentPath, aliceToken, nil, "", http.StatusOK, ""},
+		{"deleted comment is gone", http.MethodDelete, commentPath, aliceToken, nil, "", http.StatusNotFound, "comment_not_found"},
+		{"comment author still exists", http.MethodGet, "/api/auth/me/", aliceToken, nil, "", http.StatusOK, ""},
+		{"delete own product", http.MethodDelete, productPath, aliceToken, nil, "", http.StatusOK, ""},
+		{"deleted product is gone", http.MethodGet, productPath, aliceToken, nil, "", http.StatusNotFound, "product_not_found"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.requestWithHeaders(tc.method, tc.path, tc.token, tc.body, map[string]string{"If-Match": tc.ifMatch})
+			expectProblem(t, response, tc.status, tc.code)
+		})
+	}
+}
+
+func TestPagination(t *testing.T) {
+	app := newTestApp(t)
+	aliceID, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	var firstProductID uint
+
+	for i := 0; i < 25; i++ {
+		ID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: fmt.Sprint("Product ", i)})
+
+		if i == 0 {
+			firstProductID = ID
+		}
+	}
+
+	app.create("/api/products/", bobToken, dtos.ProductDTO{Name: "Bob's product"})
+
+	for i := 0; i < 12; i++ {
+		app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: fmt.Sprint("Comment ", i), ProductID: firstProductID})
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		count   int
+		firstID uint
+	}{
+		{"default page", "/api/products/", 10, 1},
+		{"second page", "/api/products/?page=2", 10, 11},
+		{"custom page size", "/api/products/?page=3&pageSize=5", 5, 11},
+		{"partial last page", "/api/products/?page=3&pageSize=10", 6, 21},
+		{"page past the end", "/api/products/?page=4&pageSize=10", 0, 0},
+		{"page size is clamped", "/api/products/?pageSize=1000", 26, 1},
+		{"invalid page falls back to first", "/api/products/?page=abc&pageSize=3", 3, 1},
+		{"products of user", fmt.Sprintf("/api/products/user/%d?pageSize=100", aliceID), 25, 1},
+		{"comments of product", fmt.Sprintf("/api/comments/product/%d?page=2&pageSize=5", firstProductID), 5, 6},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.request(http.MethodGet, tc.path, aliceToken, nil)
+
+			if response.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", response.Code, response.Body)
+			}
+
+			var items []struct {
+				ID uint `json:"ID"`
+			}
+			decode(t, response, &items)
+
+			if len(items) != tc.count {
+				t.Fatalf("expected %d items, got %d", tc.count, len(items))
+			}
+
+			if tc.count > 0 && items[0].ID != tc.firstID {
+				t.Errorf("expected first item ID %d, got %d", tc.firstID, items[0].ID)
+			}
+		})
+	}
+}
+
+func TestReviews(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+	_, carolToken := app.register("carol")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	chairID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Chair"})
+
+	bobsReviewID := app.create("/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: chairID, Rating: 5, Title: "Great"})
+	app.create("/api/reviews/", carolToken, dtos.ReviewDTO{ProductID: chairID, Rating: 2, Title: "Wobbly"})
+	app.create("/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: lampID, Rating: 3, Title: "Fine"})
+
+	reviewPath := fmt.Sprintf("/api/reviews/%d", bobsReviewID)
+	helpful := true
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+	}{
+		{"review own product", http.MethodPost, "/api/reviews/", aliceToken, dtos.ReviewDTO{ProductID: lampID, Rating: 5, Title: "Mine"}, http.StatusForbidden, "own_product_review"},
+		{"review twice", http.MethodPost, "/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: chairID, Rating: 1, Title: "Again"}, http.StatusConflict, "review_exists"},
+		{"review missing product", http.MethodPost, "/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: 999, Rating: 1, Title: "Ghost"}, http.StatusNotFound, "product_not_found"},
+		{"rating out of range", http.MethodPost, "/api/reviews/", carolToken, dtos.ReviewDTO{ProductID: lampID, Rating: 6, Title: "Wow"}, http.StatusBadRequest, "validation_failed"},
+		{"update review of other user", http.MethodPut, reviewPath, carolToken, dtos.ReviewUpdateDTO{Rating: 1, Title: "Mine"}, http.StatusForbidden, "review_not_owned"},
+		{"vote on own review", http.MethodPut, reviewPath + "/vote", bobToken, dtos.ReviewVoteDTO{Helpful: &helpful}, http.StatusForbidden, "own_review_vote"},
+		{"vote without choice", http.MethodPut, reviewPath + "/vote", carolToken, dtos.ReviewVoteDTO{}, http.StatusBadRequest, "validation_failed"},
+		{"vote helpful", http.MethodPut, reviewPath + "/vote", carolToken, dtos.ReviewVoteDTO{Helpful: &helpful}, http.StatusOK, ""},
+		{"unknown sort", http.MethodGet, "/api/products/?sort=price", aliceToken, nil, http.StatusBadRequest, "invalid_sort"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.request(tc.method, tc.path, tc.token, tc.body)
+			expectProblem(t, response, tc.status, tc.code)
+		})
+	}
+
+	var review dtos.ReviewResponseDTO
+	decode(t, app.request(http.MethodGet, reviewPath, aliceToken, nil), &review)
+
+	if review.Username != "bob" || review.HelpfulCount != 1 || review.VerifiedPurchase {
+		t.Errorf("unexpected review %+v", review)
+	}
+
+	var chair dtos.ProductResponseDTO
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/products/%d", chairID), aliceToken, nil), &chair)
+
+	if chair.Rating.Count != 2 || chair.Rating.Average != 3.5 || chair.Rating.Histogram[5] != 1 || chair.Rating.Histogram[2] != 1 {
+		t.Errorf("unexpected chair rating %+v", chair.Rating)
+	}
+
+	var products []dtos.ProductResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/products/?sort=rating", aliceToken, nil), &products)
+
+	if len(products) != 2 || products[0].ID != chairID || products[1].ID != lampID {
+		t.Errorf("expected the chair (3.5) before the lamp (3.0), got %+v", products)
+	}
+}
+
+func TestCommentThreads(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	chairID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Chair"})
+
+	questionID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is it dimmable?", ProductID: lampID})
+	answerID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Yes", ProductID: lampID, ParentID: &questionID})
+	app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Thanks", ProductID: lampID, ParentID: &answerID})
+
+	parentID := questionID
+
+	for depth := 1; depth <= services.MaxCommentDepth; depth++ {
+		parentID = app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: fmt.Sprint("Depth ", depth), ProductID: lampID, ParentID: &parentID})
+	}
+
+	missingID := uint(999)
+
+	cases := []struct {
+		name   string
+		body   dtos.CommentDTO
+		status int
+		code   string
+	}{
+		{"reply to missing comment", dtos.CommentDTO{Content: "?", ProductID: lampID, ParentID: &missingID}, http.StatusNotFound, "parent_comment_not_found"},
+		{"reply on other product", dtos.CommentDTO{Content: "?", ProductID: chairID, ParentID: &questionID}, http.StatusBadRequest, "invalid_parent_comment"},
+		{"reply too deep", dtos.CommentDTO{Content: "?", ProductID: lampID, ParentID: &parentID}, http.StatusBadRequest, "comment_too_deep"},
+		{"comment on missing product", dtos.CommentDTO{Content: "?", ProductID: 999}, http.StatusNotFound, "product_not_found"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.request(http.MethodPost, "/api/comments/", bobToken, tc.body)
+			expectProblem(t, response, tc.status, tc.code)
+		})
+	}
+
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/comments/%d", questionID), bobToken, nil), http.StatusOK, "")
+
+	var threads []dtos.CommentResponseDto
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/comments/product/%d", lampID), bobToken, nil), &threads)
+
+	if len(threads) != 1 {
+		t.Fatalf("expected one thread, got %+v", threads)
+	}
+
+	question := threads[0]
+
+	if !question.Deleted || question.Content != "" || question.Username != "" || question.ReplyCount != 2+services.MaxCommentDepth || len(question.Replies) != 2 {
+		t.Fatalf("expected the deleted question as a tombstone with its replies, got %+v", question)
+	}
+
+	answer := question.Replies[0]
+
+	if answer.ID != answerID || !answer.SellerResponse || answer.Username != "alice" || answer.ReplyCount != 1 || len(answer.Replies) != 1 {
+		t.Errorf("expected the answer as a seller response, got %+v", answer)
+	}
+
+	if answer.Replies[0].SellerResponse || *answer.Replies[0].ParentID != answerID {
+		t.Errorf("expected a plain reply to the answer, got %+v", answer.Replies[0])
+	}
+}
+
+func TestCommentModeration(t *testing.T) {
+	app := newTestApp(t)
+	aliceID, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+	carolID, carolToken := app.register("carol")
+
+	app.appointAdmin(aliceID)
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	lampComments := fmt.Sprintf("/api/comments/product/%d", lampID)
+
+	spamID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Buy SPAM now", ProductID: lampID})
+	linksID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "See http://a.example and www.b.example", ProductID: lampID})
+	praiseID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Great lamp", ProductID: lampID})
+	repeatID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "great  lamp!", ProductID: lampID})
+
+	carolRole := fmt.Sprintf("/api/users/%d/role", carolID)
+	praiseReport := fmt.Sprintf("/api/comments/%d/report", praiseID)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+	}{
+		{"appoint moderator without admin role", http.MethodPut, carolRole, bobToken, dtos.UserRoleDTO{Role: "moderator"}, http.StatusForbidden, "role_required"},
+		{"appoint unknown role", http.MethodPut, carolRole, aliceToken, dtos.UserRoleDTO{Role: "owner"}, http.StatusBadRequest, "validation_failed"},
+		{"appoint moderator", http.MethodPut, carolRole, aliceToken, dtos.UserRoleDTO{Role: "moderator"}, http.StatusOK, ""},
+		{"report comment", http.MethodPost, praiseReport, carolToken, dtos.CommentReportDTO{Reason: "Off topic"}, http.StatusCreated, ""},
+		{"report comment twice", http.MethodPost, praiseReport, carolToken, dtos.CommentReportDTO{Reason: "Off topic"}, http.StatusConflict, "comment_already_reported"},
+		{"report own comment", http.MethodPost, praiseReport, bobToken, dtos.CommentReportDTO{Reason: "Oops"}, http.StatusForbidden, "own_comment_report"},
+		{"report held comment", http.MethodPost, fmt.Sprintf("/api/comments/%d/report", spamID), aliceToken, dtos.CommentReportDTO{Reason: "Spam"}, http.StatusNotFound, "comment_not_found"},
+		{"queue without moderator role", http.MethodGet, "/api/moderation/comments", bobToken, nil, http.StatusForbidden, "role_required"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := app.request(tc.method, tc.path, tc.token, tc.body)
+			expectProblem(t, response, tc.status, tc.code)
+		})
+	}
+
+	var queue []dtos.ModerationQueueItemDTO
+	decode(t, app.request(http.MethodGet, "/api/moderation/comments", carolToken, nil), &queue)
+
+	if len(queue) != 4 || queue[0].Comment.ID != spamID || queue[0].ModerationReason == "" || queue[0].Comment.Status != "pending" {
+		t.Fatalf("expected the three held comments and the reported one, got %+v", queue)
+	}
+
+	if queue[2].Comment.ID != praiseID || len(queue[2].Reports) != 1 || queue[2].Reports[0].Reason != "Off topic" {
+		t.Errorf("expected the reported comment with its report, got %+v", queue[2])
+	}
+
+	for _, action := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", spamID)},
+		{http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/hide", praiseID)},
+		{http.MethodDelete, fmt.Sprintf("/api/moderation/comments/%d", linksID)},
+	} {
+		expectProblem(t, app.request(action.method, action.path, carolToken, nil), http.StatusOK, "")
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/moderation/comments", carolToken, nil), &queue)
+
+	if len(queue) != 1 || queue[0].Comment.ID != repeatID {
+		t.Errorf("expected only the repeated comment to be left in the queue, got %+v", queue)
+	}
+
+	var comments []dtos.CommentResponseDto
+	decode(t, app.request(http.MethodGet, lampComments, carolToken, nil), &comments)
+
+	if len(comments) != 1 || comments[0].ID != spamID || comments[0].Status != "published" {
+		t.Errorf("expected others to only see the approved comment, got %+v", comments)
+	}
+
+	expectProblem(t, app.update(fmt.Sprintf("/api/comments/%d", praiseID), bobToken, dtos.CommentDTO{Content: "Nice lamp", ProductID: lampID}), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, lampComments, bobToken, nil), &comments)
+
+	if len(comments) != 3 || comments[1].ID != praiseID || comments[1].Status != "hidden" || comments[2].Status != "pending" {
+		t.Errorf("expected the author to see the edited comment still hidden, got %+v", comments)
+	}
+}
+
+// countingUserRepository counts the lookups of users by ID.
+type countingUserRepository struct {
+	repositories.UserRepository
+	lookups int
+}
+
+func (repository *countingUserRepository) FindByID(ctx context.Context, ID uint) (*entities.User, error) {
+	repository.lookups++
+	return repository.UserRepository.FindByID(ctx, ID)
+}
+
+func (repository *countingUserRepository) FindByIDs(ctx context.Context, IDs []uint) []entities.User {
+	repository.lookups++
+	return repository.UserRepository.FindByIDs(ctx, IDs)
+}
+
+func TestCommentAuthorsAreLoadedTogether(t *testing.T) {
+	users := &countingUserRepository{UserRepository: repositories.InitMemoryUserRepository()}
+	products := repositories.InitMemoryProductRepository()
+
+	app := newTestAppWithRepos(t, &Repositories{
+		User:    users,
+		Product: products,
+		Comment: repositories.InitMemoryCommentRepository(products),
+		Review:  repositories.InitMemoryReviewRepository(products),
+
+		ProductImage:   repositories.InitMemoryProductImageRepository(),
+		IdempotencyKey: repositories.InitMemoryIdempotencyKeyRepository(),
+		AuditEvent:     repositories.InitMemoryAuditEventRepository(),
+		OutboxEvent:    repositories.InitMemoryOutboxEventRepository(),
+		Webhook:        repositories.InitMemoryWebhookRepository(),
+		Job:            repositories.InitMemoryJobRepository(),
+		Transactor:     repositories.InitMemoryTransactor(),
+
+		Notification:            repositories.InitMemoryNotificationRepository(),
+		NotificationPreferences: repositories.InitMemoryNotificationPreferencesRepository(),
+	}, storage.InitMemoryBlobStore("/media"))
+
+	aliceID, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+	carolID, carolToken := app.register("carol")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	questionID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is it dimmable?", ProductID: lampID})
+
+	app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Yes", ProductID: lampID, ParentID: &questionID})
+	app.create("/api/comments/", carolToken, dtos.CommentDTO{Content: "Mine is", ProductID: lampID, ParentID: &questionID})
+	app.create("/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: lampID, Rating: 4, Title: "Bright"})
+	app.create("/api/reviews/", carolToken, dtos.ReviewDTO{ProductID: lampID, Rating: 5, Title: "Lovely"})
+
+	if err := users.DeleteByID(context.Background(), carolID); err != nil {
+		t.Fatal(err)
+	}
+
+	users.lookups = 0
+
+	var threads []dtos.CommentResponseDto
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/comments/product/%d", lampID), aliceToken, nil), &threads)
+
+	if users.lookups != 1 {
+		t.Errorf("expected the authors to be loaded at once, got %d user lookups", users.lookups)
+	}
+
+	if len(threads) != 1 || threads[0].Username != "bob" || len(threads[0].Replies) != 2 {
+		t.Fatalf("unexpected threads %+v", threads)
+	}
+
+	if answer, deleted := threads[0].Replies[0], threads[0].Replies[1]; answer.Username != "alice" || answer.UserID != aliceID || deleted.Username != "" || deleted.Content != "Mine is" {
+		t.Errorf("expected the reply of the deleted user without a username, got %+v", threads[0].Replies)
+	}
+
+	users.lookups = 0
+
+	var reviews []dtos.ReviewResponseDTO
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/reviews/product/%d", lampID), aliceToken, nil), &reviews)
+
+	if users.lookups != 1 || len(reviews) != 2 || reviews[0].Username != "bob" || reviews[1].Username != "" {
+		t.Errorf("expected the reviewers to be loaded at once, got %d lookups and %+v", users.lookups, reviews)
+	}
+}
+
+func TestCachedReadsAreInvalidated(t *testing.T) {
+	app := newTestApp(t)
+	adminID, adminToken := app.register("alice")
+	bobID, bobToken := app.register("bob")
+	app.appointAdmin(adminID)
+
+	lampID := app.create("/api/products/", adminToken, dtos.ProductDTO{Name: "Lamp"})
+	lampPath := fmt.Sprintf("/api/products/%d", lampID)
+
+	var lamp dtos.ProductResponseDTO
+	decode(t, app.request(http.MethodGet, lampPath, bobToken, nil), &lamp)
+
+	expectProblem(t, app.update(lampPath, adminToken, dtos.ProductDTO{Name: "Desk lamp"}), http.StatusOK, "")
+	app.create("/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: lampID, Rating: 4, Title: "Bright"})
+
+	decode(t, app.request(http.MethodGet, lampPath, bobToken, nil), &lamp)
+
+	if lamp.Name != "Desk lamp" || lamp.Rating.Count != 1 {
+		t.Errorf("expected the updated and reviewed product, got %+v", lamp)
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/moderation/comments", bobToken, nil), http.StatusForbidden, "role_required")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/users/%d/role", bobID), adminToken, dtos.UserRoleDTO{Role: "moderator"}), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, "/api/moderation/comments", bobToken, nil), http.StatusOK, "")
+
+	expectProblem(t, app.request(http.MethodDelete, lampPath, adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, lampPath, bobToken, nil), http.StatusNotFound, "product_not_found")
+
+	var stats dtos.CacheStatsResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/admin/cache", adminToken, nil), &stats)
+
+	if stats.Hits == 0 || stats.Misses == 0 || stats.HitRatio <= 0 || stats.HitRatio >= 1 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/cache", bobToken, nil), http.StatusForbidden, "role_required")
+}
+
+func TestConditionalRequests(t *testing.T) {
+	app := newTestApp(t)
+	aliceID, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	commentID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Ask away", ProductID: lampID})
+	spamID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Buy spam", ProductID: lampID})
+
+	lampPath := fmt.Sprintf("/api/products/%d", lampID)
+	commentPath := fmt.Sprintf("/api/comments/%d", commentID)
+
+	response := app.request(http.MethodGet, lampPath, bobToken, nil)
+	lampETag := response.Header().Get("ETag")
+	lastModified := response.Header().Get("Last-Modified")
+
+	if lampETag == "" || lastModified == "" {
+		t.Fatalf("expected validators on the product, got %v", response.Header())
+	}
+
+	for _, path := range []string{lampPath, commentPath, fmt.Sprintf("/api/users/%d", aliceID), "/api/auth/me/"} {
+		etag := app.etag(path, aliceToken)
+
+		response := app.requestWithHeaders(http.MethodGet, path, aliceToken, nil, map[string]string{"If-None-Match": etag})
+
+		if response.Code != http.StatusNotModified || response.Body.Len() != 0 {
+			t.Errorf("expected %s to be not modified, got %d %s", path, response.Code, response.Body)
+		}
+	}
+
+	response = app.requestWithHeaders(http.MethodGet, lampPath, bobToken, nil, map[string]string{"If-Modified-Since": lastModified})
+
+	if response.Code != http.StatusNotModified {
+		t.Errorf("expected the product to be unmodified since %s, got %d", lastModified, response.Code)
+	}
+
+	expectProblem(t, app.request(http.MethodPut, lampPath, aliceToken, dtos.ProductDTO{Name: "Desk lamp"}), http.StatusPreconditionRequired, "precondition_required")
+
+	response = app.requestWithHeaders(http.MethodPut, lampPath, aliceToken, dtos.ProductDTO{Name: "Desk lamp"}, map[string]string{"If-Match": lampETag})
+	expectProblem(t, response, http.StatusOK, "")
+
+	updatedETag := response.Header().Get("ETag")
+
+	if updatedETag == "" || updatedETag == lampETag || updatedETag != app.etag(lampPath, bobToken) {
+		t.Errorf("expected the update to return the new ETag, got %q after %q", updatedETag, lampETag)
+	}
+
+	response = app.requestWithHeaders(http.MethodPut, lampPath, aliceToken, dtos.ProductDTO{Name: "Floor lamp"}, map[string]string{"If-Match": lampETag})
+	expectProblem(t, response, http.StatusPreconditionFailed, "precondition_failed")
+
+	app.create("/api/reviews/", bobToken, dtos.ReviewDTO{ProductID: lampID, Rating: 4, Title: "Bright"})
+
+	response = app.requestWithHeaders(http.MethodGet, lampPath, bobToken, nil, map[string]string{"If-None-Match": updatedETag})
+
+	if response.Code != http.StatusOK {
+		t.Errorf("expected a new review to change the product, got %d", response.Code)
+	}
+
+	commentETag := app.etag(commentPath, aliceToken)
+	update := dtos.CommentDTO{Content: "Ask me anything", ProductID: lampID}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPut, commentPath, aliceToken, update, map[string]string{"If-Match": `"stale"`}), http.StatusPreconditionFailed, "precondition_failed")
+	expectProblem(t, app.requestWithHeaders(http.MethodPut, commentPath, aliceToken, update, map[string]string{"If-Match": commentETag}), http.StatusOK, "")
+
+	spamPath := fmt.Sprintf("/api/comments/%d", spamID)
+
+	expectProblem(t, app.request(http.MethodGet, spamPath, aliceToken, nil), http.StatusNotFound, "comment_not_found")
+	expectProblem(t, app.request(http.MethodGet, spamPath, bobToken, nil), http.StatusOK, "")
+}
+
+func TestMergePatch(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Description: "Bright", Price: 1000})
+	lampPath := fmt.Sprintf("/api/products/%d", lampID)
+	patchHeaders := func(path string) map[string]string {
+		return map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": app.etag(path, aliceToken)}
+	}
+
+	response := app.requestWithHeaders(http.MethodPatch, lampPath, aliceToken, map[string]any{"price": 1500, "description": nil}, patchHeaders(lampPath))
+	expectProblem(t, response, http.StatusOK, "")
+
+	if response.Header().Get("ETag") != app.etag(lampPath, aliceToken) {
+		t.Errorf("expected the patch to return the new ETag")
+	}
+
+	var lamp dtos.ProductResponseDTO
+	decode(t, app.request(http.MethodGet, lampPath, aliceToken, nil), &lamp)
+
+	if lamp.Name != "Lamp" || lamp.Description != "" || lamp.Price != 1500 {
+		t.Errorf("expected only the price and description to change, got %+v", lamp)
+	}
+
+	invalidPatches := map[string]any{
+		"unknown member": map[string]any{"colour": "red"},
+		"wrong type":     map[string]any{"price": "cheap"},
+		"removed name":   map[string]any{"name": nil},
+		"not an object":  json.RawMessage(`["name"]`),
+	}
+
+	for name, patch := range invalidPatches {
+		response := app.requestWithHeaders(http.MethodPatch, lampPath, aliceToken, patch, patchHeaders(lampPath))
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("expected a patch with %s to be rejected, got %d %s", name, response.Code, response.Body)
+		}
+	}
+
+	headers := patchHeaders(lampPath)
+	headers["Content-Type"] = "text/plain"
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPatch, lampPath, aliceToken, map[string]any{"price": 1}, headers), http.StatusUnsupportedMediaType, "unsupported_patch_type")
+	expectProblem(t, app.request(http.MethodPatch, lampPath, aliceToken, map[string]any{"price": 1}), http.StatusPreconditionRequired, "precondition_required")
+
+	commentID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Ask away", ProductID: lampID})
+	commentPath := fmt.Sprintf("/api/comments/%d", commentID)
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPatch, commentPath, aliceToken, map[string]any{"content": "Ask me anything"}, patchHeaders(commentPath)), http.StatusOK, "")
+
+	var comment dtos.CommentResponseDto
+	decode(t, app.request(http.MethodGet, commentPath, aliceToken, nil), &comment)
+
+	if comment.Content != "Ask me anything" {
+		t.Errorf("expected the comment content to be patched, got %q", comment.Content)
+	}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPatch, "/api/users/", aliceToken, map[string]any{"firstName": "Alice"}, patchHeaders("/api/auth/me/")), http.StatusOK, "")
+
+	var me dtos.UserResponseDto
+	decode(t, app.request(http.MethodGet, "/api/auth/me/", aliceToken, nil), &me)
+
+	if me.FirstName != "Alice" || me.Username != "alice" {
+		t.Errorf("expected only the first name to change, got %+v", me)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+
+	login := func(password string) int {
+		return app.request(http.MethodPost, "/api/auth/login", "", dtos.LoginDTO{Username: "alice", Password: password}).Code
+	}
+
+	expectProblem(t, app.request(http.MethodPut, "/api/users/password", aliceToken, dtos.UserPasswordDTO{CurrentPassword: "wrong", NewPassword: "changed"}), http.StatusForbidden, "wrong_password")
+	expectProblem(t, app.request(http.MethodPut, "/api/users/password", aliceToken, map[string]any{"currentPassword": "secret"}), http.StatusBadRequest, "")
+	expectProblem(t, app.request(http.MethodPut, "/api/users/password", aliceToken, dtos.UserPasswordDTO{CurrentPassword: "secret", NewPassword: "changed"}), http.StatusOK, "")
+
+	if code := login("changed"); code != http.StatusOK {
+		t.Errorf("expected to log in with the new password, got %d", code)
+	}
+
+	if code := login("secret"); code == http.StatusOK {
+		t.Errorf("expected the old password to be rejected")
+	}
+
+	ifMatch := map[string]string{"If-Match": app.etag("/api/auth/me/", aliceToken)}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPut, "/api/users/", aliceToken, map[string]any{"email": "alice@example.com", "username": "alice", "password": "hijacked"}, ifMatch), http.StatusOK, "")
+
+	if code := login("changed"); code != http.StatusOK {
+		t.Errorf("expected updating the user to keep the password, got %d", code)
+	}
+}
+
+// blockingUserRepository holds the first update of a user until it is
+// resumed.
+type blockingUserRepository struct {
+	repositories.UserRepository
+	held     atomic.Bool
+	updating chan struct{}
+	resume   chan struct{}
+}
+
+func (repository *blockingUserRepository) UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	if repository.held.CompareAndSwap(false, true) {
+		repository.updating <- struct{}{}
+		<-repository.resume
+	}
+
+	return repository.UserRepository.UpdateByID(ctx, ID, updatedUser)
+}
+
+func TestStaleWrites(t *testing.T) {
+	repos := newMemoryRepositories()
+	users := &blockingUserRepository{
+		UserRepository: repos.User,
+		updating:       make(chan struct{}),
+		resume:         make(chan struct{}),
+	}
+	repos.User = users
+
+	app := newTestAppWithRepos(t, repos, storage.InitMemoryBlobStore("/media"))
+	_, aliceToken := app.register("alice")
+
+	// Both writers read alice at the same version.
+	etag := app.etag("/api/auth/me/", aliceToken)
+	update := dtos.UserUpdateDTO{Email: "alice@example.com", Username: "alice"}
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- app.requestWithHeaders(http.MethodPut, "/api/users/", aliceToken, update, map[string]string{"If-Match": etag})
+	}()
+
+	// The first writer is held after its If-Match check while the second one
+	// changes alice.
+	<-users.updating
+
+	response := app.requestWithHeaders(http.MethodPatch, "/api/users/", aliceToken, map[string]any{"firstName": "Alice"}, map[string]string{
+		"Content-Type": "application/merge-patch+json",
+		"If-Match":     etag,
+	})
+	expectProblem(t, response, http.StatusOK, "")
+
+	close(users.resume)
+	expectProblem(t, <-done, http.StatusConflict, "version_conflict")
+
+	if response.Header().Get("ETag") != app.etag("/api/auth/me/", aliceToken) {
+		t.Errorf("expected the patch to return the new ETag")
+	}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPut, "/api/users/", aliceToken, update, map[string]string{"If-Match": etag}), http.StatusPreconditionFailed, "precondition_failed")
+	expectProblem(t, app.request(http.MethodPut, "/api/users/", aliceToken, update), http.StatusPreconditionRequired, "precondition_required")
+
+	var me dtos.UserResponseDto
+	decode(t, app.request(http.MethodGet, "/api/auth/me/", aliceToken, nil), &me)
+
+	if me.FirstName != "Alice" {
+		t.Errorf("expected only the second writer to change alice, got %+v", me)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	app := newTestApp(t)
+	aliceID, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	key := map[string]string{"Idempotency-Key": "create-lamp"}
+
+	first := app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+	retry := app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+
+	expectProblem(t, first, http.StatusCreated, "")
+
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the retry to replay %s, got %d %s", first.Body, retry.Code, retry.Body)
+	}
+
+	var products []dtos.ProductResponseDTO
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/products/user/%d", aliceID), aliceToken, nil), &products)
+
+	if len(products) != 1 {
+		t.Errorf("expected a single product to be created, got %+v", products)
+	}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Desk lamp"}, key), http.StatusUnprocessableEntity, "idempotency_key_reused")
+
+	response := app.requestWithHeaders(http.MethodPost, "/api/products/", bobToken, dtos.ProductDTO{Name: "Lamp"}, key)
+
+	if response.Code != http.StatusCreated || response.Body.String() == first.Body.String() {
+		t.Errorf("expected keys of other users not to collide, got %d %s", response.Code, response.Body)
+	}
+
+	// Failed requests are not stored, so the key can be used again.
+	key = map[string]string{"Idempotency-Key": "create-comment"}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPost, "/api/comments/", aliceToken, dtos.CommentDTO{Content: "Hello"}, key), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, app.requestWithHeaders(http.MethodPost, "/api/comments/", aliceToken, dtos.CommentDTO{Content: "Hello", ProductID: 1}, key), http.StatusCreated, "")
+
+	key = map[string]string{"Idempotency-Key": strings.Repeat("k", 256)}
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key), http.StatusBadRequest, "invalid_idempotency_key")
+}
+
+// blockingIdempotencyKeyRepository holds requests after they have been
+// handled, before their response is stored.
+type blockingIdempotencyKeyRepository struct {
+	repositories.IdempotencyKeyRepository
+	handled chan struct{}
+	resume  chan struct{}
+}
+
+func (repository *blockingIdempotencyKeyRepository) Complete(ctx context.Context, ID uint, statusCode int, contentType string, body []byte) error {
+	repository.handled <- struct{}{}
+	<-repository.resume
+
+	return repository.IdempotencyKeyRepository.Complete(ctx, ID, statusCode, contentType, body)
+}
+
+func TestConcurrentIdempotentRequests(t *testing.T) {
+	keys := &blockingIdempotencyKeyRepository{
+		IdempotencyKeyRepository: repositories.InitMemoryIdempotencyKeyRepository(),
+		handled:                  make(chan struct{}),
+		resume:                   make(chan struct{}),
+	}
+	products := repositories.InitMemoryProductRepository()
+
+	app := newTestAppWithRepos(t, &Repositories{
+		User:    repositories.InitMemoryUserRepository(),
+		Product: products,
+		Comment: repositories.InitMemoryCommentRepository(products),
+		Review:  repositories.InitMemoryReviewRepository(products),
+
+		ProductImage:   repositories.InitMemoryProductImageRepository(),
+		IdempotencyKey: keys,
+		AuditEvent:     repositories.InitMemoryAuditEventRepository(),
+		OutboxEvent:    repositories.InitMemoryOutboxEventRepository(),
+		Webhook:        repositories.InitMemoryWebhookRepository(),
+		Job:            repositories.InitMemoryJobRepository(),
+		Transactor:     repositories.InitMemoryTransactor(),
+
+		Notification:            repositories.InitMemoryNotificationRepository(),
+		NotificationPreferences: repositories.InitMemoryNotificationPreferencesRepository(),
+	}, storage.InitMemoryBlobStore("/media"))
+
+	_, aliceToken := app.register("alice")
+	key := map[string]string{"Idempotency-Key": "create-lamp"}
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+	}()
+
+	<-keys.handled
+
+	expectProblem(t, app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key), http.StatusConflict, "idempotency_key_in_flight")
+
+	close(keys.resume)
+	first := <-done
+
+	retry := app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+
+	if first.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the retry to replay %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+}
+
+func TestAbandonedIdempotentRequests(t *testing.T) {
+	keys := &blockingIdempotencyKeyRepository{
+		IdempotencyKeyRepository: repositories.InitMemoryIdempotencyKeyRepository(),
+		handled:                  make(chan struct{}),
+		resume:                   make(chan struct{}),
+	}
+	repos := newMemoryRepositories()
+	repos.IdempotencyKey = keys
+
+	env := newTestEnv()
+	env.Idempotency.Lease = 10 * time.Millisecond
+
+	app := newTestAppWithEnv(t, env, repos, storage.InitMemoryBlobStore("/media"))
+	_, aliceToken := app.register("alice")
+	key := map[string]string{"Idempotency-Key": "create-lamp"}
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+	}()
+
+	<-keys.handled
+	time.Sleep(2 * env.Idempotency.Lease)
+
+	// The first request has outlived its lease, so the retry takes the key over
+	// and is held in turn.
+	retried := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		retried <- app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+	}()
+
+	<-keys.handled
+	close(keys.resume)
+
+	first, retry := <-done, <-retried
+
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("expected both requests to be handled, got %d and %d", first.Code, retry.Code)
+	}
+
+	replayed := app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, key)
+
+	if replayed.Body.String() != retry.Body.String() {
+		t.Errorf("expected the response to the retry to be replayed, got %s", replayed.Body)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	app := newTestApp(t)
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"})
+	questionID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is it dimmable?", ProductID: lampID})
+	answerID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "It is", ProductID: lampID, ParentID: &questionID})
+
+	lampPath := fmt.Sprintf("/api/products/%d", lampID)
+	questionPath := fmt.Sprintf("/api/comments/%d", questionID)
+
+	expectProblem(t, app.request(http.MethodDelete, lampPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, questionPath, bobToken, nil), http.StatusNotFound, "comment_not_found")
+
+	var products []dtos.TrashedProductResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/trash/products", aliceToken, nil), &products)
+
+	if len(products) != 1 || products[0].ID != lampID || !products[0].PurgeAt.After(products[0].DeletedAt) {
+		t.Errorf("expected the lamp in the trash, got %+v", products)
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/trash/products", bobToken, nil), &products)
+
+	if len(products) != 0 {
+		t.Errorf("expected the trash of bob to hold no products, got %+v", products)
+	}
+
+	restoreLamp := fmt.Sprintf("/api/trash/products/%d/restore", lampID)
+	restoreQuestion := fmt.Sprintf("/api/trash/comments/%d/restore", questionID)
+
+	expectProblem(t, app.request(http.MethodPut, restoreLamp, bobToken, nil), http.StatusForbidden, "product_not_owned")
+	expectProblem(t, app.request(http.MethodPut, restoreQuestion, bobToken, nil), http.StatusConflict, "comment_product_deleted")
+	expectProblem(t, app.request(http.MethodPut, restoreLamp, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, questionPath, bobToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, restoreLamp, aliceToken, nil), http.StatusNotFound, "product_not_found")
+
+	expectProblem(t, app.request(http.MethodDelete, questionPath, bobToken, nil), http.StatusOK, "")
+
+	var comments []dtos.TrashedCommentResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/trash/comments", bobToken, nil), &comments)
+
+	if len(comments) != 1 || comments[0].ID != questionID || comments[0].Content != "Is it dimmable?" {
+		t.Errorf("expected the question in the trash of bob, got %+v", comments)
+	}
+
+	purgeQuestion := fmt.Sprintf("/api/trash/comments/%d", questionID)
+
+	expectProblem(t, app.request(http.MethodDelete, purgeQuestion, aliceToken, nil), http.StatusForbidden, "comment_not_owned")
+	expectProblem(t, app.request(http.MethodDelete, purgeQuestion, bobToken, nil), http.StatusConflict, "comment_has_replies")
+	expectProblem(t, app.request(http.MethodPut, restoreQuestion, bobToken, nil), http.StatusOK, "")
+
+	expectProblem(t, app.request(http.MethodDelete, lampPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/trash/products/%d", lampID), aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, restoreLamp, aliceToken, nil), http.StatusNotFound, "product_not_found")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/comments/%d/restore", answerID), aliceToken, nil), http.StatusNotFound, "comment_not_found")
+
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	otherLampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Other lamp"})
+	rantID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is it bright?", ProductID: otherLampID})
+
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/moderation/comments/%d", rantID), adminToken, nil), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, "/api/trash/comments", bobToken, nil), &comments)
+
+	if len(comments) != 0 {
+		t.Errorf("expected the comment deleted by a moderator to stay out of the trash of bob, got %+v", comments)
+	}
+
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/comments/%d/restore", rantID), bobToken, nil), http.StatusNotFound, "comment_not_found")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/trash/comments/%d", rantID), bobToken, nil), http.StatusNotFound, "comment_not_found")
+}
+
+func TestAuditLog(t *testing.T) {
+	app := newTestApp(t)
+	aliceID, aliceToken := app.register("alice")
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	lampPath := fmt.Sprintf("/api/products/%d", lampID)
+
+	response := app.requestWithHeaders(http.MethodPut, lampPath, aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 2499}, map[string]string{
+		"If-Match":                 app.etag(lampPath, aliceToken),
+		middleware.RequestIDHeader: "price-change",
+	})
+	expectProblem(t, response, http.StatusOK, "")
+
+	query := fmt.Sprintf("/api/admin/audit?entityType=product&entityID=%d", lampID)
+
+	expectProblem(t, app.request(http.MethodGet, query, aliceToken, nil), http.StatusForbidden, "role_required")
+
+	var events []dtos.AuditEventResponseDTO
+	decode(t, app.request(http.MethodGet, query, adminToken, nil), &events)
+
+	if len(events) != 2 || events[0].Action != entities.AuditActionUpdate || events[1].Action != entities.AuditActionCreate {
+		t.Fatalf("expected the update and then the creation of the lamp, got %+v", events)
+	}
+
+	update := events[0]
+	expected := map[string]entities.AuditChange{"price": {From: float64(1999), To: float64(2499)}}
+
+	if update.ActorID != aliceID || update.RequestID != "price-change" || update.IP == "" || !reflect.DeepEqual(update.Changes, expected) {
+		t.Errorf("expected the price change by alice, got %+v", update)
+	}
+
+	if name := events[1].Changes["name"]; name.From != nil || name.To != "Lamp" {
+		t.Errorf("expected the creation to record the name, got %+v", events[1].Changes)
+	}
+
+	expectProblem(t, app.request(http.MethodPut, "/api/users/password", aliceToken, dtos.UserPasswordDTO{
+		CurrentPassword: "secret",
+		NewPassword:     "new-secret",
+	}), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/admin/audit?actorID=%d&entityType=user", aliceID), adminToken, nil), &events)
+
+	if len(events) != 1 || events[0].Changes["password"].To != "[redacted]" {
+		t.Errorf("expected the password change with a redacted value, got %+v", events)
+	}
+
+	// Moderators and the trash leave their marks too.
+	heldID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Spam, but a lamp", ProductID: lampID})
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", heldID), adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/hide", heldID), adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/moderation/comments/%d", heldID), adminToken, nil), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, fmt.Sprintf("/api/admin/audit?entityType=comment&entityID=%d", heldID), adminToken, nil), &events)
+
+	if len(events) != 4 || events[0].Action != entities.AuditActionDelete || events[0].ActorID != adminID ||
+		events[1].Changes["status"].To != "hidden" || events[2].Changes["status"].From != "pending" || events[2].Changes["status"].To != "published" {
+		t.Errorf("expected the approval, hiding and deletion by the admin, got %+v", events)
+	}
+
+	expectProblem(t, app.request(http.MethodDelete, lampPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/products/%d/restore", lampID), aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, lampPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/trash/products/%d", lampID), aliceToken, nil), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, query, adminToken, nil), &events)
+
+	if len(events) != 6 || events[0].Action != entities.AuditActionPurge || events[2].Action != entities.AuditActionRestore ||
+		events[0].Changes["name"].From != "Lamp" || events[2].Changes["name"].To != "Lamp" {
+		t.Errorf("expected the restoration and the purge of the lamp, got %+v", events)
+	}
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	decode(t, app.request(http.MethodGet, "/api/admin/audit?from="+future, adminToken, nil), &events)
+
+	if len(events) != 0 {
+		t.Errorf("expected no events in the future, got %+v", events)
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/audit?entityType=order", adminToken, nil), http.StatusBadRequest, "invalid_audit_query")
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/audit?from=yesterday", adminToken, nil), http.StatusBadRequest, "invalid_audit_query")
+}
+
+func TestDomainEvents(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	aliceID, aliceToken := app.register("alice")
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	var delivered []*events.Event
+	failing := true
+
+	app.bus.Subscribe("recorder", func(ctx context.Context, event *events.Event) error {
+		delivered = append(delivered, event)
+		return nil
+	}, events.ProductCreated, events.CommentPosted)
+
+	app.bus.Subscribe("flaky", func(ctx context.Context, event *events.Event) error {
+		if failing {
+			return errors.New("not today")
+		}
+
+		return nil
+	}, events.CommentPosted)
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	commentID := app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "Now on sale", ProductID: lampID})
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 2 || delivered[0].Type != events.ProductCreated || delivered[1].Type != events.CommentPosted {
+		t.Fatalf("expected the product and the comment to be delivered, got %+v", delivered)
+	}
+
+	var product events.ProductPayload
+
+	if err := delivered[0].Decode(&product); err != nil || product.ProductID != lampID || product.UserID != aliceID || product.Price != 1999 {
+		t.Errorf("expected the payload of the lamp, got %+v, %v", product, err)
+	}
+
+	// The comment failed to be delivered to one subscriber and runs out of
+	// its two attempts.
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []dtos.DeadEventResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/admin/events/dead", adminToken, nil), &dead)
+
+	if len(dead) != 1 || dead[0].Type != string(events.CommentPosted) || dead[0].EntityID != commentID || !strings.Contains(dead[0].LastError, "not today") {
+		t.Fatalf("expected the comment event to be dead, got %+v", dead)
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/events/dead", aliceToken, nil), http.StatusForbidden, "role_required")
+	expectProblem(t, app.request(http.MethodPut, "/api/admin/events/999/retry", adminToken, nil), http.StatusNotFound, "dead_event_not_found")
+
+	failing = false
+	delivered = nil
+
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/admin/events/%d/retry", dead[0].ID), adminToken, nil), http.StatusOK, "")
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 1 || delivered[0].EntityID != commentID {
+		t.Errorf("expected the retried comment event to be delivered, got %+v", delivered)
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/admin/events/dead", adminToken, nil), &dead)
+
+	if len(dead) != 0 {
+		t.Errorf("expected no dead events after the retry, got %+v", dead)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, bobToken := app.register("bob")
+	_, carolToken := app.register("carol")
+
+	type received struct {
+		eventType string
+		signature string
+		body      []byte
+	}
+
+	var requests []received
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, received{
+			eventType: r.Header.Get(services.WebhookEventHeader),
+			signature: r.Header.Get(services.WebhookSignatureHeader),
+			body:      body,
+		})
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	expectProblem(t, app.request(http.MethodPost, "/api/webhooks/", bobToken, dtos.WebhookEndpointDTO{
+		URL: server.URL, EventTypes: []string{"order.placed"},
+	}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, app.request(http.MethodPost, "/api/webhooks/", bobToken, dtos.WebhookEndpointDTO{
+		URL: "ftp://example.com", EventTypes: []string{"comment.posted"},
+	}), http.StatusBadRequest, "validation_failed")
+
+	response := app.request(http.MethodPost, "/api/webhooks/", bobToken, dtos.WebhookEndpointDTO{
+		URL: server.URL, Description: "Shop backend", EventTypes: []string{"comment.posted"},
+	})
+
+	if response.Code != http.StatusCreated {
+		t.Fatalf("could not register the webhook: %d %s", response.Code, response.Body)
+	}
+
+	var created dtos.WebhookEndpointCreatedResponseDTO
+	decode(t, response, &created)
+
+	if !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Fatalf("expected a signing secret, got %q", created.Secret)
+	}
+
+	webhookPath := fmt.Sprintf("/api/webhooks/%d", created.ID)
+
+	expectProblem(t, app.request(http.MethodGet, webhookPath, carolToken, nil), http.StatusForbidden, "webhook_not_owned")
+	expectProblem(t, app.request(http.MethodPost, webhookPath+"/test", carolToken, nil), http.StatusForbidden, "webhook_not_owned")
+	expectProblem(t, app.request(http.MethodGet, "/api/webhooks/999", bobToken, nil), http.StatusNotFound, "webhook_not_found")
+
+	var carolWebhooks []dtos.WebhookEndpointResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/webhooks/", carolToken, nil), &carolWebhooks)
+
+	if len(carolWebhooks) != 0 {
+		t.Errorf("expected carol to see none of the webhooks of bob, got %+v", carolWebhooks)
+	}
+
+	lampID := app.create("/api/products/", bobToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Now on sale", ProductID: lampID})
+	commentID := app.create("/api/comments/", carolToken, dtos.CommentDTO{Content: "Does it come in red?", ProductID: lampID})
+
+	dispatch := func() {
+		t.Helper()
+
+		if _, err := app.outbox.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := app.webhooks.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the comment of carol is sent, bob is not told about the product
+	// he did not subscribe to or about his own comment.
+	dispatch()
+
+	if len(requests) != 1 || requests[0].eventType != string(events.CommentPosted) {
+		t.Fatalf("expected the comment of carol to be sent, got %+v", requests)
+	}
+
+	var timestamp int64
+
+	if _, err := fmt.Sscanf(requests[0].signature, "t=%d,", &timestamp); err != nil {
+		t.Fatalf("could not parse the signature %q: %v", requests[0].signature, err)
+	}
+
+	if expected := services.SignWebhookPayload(created.Secret, time.Unix(timestamp, 0), requests[0].body); requests[0].signature != expected {
+		t.Errorf("expected signature %q, got %q", expected, requests[0].signature)
+	}
+
+	var body struct {
+		Type string                `json:"type"`
+		Data events.CommentPayload `json:"data"`
+	}
+
+	if err := json.Unmarshal(requests[0].body, &body); err != nil || body.Type != string(events.CommentPosted) || body.Data.CommentID != commentID {
+		t.Errorf("expected the comment of carol in the body, got %+v, %v", body, err)
+	}
+
+	response = app.request(http.MethodPost, webhookPath+"/test", bobToken, nil)
+
+	var testDelivery dtos.WebhookDeliveryResponseDTO
+	decode(t, response, &testDelivery)
+
+	if response.Code != http.StatusOK || testDelivery.EventType != services.WebhookTestEventType || testDelivery.DeliveredAt == nil ||
+		len(testDelivery.Attempts) != 1 || testDelivery.Attempts[0].StatusCode != http.StatusOK {
+		t.Fatalf("expected the test event to be delivered, got %d %+v", response.Code, testDelivery)
+	}
+
+	// Every failed attempt counts towards disabling the endpoint, which
+	// happens at the third one, so the last delivery is not retried.
+	status = http.StatusInternalServerError
+
+	app.create("/api/comments/", carolToken, dtos.CommentDTO{Content: "Or in blue?", ProductID: lampID})
+	app.create("/api/comments/", carolToken, dtos.CommentDTO{Content: "Or in green?", ProductID: lampID})
+
+	dispatch()
+	dispatch()
+
+	if len(requests) != 5 {
+		t.Errorf("expected three requests for the failing deliveries, got %d", len(requests)-2)
+	}
+
+	var webhook dtos.WebhookEndpointResponseDTO
+	decode(t, app.request(http.MethodGet, webhookPath, bobToken, nil), &webhook)
+
+	if webhook.Enabled || webhook.DisabledAt == nil || webhook.ConsecutiveFailures != 3 {
+		t.Fatalf("expected the failing webhook to be disabled, got %+v", webhook)
+	}
+
+	var deliveries []dtos.WebhookDeliveryResponseDTO
+	decode(t, app.request(http.MethodGet, webhookPath+"/deliveries", bobToken, nil), &deliveries)
+
+	if len(deliveries) != 4 {
+		t.Fatalf("expected four deliveries, got %+v", deliveries)
+	}
+
+	for i, expected := range []struct {
+		attempts   int
+		statusCode int
+		delivered  bool
+	}{{1, http.StatusInternalServerError, false}, {2, http.StatusInternalServerError, false}, {1, http.StatusOK, true}, {1, http.StatusOK, true}} {
+		delivery := deliveries[i]
+
+		if len(delivery.Attempts) != expected.attempts || delivery.AttemptCount != expected.attempts ||
+			delivery.LastStatusCode != expected.statusCode || (delivery.DeliveredAt != nil) != expected.delivered ||
+			delivery.NextAttemptAt != nil {
+			t.Errorf("unexpected delivery %d: %+v", i, delivery)
+		}
+	}
+
+	response = app.request(http.MethodPut, webhookPath, bobToken, dtos.WebhookEndpointDTO{
+		URL: server.URL, EventTypes: []string{"comment.posted", "product.updated"},
+	})
+	expectProblem(t, response, http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, webhookPath, bobToken, nil), &webhook)
+
+	if !webhook.Enabled || webhook.DisabledAt != nil || webhook.ConsecutiveFailures != 0 || len(webhook.EventTypes) != 2 {
+		t.Errorf("expected the webhook to be enabled again, got %+v", webhook)
+	}
+
+	expectProblem(t, app.request(http.MethodDelete, webhookPath, bobToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, webhookPath, bobToken, nil), http.StatusNotFound, "webhook_not_found")
+}
+
+func TestJobs(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, aliceToken := app.register("alice")
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	env := &infrastructure.JobsEnv{MaxAttempts: 2, Lease: time.Minute}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	enqueuer := jobs.InitEnqueuer(app.repos.Job, env, logger)
+	runner := jobs.InitRunner(app.repos.Job, enqueuer, env, logger)
+
+	failing := true
+
+	runner.Register("thumbnail", func(ctx context.Context, job *entities.Job) error {
+		if failing {
+			return errors.New("image is missing")
+		}
+
+		return nil
+	})
+
+	thumbnailID, err := enqueuer.Enqueue(ctx, "thumbnail", map[string]uint{"imageID": 7})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runner.Work(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed []dtos.JobResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/admin/jobs?status=failed", adminToken, nil), &failed)
+
+	if len(failed) != 1 || failed[0].ID != thumbnailID || failed[0].Attempts != 2 || failed[0].LastError != "image is missing" ||
+		string(failed[0].Payload) != `{"imageID":7}` {
+		t.Fatalf("expected the failed thumbnail job, got %+v", failed)
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/jobs?status=stuck", adminToken, nil), http.StatusBadRequest, "invalid_job_query")
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/jobs", aliceToken, nil), http.StatusForbidden, "role_required")
+	expectProblem(t, app.request(http.MethodGet, "/api/admin/jobs/999", adminToken, nil), http.StatusNotFound, "job_not_found")
+
+	failing = false
+	jobPath := fmt.Sprintf("/api/admin/jobs/%d", thumbnailID)
+
+	expectProblem(t, app.request(http.MethodPut, jobPath+"/retry", adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, jobPath+"/retry", adminToken, nil), http.StatusNotFound, "failed_job_not_found")
+
+	if _, err := runner.Work(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var job dtos.JobResponseDTO
+	decode(t, app.request(http.MethodGet, jobPath, adminToken, nil), &job)
+
+	if job.Status != entities.JobStatusSucceeded || job.Attempts != 1 || job.FinishedAt == nil {
+		t.Errorf("expected the retried job to succeed, got %+v", job)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+
+	env := &infrastructure.JobsEnv{MaxAttempts: 2, Lease: time.Minute}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := jobs.InitRunner(app.repos.Job, jobs.InitEnqueuer(app.repos.Job, env, logger), env, logger)
+	mailer := notifications.InitMemoryMailer()
+	renderer, err := notifications.InitRenderer()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services.RegisterEmailJobs(runner, services.InitEmailService(
+		app.repos.User, app.repos.Product, app.repos.NotificationPreferences, renderer, mailer, "go-webstore <no-reply@example.com>", logger,
+	))
+
+	deliver := func() []notifications.Message {
+		t.Helper()
+
+		sent := len(mailer.Messages())
+
+		if _, err := app.outbox.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := runner.Work(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		return mailer.Messages()[sent:]
+	}
+
+	welcomes := deliver()
+
+	if len(welcomes) != 2 || welcomes[0].To != "alice@example.com" || welcomes[0].Subject != "Welcome to go-webstore, alice!" ||
+		!strings.Contains(welcomes[1].HTML, "Hi bob,") {
+		t.Fatalf("expected a welcome email to both users, got %+v", welcomes)
+	}
+
+	var preferences dtos.NotificationPreferencesResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/notifications/preferences", aliceToken, nil), &preferences)
+
+	if preferences.Locale != "en" || !preferences.CommentEmails {
+		t.Errorf("expected the default preferences, got %+v", preferences)
+	}
+
+	commentEmails := true
+	expectProblem(t, app.request(http.MethodPut, "/api/notifications/preferences", aliceToken, dtos.NotificationPreferencesDTO{
+		Locale: "hr", CommentEmails: &commentEmails,
+	}), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, "/api/notifications/preferences", aliceToken, dtos.NotificationPreferencesDTO{
+		Locale: "de", CommentEmails: &commentEmails,
+	}), http.StatusBadRequest, "validation_failed")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is the <b>bulb</b> included?", ProductID: lampID})
+	app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "It is", ProductID: lampID})
+
+	sent := deliver()
+
+	if len(sent) != 1 || sent[0].To != "alice@example.com" || sent[0].Subject != "Novi komentar na proizvodu Lamp" {
+		t.Fatalf("expected alice to be told about the comment of bob in Croatian, got %+v", sent)
+	}
+
+	if !strings.Contains(sent[0].Text, "korisnik bob komentirao je vaš proizvod Lamp") || !strings.Contains(sent[0].Text, "<b>bulb</b>") ||
+		!strings.Contains(sent[0].HTML, "&lt;b&gt;bulb&lt;/b&gt;") {
+		t.Errorf("expected the comment in both bodies, escaped in HTML, got %+v", sent[0])
+	}
+
+	commentEmails = false
+	expectProblem(t, app.request(http.MethodPut, "/api/notifications/preferences", aliceToken, dtos.NotificationPreferencesDTO{
+		Locale: "hr", CommentEmails: &commentEmails,
+	}), http.StatusOK, "")
+
+	app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Thanks", ProductID: lampID})
+
+	if sent := deliver(); len(sent) != 0 {
+		t.Errorf("expected no email after alice turned them off, got %+v", sent)
+	}
+}
+
+// readEvent reads the fields of the next Server-Sent Event from the stream.
+func readEvent(t *testing.T, stream *bufio.Reader) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+
+	for {
+		line, err := stream.ReadString('\n')
+
+		if err != nil {
+			t.Fatalf("could not read the event stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" {
+			return fields
+		}
+
+		name, value, _ := strings.Cut(line, ": ")
+		fields[name] = value
+	}
+}
+
+func TestNotificationInbox(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, aliceToken := app.register("alice")
+	bobID, bobToken := app.register("bob")
+
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	openStream := func(lastEventID string) (*bufio.Reader, func()) {
+		t.Helper()
+
+		streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		req, _ := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL+"/api/notifications/stream?token="+aliceToken, nil)
+
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		response, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+		}
+
+		stream := bufio.NewReader(response.Body)
+
+		if event := readEvent(t, stream); event["retry"] == "" {
+			t.Fatalf("expected the stream to start with the retry delay, got %v", event)
+		}
+
+		return stream, func() {
+			cancel()
+			response.Body.Close()
+		}
+	}
+
+	expectProblem(t, app.request(http.MethodGet, "/api/notifications/stream", "", nil), http.StatusUnauthorized, "invalid_token")
+
+	stream, closeStream := openStream("")
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	firstID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Is the bulb included?", ProductID: lampID})
+	app.create("/api/comments/", aliceToken, dtos.CommentDTO{Content: "It is", ProductID: lampID})
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	event := readEvent(t, stream)
+
+	var pushed dtos.NotificationResponseDTO
+
+	if err := json.Unmarshal([]byte(event["data"]), &pushed); err != nil || event["event"] != "notification" || event["id"] != fmt.Sprint(pushed.ID) {
+		t.Fatalf("expected a notification event, got %v, %v", event, err)
+	}
+
+	if pushed.Type != string(entities.NotificationCommentPosted) || pushed.ActorID == nil || *pushed.ActorID != bobID ||
+		pushed.CommentID == nil || *pushed.CommentID != firstID || pushed.Excerpt != "Is the bulb included?" || pushed.Read {
+		t.Errorf("expected alice to be told about the comment of bob, got %+v", pushed)
+	}
+
+	closeStream()
+
+	app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "Does it dim?", ProductID: lampID})
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reconnecting with the ID of the last event received replays what was
+	// missed in between.
+	stream, closeStream = openStream(event["id"])
+	defer closeStream()
+
+	var missed dtos.NotificationResponseDTO
+
+	if err := json.Unmarshal([]byte(readEvent(t, stream)["data"]), &missed); err != nil || missed.Excerpt != "Does it dim?" {
+		t.Errorf("expected the missed notification to be replayed, got %+v, %v", missed, err)
+	}
+
+	var inbox dtos.NotificationListResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/notifications/", aliceToken, nil), &inbox)
+
+	if inbox.UnreadCount != 2 || len(inbox.Notifications) != 2 || inbox.Notifications[0].ID != missed.ID {
+		t.Fatalf("expected two unread notifications, newest first, got %+v", inbox)
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/notifications/", bobToken, nil), &inbox)
+
+	if inbox.UnreadCount != 0 || len(inbox.Notifications) != 0 {
+		t.Errorf("expected bob to have no notifications, got %+v", inbox)
+	}
+
+	readPath := fmt.Sprintf("/api/notifications/%d/read", pushed.ID)
+
+	expectProblem(t, app.request(http.MethodPut, readPath, bobToken, nil), http.StatusNotFound, "notification_not_found")
+	expectProblem(t, app.request(http.MethodPut, readPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, readPath, aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodGet, "/api/notifications/?unread=maybe", aliceToken, nil), http.StatusBadRequest, "invalid_notification_query")
+
+	decode(t, app.request(http.MethodGet, "/api/notifications/?unread=true", aliceToken, nil), &inbox)
+
+	if inbox.UnreadCount != 1 || len(inbox.Notifications) != 1 || inbox.Notifications[0].ID != missed.ID {
+		t.Errorf("expected only the notification left unread, got %+v", inbox)
+	}
+
+	expectProblem(t, app.request(http.MethodPut, "/api/notifications/read", aliceToken, nil), http.StatusOK, "")
+
+	decode(t, app.request(http.MethodGet, "/api/notifications/", aliceToken, nil), &inbox)
+
+	if inbox.UnreadCount != 0 || len(inbox.Notifications) != 2 || !inbox.Notifications[0].Read || inbox.Notifications[1].ReadAt == nil {
+		t.Errorf("expected every notification to be read, got %+v", inbox)
+	}
+}
+
+func TestApprovedCommentsNotifySellers(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, aliceToken := app.register("alice")
+	bobID, bobToken := app.register("bob")
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	heldID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "No spam, just a question", ProductID: lampID})
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var inbox dtos.NotificationListResponseDTO
+	decode(t, app.request(http.MethodGet, "/api/notifications/", aliceToken, nil), &inbox)
+
+	if len(inbox.Notifications) != 0 {
+		t.Fatalf("expected no notification of a held comment, got %+v", inbox)
+	}
+
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", heldID), adminToken, nil), http.StatusOK, "")
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/notifications/", aliceToken, nil), &inbox)
+
+	if len(inbox.Notifications) != 1 || inbox.Notifications[0].CommentID == nil || *inbox.Notifications[0].CommentID != heldID ||
+		inbox.Notifications[0].ActorID == nil || *inbox.Notifications[0].ActorID != bobID {
+		t.Fatalf("expected alice to be told about the approved comment, got %+v", inbox)
+	}
+
+	// Neither approving the comment again nor restoring it tells alice twice.
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", heldID), adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/comments/%d", heldID), bobToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/comments/%d/restore", heldID), bobToken, nil), http.StatusOK, "")
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	decode(t, app.request(http.MethodGet, "/api/notifications/", aliceToken, nil), &inbox)
+
+	if len(inbox.Notifications) != 1 {
+		t.Errorf("expected a single notification of the comment, got %+v", inbox)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	forwarded := map[string]string{"X-Forwarded-For": "203.0.113.7"}
+
+	recordedIP := func(app *testApp) string {
+		t.Helper()
+
+		aliceID, aliceToken := app.register("alice")
+		app.appointAdmin(aliceID)
+
+		response := app.requestWithHeaders(http.MethodPost, "/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp"}, forwarded)
+		expectProblem(t, response, http.StatusCreated, "")
+
+		var events []dtos.AuditEventResponseDTO
+		decode(t, app.request(http.MethodGet, "/api/admin/audit?entityType=product", aliceToken, nil), &events)
+
+		if len(events) != 1 {
+			t.Fatalf("expected the creation of the lamp, got %+v", events)
+		}
+
+		return events[0].IP
+	}
+
+	// httptest requests come from 192.0.2.1.
+	if ip := recordedIP(newTestApp(t)); ip != "192.0.2.1" {
+		t.Errorf("expected X-Forwarded-For to be ignored without trusted proxies, got %q", ip)
+	}
+
+	env := newTestEnv()
+	env.TrustedProxies = []string{"192.0.2.0/24"}
+
+	if ip := recordedIP(newTestAppWithEnv(t, env, newMemoryRepositories(), storage.InitMemoryBlobStore("/media"))); ip != "203.0.113.7" {
+		t.Errorf("expected X-Forwarded-For to be believed from a trusted proxy, got %q", ip)
+	}
+}
+
+func TestModerationAndTrashEvents(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	_, aliceToken := app.register("alice")
+	_, bobToken := app.register("bob")
+	adminID, adminToken := app.register("admin")
+	app.appointAdmin(adminID)
+
+	var delivered []*events.Event
+
+	app.bus.Subscribe("recorder", func(ctx context.Context, event *events.Event) error {
+		delivered = append(delivered, event)
+		return nil
+	}, events.CommentPosted, events.CommentUpdated, events.CommentDeleted, events.ProductRestored, events.CommentRestored)
+
+	lampID := app.create("/api/products/", aliceToken, dtos.ProductDTO{Name: "Lamp", Price: 1999})
+	heldID := app.create("/api/comments/", bobToken, dtos.CommentDTO{Content: "No spam, just a question", ProductID: lampID})
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var comment events.CommentPayload
+
+	if len(delivered) != 1 || delivered[0].Decode(&comment) != nil || comment.Status != string(entities.CommentStatusPending) {
+		t.Fatalf("expected the comment to be posted as held for review, got %+v", delivered)
+	}
+
+	delivered = nil
+
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", heldID), adminToken, nil), http.StatusOK, "")
+
+	// Approving a comment which is already published does not post it again.
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/approve", heldID), adminToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/moderation/comments/%d/hide", heldID), adminToken, nil), http.StatusOK, "")
+
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/products/%d", lampID), aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/products/%d/restore", lampID), aliceToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/comments/%d", heldID), bobToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodPut, fmt.Sprintf("/api/trash/comments/%d/restore", heldID), bobToken, nil), http.StatusOK, "")
+	expectProblem(t, app.request(http.MethodDelete, fmt.Sprintf("/api/moderation/comments/%d", heldID), adminToken, nil), http.StatusOK, "")
+
+	if _, err := app.outbox.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []events.Type{
+		events.CommentPosted,
+		events.CommentUpdated,
+		events.ProductRestored,
+		events.CommentDeleted,
+		events.CommentRestored,
+		events.CommentDeleted,
+	}
+
+	if len(delivered) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, delivered)
+	}
+
+	for i, event := range delivered {
+		if event.Type != expected[i] {
+			t.Errorf("expected event %d to be %s, got %s", i, expected[i], event.Type)
+		}
+	}
+
+	if err := delivered[0].Decode(&comment); err != nil || comment.CommentID != heldID || comment.Status != string(entities.CommentStatusPublished) {
+		t.Errorf("expected the approved comment to be posted as published, got %+v, %v", comment, err)
+	}
+
+	if delivered[2].EntityID != lampID {
+		t.Errorf("expected the lamp to be restored, got %+v", delivered[2])
+	}
+}
@@ -0,0 +1,185 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/brunohradec/go-webstore/controllers"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/gin-gonic/gin"
+)
+
+type Controllers struct {
+	Auth    controllers.AuthController
+	User    controllers.UserController
+	Product controllers.ProductController
+	Comment controllers.CommentController
+	Review  controllers.ReviewController
+	Docs    controllers.DocsController
+
+	ProductImage controllers.ProductImageController
+	Media        controllers.MediaController
+	Moderation   controllers.ModerationController
+	Cache        controllers.CacheController
+	Trash        controllers.TrashController
+	Audit        controllers.AuditController
+	Event        controllers.EventController
+	Webhook      controllers.WebhookController
+	Job          controllers.JobController
+	Notification controllers.NotificationController
+}
+
+type Middlewares struct {
+	Auth        gin.HandlerFunc
+	RequireRole func(role entities.Role) gin.HandlerFunc
+	// Idempotency lets clients safely retry the requests creating resources.
+	Idempotency gin.HandlerFunc
+}
+
+/* RegisterRoutes adds every API route to the router. Each route must also be
+* described in apiOperations, which is enforced when the OpenAPI document is
+* generated. */
+func RegisterRoutes(r *gin.Engine, controllers *Controllers, middlewares *Middlewares) {
+	r.GET("/media/*key", controllers.Media.Get)
+
+	api := r.Group("/api")
+	{
+		api.GET("/ping", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "pong",
+			})
+		})
+
+		api.GET("/openapi.json", controllers.Docs.Spec)
+		api.GET("/docs", controllers.Docs.UI)
+		api.GET("/docs/assets/:name", controllers.Docs.Asset)
+
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", controllers.Auth.Register)
+			auth.POST("/login", controllers.Auth.Login)
+
+			me := auth.Group("/me")
+			me.Use(middlewares.Auth)
+
+			me.GET("/", controllers.Auth.Me)
+		}
+
+		users := api.Group("/users")
+		users.Use(middlewares.Auth)
+
+		{
+			users.GET("/:id", controllers.User.FindByID)
+			users.PUT("/", controllers.User.UpdateCurrent)
+			users.PATCH("/", controllers.User.PatchCurrent)
+			users.PUT("/password", controllers.User.ChangePassword)
+			users.PUT("/:id/role", middlewares.RequireRole(entities.RoleAdmin), controllers.User.UpdateRole)
+		}
+
+		products := api.Group("/products")
+		products.Use(middlewares.Auth)
+
+		{
+			products.POST("/", middlewares.Idempotency, controllers.Product.Save)
+			products.GET("/", controllers.Product.FindAll)
+			products.GET("/:id", controllers.Product.FindByID)
+			products.GET("/user/:userId", controllers.Product.FindByUserID)
+			products.PUT("/:id", controllers.Product.UpdateByID)
+			products.PATCH("/:id", controllers.Product.Patch)
+			products.DELETE("/:id", controllers.Product.DeleteByID)
+
+			products.POST("/:id/images", controllers.ProductImage.Upload)
+			products.POST("/:id/images/uploads", controllers.ProductImage.CreateUpload)
+			products.POST("/:id/images/uploads/confirm", controllers.ProductImage.ConfirmUpload)
+			products.GET("/:id/images", controllers.ProductImage.FindByProductID)
+			products.PUT("/:id/images/order", controllers.ProductImage.Reorder)
+			products.PUT("/:id/images/:imageId/primary", controllers.ProductImage.SetPrimary)
+			products.DELETE("/:id/images/:imageId", controllers.ProductImage.DeleteByID)
+		}
+
+		comments := api.Group("/comments")
+		comments.Use(middlewares.Auth)
+
+		{
+			comments.POST("/", middlewares.Idempotency, controllers.Comment.Save)
+			comments.GET("/:id", controllers.Comment.FindByID)
+			comments.GET("/product/:productId", controllers.Comment.FindByProductID)
+			comments.PUT("/:id", controllers.Comment.UpdateByID)
+			comments.PATCH("/:id", controllers.Comment.Patch)
+			comments.DELETE("/:id", controllers.Comment.DeleteByID)
+			comments.POST("/:id/report", controllers.Comment.Report)
+		}
+
+		trash := api.Group("/trash")
+		trash.Use(middlewares.Auth)
+
+		{
+			trash.GET("/products", controllers.Trash.FindProducts)
+			trash.PUT("/products/:id/restore", controllers.Trash.RestoreProduct)
+			trash.DELETE("/products/:id", controllers.Trash.PurgeProduct)
+			trash.GET("/comments", controllers.Trash.FindComments)
+			trash.PUT("/comments/:id/restore", controllers.Trash.RestoreComment)
+			trash.DELETE("/comments/:id", controllers.Trash.PurgeComment)
+		}
+
+		moderation := api.Group("/moderation")
+		moderation.Use(middlewares.Auth, middlewares.RequireRole(entities.RoleModerator))
+
+		{
+			moderation.GET("/comments", controllers.Moderation.FindQueue)
+			moderation.PUT("/comments/:id/approve", controllers.Moderation.Approve)
+			moderation.PUT("/comments/:id/hide", controllers.Moderation.Hide)
+			moderation.DELETE("/comments/:id", controllers.Moderation.DeleteByID)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(middlewares.Auth, middlewares.RequireRole(entities.RoleAdmin))
+
+		{
+			admin.GET("/cache", controllers.Cache.Stats)
+			admin.GET("/audit", controllers.Audit.FindEvents)
+			admin.GET("/events/dead", controllers.Event.FindDead)
+			admin.PUT("/events/:id/retry", controllers.Event.Retry)
+			admin.GET("/jobs", controllers.Job.FindJobs)
+			admin.GET("/jobs/:id", controllers.Job.FindByID)
+			admin.PUT("/jobs/:id/retry", controllers.Job.Retry)
+		}
+
+		reviews := api.Group("/reviews")
+		reviews.Use(middlewares.Auth)
+
+		{
+			reviews.POST("/", middlewares.Idempotency, controllers.Review.Save)
+			reviews.GET("/:id", controllers.Review.FindByID)
+			reviews.GET("/product/:productId", controllers.Review.FindByProductID)
+			reviews.PUT("/:id", controllers.Review.UpdateByID)
+			reviews.DELETE("/:id", controllers.Review.DeleteByID)
+			reviews.PUT("/:id/vote", controllers.Review.Vote)
+			reviews.DELETE("/:id/vote", controllers.Review.DeleteVote)
+		}
+
+		webhooks := api.Group("/webhooks")
+		webhooks.Use(middlewares.Auth)
+
+		{
+			webhooks.POST("/", controllers.Webhook.Save)
+			webhooks.GET("/", controllers.Webhook.FindAll)
+			webhooks.GET("/:id", controllers.Webhook.FindByID)
+			webhooks.PUT("/:id", controllers.Webhook.UpdateByID)
+			webhooks.DELETE("/:id", controllers.Webhook.DeleteByID)
+			webhooks.POST("/:id/test", controllers.Webhook.SendTest)
+			webhooks.GET("/:id/deliveries", controllers.Webhook.FindDeliveries)
+		}
+
+		notifications := api.Group("/notifications")
+		notifications.Use(middlewares.Auth)
+
+		{
+			notifications.GET("/", controllers.Notification.FindNotifications)
+			notifications.PUT("/read", controllers.Notification.MarkAllRead)
+			notifications.PUT("/:id/read", controllers.Notification.MarkRead)
+			notifications.GET("/stream", controllers.Notification.Stream)
+			notifications.GET("/preferences", controllers.Notification.FindPreferences)
+			notifications.PUT("/preferences", controllers.Notification.UpdatePreferences)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package services
+
+import "context"
+
+/* Actor describes who a request was made by, so that changes made while
+* handling it can be attributed in the audit log. PrincipalID is zero for
+* requests made without logging in. */
+type Actor struct {
+	PrincipalID uint
+	RequestID   string
+	IP          string
+}
+
+type actorKey struct{}
+
+func ContextWithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor attached to the context, or the zero
+// actor for changes made outside of a request.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+const (
+	AuditEntityProduct = "product"
+	AuditEntityComment = "comment"
+	AuditEntityUser    = "user"
+)
+
+// AuditEventFilter is the filter of an audit log listing.
+type AuditEventFilter = repositories.AuditEventFilter
+
+// redactedValue stands in for values which must not be written to the audit
+// log, such as passwords.
+const redactedValue = "[redacted]"
+
+type AuditService interface {
+	/* Record appends an event to the audit log, attributed to the actor in
+	* the context. Before and after are snapshots of the entity, nil for
+	* created and deleted entities respectively, from which only the changed
+	* fields are kept. */
+	Record(ctx context.Context, action entities.AuditAction, entityType string, entityID uint, before map[string]any, after map[string]any)
+	Find(ctx context.Context, filter AuditEventFilter, page paging.Page) []entities.AuditEvent
+}
+
+type AuditServiceImpl struct {
+	AuditEventRepository repositories.AuditEventRepository
+	Logger               *slog.Logger
+}
+
+func InitAuditService(auditEventRepository repositories.AuditEventRepository, logger *slog.Logger) AuditService {
+	return &AuditServiceImpl{
+		AuditEventRepository: auditEventRepository,
+		Logger:               logger,
+	}
+}
+
+/* Record does not fail: the change it describes has already been made, so an
+* event which can not be stored is logged instead of failing the request. */
+func (service *AuditServiceImpl) Record(
+	ctx context.Context,
+	action entities.AuditAction,
+	entityType string,
+	entityID uint,
+	before map[string]any,
+	after map[string]any,
+) {
+	ctx, span := tracer.Start(ctx, "AuditService.Record")
+
+	err := service.record(ctx, action, entityType, entityID, before, after)
+	endSpan(span, err)
+
+	if err != nil {
+		service.Logger.ErrorContext(ctx, "could not record audit event",
+			"action", action, "entity_type", entityType, "entity_id", entityID, "error", err)
+	}
+}
+
+func (service *AuditServiceImpl) record(
+	ctx context.Context,
+	action entities.AuditAction,
+	entityType string,
+	entityID uint,
+	before map[string]any,
+	after map[string]any,
+) error {
+	changes, err := json.Marshal(diffSnapshots(before, after))
+
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFromContext(ctx)
+
+	return service.AuditEventRepository.Save(ctx, &entities.AuditEvent{
+		ActorID:    actor.PrincipalID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    string(changes),
+		RequestID:  actor.RequestID,
+		IP:         actor.IP,
+	})
+}
+
+func (service *AuditServiceImpl) Find(ctx context.Context, filter AuditEventFilter, page paging.Page) []entities.AuditEvent {
+	ctx, span := tracer.Start(ctx, "AuditService.Find")
+	defer span.End()
+
+	return service.AuditEventRepository.Find(ctx, filter, page)
+}
+
+// diffSnapshots returns the fields whose values differ between the two
+// snapshots.
+func diffSnapshots(before map[string]any, after map[string]any) map[string]entities.AuditChange {
+	changes := make(map[string]entities.AuditChange)
+
+	for field, from := range before {
+		to := after[field]
+
+		if !reflect.DeepEqual(from, to) {
+			changes[field] = entities.AuditChange{From: from, To: to}
+		}
+	}
+
+	for field, to := range after {
+		if _, found := before[field]; !found {
+			changes[field] = entities.AuditChange{To: to}
+		}
+	}
+
+	return changes
+}
+
+func productAuditSnapshot(product *entities.Product) map[string]any {
+	return map[string]any{
+		"name":        product.Name,
+		"description": product.Description,
+		"price":       product.Price,
+		"userId":      product.UserID,
+	}
+}
+
+func commentAuditSnapshot(comment *entities.Comment) map[string]any {
+	return map[string]any{
+		"content":          comment.Content,
+		"productId":        comment.ProductID,
+		"parentId":         comment.ParentID,
+		"status":           comment.Status,
+		"moderationReason": comment.ModerationReason,
+	}
+}
+
+// userAuditSnapshot leaves out the password, changes to which are recorded
+// with a redacted value.
+func userAuditSnapshot(user *entities.User) map[string]any {
+	return map[string]any{
+		"firstName": user.FirstName,
+		"lastName":  user.LastName,
+		"email":     user.Email,
+		"username":  user.Username,
+		"role":      user.Role,
+	}
+}
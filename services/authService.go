@@ -1,40 +1,59 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+
 	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/entities"
 	"github.com/brunohradec/go-webstore/infrastructure"
 )
 
 type AuthService interface {
-	Register(user *entities.User) (uint, error)
-	Login(username string, password string) (string, error)
+	Register(ctx context.Context, user *entities.User) (uint, error)
+	Login(ctx context.Context, username string, password string) (string, error)
 }
 
 type AuthServiceImpl struct {
 	UserService UserService
 	Env         *infrastructure.Env
+	Logger      *slog.Logger
 }
 
 func InitAuthService(
 	userService UserService,
 	env *infrastructure.Env,
+	logger *slog.Logger,
 ) AuthService {
 	return &AuthServiceImpl{
 		UserService: userService,
 		Env:         env,
+		Logger:      logger,
 	}
 }
 
-func (service *AuthServiceImpl) Register(user *entities.User) (uint, error) {
-	return service.UserService.Save(user)
+func (service *AuthServiceImpl) Register(ctx context.Context, user *entities.User) (uint, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+
+	id, err := service.UserService.Save(ctx, user)
+	endSpan(span, err)
+
+	return id, err
 }
 
-func (service *AuthServiceImpl) Login(username string, password string) (string, error) {
+func (service *AuthServiceImpl) Login(ctx context.Context, username string, password string) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
 	secret := service.Env.JWT.AccessTokenSecret
 	tokenTTL := service.Env.JWT.AccessTokenTTL
 
-	user, err := service.UserService.FindByUseraname(username)
+	user, err := service.UserService.FindByUseraname(ctx, username)
+
+	if errors.Is(err, ErrUserNotFound) {
+		return "", ErrInvalidCredentials.Wrap(err)
+	}
 
 	if err != nil {
 		return "", err
@@ -43,12 +62,14 @@ func (service *AuthServiceImpl) Login(username string, password string) (string,
 	err = authutils.VerifyPassword(password, user.Password)
 
 	if err != nil {
-		return "", err
+		service.Logger.WarnContext(ctx, "login failed, wrong password", "user_id", user.ID)
+		return "", ErrInvalidCredentials.Wrap(err)
 	}
 
 	token, err := authutils.GenerateToken(user.ID, secret, tokenTTL)
 
 	if err != nil {
+		service.Logger.ErrorContext(ctx, "could not generate access token", "user_id", user.ID, "error", err)
 		return "", err
 	}
 
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+/* CachedProductService caches products looked up by ID in front of another
+* product service and invalidates them around updates and deletes.
+* Listings are not cached. Changes made around the service, such as ratings
+* refreshed by reviews, have to invalidate the product themselves. */
+type CachedProductService struct {
+	ProductService
+
+	Cache  cache.Cache
+	TTL    time.Duration
+	Logger *slog.Logger
+}
+
+func InitCachedProductService(
+	productService ProductService,
+	productCache cache.Cache,
+	ttl time.Duration,
+	logger *slog.Logger,
+) ProductService {
+	return &CachedProductService{
+		ProductService: productService,
+		Cache:          productCache,
+		TTL:            ttl,
+		Logger:         logger,
+	}
+}
+
+func (service *CachedProductService) FindByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	key := productCacheKey(ID)
+
+	if product, found := getCached[entities.Product](ctx, service.Cache, key, service.Logger); found {
+		return product, nil
+	}
+
+	product, err := service.ProductService.FindByID(ctx, ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	setCached(ctx, service.Cache, key, product, service.TTL, service.Logger)
+
+	return product, nil
+}
+
+func (service *CachedProductService) UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.ProductService.UpdateByID(ctx, ID, updatedProduct)
+	}, productCacheKey(ID))
+}
+
+func (service *CachedProductService) DeleteByID(ctx context.Context, ID uint) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.ProductService.DeleteByID(ctx, ID)
+	}, productCacheKey(ID))
+}
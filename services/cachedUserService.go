@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+/* CachedUserService caches users looked up by ID in front of another user
+* service and invalidates them around updates and deletes. Password
+* hashes are never cached, users read through this service come without
+* them. Lookups by username, which are used to log in, are not cached. */
+type CachedUserService struct {
+	UserService
+
+	Cache  cache.Cache
+	TTL    time.Duration
+	Logger *slog.Logger
+}
+
+func InitCachedUserService(
+	userService UserService,
+	userCache cache.Cache,
+	ttl time.Duration,
+	logger *slog.Logger,
+) UserService {
+	return &CachedUserService{
+		UserService: userService,
+		Cache:       userCache,
+		TTL:         ttl,
+		Logger:      logger,
+	}
+}
+
+func (service *CachedUserService) FindByID(ctx context.Context, ID uint) (*entities.User, error) {
+	key := userCacheKey(ID)
+
+	if user, found := getCached[entities.User](ctx, service.Cache, key, service.Logger); found {
+		return user, nil
+	}
+
+	user, err := service.UserService.FindByID(ctx, ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	setCached(ctx, service.Cache, key, user, service.TTL, service.Logger)
+
+	return user, nil
+}
+
+// FindByIDs reads the cached users with one cache lookup and loads the rest
+// with one query.
+func (service *CachedUserService) FindByIDs(ctx context.Context, IDs []uint) map[uint]entities.User {
+	keys := make([]string, len(IDs))
+
+	for i, ID := range IDs {
+		keys[i] = userCacheKey(ID)
+	}
+
+	cached, err := service.Cache.GetMany(ctx, keys)
+
+	if err != nil {
+		service.Logger.WarnContext(ctx, "could not read from cache", "keys", keys, "error", err)
+	}
+
+	usersByID := make(map[uint]entities.User, len(IDs))
+	var missing []uint
+
+	for i, ID := range IDs {
+		if data, found := cached[keys[i]]; found {
+			if user, ok := decodeCached[entities.User](ctx, keys[i], data, service.Logger); ok {
+				usersByID[ID] = *user
+				continue
+			}
+		}
+
+		missing = append(missing, ID)
+	}
+
+	if len(missing) == 0 {
+		return usersByID
+	}
+
+	for ID, user := range service.UserService.FindByIDs(ctx, missing) {
+		user.Password = ""
+		usersByID[ID] = user
+
+		setCached(ctx, service.Cache, userCacheKey(ID), user, service.TTL, service.Logger)
+	}
+
+	return usersByID
+}
+
+func (service *CachedUserService) UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.UserService.UpdateByID(ctx, ID, updatedUser)
+	}, userCacheKey(ID))
+}
+
+func (service *CachedUserService) UpdateRoleByID(ctx context.Context, ID uint, role entities.Role) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.UserService.UpdateRoleByID(ctx, ID, role)
+	}, userCacheKey(ID))
+}
+
+func (service *CachedUserService) ChangePassword(ctx context.Context, ID uint, currentPassword string, newPassword string) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.UserService.ChangePassword(ctx, ID, currentPassword, newPassword)
+	}, userCacheKey(ID))
+}
+
+func (service *CachedUserService) DeleteByID(ctx context.Context, ID uint) error {
+	return invalidateAround(ctx, service.Cache, service.Logger, func() error {
+		return service.UserService.DeleteByID(ctx, ID)
+	}, userCacheKey(ID))
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/cache"
+)
+
+func productCacheKey(ID uint) string {
+	return fmt.Sprintf("product:%d", ID)
+}
+
+func userCacheKey(ID uint) string {
+	return fmt.Sprintf("user:%d", ID)
+}
+
+/* The cache only speeds up reads, so a failing cache is logged and otherwise
+* ignored: lookups fall back to the database and writes go ahead without the
+* cache. */
+
+func getCached[T any](ctx context.Context, store cache.Cache, key string, logger *slog.Logger) (*T, bool) {
+	data, found, err := store.Get(ctx, key)
+
+	if err != nil {
+		logger.WarnContext(ctx, "could not read from cache", "key", key, "error", err)
+		return nil, false
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	return decodeCached[T](ctx, key, data, logger)
+}
+
+func decodeCached[T any](ctx context.Context, key string, data []byte, logger *slog.Logger) (*T, bool) {
+	var value T
+
+	err := json.Unmarshal(data, &value)
+
+	if err != nil {
+		logger.WarnContext(ctx, "could not decode cached value", "key", key, "error", err)
+		return nil, false
+	}
+
+	return &value, true
+}
+
+func setCached(ctx context.Context, store cache.Cache, key string, value any, ttl time.Duration, logger *slog.Logger) {
+	data, err := json.Marshal(value)
+
+	if err == nil {
+		err = store.Set(ctx, key, data, ttl)
+	}
+
+	if err != nil {
+		logger.WarnContext(ctx, "could not write to cache", "key", key, "error", err)
+	}
+}
+
+func invalidateCached(ctx context.Context, store cache.Cache, logger *slog.Logger, keys ...string) {
+	err := store.Delete(ctx, keys...)
+
+	if err != nil {
+		logger.WarnContext(ctx, "could not invalidate cache", "keys", keys, "error", err)
+	}
+}
+
+/* invalidateAround runs the write with the keys invalidated both before and
+* after it. Invalidating after the write drops what readers cached while it
+* ran, and invalidating before keeps the old value from being served after
+* the write when the second invalidation fails. A reader which loaded the old
+* value before the write and stores it after both invalidations can still
+* leave it cached until its TTL runs out. */
+func invalidateAround(ctx context.Context, store cache.Cache, logger *slog.Logger, write func() error, keys ...string) error {
+	invalidateCached(ctx, store, logger, keys...)
+	err := write()
+	invalidateCached(ctx, store, logger, keys...)
+
+	return err
+}
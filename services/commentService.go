@@ -1,45 +1,344 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+
 	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
 	"github.com/brunohradec/go-webstore/paging"
 	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
 )
 
+// MaxCommentDepth is how many levels deep replies can be nested below a top
+// level comment.
+const MaxCommentDepth = 5
+
 type CommentService interface {
-	Save(comment *entities.Comment) (uint, error)
-	FindByID(ID uint) (*entities.Comment, error)
-	FindByProductID(productID uint, page paging.Page) []entities.Comment
-	UpdateByID(ID uint, updatedComment *entities.Comment) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, comment *entities.Comment) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Comment, error)
+	FindVisibleByID(ctx context.Context, ID uint, viewerID uint) (*entities.Comment, error)
+	FindThreadsByProductID(ctx context.Context, productID uint, viewerID uint, page paging.Page) []*CommentThread
+	UpdateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error
+	DeleteByID(ctx context.Context, ID uint) error
+	Report(ctx context.Context, report *entities.CommentReport) error
 }
 
 type CommentServiceImpl struct {
 	CommentRepository repositories.CommentRepository
+	ProductRepository repositories.ProductRepository
+	ContentFilter     ContentFilter
+	Transactor        repositories.Transactor
+	EventPublisher    EventPublisher
+	AuditService      AuditService
+	Logger            *slog.Logger
 }
 
-func InitCommentService(commentRepository repositories.CommentRepository) CommentService {
+func InitCommentService(
+	commentRepository repositories.CommentRepository,
+	productRepository repositories.ProductRepository,
+	contentFilter ContentFilter,
+	transactor repositories.Transactor,
+	eventPublisher EventPublisher,
+	auditService AuditService,
+	logger *slog.Logger,
+) CommentService {
 	return &CommentServiceImpl{
 		CommentRepository: commentRepository,
+		ProductRepository: productRepository,
+		ContentFilter:     contentFilter,
+		Transactor:        transactor,
+		EventPublisher:    eventPublisher,
+		AuditService:      auditService,
+		Logger:            logger,
+	}
+}
+
+/* Save stores a new comment or, when it has a parent, a reply. Replies are
+* placed in the thread of their parent, and comments written by the seller of
+* the product are marked as seller responses. Comments caught by the content
+* filter are held for review instead of being published. */
+func (service *CommentServiceImpl) Save(ctx context.Context, comment *entities.Comment) (uint, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.Save")
+
+	id, err := service.save(ctx, comment)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "saved comment", "comment_id", id, "parent_id", comment.ParentID, "status", comment.Status)
+	}
+
+	return id, err
+}
+
+func (service *CommentServiceImpl) save(ctx context.Context, comment *entities.Comment) (uint, error) {
+	product, err := service.ProductRepository.FindByID(ctx, comment.ProductID)
+
+	if err != nil {
+		return 0, translateError(err, ErrProductNotFound)
+	}
+
+	comment.SellerResponse = product.UserID == comment.UserID
+	comment.RootID = nil
+	comment.Depth = 0
+
+	if comment.ParentID != nil {
+		parent, err := service.CommentRepository.FindByID(ctx, *comment.ParentID)
+
+		if err != nil {
+			return 0, translateError(err, ErrParentCommentNotFound)
+		}
+
+		if !commentVisibleTo(parent, comment.UserID) {
+			return 0, ErrParentCommentNotFound
+		}
+
+		if parent.ProductID != comment.ProductID {
+			return 0, ErrInvalidParentComment
+		}
+
+		if parent.Depth >= MaxCommentDepth {
+			return 0, ErrCommentTooDeep
+		}
+
+		comment.RootID = parent.RootID
+		comment.Depth = parent.Depth + 1
+
+		if comment.RootID == nil {
+			comment.RootID = &parent.ID
+		}
+	}
+
+	err = service.moderate(ctx, comment)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		id, err = service.CommentRepository.Save(ctx, comment)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentPosted, id, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return 0, translateError(err, ErrProductNotFound)
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionCreate, AuditEntityComment, id, nil, commentAuditSnapshot(comment))
+
+	return id, nil
+}
+
+func (service *CommentServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.FindByID")
+
+	comment, err := service.CommentRepository.FindByID(ctx, ID)
+	endSpan(span, err)
+
+	return comment, translateError(err, ErrCommentNotFound)
+}
+
+// FindVisibleByID returns a comment unless it is held for review or hidden and
+// the viewer is not its author.
+func (service *CommentServiceImpl) FindVisibleByID(ctx context.Context, ID uint, viewerID uint) (*entities.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.FindVisibleByID")
+
+	comment, err := service.CommentRepository.FindByID(ctx, ID)
+
+	if err == nil && !commentVisibleTo(comment, viewerID) {
+		comment, err = nil, ErrCommentNotFound
+	}
+
+	endSpan(span, err)
+
+	return comment, translateError(err, ErrCommentNotFound)
+}
+
+// FindThreadsByProductID returns a page of the top level comments of a product
+// with their replies nested below them, as seen by the viewer.
+func (service *CommentServiceImpl) FindThreadsByProductID(ctx context.Context, productID uint, viewerID uint, page paging.Page) []*CommentThread {
+	ctx, span := tracer.Start(ctx, "CommentService.FindThreadsByProductID")
+	defer span.End()
+
+	return buildCommentThreads(service.CommentRepository.FindThreadsByProductID(ctx, productID, viewerID, page), viewerID)
+}
+
+/* UpdateByID replaces the content of a comment. Its place in the thread and the
+* seller response flag stay as they were. The new content goes through the
+* content filter again, unless a moderator has hidden the comment. The update
+* is based on the version in updatedComment and fails with ErrVersionConflict
+* when the comment has been changed since. */
+func (service *CommentServiceImpl) UpdateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error {
+	ctx, span := tracer.Start(ctx, "CommentService.UpdateByID")
+
+	err := service.updateByID(ctx, ID, updatedComment)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated comment", "comment_id", ID, "status", updatedComment.Status)
 	}
+
+	return err
+}
+
+func (service *CommentServiceImpl) updateByID(ctx context.Context, ID uint, updatedComment *entities.Comment) error {
+	comment, err := service.CommentRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return translateError(err, ErrCommentNotFound)
+	}
+
+	updatedComment.ID = ID
+	updatedComment.UserID = comment.UserID
+	updatedComment.ProductID = comment.ProductID
+	updatedComment.ParentID = comment.ParentID
+	updatedComment.RootID = comment.RootID
+	updatedComment.Depth = comment.Depth
+	updatedComment.SellerResponse = comment.SellerResponse
+	updatedComment.Status = comment.Status
+	updatedComment.ModerationReason = comment.ModerationReason
+
+	if comment.Status != entities.CommentStatusHidden {
+		err = service.moderate(ctx, updatedComment)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.UpdateByID(ctx, ID, updatedComment)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentUpdated, ID, commentEventPayload(updatedComment))
+	})
+
+	if err != nil {
+		return translateError(err, ErrCommentNotFound)
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityComment, ID,
+		commentAuditSnapshot(comment), commentAuditSnapshot(updatedComment))
+
+	return nil
 }
 
-func (service *CommentServiceImpl) Save(comment *entities.Comment) (uint, error) {
-	return service.CommentRepository.Save(comment)
+func (service *CommentServiceImpl) DeleteByID(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "CommentService.DeleteByID")
+
+	err := service.deleteByID(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted comment", "comment_id", ID)
+	}
+
+	return translateError(err, ErrCommentNotFound)
+}
+
+func (service *CommentServiceImpl) deleteByID(ctx context.Context, ID uint) error {
+	comment, err := service.CommentRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.DeleteByID(ctx, ID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentDeleted, ID, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionDelete, AuditEntityComment, ID, commentAuditSnapshot(comment), nil)
+
+	return nil
 }
 
-func (service *CommentServiceImpl) FindByID(ID uint) (*entities.Comment, error) {
-	return service.CommentRepository.FindByID(ID)
+// Report records a report of a comment by a user, for moderators to look into.
+// Users can not report their own comments.
+func (service *CommentServiceImpl) Report(ctx context.Context, report *entities.CommentReport) error {
+	ctx, span := tracer.Start(ctx, "CommentService.Report")
+
+	err := service.report(ctx, report)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "reported comment", "comment_id", report.CommentID)
+	}
+
+	return err
 }
 
-func (service *CommentServiceImpl) FindByProductID(productID uint, page paging.Page) []entities.Comment {
-	return service.CommentRepository.FindByProductID(productID, page)
+func (service *CommentServiceImpl) report(ctx context.Context, report *entities.CommentReport) error {
+	comment, err := service.CommentRepository.FindByID(ctx, report.CommentID)
+
+	if err != nil {
+		return translateError(err, ErrCommentNotFound)
+	}
+
+	if !commentVisibleTo(comment, report.UserID) {
+		return ErrCommentNotFound
+	}
+
+	if comment.UserID == report.UserID {
+		return ErrOwnCommentReport
+	}
+
+	err = service.CommentRepository.SaveReport(ctx, report)
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrCommentAlreadyReported.Wrap(err)
+	}
+
+	return translateError(err, ErrCommentNotFound)
 }
 
-func (service *CommentServiceImpl) UpdateByID(ID uint, updatedComment *entities.Comment) error {
-	return service.CommentRepository.UpdateByID(ID, updatedComment)
+// moderate publishes the comment or holds it for review, depending on the
+// content filter.
+func (service *CommentServiceImpl) moderate(ctx context.Context, comment *entities.Comment) error {
+	reason, err := service.ContentFilter.Check(ctx, comment)
+
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		comment.Status = entities.CommentStatusPublished
+		comment.ModerationReason = ""
+
+		return nil
+	}
+
+	comment.Status = entities.CommentStatusPending
+	comment.ModerationReason = reason
+
+	return nil
 }
 
-func (service *CommentServiceImpl) DeleteByID(ID uint) error {
-	return service.CommentRepository.DeleteByID(ID)
+// commentVisibleTo reports whether the comment is shown to the given user,
+// which is the case for published comments and for the author.
+func commentVisibleTo(comment *entities.Comment, userID uint) bool {
+	return comment.Status == entities.CommentStatusPublished || comment.UserID == userID
 }
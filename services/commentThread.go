@@ -0,0 +1,63 @@
+package services
+
+import (
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+/* CommentThread is a comment with the replies to it, as seen by a viewer. A
+* comment which is deleted or not visible to the viewer stays in its thread as
+* a tombstone while any of its replies are visible, so that the replies keep
+* their context. ReplyCount counts all visible replies below the comment. */
+type CommentThread struct {
+	Comment    entities.Comment
+	Tombstone  bool
+	ReplyCount int
+	Replies    []*CommentThread
+}
+
+// buildCommentThreads nests comments, ordered by ID, below their parents and
+// drops tombstones without replies.
+func buildCommentThreads(comments []entities.Comment, viewerID uint) []*CommentThread {
+	threads := make(map[uint]*CommentThread, len(comments))
+	roots := []*CommentThread{}
+
+	for _, comment := range comments {
+		thread := &CommentThread{
+			Comment:   comment,
+			Tombstone: comment.DeletedAt.Valid || !commentVisibleTo(&comment, viewerID),
+		}
+
+		threads[comment.ID] = thread
+
+		if comment.ParentID == nil {
+			roots = append(roots, thread)
+		} else if parent, found := threads[*comment.ParentID]; found {
+			parent.Replies = append(parent.Replies, thread)
+		}
+	}
+
+	return pruneCommentThreads(roots)
+}
+
+func pruneCommentThreads(threads []*CommentThread) []*CommentThread {
+	kept := []*CommentThread{}
+
+	for _, thread := range threads {
+		thread.Replies = pruneCommentThreads(thread.Replies)
+		thread.ReplyCount = 0
+
+		for _, reply := range thread.Replies {
+			thread.ReplyCount += reply.ReplyCount
+
+			if !reply.Tombstone {
+				thread.ReplyCount++
+			}
+		}
+
+		if !thread.Tombstone || thread.ReplyCount > 0 {
+			kept = append(kept, thread)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+/* ContentFilter decides whether a comment is held for review by a moderator
+* before it is published. Check returns the reason for holding the comment,
+* or an empty string when it can be published right away. */
+type ContentFilter interface {
+	Check(ctx context.Context, comment *entities.Comment) (string, error)
+}
+
+// ContentFilters runs several filters, holding a comment for the reason of the
+// first one that holds it.
+type ContentFilters []ContentFilter
+
+func (filters ContentFilters) Check(ctx context.Context, comment *entities.Comment) (string, error) {
+	for _, filter := range filters {
+		reason, err := filter.Check(ctx, comment)
+
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+
+	return "", nil
+}
+
+/* InitContentFilter returns the filters configured in the environment: banned
+* words, a limit on the number of links and the detection of comments which
+* repeat an earlier comment of the same user. */
+func InitContentFilter(env *infrastructure.ModerationEnv, commentRepository repositories.CommentRepository) ContentFilter {
+	filters := ContentFilters{}
+
+	if len(env.BannedWords) > 0 {
+		filters = append(filters, InitBannedWordsFilter(env.BannedWords))
+	}
+
+	if env.MaxLinks >= 0 {
+		filters = append(filters, &LinkLimitFilter{MaxLinks: env.MaxLinks})
+	}
+
+	if env.RepeatWindow > 0 {
+		filters = append(filters, &RepeatedPostFilter{
+			CommentRepository: commentRepository,
+			Window:            env.RepeatWindow,
+		})
+	}
+
+	return filters
+}
+
+// BannedWordsFilter holds comments containing any of the banned words,
+// ignoring case.
+type BannedWordsFilter struct {
+	Words map[string]bool
+}
+
+func InitBannedWordsFilter(words []string) *BannedWordsFilter {
+	filter := &BannedWordsFilter{
+		Words: make(map[string]bool, len(words)),
+	}
+
+	for _, word := range words {
+		filter.Words[strings.ToLower(word)] = true
+	}
+
+	return filter
+}
+
+func (filter *BannedWordsFilter) Check(ctx context.Context, comment *entities.Comment) (string, error) {
+	for _, word := range contentWords(comment.Content) {
+		if filter.Words[word] {
+			return "contains a banned word", nil
+		}
+	}
+
+	return "", nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkLimitFilter holds comments with more than MaxLinks links.
+type LinkLimitFilter struct {
+	MaxLinks int
+}
+
+func (filter *LinkLimitFilter) Check(ctx context.Context, comment *entities.Comment) (string, error) {
+	links := len(linkPattern.FindAllStringIndex(comment.Content, -1))
+
+	if links > filter.MaxLinks {
+		return fmt.Sprintf("contains %d links, at most %d are allowed", links, filter.MaxLinks), nil
+	}
+
+	return "", nil
+}
+
+/* RepeatedPostFilter holds comments repeating another comment the same user
+* wrote within the window, on any product. Comments are compared ignoring
+* case, punctuation and whitespace. */
+type RepeatedPostFilter struct {
+	CommentRepository repositories.CommentRepository
+	Window            time.Duration
+}
+
+func (filter *RepeatedPostFilter) Check(ctx context.Context, comment *entities.Comment) (string, error) {
+	content := strings.Join(contentWords(comment.Content), " ")
+	recent := filter.CommentRepository.FindByUserIDSince(ctx, comment.UserID, time.Now().Add(-filter.Window))
+
+	for _, other := range recent {
+		if other.ID != comment.ID && strings.Join(contentWords(other.Content), " ") == content {
+			return "repeats an earlier comment", nil
+		}
+	}
+
+	return "", nil
+}
+
+func contentWords(content string) []string {
+	return strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/jobs"
+	"github.com/brunohradec/go-webstore/notifications"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+const JobSendEmail = "email.send"
+
+/* EmailJob is the payload of the jobs sending emails to users. The recipient
+* and the entities the email is about are looked up when it is sent, so that
+* it reflects their preferences and names at that time. */
+type EmailJob struct {
+	Template  notifications.Template `json:"template"`
+	UserID    uint                   `json:"userID"`
+	ProductID uint                   `json:"productID,omitempty"`
+	AuthorID  uint                   `json:"authorID,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+}
+
+type EmailService interface {
+	// Send renders the email of a job in the locale of the recipient and
+	// sends it, unless the recipient turned such emails off or no longer
+	// exists.
+	Send(ctx context.Context, job EmailJob) error
+}
+
+type EmailServiceImpl struct {
+	UserRepository                    repositories.UserRepository
+	ProductRepository                 repositories.ProductRepository
+	NotificationPreferencesRepository repositories.NotificationPreferencesRepository
+	Renderer                          notifications.Renderer
+	Mailer                            notifications.Mailer
+	From                              string
+	Logger                            *slog.Logger
+}
+
+func InitEmailService(
+	userRepository repositories.UserRepository,
+	productRepository repositories.ProductRepository,
+	notificationPreferencesRepository repositories.NotificationPreferencesRepository,
+	renderer notifications.Renderer,
+	mailer notifications.Mailer,
+	from string,
+	logger *slog.Logger,
+) EmailService {
+	return &EmailServiceImpl{
+		UserRepository:                    userRepository,
+		ProductRepository:                 productRepository,
+		NotificationPreferencesRepository: notificationPreferencesRepository,
+		Renderer:                          renderer,
+		Mailer:                            mailer,
+		From:                              from,
+		Logger:                            logger,
+	}
+}
+
+// RegisterEmailJobs registers the handler of the email jobs with the runner.
+func RegisterEmailJobs(runner jobs.Runner, emailService EmailService) {
+	runner.Register(JobSendEmail, jobs.Handle(emailService.Send))
+}
+
+func (service *EmailServiceImpl) Send(ctx context.Context, job EmailJob) error {
+	ctx, span := tracer.Start(ctx, "EmailService.Send")
+
+	err := service.send(ctx, &job)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *EmailServiceImpl) send(ctx context.Context, job *EmailJob) error {
+	user, err := service.UserRepository.FindByID(ctx, job.UserID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	preferences, err := findNotificationPreferences(ctx, service.NotificationPreferencesRepository, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	var data any
+
+	switch job.Template {
+	case notifications.TemplateWelcome:
+		data = &notifications.WelcomeData{Username: user.Username}
+	case notifications.TemplateCommentPosted:
+		if !preferences.CommentEmails {
+			return nil
+		}
+
+		product, err := service.ProductRepository.FindByID(ctx, job.ProductID)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		author, err := service.UserRepository.FindByID(ctx, job.AuthorID)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		data = &notifications.CommentPostedData{
+			Username:    user.Username,
+			Author:      author.Username,
+			ProductName: product.Name,
+			Content:     job.Content,
+		}
+	}
+
+	message, err := service.Renderer.Render(job.Template, preferences.Locale, data)
+
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	message.From = service.From
+	message.To = user.Email
+
+	err = service.Mailer.Send(ctx, message)
+
+	if err != nil {
+		return err
+	}
+
+	service.Logger.InfoContext(ctx, "sent email", "template", job.Template, "user_id", user.ID)
+
+	return nil
+}
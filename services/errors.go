@@ -0,0 +1,330 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+type ErrorKind int
+
+const (
+	ErrorKindInternal ErrorKind = iota
+	ErrorKindInvalid
+	ErrorKindUnauthorized
+	ErrorKindForbidden
+	ErrorKindNotFound
+	ErrorKindConflict
+	ErrorKindTooLarge
+	ErrorKindUnsupportedMediaType
+	ErrorKindNotImplemented
+	ErrorKindPreconditionFailed
+	ErrorKindPreconditionRequired
+	ErrorKindUnprocessable
+)
+
+/* Error is a domain error returned by the service layer. Code is a stable,
+* machine readable identifier which API clients may rely on, while Message is
+* a human readable description of the problem. Two errors are considered equal
+* by errors.Is when their codes match, so a wrapped copy of one of the
+* predefined errors below still matches the original. */
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (err *Error) Error() string {
+	if err.Err != nil {
+		return err.Message + ": " + err.Err.Error()
+	}
+
+	return err.Message
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+func (err *Error) Is(target error) bool {
+	targetErr, ok := target.(*Error)
+	return ok && targetErr.Code == err.Code
+}
+
+// Wrap returns a copy of the error with cause attached as the underlying error.
+func (err *Error) Wrap(cause error) *Error {
+	wrapped := *err
+	wrapped.Err = cause
+
+	return &wrapped
+}
+
+var (
+	ErrInvalidID = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_id",
+		Message: "Could not get ID from path params",
+	}
+	ErrInvalidToken = &Error{
+		Kind:    ErrorKindUnauthorized,
+		Code:    "invalid_token",
+		Message: "Provided JSON web token is missing or not valid",
+	}
+	ErrInvalidCredentials = &Error{
+		Kind:    ErrorKindUnauthorized,
+		Code:    "invalid_credentials",
+		Message: "Invalid username or password",
+	}
+	ErrInvalidSort = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_sort",
+		Message: "Requested sort order is not supported",
+	}
+	ErrInvalidPatch = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_patch",
+		Message: "Merge patch must be a JSON object",
+	}
+	ErrUnsupportedPatchType = &Error{
+		Kind:    ErrorKindUnsupportedMediaType,
+		Code:    "unsupported_patch_type",
+		Message: "Patch must be sent as application/merge-patch+json",
+	}
+	ErrInvalidIdempotencyKey = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_idempotency_key",
+		Message: "Idempotency-Key must be at most 255 characters long",
+	}
+	ErrIdempotencyKeyReused = &Error{
+		Kind:    ErrorKindUnprocessable,
+		Code:    "idempotency_key_reused",
+		Message: "Idempotency-Key was already used for a different request",
+	}
+	ErrIdempotencyKeyInFlight = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "idempotency_key_in_flight",
+		Message: "A request with the same Idempotency-Key is still being handled",
+	}
+	ErrInvalidAuditQuery = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_audit_query",
+		Message: "Audit log filters must be IDs, an entity type of product, comment or user and RFC 3339 times",
+	}
+	ErrInvalidJobQuery = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_job_query",
+		Message: "Job status must be one of pending, running, succeeded or failed",
+	}
+	ErrWrongPassword = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "wrong_password",
+		Message: "Current password is not correct",
+	}
+	ErrPreconditionFailed = &Error{
+		Kind:    ErrorKindPreconditionFailed,
+		Code:    "precondition_failed",
+		Message: "Resource was changed since it was read, fetch it again and retry",
+	}
+	ErrPreconditionRequired = &Error{
+		Kind:    ErrorKindPreconditionRequired,
+		Code:    "precondition_required",
+		Message: "Request must include an If-Match header with the ETag of the resource",
+	}
+	ErrVersionConflict = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "version_conflict",
+		Message: "Resource was changed by another request, fetch it again and retry",
+	}
+	ErrDeadEventNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "dead_event_not_found",
+		Message: "Could not find a dead event with the given ID",
+	}
+	ErrJobNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "job_not_found",
+		Message: "Could not find a job with the given ID",
+	}
+	ErrFailedJobNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "failed_job_not_found",
+		Message: "Could not find a failed job with the given ID",
+	}
+	ErrWebhookNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "webhook_not_found",
+		Message: "Could not find webhook endpoint with the given ID",
+	}
+	ErrWebhookNotOwned = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "webhook_not_owned",
+		Message: "Webhook endpoint user ID and logged in user ID do not match",
+	}
+	ErrInvalidNotificationQuery = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_notification_query",
+		Message: "Notifications can only be filtered by unread=true or unread=false",
+	}
+	ErrNotificationNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "notification_not_found",
+		Message: "Could not find a notification of the logged in user with the given ID",
+	}
+	ErrUserNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "user_not_found",
+		Message: "Could not find user with the given ID",
+	}
+	ErrUsernameTaken = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "username_taken",
+		Message: "User with the given username already exists",
+	}
+	ErrProductNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "product_not_found",
+		Message: "Could not find product with the given ID",
+	}
+	ErrProductNotOwned = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "product_not_owned",
+		Message: "Product user ID and logged in user ID do not match",
+	}
+	ErrCommentNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "comment_not_found",
+		Message: "Could not find comment with the given ID",
+	}
+	ErrCommentNotOwned = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "comment_not_owned",
+		Message: "Comment user ID and logged in user ID do not match",
+	}
+	ErrParentCommentNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "parent_comment_not_found",
+		Message: "Could not find the comment being replied to",
+	}
+	ErrInvalidParentComment = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_parent_comment",
+		Message: "Replies must be on the same product as the comment being replied to",
+	}
+	ErrCommentTooDeep = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "comment_too_deep",
+		Message: fmt.Sprintf("Replies can be nested at most %d levels deep", MaxCommentDepth),
+	}
+	ErrOwnCommentReport = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "own_comment_report",
+		Message: "Users can not report their own comments",
+	}
+	ErrCommentAlreadyReported = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "comment_already_reported",
+		Message: "User has already reported this comment",
+	}
+	ErrCommentHasReplies = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "comment_has_replies",
+		Message: "Comment can not be purged while it has replies",
+	}
+	ErrCommentProductDeleted = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "comment_product_deleted",
+		Message: "Comment can not be restored while its product is deleted, restore the product instead",
+	}
+	ErrRoleRequired = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "role_required",
+		Message: "Logged in user does not have the role required for this action",
+	}
+	ErrReviewNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "review_not_found",
+		Message: "Could not find review with the given ID",
+	}
+	ErrReviewNotOwned = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "review_not_owned",
+		Message: "Review user ID and logged in user ID do not match",
+	}
+	ErrReviewExists = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "review_exists",
+		Message: "User has already reviewed this product",
+	}
+	ErrOwnProductReview = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "own_product_review",
+		Message: "Users can not review their own products",
+	}
+	ErrOwnReviewVote = &Error{
+		Kind:    ErrorKindForbidden,
+		Code:    "own_review_vote",
+		Message: "Users can not vote on their own reviews",
+	}
+	ErrProductImageNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "product_image_not_found",
+		Message: "Could not find product image with the given ID",
+	}
+	ErrMediaNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "media_not_found",
+		Message: "Could not find media with the given key",
+	}
+	ErrUploadNotFound = &Error{
+		Kind:    ErrorKindNotFound,
+		Code:    "upload_not_found",
+		Message: "Could not find an uploaded object with the given key",
+	}
+	ErrDirectUploadUnsupported = &Error{
+		Kind:    ErrorKindNotImplemented,
+		Code:    "direct_upload_unsupported",
+		Message: "Configured media storage does not support direct uploads",
+	}
+	ErrImageTooLarge = &Error{
+		Kind:    ErrorKindTooLarge,
+		Code:    "image_too_large",
+		Message: "Image exceeds the maximum allowed size",
+	}
+	ErrUnsupportedImageType = &Error{
+		Kind:    ErrorKindUnsupportedMediaType,
+		Code:    "unsupported_image_type",
+		Message: "Image must be a JPEG, PNG, GIF or WebP file",
+	}
+	ErrInvalidImage = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_image",
+		Message: "Image could not be decoded",
+	}
+	ErrTooManyImages = &Error{
+		Kind:    ErrorKindConflict,
+		Code:    "too_many_images",
+		Message: "Product already has the maximum number of images",
+	}
+	ErrInvalidImageOrder = &Error{
+		Kind:    ErrorKindInvalid,
+		Code:    "invalid_image_order",
+		Message: "Image order must list every image of the product exactly once",
+	}
+)
+
+// translateError maps well known repository errors to domain errors.
+func translateError(err error, notFound *Error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return notFound.Wrap(err)
+	case errors.Is(err, repositories.ErrStaleVersion):
+		return ErrVersionConflict.Wrap(err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+/* IdempotencyService keeps track of requests sent with an idempotency key, so
+* that a retried request is answered with the response to the first one
+* instead of being handled again. Responses are kept for TTL. A request which
+* is still not handled after Lease is taken to be abandoned, for example by an
+* instance which crashed, and a retry takes its key over. */
+type IdempotencyService interface {
+	// Begin claims the key for a request with the given fingerprint. When the
+	// same request was already handled its record is returned with replay set.
+	// Completing or releasing a record whose key was taken over fails with
+	// gorm.ErrRecordNotFound.
+	Begin(ctx context.Context, userID uint, key string, fingerprint string) (record *entities.IdempotencyKey, replay bool, err error)
+	Complete(ctx context.Context, record *entities.IdempotencyKey, statusCode int, contentType string, body []byte) error
+	// Release gives up the key, so that the request can be retried.
+	Release(ctx context.Context, record *entities.IdempotencyKey) error
+	// PurgeExpired deletes the keys past their TTL.
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type IdempotencyServiceImpl struct {
+	IdempotencyKeyRepository repositories.IdempotencyKeyRepository
+	TTL                      time.Duration
+	// Lease is how long a request may be handled before its key is taken
+	// over. Without a lease keys are never taken over.
+	Lease  time.Duration
+	Logger *slog.Logger
+}
+
+func InitIdempotencyService(
+	idempotencyKeyRepository repositories.IdempotencyKeyRepository,
+	ttl time.Duration,
+	lease time.Duration,
+	logger *slog.Logger,
+) IdempotencyService {
+	return &IdempotencyServiceImpl{
+		IdempotencyKeyRepository: idempotencyKeyRepository,
+		TTL:                      ttl,
+		Lease:                    lease,
+		Logger:                   logger,
+	}
+}
+
+func (service *IdempotencyServiceImpl) Begin(ctx context.Context, userID uint, key string, fingerprint string) (*entities.IdempotencyKey, bool, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Begin")
+
+	record, replay, err := service.begin(ctx, userID, key, fingerprint)
+	endSpan(span, err)
+
+	if replay {
+		service.Logger.InfoContext(ctx, "replaying response to idempotent request", "idempotency_key_id", record.ID)
+	}
+
+	return record, replay, err
+}
+
+func (service *IdempotencyServiceImpl) begin(ctx context.Context, userID uint, key string, fingerprint string) (*entities.IdempotencyKey, bool, error) {
+	// The key may be released between failing to reserve it and looking it
+	// up, in which case reserving it again is worth one more try.
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record := &entities.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   now.Add(service.TTL),
+		}
+
+		var abandonedBefore time.Time
+
+		if service.Lease > 0 {
+			abandonedBefore = now.Add(-service.Lease)
+		}
+
+		err := service.IdempotencyKeyRepository.Reserve(ctx, record, abandonedBefore)
+
+		if err == nil {
+			return record, false, nil
+		}
+
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, false, err
+		}
+
+		existing, err := service.IdempotencyKeyRepository.FindByKey(ctx, userID, key)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return nil, false, ErrIdempotencyKeyReused
+		case !existing.IsCompleted():
+			return nil, false, ErrIdempotencyKeyInFlight
+		default:
+			return existing, true, nil
+		}
+	}
+
+	return nil, false, ErrIdempotencyKeyInFlight
+}
+
+func (service *IdempotencyServiceImpl) Complete(ctx context.Context, record *entities.IdempotencyKey, statusCode int, contentType string, body []byte) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Complete")
+
+	err := service.IdempotencyKeyRepository.Complete(ctx, record.ID, statusCode, contentType, body)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *IdempotencyServiceImpl) Release(ctx context.Context, record *entities.IdempotencyKey) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Release")
+
+	err := service.IdempotencyKeyRepository.DeleteByID(ctx, record.ID)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *IdempotencyServiceImpl) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.PurgeExpired")
+
+	purged, err := service.IdempotencyKeyRepository.DeleteExpired(ctx, time.Now())
+	endSpan(span, err)
+
+	if purged > 0 {
+		service.Logger.InfoContext(ctx, "purged expired idempotency keys", "count", purged)
+	}
+
+	return purged, err
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// Registered for image.Decode.
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const jpegQuality = 85
+
+// maxImagePixels guards against decompression bombs, images which are small
+// on the wire but huge once decoded.
+const maxImagePixels = 50_000_000
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type encodedImage struct {
+	data        []byte
+	contentType string
+	extension   string
+	width       int
+	height      int
+}
+
+/* decodeImage decodes the image and applies its EXIF orientation, so that the
+* pixels are upright once the metadata is dropped by re-encoding. */
+func decodeImage(data []byte) (*image.NRGBA, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrInvalidImage.Wrap(err)
+	}
+
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrInvalidImage.Wrap(err)
+	}
+
+	bounds := decoded.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), decoded, bounds.Min, draw.Src)
+
+	return orient(img, exifOrientation(data)), nil
+}
+
+// encodeImage encodes JPEG sources as JPEG and everything else as PNG, which
+// keeps transparency intact. Neither encoder writes any metadata.
+func encodeImage(img image.Image, sourceType string) (*encodedImage, error) {
+	var buffer bytes.Buffer
+
+	encoded := &encodedImage{
+		width:  img.Bounds().Dx(),
+		height: img.Bounds().Dy(),
+	}
+
+	if sourceType == "image/jpeg" {
+		encoded.contentType = "image/jpeg"
+		encoded.extension = "jpg"
+
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	} else {
+		encoded.contentType = "image/png"
+		encoded.extension = "png"
+
+		if err := png.Encode(&buffer, img); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded.data = buffer.Bytes()
+
+	return encoded, nil
+}
+
+// resizeToFit scales the image down so that neither side exceeds maxSize.
+// Smaller images are returned unchanged.
+func resizeToFit(img *image.NRGBA, maxSize int) image.Image {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*maxSize/width)
+		width = maxSize
+	} else {
+		width = max(1, width*maxSize/height)
+		height = maxSize
+	}
+
+	resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(resized, resized.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+
+	return resized
+}
+
+/* orient transforms the image according to an EXIF orientation value:
+* 2 and 4 are mirrored, 3 is rotated by 180 degrees, 6 and 8 are rotated by 90
+* degrees clockwise and counterclockwise, 5 and 7 are mirrored along the
+* diagonals. */
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+
+			srcOffset := src.PixOffset(x, y)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+4], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+
+	return dst
+}
+
+/* exifOrientation returns the orientation tag of a JPEG image, or 1 when the
+* image has none. Only the APP1 segment holding the EXIF data is parsed. */
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+
+		// Start of scan, no more metadata segments follow.
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		offset += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+// JobFilter is the filter of a background job listing.
+type JobFilter = repositories.JobFilter
+
+// JobService lets admins look into the background jobs and run failed ones
+// again.
+type JobService interface {
+	// Find returns a page of the jobs matching the filter, newest first.
+	Find(ctx context.Context, filter JobFilter, page paging.Page) []entities.Job
+	FindByID(ctx context.Context, ID uint) (*entities.Job, error)
+	// Retry gives a failed job a new set of attempts.
+	Retry(ctx context.Context, ID uint) error
+}
+
+type JobServiceImpl struct {
+	JobRepository repositories.JobRepository
+	Logger        *slog.Logger
+}
+
+func InitJobService(jobRepository repositories.JobRepository, logger *slog.Logger) JobService {
+	return &JobServiceImpl{
+		JobRepository: jobRepository,
+		Logger:        logger,
+	}
+}
+
+func (service *JobServiceImpl) Find(ctx context.Context, filter JobFilter, page paging.Page) []entities.Job {
+	ctx, span := tracer.Start(ctx, "JobService.Find")
+	defer span.End()
+
+	return service.JobRepository.Find(ctx, filter, page)
+}
+
+func (service *JobServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.Job, error) {
+	ctx, span := tracer.Start(ctx, "JobService.FindByID")
+
+	job, err := service.JobRepository.FindByID(ctx, ID)
+	endSpan(span, err)
+
+	return job, translateError(err, ErrJobNotFound)
+}
+
+func (service *JobServiceImpl) Retry(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "JobService.Retry")
+
+	err := service.JobRepository.Requeue(ctx, ID, time.Now())
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "requeued failed job", "job_id", ID)
+	}
+
+	return translateError(err, ErrFailedJobNotFound)
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/jobs"
+)
+
+const (
+	JobPurgeTrash           = "trash.purge"
+	JobPurgeOutbox          = "outbox.purge"
+	JobPurgeIdempotencyKeys = "idempotency_keys.purge"
+)
+
+/* ScheduleMaintenanceJobs registers the recurring clean up jobs with the
+* runner, on the maintenance queue. Expired trash is purged every
+* trashPurgeInterval, delivered outbox events and expired idempotency keys
+* once an hour. */
+func ScheduleMaintenanceJobs(
+	runner jobs.Runner,
+	trashService TrashService,
+	outboxService OutboxService,
+	idempotencyService IdempotencyService,
+	trashPurgeInterval time.Duration,
+) error {
+	purges := []struct {
+		jobType string
+		spec    string
+		handler jobs.HandlerFunc
+	}{
+		{JobPurgeTrash, "@every " + trashPurgeInterval.String(), func(ctx context.Context, job *entities.Job) error {
+			_, err := trashService.PurgeExpired(ctx)
+			return err
+		}},
+		{JobPurgeOutbox, "@hourly", func(ctx context.Context, job *entities.Job) error {
+			_, err := outboxService.PurgeDispatched(ctx)
+			return err
+		}},
+		{JobPurgeIdempotencyKeys, "@hourly", func(ctx context.Context, job *entities.Job) error {
+			_, err := idempotencyService.PurgeExpired(ctx)
+			return err
+		}},
+	}
+
+	for _, purge := range purges {
+		runner.Register(purge.jobType, purge.handler)
+
+		err := runner.Schedule(purge.jobType, purge.spec, purge.jobType, nil, jobs.OnQueue(jobs.MaintenanceQueue))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
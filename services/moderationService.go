@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+/* ModerationService lets moderators work through the comments which are held
+* for review or have been reported. Every action resolves the open reports of
+* the comment, taking it off the queue. */
+type ModerationService interface {
+	FindQueue(ctx context.Context, page paging.Page) []entities.Comment
+	Approve(ctx context.Context, commentID uint) error
+	Hide(ctx context.Context, commentID uint) error
+	DeleteByID(ctx context.Context, commentID uint) error
+}
+
+type ModerationServiceImpl struct {
+	CommentRepository repositories.CommentRepository
+	Transactor        repositories.Transactor
+	EventPublisher    EventPublisher
+	AuditService      AuditService
+	Logger            *slog.Logger
+}
+
+func InitModerationService(
+	commentRepository repositories.CommentRepository,
+	transactor repositories.Transactor,
+	eventPublisher EventPublisher,
+	auditService AuditService,
+	logger *slog.Logger,
+) ModerationService {
+	return &ModerationServiceImpl{
+		CommentRepository: commentRepository,
+		Transactor:        transactor,
+		EventPublisher:    eventPublisher,
+		AuditService:      auditService,
+		Logger:            logger,
+	}
+}
+
+func (service *ModerationServiceImpl) FindQueue(ctx context.Context, page paging.Page) []entities.Comment {
+	ctx, span := tracer.Start(ctx, "ModerationService.FindQueue")
+	defer span.End()
+
+	return service.CommentRepository.FindModerationQueue(ctx, page)
+}
+
+/* Approve publishes the comment. A comment which was held for review is only
+* posted now as far as the subscribers of the events are concerned, so its
+* approval emits events.CommentPosted. */
+func (service *ModerationServiceImpl) Approve(ctx context.Context, commentID uint) error {
+	ctx, span := tracer.Start(ctx, "ModerationService.Approve")
+
+	err := service.approve(ctx, commentID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "approved comment", "comment_id", commentID)
+	}
+
+	return translateError(err, ErrCommentNotFound)
+}
+
+// Hide hides the comment from everyone but its author. Hidden comments stay
+// hidden when their author edits them.
+func (service *ModerationServiceImpl) Hide(ctx context.Context, commentID uint) error {
+	ctx, span := tracer.Start(ctx, "ModerationService.Hide")
+
+	err := service.hide(ctx, commentID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "hid comment", "comment_id", commentID)
+	}
+
+	return translateError(err, ErrCommentNotFound)
+}
+
+func (service *ModerationServiceImpl) approve(ctx context.Context, commentID uint) error {
+	comment, err := service.CommentRepository.FindByID(ctx, commentID)
+
+	if err != nil {
+		return err
+	}
+
+	before := commentAuditSnapshot(comment)
+	wasPublished := comment.Status == entities.CommentStatusPublished
+	comment.Status = entities.CommentStatusPublished
+	comment.ModerationReason = ""
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.UpdateStatusByID(ctx, commentID, comment.Status, comment.ModerationReason)
+
+		if err != nil || wasPublished {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentPosted, commentID, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityComment, commentID, before, commentAuditSnapshot(comment))
+
+	return nil
+}
+
+func (service *ModerationServiceImpl) hide(ctx context.Context, commentID uint) error {
+	comment, err := service.CommentRepository.FindByID(ctx, commentID)
+
+	if err != nil {
+		return err
+	}
+
+	before := commentAuditSnapshot(comment)
+	comment.Status = entities.CommentStatusHidden
+	comment.ModerationReason = "hidden by a moderator"
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.UpdateStatusByID(ctx, commentID, comment.Status, comment.ModerationReason)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentUpdated, commentID, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityComment, commentID, before, commentAuditSnapshot(comment))
+
+	return nil
+}
+
+func (service *ModerationServiceImpl) DeleteByID(ctx context.Context, commentID uint) error {
+	ctx, span := tracer.Start(ctx, "ModerationService.DeleteByID")
+
+	err := service.deleteByID(ctx, commentID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted comment as moderator", "comment_id", commentID)
+	}
+
+	return err
+}
+
+func (service *ModerationServiceImpl) deleteByID(ctx context.Context, commentID uint) error {
+	comment, err := service.CommentRepository.FindByID(ctx, commentID)
+
+	if err != nil {
+		return translateError(err, ErrCommentNotFound)
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.DeleteByIDAsModerator(ctx, commentID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentDeleted, commentID, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return translateError(err, ErrCommentNotFound)
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionDelete, AuditEntityComment, commentID, commentAuditSnapshot(comment), nil)
+
+	return nil
+}
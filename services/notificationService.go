@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/jobs"
+	"github.com/brunohradec/go-webstore/notifications"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+// notificationExcerptLength is how many characters of a comment its
+// notification shows.
+const notificationExcerptLength = 140
+
+// NotificationEventTypes are the events users are notified of.
+var NotificationEventTypes = []events.Type{
+	events.UserRegistered,
+	events.CommentPosted,
+}
+
+type NotificationService interface {
+	// FindPreferences returns the notification preferences of a user, or the
+	// defaults when the user never changed them.
+	FindPreferences(ctx context.Context, userID uint) (*entities.NotificationPreferences, error)
+	UpdatePreferences(ctx context.Context, preferences *entities.NotificationPreferences) error
+
+	// Find returns a page of the notifications of a user, newest first, only
+	// the unread ones if unreadOnly is set.
+	Find(ctx context.Context, userID uint, unreadOnly bool, page paging.Page) []entities.Notification
+	// FindAfter returns the notifications of a user newer than the one with
+	// the given ID, oldest first, in batches.
+	FindAfter(ctx context.Context, userID uint, afterID uint) []entities.Notification
+	CountUnread(ctx context.Context, userID uint) int64
+	MarkRead(ctx context.Context, userID uint, ID uint) error
+	MarkAllRead(ctx context.Context, userID uint) error
+	// Subscribe returns a channel receiving a value whenever notifications
+	// are created for the user, and a function ending the subscription.
+	Subscribe(userID uint) (<-chan struct{}, func())
+
+	// Notify is the bus handler notifying users of an event: the seller whose
+	// product was commented on is notified in the application and by email,
+	// a new user gets a welcome email.
+	Notify(ctx context.Context, event *events.Event) error
+}
+
+type NotificationServiceImpl struct {
+	NotificationRepository            repositories.NotificationRepository
+	NotificationPreferencesRepository repositories.NotificationPreferencesRepository
+	ProductRepository                 repositories.ProductRepository
+	Enqueuer                          jobs.Enqueuer
+	Hub                               notifications.Hub
+	Logger                            *slog.Logger
+}
+
+func InitNotificationService(
+	notificationRepository repositories.NotificationRepository,
+	notificationPreferencesRepository repositories.NotificationPreferencesRepository,
+	productRepository repositories.ProductRepository,
+	enqueuer jobs.Enqueuer,
+	hub notifications.Hub,
+	logger *slog.Logger,
+) NotificationService {
+	return &NotificationServiceImpl{
+		NotificationRepository:            notificationRepository,
+		NotificationPreferencesRepository: notificationPreferencesRepository,
+		ProductRepository:                 productRepository,
+		Enqueuer:                          enqueuer,
+		Hub:                               hub,
+		Logger:                            logger,
+	}
+}
+
+func (service *NotificationServiceImpl) FindPreferences(ctx context.Context, userID uint) (*entities.NotificationPreferences, error) {
+	ctx, span := tracer.Start(ctx, "NotificationService.FindPreferences")
+
+	preferences, err := findNotificationPreferences(ctx, service.NotificationPreferencesRepository, userID)
+	endSpan(span, err)
+
+	return preferences, err
+}
+
+func (service *NotificationServiceImpl) UpdatePreferences(ctx context.Context, preferences *entities.NotificationPreferences) error {
+	ctx, span := tracer.Start(ctx, "NotificationService.UpdatePreferences")
+
+	err := service.NotificationPreferencesRepository.Save(ctx, preferences)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *NotificationServiceImpl) Find(ctx context.Context, userID uint, unreadOnly bool, page paging.Page) []entities.Notification {
+	ctx, span := tracer.Start(ctx, "NotificationService.Find")
+	defer span.End()
+
+	return service.NotificationRepository.FindByUserID(ctx, userID, unreadOnly, page)
+}
+
+func (service *NotificationServiceImpl) FindAfter(ctx context.Context, userID uint, afterID uint) []entities.Notification {
+	ctx, span := tracer.Start(ctx, "NotificationService.FindAfter")
+	defer span.End()
+
+	return service.NotificationRepository.FindByUserIDAfter(ctx, userID, afterID, paging.MaxPageSize)
+}
+
+func (service *NotificationServiceImpl) CountUnread(ctx context.Context, userID uint) int64 {
+	ctx, span := tracer.Start(ctx, "NotificationService.CountUnread")
+	defer span.End()
+
+	return service.NotificationRepository.CountUnread(ctx, userID)
+}
+
+func (service *NotificationServiceImpl) MarkRead(ctx context.Context, userID uint, ID uint) error {
+	ctx, span := tracer.Start(ctx, "NotificationService.MarkRead")
+
+	err := service.NotificationRepository.MarkRead(ctx, userID, ID, time.Now())
+	endSpan(span, err)
+
+	return translateError(err, ErrNotificationNotFound)
+}
+
+func (service *NotificationServiceImpl) MarkAllRead(ctx context.Context, userID uint) error {
+	ctx, span := tracer.Start(ctx, "NotificationService.MarkAllRead")
+
+	_, err := service.NotificationRepository.MarkAllRead(ctx, userID, time.Now())
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *NotificationServiceImpl) Subscribe(userID uint) (<-chan struct{}, func()) {
+	return service.Hub.Subscribe(userID)
+}
+
+func (service *NotificationServiceImpl) Notify(ctx context.Context, event *events.Event) error {
+	ctx, span := tracer.Start(ctx, "NotificationService.Notify")
+
+	err := service.notify(ctx, event)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *NotificationServiceImpl) notify(ctx context.Context, event *events.Event) error {
+	switch event.Type {
+	case events.UserRegistered:
+		var payload events.UserPayload
+
+		err := event.Decode(&payload)
+
+		if err != nil {
+			return err
+		}
+
+		return service.enqueueEmail(ctx, event, &EmailJob{
+			Template: notifications.TemplateWelcome,
+			UserID:   payload.UserID,
+		})
+	case events.CommentPosted:
+		var payload events.CommentPayload
+
+		err := event.Decode(&payload)
+
+		if err != nil {
+			return err
+		}
+
+		if payload.Status != string(entities.CommentStatusPublished) {
+			return nil
+		}
+
+		product, err := service.ProductRepository.FindByID(ctx, payload.ProductID)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if product.UserID == payload.UserID {
+			return nil
+		}
+
+		err = service.save(ctx, event, &entities.Notification{
+			UserID:    product.UserID,
+			Type:      entities.NotificationCommentPosted,
+			ActorID:   &payload.UserID,
+			ProductID: &product.ID,
+			CommentID: &payload.CommentID,
+			Excerpt:   excerpt(payload.Content, notificationExcerptLength),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return service.enqueueEmail(ctx, event, &EmailJob{
+			Template:  notifications.TemplateCommentPosted,
+			UserID:    product.UserID,
+			ProductID: product.ID,
+			AuthorID:  payload.UserID,
+			Content:   payload.Content,
+		})
+	default:
+		return nil
+	}
+}
+
+// save creates the notification of an event once and wakes up the streams of
+// its user.
+func (service *NotificationServiceImpl) save(ctx context.Context, event *events.Event, notification *entities.Notification) error {
+	eventID := event.ID
+	notification.EventID = &eventID
+
+	err := service.NotificationRepository.Save(ctx, notification)
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	service.Hub.Publish(notification.UserID)
+
+	return nil
+}
+
+// enqueueEmail queues an email job once per event and recipient, so that an
+// event delivered again does not send the email twice.
+func (service *NotificationServiceImpl) enqueueEmail(ctx context.Context, event *events.Event, job *EmailJob) error {
+	_, err := service.Enqueuer.Enqueue(ctx, JobSendEmail, job, jobs.Unique(fmt.Sprintf("email:%d:%d", event.ID, job.UserID)))
+
+	if errors.Is(err, jobs.ErrDuplicate) {
+		return nil
+	}
+
+	return err
+}
+
+func findNotificationPreferences(
+	ctx context.Context,
+	repository repositories.NotificationPreferencesRepository,
+	userID uint,
+) (*entities.NotificationPreferences, error) {
+	preferences, err := repository.FindByUserID(ctx, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return entities.DefaultNotificationPreferences(userID), nil
+	}
+
+	return preferences, err
+}
+
+// excerpt shortens text to at most length characters, ending it with an
+// ellipsis when it was cut.
+func excerpt(text string, length int) string {
+	runes := []rune(text)
+
+	if len(runes) <= length {
+		return text
+	}
+
+	return string(runes[:length-1]) + "…"
+}
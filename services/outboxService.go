@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+)
+
+const (
+	dispatchBatchSize = 100
+	// dispatchLease is how long a claimed event is left to its dispatcher
+	// before another one may deliver it.
+	dispatchLease = time.Minute
+	maxRetryDelay = time.Hour
+)
+
+type EventPublisher interface {
+	/* Publish writes an event to the outbox. Called with the context of a
+	* transaction, the event is saved in that transaction and only delivered
+	* if it commits. */
+	Publish(ctx context.Context, eventType events.Type, entityID uint, payload any) error
+}
+
+type OutboxService interface {
+	EventPublisher
+	// Dispatch delivers the events which are due to the subscribers of the
+	// bus and returns how many were delivered.
+	Dispatch(ctx context.Context) (int, error)
+	// FindDead returns the events which ran out of attempts.
+	FindDead(ctx context.Context, page paging.Page) []entities.OutboxEvent
+	// Retry gives a dead event a new set of attempts.
+	Retry(ctx context.Context, ID uint) error
+	// PurgeDispatched deletes the delivered events older than the retention.
+	PurgeDispatched(ctx context.Context) (int64, error)
+}
+
+type OutboxServiceImpl struct {
+	OutboxEventRepository repositories.OutboxEventRepository
+	Bus                   events.Bus
+	MaxAttempts           int
+	RetryDelay            time.Duration
+	Retention             time.Duration
+	Logger                *slog.Logger
+}
+
+func InitOutboxService(
+	outboxEventRepository repositories.OutboxEventRepository,
+	bus events.Bus,
+	env *infrastructure.OutboxEnv,
+	logger *slog.Logger,
+) OutboxService {
+	return &OutboxServiceImpl{
+		OutboxEventRepository: outboxEventRepository,
+		Bus:                   bus,
+		MaxAttempts:           env.MaxAttempts,
+		RetryDelay:            env.RetryDelay,
+		Retention:             env.Retention,
+		Logger:                logger,
+	}
+}
+
+func (service *OutboxServiceImpl) Publish(ctx context.Context, eventType events.Type, entityID uint, payload any) error {
+	ctx, span := tracer.Start(ctx, "OutboxService.Publish")
+
+	err := service.publish(ctx, eventType, entityID, payload)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *OutboxServiceImpl) publish(ctx context.Context, eventType events.Type, entityID uint, payload any) error {
+	encoded, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	return service.OutboxEventRepository.Save(ctx, &entities.OutboxEvent{
+		Type:          string(eventType),
+		EntityID:      entityID,
+		Payload:       string(encoded),
+		NextAttemptAt: time.Now(),
+	})
+}
+
+func (service *OutboxServiceImpl) Dispatch(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "OutboxService.Dispatch")
+
+	delivered, err := service.dispatch(ctx)
+	endSpan(span, err)
+
+	if delivered > 0 {
+		service.Logger.DebugContext(ctx, "dispatched outbox events", "count", delivered)
+	}
+
+	return delivered, err
+}
+
+func (service *OutboxServiceImpl) dispatch(ctx context.Context) (int, error) {
+	delivered := 0
+
+	for {
+		claimed, err := service.OutboxEventRepository.ClaimDue(ctx, time.Now(), dispatchLease, dispatchBatchSize)
+
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, event := range claimed {
+			ok, err := service.deliver(ctx, &event)
+
+			if err != nil {
+				return delivered, err
+			}
+
+			if ok {
+				delivered++
+			}
+		}
+
+		if len(claimed) < dispatchBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+/* deliver hands a claimed event to the bus and records the outcome. A failed
+* delivery is retried with an exponential backoff until the event runs out of
+* attempts and is marked dead. The error returned is that of recording the
+* outcome, the delivery error is kept with the event. */
+func (service *OutboxServiceImpl) deliver(ctx context.Context, outboxEvent *entities.OutboxEvent) (bool, error) {
+	ctx, span := tracer.Start(ctx, "OutboxService.Deliver")
+
+	deliveryErr := service.Bus.Deliver(ctx, outboxEventToEvent(outboxEvent))
+	endSpan(span, deliveryErr)
+
+	now := time.Now()
+
+	if deliveryErr == nil {
+		return true, service.OutboxEventRepository.MarkDispatched(ctx, outboxEvent.ID, now)
+	}
+
+	attempts := outboxEvent.Attempts + 1
+
+	if attempts >= service.MaxAttempts {
+		service.Logger.ErrorContext(ctx, "outbox event ran out of attempts",
+			"event_id", outboxEvent.ID, "type", outboxEvent.Type, "attempts", attempts, "error", deliveryErr)
+
+		return false, service.OutboxEventRepository.MarkDead(ctx, outboxEvent.ID, attempts, now, deliveryErr.Error())
+	}
+
+	service.Logger.WarnContext(ctx, "could not deliver outbox event",
+		"event_id", outboxEvent.ID, "type", outboxEvent.Type, "attempts", attempts, "error", deliveryErr)
+
+	nextAttemptAt := now.Add(retryDelay(service.RetryDelay, attempts))
+
+	return false, service.OutboxEventRepository.MarkFailed(ctx, outboxEvent.ID, attempts, nextAttemptAt, deliveryErr.Error())
+}
+
+func (service *OutboxServiceImpl) FindDead(ctx context.Context, page paging.Page) []entities.OutboxEvent {
+	ctx, span := tracer.Start(ctx, "OutboxService.FindDead")
+	defer span.End()
+
+	return service.OutboxEventRepository.FindDead(ctx, page)
+}
+
+func (service *OutboxServiceImpl) Retry(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "OutboxService.Retry")
+
+	err := service.OutboxEventRepository.Requeue(ctx, ID, time.Now())
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "requeued dead outbox event", "event_id", ID)
+	}
+
+	return translateError(err, ErrDeadEventNotFound)
+}
+
+func (service *OutboxServiceImpl) PurgeDispatched(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "OutboxService.PurgeDispatched")
+
+	purged, err := service.OutboxEventRepository.DeleteDispatchedBefore(ctx, time.Now().Add(-service.Retention))
+	endSpan(span, err)
+
+	if purged > 0 {
+		service.Logger.InfoContext(ctx, "purged dispatched outbox events", "count", purged)
+	}
+
+	return purged, err
+}
+
+// RunOutboxDispatcher delivers due events every interval until ctx is done.
+func RunOutboxDispatcher(ctx context.Context, service OutboxService, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := service.Dispatch(ctx)
+
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.ErrorContext(ctx, "could not dispatch outbox events", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryDelay doubles the delay with every failed attempt, up to
+// maxRetryDelay.
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+func outboxEventToEvent(outboxEvent *entities.OutboxEvent) *events.Event {
+	return &events.Event{
+		ID:         outboxEvent.ID,
+		Type:       events.Type(outboxEvent.Type),
+		EntityID:   outboxEvent.EntityID,
+		OccurredAt: outboxEvent.CreatedAt,
+		Payload:    json.RawMessage(outboxEvent.Payload),
+	}
+}
+
+func productEventPayload(product *entities.Product) *events.ProductPayload {
+	return &events.ProductPayload{
+		ProductID:   product.ID,
+		UserID:      product.UserID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+	}
+}
+
+func commentEventPayload(comment *entities.Comment) *events.CommentPayload {
+	return &events.CommentPayload{
+		CommentID: comment.ID,
+		UserID:    comment.UserID,
+		ProductID: comment.ProductID,
+		ParentID:  comment.ParentID,
+		Content:   comment.Content,
+		Status:    string(comment.Status),
+	}
+}
+
+func userEventPayload(user *entities.User) *events.UserPayload {
+	return &events.UserPayload{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     string(user.Role),
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/storage"
+)
+
+const (
+	MaxImagesPerProduct = 10
+	MediumImageSize     = 800
+	ThumbnailImageSize  = 200
+	UploadURLTTL        = 15 * time.Minute
+)
+
+// PresignedUpload is a URL a client may PUT an image to until ExpiresAt,
+// after which the upload is confirmed by its Key.
+type PresignedUpload struct {
+	Key       string
+	URL       string
+	ExpiresAt time.Time
+}
+
+type ProductImageService interface {
+	Upload(ctx context.Context, productID uint, content io.Reader) (*entities.ProductImage, error)
+	CreateUpload(ctx context.Context, productID uint) (*PresignedUpload, error)
+	ConfirmUpload(ctx context.Context, productID uint, key string) (*entities.ProductImage, error)
+	FindByProductID(ctx context.Context, productID uint) []entities.ProductImage
+	FindByProductIDs(ctx context.Context, productIDs []uint) map[uint][]entities.ProductImage
+	Reorder(ctx context.Context, productID uint, imageIDs []uint) error
+	SetPrimary(ctx context.Context, productID uint, ID uint) error
+	DeleteByID(ctx context.Context, productID uint, ID uint) error
+	URL(key string) string
+}
+
+type ProductImageServiceImpl struct {
+	ProductImageRepository repositories.ProductImageRepository
+	BlobStore              storage.BlobStore
+	MaxUploadBytes         int64
+	Logger                 *slog.Logger
+}
+
+func InitProductImageService(
+	productImageRepository repositories.ProductImageRepository,
+	blobStore storage.BlobStore,
+	maxUploadBytes int64,
+	logger *slog.Logger,
+) ProductImageService {
+	return &ProductImageServiceImpl{
+		ProductImageRepository: productImageRepository,
+		BlobStore:              blobStore,
+		MaxUploadBytes:         maxUploadBytes,
+		Logger:                 logger,
+	}
+}
+
+/* Upload validates the uploaded image, strips its metadata and stores it
+* together with a medium sized rendition and a thumbnail. The first image of a
+* product becomes its primary image. */
+func (service *ProductImageServiceImpl) Upload(ctx context.Context, productID uint, content io.Reader) (*entities.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductImageService.Upload")
+
+	image, err := service.upload(ctx, productID, content)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "uploaded product image", "product_id", productID, "image_id", image.ID)
+	}
+
+	return image, err
+}
+
+func (service *ProductImageServiceImpl) upload(ctx context.Context, productID uint, content io.Reader) (*entities.ProductImage, error) {
+	// Checked up front to spare the processing of an image which would be
+	// rejected anyway, the repository enforces the limit when saving.
+	if len(service.ProductImageRepository.FindByProductID(ctx, productID)) >= MaxImagesPerProduct {
+		return nil, ErrTooManyImages
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, service.MaxUploadBytes+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > service.MaxUploadBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+
+	if !allowedImageTypes[contentType] {
+		return nil, ErrUnsupportedImageType
+	}
+
+	decoded, err := decodeImage(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := encodeImage(decoded, contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	medium, err := encodeImage(resizeToFit(decoded, MediumImageSize), contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail, err := encodeImage(resizeToFit(decoded, ThumbnailImageSize), contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := imageKeyPrefix(productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	image := &entities.ProductImage{
+		ProductID:    productID,
+		ContentType:  original.contentType,
+		Width:        original.width,
+		Height:       original.height,
+		Size:         int64(len(original.data)),
+		OriginalKey:  prefix + "original." + original.extension,
+		MediumKey:    prefix + "medium." + medium.extension,
+		ThumbnailKey: prefix + "thumbnail." + thumbnail.extension,
+	}
+
+	renditions := map[string]*encodedImage{
+		image.OriginalKey:  original,
+		image.MediumKey:    medium,
+		image.ThumbnailKey: thumbnail,
+	}
+
+	for key, rendition := range renditions {
+		err := service.BlobStore.Put(ctx, key, bytes.NewReader(rendition.data), rendition.contentType)
+
+		if err != nil {
+			service.deleteBlobs(ctx, image)
+			return nil, err
+		}
+	}
+
+	_, err = service.ProductImageRepository.Save(ctx, image, MaxImagesPerProduct)
+
+	if err != nil {
+		service.deleteBlobs(ctx, image)
+	}
+
+	if errors.Is(err, repositories.ErrImageLimitReached) {
+		return nil, ErrTooManyImages.Wrap(err)
+	}
+
+	if err != nil {
+		return nil, translateError(err, ErrProductNotFound)
+	}
+
+	return image, nil
+}
+
+/* CreateUpload presigns a direct upload of an image to the blob store. The
+* object is staged under a key of its own and only becomes a product image once
+* ConfirmUpload has verified it. */
+func (service *ProductImageServiceImpl) CreateUpload(ctx context.Context, productID uint) (*PresignedUpload, error) {
+	ctx, span := tracer.Start(ctx, "ProductImageService.CreateUpload")
+
+	upload, err := service.createUpload(ctx, productID)
+	endSpan(span, err)
+
+	return upload, err
+}
+
+func (service *ProductImageServiceImpl) createUpload(ctx context.Context, productID uint) (*PresignedUpload, error) {
+	store, ok := service.BlobStore.(storage.PresignedBlobStore)
+
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+
+	if len(service.ProductImageRepository.FindByProductID(ctx, productID)) >= MaxImagesPerProduct {
+		return nil, ErrTooManyImages
+	}
+
+	random, err := randomHex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := uploadKeyPrefix(productID) + random
+
+	presignedURL, err := store.PresignPut(ctx, key, UploadURLTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedUpload{
+		Key:       key,
+		URL:       presignedURL,
+		ExpiresAt: time.Now().Add(UploadURLTTL),
+	}, nil
+}
+
+/* ConfirmUpload attaches a directly uploaded image to the product. The staged
+* object goes through the same checks and processing as an upload through the
+* API and is removed afterwards, whether or not it was accepted. */
+func (service *ProductImageServiceImpl) ConfirmUpload(ctx context.Context, productID uint, key string) (*entities.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductImageService.ConfirmUpload")
+
+	image, err := service.confirmUpload(ctx, productID, key)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "confirmed product image upload", "product_id", productID, "image_id", image.ID)
+	}
+
+	return image, err
+}
+
+func (service *ProductImageServiceImpl) confirmUpload(ctx context.Context, productID uint, key string) (*entities.ProductImage, error) {
+	store, ok := service.BlobStore.(storage.PresignedBlobStore)
+
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+
+	// Keys of other products are treated as missing, so that an upload can
+	// not be attached to a product it was not presigned for.
+	if !strings.HasPrefix(key, uploadKeyPrefix(productID)) {
+		return nil, ErrUploadNotFound
+	}
+
+	info, err := store.Stat(ctx, key)
+
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return nil, ErrUploadNotFound.Wrap(err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer service.deleteBlob(ctx, key)
+
+	if info.Size > service.MaxUploadBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	content, _, err := store.Get(ctx, key)
+
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return nil, ErrUploadNotFound.Wrap(err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer content.Close()
+
+	return service.upload(ctx, productID, content)
+}
+
+func (service *ProductImageServiceImpl) FindByProductID(ctx context.Context, productID uint) []entities.ProductImage {
+	ctx, span := tracer.Start(ctx, "ProductImageService.FindByProductID")
+	defer span.End()
+
+	return service.ProductImageRepository.FindByProductID(ctx, productID)
+}
+
+// FindByProductIDs loads the images of several products at once and groups
+// them by product ID, which keeps product listings to a single query.
+func (service *ProductImageServiceImpl) FindByProductIDs(ctx context.Context, productIDs []uint) map[uint][]entities.ProductImage {
+	ctx, span := tracer.Start(ctx, "ProductImageService.FindByProductIDs")
+	defer span.End()
+
+	imagesByProductID := make(map[uint][]entities.ProductImage, len(productIDs))
+
+	for _, image := range service.ProductImageRepository.FindByProductIDs(ctx, productIDs) {
+		imagesByProductID[image.ProductID] = append(imagesByProductID[image.ProductID], image)
+	}
+
+	return imagesByProductID
+}
+
+// Reorder sets the image positions to the order of imageIDs, which must list
+// every image of the product exactly once.
+func (service *ProductImageServiceImpl) Reorder(ctx context.Context, productID uint, imageIDs []uint) error {
+	ctx, span := tracer.Start(ctx, "ProductImageService.Reorder")
+
+	err := service.reorder(ctx, productID, imageIDs)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "reordered product images", "product_id", productID)
+	}
+
+	return err
+}
+
+func (service *ProductImageServiceImpl) reorder(ctx context.Context, productID uint, imageIDs []uint) error {
+	existing := service.ProductImageRepository.FindByProductID(ctx, productID)
+
+	if len(existing) != len(imageIDs) {
+		return ErrInvalidImageOrder
+	}
+
+	known := make(map[uint]bool, len(existing))
+
+	for _, image := range existing {
+		known[image.ID] = true
+	}
+
+	positions := make(map[uint]int, len(imageIDs))
+
+	for position, ID := range imageIDs {
+		if _, duplicate := positions[ID]; duplicate || !known[ID] {
+			return ErrInvalidImageOrder
+		}
+
+		positions[ID] = position
+	}
+
+	return service.ProductImageRepository.UpdatePositions(ctx, productID, positions)
+}
+
+func (service *ProductImageServiceImpl) SetPrimary(ctx context.Context, productID uint, ID uint) error {
+	ctx, span := tracer.Start(ctx, "ProductImageService.SetPrimary")
+
+	err := service.setPrimary(ctx, productID, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "set primary product image", "product_id", productID, "image_id", ID)
+	}
+
+	return err
+}
+
+func (service *ProductImageServiceImpl) setPrimary(ctx context.Context, productID uint, ID uint) error {
+	_, err := service.findProductImage(ctx, productID, ID)
+
+	if err != nil {
+		return err
+	}
+
+	return service.ProductImageRepository.SetPrimary(ctx, productID, ID)
+}
+
+/* DeleteByID deletes the image together with its stored renditions. When the
+* primary image is deleted, the next image in order becomes primary. */
+func (service *ProductImageServiceImpl) DeleteByID(ctx context.Context, productID uint, ID uint) error {
+	ctx, span := tracer.Start(ctx, "ProductImageService.DeleteByID")
+
+	err := service.deleteByID(ctx, productID, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted product image", "product_id", productID, "image_id", ID)
+	}
+
+	return err
+}
+
+func (service *ProductImageServiceImpl) deleteByID(ctx context.Context, productID uint, ID uint) error {
+	image, err := service.findProductImage(ctx, productID, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = service.ProductImageRepository.DeleteByID(ctx, ID)
+
+	if err != nil {
+		return translateError(err, ErrProductImageNotFound)
+	}
+
+	service.deleteBlobs(ctx, image)
+
+	if !image.IsPrimary {
+		return nil
+	}
+
+	remaining := service.ProductImageRepository.FindByProductID(ctx, productID)
+
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	return service.ProductImageRepository.SetPrimary(ctx, productID, remaining[0].ID)
+}
+
+func (service *ProductImageServiceImpl) URL(key string) string {
+	return service.BlobStore.URL(key)
+}
+
+func (service *ProductImageServiceImpl) findProductImage(ctx context.Context, productID uint, ID uint) (*entities.ProductImage, error) {
+	image, err := service.ProductImageRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return nil, translateError(err, ErrProductImageNotFound)
+	}
+
+	if image.ProductID != productID {
+		return nil, ErrProductImageNotFound
+	}
+
+	return image, nil
+}
+
+// deleteBlobs removes the stored renditions of an image. Failures are only
+// logged, a leftover blob is harmless once its record is gone.
+func (service *ProductImageServiceImpl) deleteBlobs(ctx context.Context, image *entities.ProductImage) {
+	for _, key := range []string{image.OriginalKey, image.MediumKey, image.ThumbnailKey} {
+		service.deleteBlob(ctx, key)
+	}
+}
+
+func (service *ProductImageServiceImpl) deleteBlob(ctx context.Context, key string) {
+	err := service.BlobStore.Delete(ctx, key)
+
+	if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		service.Logger.WarnContext(ctx, "could not delete product image blob", "key", key, "error", err)
+	}
+}
+
+// imageKeyPrefix returns a unique, unguessable prefix for the renditions of a
+// new image.
+func imageKeyPrefix(productID uint) (string, error) {
+	random, err := randomHex()
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("products/%d/images/%s/", productID, random), nil
+}
+
+func uploadKeyPrefix(productID uint) string {
+	return fmt.Sprintf("uploads/products/%d/", productID)
+}
+
+func randomHex() (string, error) {
+	random := make([]byte, 16)
+
+	_, err := rand.Read(random)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
@@ -1,50 +1,186 @@
 package services
 
 import (
+	"context"
+	"log/slog"
+
 	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
 	"github.com/brunohradec/go-webstore/paging"
 	"github.com/brunohradec/go-webstore/repositories"
 )
 
 type ProductService interface {
-	Save(product *entities.Product) (uint, error)
-	FindByID(ID uint) (*entities.Product, error)
-	FindAll(page paging.Page) []entities.Product
-	FindByUserID(userID uint, page paging.Page) []entities.Product
-	UpdateByID(ID uint, updatedProduct *entities.Product) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, product *entities.Product) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Product, error)
+	FindAll(ctx context.Context, page paging.Page, sort paging.Sort) []entities.Product
+	FindByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product
+	UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error
+	DeleteByID(ctx context.Context, ID uint) error
 }
 
 type ProductServiceImpl struct {
 	ProductRepository repositories.ProductRepository
+	Transactor        repositories.Transactor
+	EventPublisher    EventPublisher
+	AuditService      AuditService
+	Logger            *slog.Logger
 }
 
-func InitProductService(productRepository repositories.ProductRepository) ProductService {
+func InitProductService(
+	productRepository repositories.ProductRepository,
+	transactor repositories.Transactor,
+	eventPublisher EventPublisher,
+	auditService AuditService,
+	logger *slog.Logger,
+) ProductService {
 	return &ProductServiceImpl{
 		ProductRepository: productRepository,
+		Transactor:        transactor,
+		EventPublisher:    eventPublisher,
+		AuditService:      auditService,
+		Logger:            logger,
+	}
+}
+
+func (service *ProductServiceImpl) Save(ctx context.Context, product *entities.Product) (uint, error) {
+	ctx, span := tracer.Start(ctx, "ProductService.Save")
+
+	id, err := service.save(ctx, product)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "saved product", "product_id", id)
+		service.AuditService.Record(ctx, entities.AuditActionCreate, AuditEntityProduct, id, nil, productAuditSnapshot(product))
 	}
+
+	return id, translateError(err, ErrProductNotFound)
 }
 
-func (service *ProductServiceImpl) Save(product *entities.Product) (uint, error) {
-	return service.ProductRepository.Save(product)
+func (service *ProductServiceImpl) save(ctx context.Context, product *entities.Product) (uint, error) {
+	var id uint
+
+	err := service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		id, err = service.ProductRepository.Save(ctx, product)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.ProductCreated, id, productEventPayload(product))
+	})
+
+	return id, err
 }
 
-func (service *ProductServiceImpl) FindByID(ID uint) (*entities.Product, error) {
-	return service.ProductRepository.FindByID(ID)
+func (service *ProductServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductService.FindByID")
+
+	product, err := service.ProductRepository.FindByID(ctx, ID)
+	endSpan(span, err)
+
+	return product, translateError(err, ErrProductNotFound)
 }
 
-func (service *ProductServiceImpl) FindAll(page paging.Page) []entities.Product {
-	return service.ProductRepository.FindAll(page)
+func (service *ProductServiceImpl) FindAll(ctx context.Context, page paging.Page, sort paging.Sort) []entities.Product {
+	ctx, span := tracer.Start(ctx, "ProductService.FindAll")
+	defer span.End()
+
+	return service.ProductRepository.FindAll(ctx, page, sort)
 }
 
-func (service *ProductServiceImpl) FindByUserID(userID uint, page paging.Page) []entities.Product {
-	return service.ProductRepository.FindByUserID(userID, page)
+func (service *ProductServiceImpl) FindByUserID(ctx context.Context, userID uint, page paging.Page) []entities.Product {
+	ctx, span := tracer.Start(ctx, "ProductService.FindByUserID")
+	defer span.End()
+
+	return service.ProductRepository.FindByUserID(ctx, userID, page)
 }
 
-func (service *ProductServiceImpl) UpdateByID(ID uint, updatedProduct *entities.Product) error {
-	return service.ProductRepository.UpdateByID(ID, updatedProduct)
+// UpdateByID replaces the details of a product. The update is based on the
+// version in updatedProduct and fails with ErrVersionConflict when the product
+// has been changed since.
+func (service *ProductServiceImpl) UpdateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error {
+	ctx, span := tracer.Start(ctx, "ProductService.UpdateByID")
+
+	err := service.updateByID(ctx, ID, updatedProduct)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated product", "product_id", ID)
+	}
+
+	return translateError(err, ErrProductNotFound)
 }
 
-func (service *ProductServiceImpl) DeleteByID(ID uint) error {
-	return service.ProductRepository.DeleteByID(ID)
+func (service *ProductServiceImpl) updateByID(ctx context.Context, ID uint, updatedProduct *entities.Product) error {
+	product, err := service.ProductRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	updated := *product
+	updated.Name = updatedProduct.Name
+	updated.Description = updatedProduct.Description
+	updated.Price = updatedProduct.Price
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.ProductRepository.UpdateByID(ctx, ID, updatedProduct)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.ProductUpdated, ID, productEventPayload(&updated))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityProduct, ID,
+		productAuditSnapshot(product), productAuditSnapshot(&updated))
+
+	return nil
+}
+
+func (service *ProductServiceImpl) DeleteByID(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "ProductService.DeleteByID")
+
+	err := service.deleteByID(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted product", "product_id", ID)
+	}
+
+	return translateError(err, ErrProductNotFound)
+}
+
+func (service *ProductServiceImpl) deleteByID(ctx context.Context, ID uint) error {
+	product, err := service.ProductRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.ProductRepository.DeleteByID(ctx, ID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.ProductDeleted, ID, productEventPayload(product))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionDelete, AuditEntityProduct, ID, productAuditSnapshot(product), nil)
+
+	return nil
 }
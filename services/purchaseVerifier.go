@@ -0,0 +1,21 @@
+package services
+
+import "context"
+
+/* PurchaseVerifier tells whether a user has bought a product, which marks
+* their review of it as a verified purchase. */
+type PurchaseVerifier interface {
+	HasPurchased(ctx context.Context, userID uint, productID uint) (bool, error)
+}
+
+type NoPurchaseVerifier struct{}
+
+// InitNoPurchaseVerifier returns a verifier for stores without order
+// history, under which no review is a verified purchase.
+func InitNoPurchaseVerifier() PurchaseVerifier {
+	return &NoPurchaseVerifier{}
+}
+
+func (verifier *NoPurchaseVerifier) HasPurchased(ctx context.Context, userID uint, productID uint) (bool, error) {
+	return false, nil
+}
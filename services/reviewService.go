@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/cache"
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+type ReviewService interface {
+	Save(ctx context.Context, review *entities.Review) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.Review, error)
+	FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Review
+	UpdateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error
+	DeleteByID(ctx context.Context, ID uint) error
+	Vote(ctx context.Context, reviewID uint, userID uint, helpful bool) error
+	DeleteVote(ctx context.Context, reviewID uint, userID uint) error
+}
+
+type ReviewServiceImpl struct {
+	ReviewRepository  repositories.ReviewRepository
+	ProductRepository repositories.ProductRepository
+	PurchaseVerifier  PurchaseVerifier
+	ProductCache      cache.Cache
+	Logger            *slog.Logger
+}
+
+func InitReviewService(
+	reviewRepository repositories.ReviewRepository,
+	productRepository repositories.ProductRepository,
+	purchaseVerifier PurchaseVerifier,
+	productCache cache.Cache,
+	logger *slog.Logger,
+) ReviewService {
+	return &ReviewServiceImpl{
+		ReviewRepository:  reviewRepository,
+		ProductRepository: productRepository,
+		PurchaseVerifier:  purchaseVerifier,
+		ProductCache:      productCache,
+		Logger:            logger,
+	}
+}
+
+/* Save stores a new review. Every user may review a product once, except for
+* its seller, and the verified purchase flag is always determined here rather
+* than taken from the request. Reviews change the rating of the product, so
+* the cached product is dropped whenever they change. */
+func (service *ReviewServiceImpl) Save(ctx context.Context, review *entities.Review) (uint, error) {
+	ctx, span := tracer.Start(ctx, "ReviewService.Save")
+
+	id, err := service.save(ctx, review)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "saved review", "review_id", id, "product_id", review.ProductID)
+	}
+
+	return id, err
+}
+
+func (service *ReviewServiceImpl) save(ctx context.Context, review *entities.Review) (uint, error) {
+	product, err := service.ProductRepository.FindByID(ctx, review.ProductID)
+
+	if err != nil {
+		return 0, translateError(err, ErrProductNotFound)
+	}
+
+	if product.UserID == review.UserID {
+		return 0, ErrOwnProductReview
+	}
+
+	review.VerifiedPurchase, err = service.PurchaseVerifier.HasPurchased(ctx, review.UserID, review.ProductID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint
+
+	err = invalidateAround(ctx, service.ProductCache, service.Logger, func() error {
+		id, err = service.ReviewRepository.Save(ctx, review)
+		return err
+	}, productCacheKey(review.ProductID))
+
+	return id, translateSaveReviewError(err)
+}
+
+func (service *ReviewServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.Review, error) {
+	ctx, span := tracer.Start(ctx, "ReviewService.FindByID")
+
+	review, err := service.ReviewRepository.FindByID(ctx, ID)
+	endSpan(span, err)
+
+	return review, translateError(err, ErrReviewNotFound)
+}
+
+func (service *ReviewServiceImpl) FindByProductID(ctx context.Context, productID uint, page paging.Page) []entities.Review {
+	ctx, span := tracer.Start(ctx, "ReviewService.FindByProductID")
+	defer span.End()
+
+	return service.ReviewRepository.FindByProductID(ctx, productID, page)
+}
+
+// UpdateByID replaces the rating and text of a review. The reviewed product,
+// the author and the verified purchase flag stay as they were.
+func (service *ReviewServiceImpl) UpdateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error {
+	ctx, span := tracer.Start(ctx, "ReviewService.UpdateByID")
+
+	err := service.updateByID(ctx, ID, updatedReview)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated review", "review_id", ID)
+	}
+
+	return err
+}
+
+func (service *ReviewServiceImpl) updateByID(ctx context.Context, ID uint, updatedReview *entities.Review) error {
+	review, err := service.ReviewRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return translateError(err, ErrReviewNotFound)
+	}
+
+	updatedReview.ProductID = review.ProductID
+	updatedReview.UserID = review.UserID
+	updatedReview.VerifiedPurchase = review.VerifiedPurchase
+
+	err = invalidateAround(ctx, service.ProductCache, service.Logger, func() error {
+		return service.ReviewRepository.UpdateByID(ctx, ID, updatedReview)
+	}, productCacheKey(review.ProductID))
+
+	return translateError(err, ErrReviewNotFound)
+}
+
+func (service *ReviewServiceImpl) DeleteByID(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "ReviewService.DeleteByID")
+
+	err := service.deleteByID(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted review", "review_id", ID)
+	}
+
+	return err
+}
+
+func (service *ReviewServiceImpl) deleteByID(ctx context.Context, ID uint) error {
+	review, err := service.ReviewRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return translateError(err, ErrReviewNotFound)
+	}
+
+	err = invalidateAround(ctx, service.ProductCache, service.Logger, func() error {
+		return service.ReviewRepository.DeleteByID(ctx, ID)
+	}, productCacheKey(review.ProductID))
+
+	return translateError(err, ErrReviewNotFound)
+}
+
+// Vote marks a review as helpful or unhelpful for the user, replacing their
+// earlier vote. Authors can not vote on their own reviews.
+func (service *ReviewServiceImpl) Vote(ctx context.Context, reviewID uint, userID uint, helpful bool) error {
+	ctx, span := tracer.Start(ctx, "ReviewService.Vote")
+
+	err := service.vote(ctx, reviewID, userID, helpful)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *ReviewServiceImpl) vote(ctx context.Context, reviewID uint, userID uint, helpful bool) error {
+	review, err := service.ReviewRepository.FindByID(ctx, reviewID)
+
+	if err != nil {
+		return translateError(err, ErrReviewNotFound)
+	}
+
+	if review.UserID == userID {
+		return ErrOwnReviewVote
+	}
+
+	err = service.ReviewRepository.SaveVote(ctx, &entities.ReviewVote{
+		ReviewID: reviewID,
+		UserID:   userID,
+		Helpful:  helpful,
+	})
+
+	return translateError(err, ErrReviewNotFound)
+}
+
+func (service *ReviewServiceImpl) DeleteVote(ctx context.Context, reviewID uint, userID uint) error {
+	ctx, span := tracer.Start(ctx, "ReviewService.DeleteVote")
+
+	err := service.ReviewRepository.DeleteVote(ctx, reviewID, userID)
+	endSpan(span, err)
+
+	return translateError(err, ErrReviewNotFound)
+}
+
+// translateSaveReviewError maps the errors of saving a review, where a missing
+// record is the reviewed product.
+func translateSaveReviewError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrReviewExists.Wrap(err)
+	}
+
+	return translateError(err, ErrProductNotFound)
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+var tracer = otel.Tracer("github.com/brunohradec/go-webstore/services")
+
+// endSpan records err on the span, unless it is a plain "not found" which is
+// an expected outcome for lookups, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
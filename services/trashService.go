@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"github.com/brunohradec/go-webstore/storage"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize is the number of products and of comments purged at once by
+// PurgeExpired.
+const purgeBatchSize = 100
+
+/* TrashService lets users find, restore and permanently delete the products
+* and comments they have deleted. Deleted products take their comments with
+* them, restoring a product brings back the comments deleted with it. Anything
+* left in the trash for longer than Retention is purged by PurgeExpired. */
+type TrashService interface {
+	FindProducts(ctx context.Context, userID uint, page paging.Page) []entities.Product
+	FindComments(ctx context.Context, userID uint, page paging.Page) []entities.Comment
+	FindProductByID(ctx context.Context, ID uint) (*entities.Product, error)
+	FindCommentByID(ctx context.Context, ID uint) (*entities.Comment, error)
+	RestoreProduct(ctx context.Context, ID uint) error
+	RestoreComment(ctx context.Context, ID uint) error
+	PurgeProduct(ctx context.Context, ID uint) error
+	PurgeComment(ctx context.Context, ID uint) error
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+type TrashServiceImpl struct {
+	ProductRepository      repositories.ProductRepository
+	CommentRepository      repositories.CommentRepository
+	ProductImageRepository repositories.ProductImageRepository
+	Transactor             repositories.Transactor
+	EventPublisher         EventPublisher
+	AuditService           AuditService
+	BlobStore              storage.BlobStore
+	Retention              time.Duration
+	Logger                 *slog.Logger
+}
+
+func InitTrashService(
+	productRepository repositories.ProductRepository,
+	commentRepository repositories.CommentRepository,
+	productImageRepository repositories.ProductImageRepository,
+	transactor repositories.Transactor,
+	eventPublisher EventPublisher,
+	auditService AuditService,
+	blobStore storage.BlobStore,
+	retention time.Duration,
+	logger *slog.Logger,
+) TrashService {
+	return &TrashServiceImpl{
+		ProductRepository:      productRepository,
+		CommentRepository:      commentRepository,
+		ProductImageRepository: productImageRepository,
+		Transactor:             transactor,
+		EventPublisher:         eventPublisher,
+		AuditService:           auditService,
+		BlobStore:              blobStore,
+		Retention:              retention,
+		Logger:                 logger,
+	}
+}
+
+func (service *TrashServiceImpl) FindProducts(ctx context.Context, userID uint, page paging.Page) []entities.Product {
+	ctx, span := tracer.Start(ctx, "TrashService.FindProducts")
+	defer span.End()
+
+	return service.ProductRepository.FindDeletedByUserID(ctx, userID, page)
+}
+
+func (service *TrashServiceImpl) FindComments(ctx context.Context, userID uint, page paging.Page) []entities.Comment {
+	ctx, span := tracer.Start(ctx, "TrashService.FindComments")
+	defer span.End()
+
+	return service.CommentRepository.FindDeletedByUserID(ctx, userID, page)
+}
+
+func (service *TrashServiceImpl) FindProductByID(ctx context.Context, ID uint) (*entities.Product, error) {
+	ctx, span := tracer.Start(ctx, "TrashService.FindProductByID")
+
+	product, err := service.ProductRepository.FindDeletedByID(ctx, ID)
+	endSpan(span, err)
+
+	return product, translateError(err, ErrProductNotFound)
+}
+
+func (service *TrashServiceImpl) FindCommentByID(ctx context.Context, ID uint) (*entities.Comment, error) {
+	ctx, span := tracer.Start(ctx, "TrashService.FindCommentByID")
+
+	comment, err := service.CommentRepository.FindDeletedByID(ctx, ID)
+	endSpan(span, err)
+
+	return comment, translateError(err, ErrCommentNotFound)
+}
+
+func (service *TrashServiceImpl) RestoreProduct(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "TrashService.RestoreProduct")
+
+	err := service.restoreProduct(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "restored product", "product_id", ID)
+	}
+
+	return translateError(err, ErrProductNotFound)
+}
+
+func (service *TrashServiceImpl) restoreProduct(ctx context.Context, ID uint) error {
+	product, err := service.ProductRepository.FindDeletedByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.ProductRepository.RestoreByID(ctx, ID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.ProductRestored, ID, productEventPayload(product))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionRestore, AuditEntityProduct, ID, nil, productAuditSnapshot(product))
+
+	return nil
+}
+
+// RestoreComment restores a comment on a product which has not been deleted.
+func (service *TrashServiceImpl) RestoreComment(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "TrashService.RestoreComment")
+
+	err := service.restoreComment(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "restored comment", "comment_id", ID)
+	}
+
+	return translateError(err, ErrCommentNotFound)
+}
+
+func (service *TrashServiceImpl) restoreComment(ctx context.Context, ID uint) error {
+	comment, err := service.CommentRepository.FindDeletedByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = service.ProductRepository.FindByID(ctx, comment.ProductID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCommentProductDeleted
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.CommentRepository.RestoreByID(ctx, ID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.CommentRestored, ID, commentEventPayload(comment))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionRestore, AuditEntityComment, ID, nil, commentAuditSnapshot(comment))
+
+	return nil
+}
+
+// PurgeProduct permanently deletes a deleted product, everything belonging to
+// it and the files of its images.
+func (service *TrashServiceImpl) PurgeProduct(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "TrashService.PurgeProduct")
+
+	product, err := service.ProductRepository.FindDeletedByID(ctx, ID)
+
+	if err == nil {
+		err = service.purgeProduct(ctx, product)
+	}
+
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "purged product", "product_id", ID)
+	}
+
+	return translateError(err, ErrProductNotFound)
+}
+
+func (service *TrashServiceImpl) purgeProduct(ctx context.Context, product *entities.Product) error {
+	images := service.ProductImageRepository.FindByProductID(ctx, product.ID)
+
+	err := service.ProductRepository.PurgeByID(ctx, product.ID)
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionPurge, AuditEntityProduct, product.ID, productAuditSnapshot(product), nil)
+
+	for _, image := range images {
+		for _, key := range []string{image.OriginalKey, image.MediumKey, image.ThumbnailKey} {
+			err := service.BlobStore.Delete(ctx, key)
+
+			if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+				service.Logger.WarnContext(ctx, "could not delete product image blob", "key", key, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (service *TrashServiceImpl) PurgeComment(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "TrashService.PurgeComment")
+
+	comment, err := service.CommentRepository.FindDeletedByID(ctx, ID)
+
+	if err == nil {
+		err = service.purgeComment(ctx, comment)
+	}
+
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "purged comment", "comment_id", ID)
+	}
+
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		return ErrCommentHasReplies.Wrap(err)
+	}
+
+	return translateError(err, ErrCommentNotFound)
+}
+
+func (service *TrashServiceImpl) purgeComment(ctx context.Context, comment *entities.Comment) error {
+	err := service.CommentRepository.PurgeByID(ctx, comment.ID)
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionPurge, AuditEntityComment, comment.ID, commentAuditSnapshot(comment), nil)
+
+	return nil
+}
+
+/* PurgeExpired purges the products and comments deleted longer than Retention
+* ago and returns how many were purged. Comments which still have replies are
+* left until their replies are purged. */
+func (service *TrashServiceImpl) PurgeExpired(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "TrashService.PurgeExpired")
+
+	purged, err := service.purgeExpired(ctx, time.Now().Add(-service.Retention))
+	endSpan(span, err)
+
+	if purged > 0 {
+		service.Logger.InfoContext(ctx, "purged expired trash", "count", purged)
+	}
+
+	return purged, err
+}
+
+func (service *TrashServiceImpl) purgeExpired(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+
+	for {
+		products := service.ProductRepository.FindDeletedBefore(ctx, before, purgeBatchSize)
+
+		for _, product := range products {
+			err := service.purgeProduct(ctx, &product)
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return purged, err
+			}
+
+			purged++
+		}
+
+		if len(products) < purgeBatchSize {
+			break
+		}
+	}
+
+	// Purging a comment may leave its parent without replies, which is then
+	// found by the next query.
+	for {
+		comments := service.CommentRepository.FindDeletedBefore(ctx, before, purgeBatchSize)
+
+		for _, comment := range comments {
+			err := service.purgeComment(ctx, &comment)
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return purged, err
+			}
+
+			purged++
+		}
+
+		if len(comments) == 0 {
+			break
+		}
+	}
+
+	return purged, nil
+}
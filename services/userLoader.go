@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/brunohradec/go-webstore/entities"
+)
+
+/* UserLoader looks up the users embedded in a response in batches. Load only
+* queries the users it has not looked up before, including users which turned
+* out not to exist, and Get reads them back. A loader never forgets a user, so
+* it must only live as long as a single request. */
+type UserLoader struct {
+	UserService UserService
+
+	mu     sync.Mutex
+	users  map[uint]*entities.User
+	loaded map[uint]bool
+}
+
+func InitUserLoader(userService UserService) *UserLoader {
+	return &UserLoader{
+		UserService: userService,
+		users:       make(map[uint]*entities.User),
+		loaded:      make(map[uint]bool),
+	}
+}
+
+// Load looks up the users with the given IDs which were not looked up yet with
+// a single query.
+func (loader *UserLoader) Load(ctx context.Context, IDs ...uint) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+
+	var missing []uint
+
+	for _, ID := range IDs {
+		if !loader.loaded[ID] {
+			loader.loaded[ID] = true
+			missing = append(missing, ID)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	for ID, user := range loader.UserService.FindByIDs(ctx, missing) {
+		user := user
+		loader.users[ID] = &user
+	}
+}
+
+// Get returns a loaded user, or false when the user was not loaded or does not
+// exist, for example because it was deleted.
+func (loader *UserLoader) Get(ID uint) (*entities.User, bool) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+
+	user, found := loader.users[ID]
+
+	return user, found
+}
+
+// Username returns the username of a loaded user, or an empty string when the
+// user is not known.
+func (loader *UserLoader) Username(ID uint) string {
+	if user, found := loader.Get(ID); found {
+		return user.Username
+	}
+
+	return ""
+}
@@ -1,44 +1,301 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/brunohradec/go-webstore/authutils"
 	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
 	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
 )
 
 type UserService interface {
-	Save(user *entities.User) (uint, error)
-	FindByID(ID uint) (*entities.User, error)
-	FindByUseraname(username string) (*entities.User, error)
-	UpdateByID(ID uint, updatedUser *entities.User) error
-	DeleteByID(ID uint) error
+	Save(ctx context.Context, user *entities.User) (uint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.User, error)
+	FindByIDs(ctx context.Context, IDs []uint) map[uint]entities.User
+	FindByUseraname(ctx context.Context, username string) (*entities.User, error)
+	UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error
+	UpdateRoleByID(ctx context.Context, ID uint, role entities.Role) error
+	ChangePassword(ctx context.Context, ID uint, currentPassword string, newPassword string) error
+	DeleteByID(ctx context.Context, ID uint) error
 }
 
 type UserServiceImpl struct {
 	UserRepository repositories.UserRepository
+	Transactor     repositories.Transactor
+	EventPublisher EventPublisher
+	AuditService   AuditService
+	Logger         *slog.Logger
 }
 
-func InitUserService(userRepository repositories.UserRepository) UserService {
+func InitUserService(
+	userRepository repositories.UserRepository,
+	transactor repositories.Transactor,
+	eventPublisher EventPublisher,
+	auditService AuditService,
+	logger *slog.Logger,
+) UserService {
 	return &UserServiceImpl{
 		UserRepository: userRepository,
+		Transactor:     transactor,
+		EventPublisher: eventPublisher,
+		AuditService:   auditService,
+		Logger:         logger,
+	}
+}
+
+func (service *UserServiceImpl) Save(ctx context.Context, user *entities.User) (uint, error) {
+	ctx, span := tracer.Start(ctx, "UserService.Save")
+
+	if user.Role == "" {
+		user.Role = entities.RoleUser
+	}
+
+	id, err := service.save(ctx, user)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "saved user", "user_id", id)
+		service.AuditService.Record(ctx, entities.AuditActionCreate, AuditEntityUser, id, nil, userAuditSnapshot(user))
+	}
+
+	return id, translateUserError(err)
+}
+
+func (service *UserServiceImpl) save(ctx context.Context, user *entities.User) (uint, error) {
+	var id uint
+
+	err := service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		id, err = service.UserRepository.Save(ctx, user)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.UserRegistered, id, userEventPayload(user))
+	})
+
+	return id, err
+}
+
+func (service *UserServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.FindByID")
+
+	user, err := service.UserRepository.FindByID(ctx, ID)
+	endSpan(span, err)
+
+	return user, translateUserError(err)
+}
+
+// FindByIDs loads several users at once, keyed by ID. Users which do not exist
+// are left out.
+func (service *UserServiceImpl) FindByIDs(ctx context.Context, IDs []uint) map[uint]entities.User {
+	ctx, span := tracer.Start(ctx, "UserService.FindByIDs")
+	defer span.End()
+
+	usersByID := make(map[uint]entities.User, len(IDs))
+
+	for _, user := range service.UserRepository.FindByIDs(ctx, IDs) {
+		usersByID[user.ID] = user
+	}
+
+	return usersByID
+}
+
+func (service *UserServiceImpl) FindByUseraname(ctx context.Context, username string) (*entities.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.FindByUseraname")
+
+	user, err := service.UserRepository.FindByUseraname(ctx, username)
+	endSpan(span, err)
+
+	return user, translateUserError(err)
+}
+
+// UpdateByID replaces the details of a user, keeping their role and password.
+// The update is based on the version in updatedUser and fails with
+// ErrVersionConflict when the user has been changed since.
+func (service *UserServiceImpl) UpdateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateByID")
+
+	err := service.updateByID(ctx, ID, updatedUser)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated user", "user_id", ID)
+	}
+
+	return translateUserError(err)
+}
+
+func (service *UserServiceImpl) updateByID(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	user, err := service.UserRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	updatedUser.Role = user.Role
+
+	err = service.updateAndPublish(ctx, ID, updatedUser)
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityUser, ID,
+		userAuditSnapshot(user), userAuditSnapshot(updatedUser))
+
+	return nil
+}
+
+func (service *UserServiceImpl) UpdateRoleByID(ctx context.Context, ID uint, role entities.Role) error {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateRoleByID")
+
+	err := service.updateRoleByID(ctx, ID, role)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated user role", "user_id", ID, "role", role)
 	}
+
+	return translateUserError(err)
 }
 
-func (service *UserServiceImpl) Save(user *entities.User) (uint, error) {
-	return service.UserRepository.Save(user)
+func (service *UserServiceImpl) updateRoleByID(ctx context.Context, ID uint, role entities.Role) error {
+	user, err := service.UserRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	before := userAuditSnapshot(user)
+	user.Role = role
+
+	err = service.updateAndPublish(ctx, ID, user)
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityUser, ID, before, userAuditSnapshot(user))
+
+	return nil
 }
 
-func (service *UserServiceImpl) FindByID(ID uint) (*entities.User, error) {
-	return service.UserRepository.FindByID(ID)
+// ChangePassword sets a new password after checking the current one, so that a
+// stolen access token is not enough to take over the account.
+func (service *UserServiceImpl) ChangePassword(ctx context.Context, ID uint, currentPassword string, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "UserService.ChangePassword")
+
+	err := service.changePassword(ctx, ID, currentPassword, newPassword)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "changed user password", "user_id", ID)
+	}
+
+	return translateUserError(err)
 }
 
-func (service *UserServiceImpl) FindByUseraname(username string) (*entities.User, error) {
-	return service.UserRepository.FindByUseraname(username)
+func (service *UserServiceImpl) changePassword(ctx context.Context, ID uint, currentPassword string, newPassword string) error {
+	user, err := service.UserRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = authutils.VerifyPassword(currentPassword, user.Password)
+
+	if err != nil {
+		return ErrWrongPassword.Wrap(err)
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.UserRepository.UpdatePasswordByID(ctx, ID, newPassword)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.UserPasswordChanged, ID, userEventPayload(user))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionUpdate, AuditEntityUser, ID, nil, map[string]any{
+		"password": redactedValue,
+	})
+
+	return nil
+}
+
+func (service *UserServiceImpl) DeleteByID(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "UserService.DeleteByID")
+
+	err := service.deleteByID(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted user", "user_id", ID)
+	}
+
+	return translateUserError(err)
+}
+
+func (service *UserServiceImpl) deleteByID(ctx context.Context, ID uint) error {
+	user, err := service.UserRepository.FindByID(ctx, ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.UserRepository.DeleteByID(ctx, ID)
+
+		if err != nil {
+			return err
+		}
+
+		return service.EventPublisher.Publish(ctx, events.UserDeleted, ID, userEventPayload(user))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service.AuditService.Record(ctx, entities.AuditActionDelete, AuditEntityUser, ID, userAuditSnapshot(user), nil)
+
+	return nil
 }
 
-func (service *UserServiceImpl) UpdateByID(ID uint, updatedUser *entities.User) error {
-	return service.UserRepository.UpdateByID(ID, updatedUser)
+// updateAndPublish updates the user and publishes the change in one
+// transaction.
+func (service *UserServiceImpl) updateAndPublish(ctx context.Context, ID uint, updatedUser *entities.User) error {
+	return service.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		err := service.UserRepository.UpdateByID(ctx, ID, updatedUser)
+
+		if err != nil {
+			return err
+		}
+
+		updated := *updatedUser
+		updated.ID = ID
+
+		return service.EventPublisher.Publish(ctx, events.UserUpdated, ID, userEventPayload(&updated))
+	})
 }
 
-func (service *UserServiceImpl) DeleteByID(ID uint) error {
-	return service.UserRepository.DeleteByID(ID)
+func translateUserError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrUsernameTaken.Wrap(err)
+	}
+
+	return translateError(err, ErrUserNotFound)
 }
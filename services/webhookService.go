@@ -0,0 +1,632 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/brunohradec/go-webstore/entities"
+	"github.com/brunohradec/go-webstore/events"
+	"github.com/brunohradec/go-webstore/infrastructure"
+	"github.com/brunohradec/go-webstore/paging"
+	"github.com/brunohradec/go-webstore/repositories"
+	"gorm.io/gorm"
+)
+
+const (
+	WebhookTestEventType = "webhook.test"
+
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+
+	webhookUserAgent         = "go-webstore-webhooks/1.0"
+	webhookDispatchBatchSize = 10
+	// webhookResponseLimit is how much of a response body is read before the
+	// connection is released, the body itself is not kept.
+	webhookResponseLimit = 64 << 10
+)
+
+// WebhookEventTypes are the events sellers can subscribe their endpoints to.
+var WebhookEventTypes = []events.Type{
+	events.ProductCreated,
+	events.ProductUpdated,
+	events.ProductDeleted,
+	events.ProductRestored,
+	events.CommentPosted,
+	events.CommentUpdated,
+	events.CommentDeleted,
+	events.CommentRestored,
+}
+
+type WebhookService interface {
+	// Save registers a new endpoint, generating the secret its payloads are
+	// signed with.
+	Save(ctx context.Context, endpoint *entities.WebhookEndpoint) (*entities.WebhookEndpoint, error)
+	FindByID(ctx context.Context, ID uint) (*entities.WebhookEndpoint, error)
+	FindByUserID(ctx context.Context, userID uint) []entities.WebhookEndpoint
+	// UpdateByID replaces the URL, description, subscriptions and enabled
+	// state of an endpoint. Enabling an endpoint clears its failures.
+	UpdateByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error
+	DeleteByID(ctx context.Context, ID uint) error
+	// FindDeliveries returns a page of the deliveries to an endpoint, newest
+	// first, with their attempts.
+	FindDeliveries(ctx context.Context, ID uint, page paging.Page) ([]entities.WebhookDelivery, error)
+	// SendTest sends a test event to an endpoint right away and returns the
+	// delivery. Test events are not retried and do not count towards
+	// disabling the endpoint.
+	SendTest(ctx context.Context, ID uint) (*entities.WebhookDelivery, error)
+
+	// Enqueue is the bus handler creating the deliveries of an event to the
+	// endpoints of the seller it concerns.
+	Enqueue(ctx context.Context, event *events.Event) error
+	// Dispatch sends the deliveries which are due and returns how many
+	// succeeded.
+	Dispatch(ctx context.Context) (int, error)
+}
+
+type WebhookServiceImpl struct {
+	WebhookRepository repositories.WebhookRepository
+	ProductRepository repositories.ProductRepository
+	Client            *http.Client
+	MaxAttempts       int
+	RetryDelay        time.Duration
+	DisableAfter      int
+	Timeout           time.Duration
+	Logger            *slog.Logger
+}
+
+func InitWebhookService(
+	webhookRepository repositories.WebhookRepository,
+	productRepository repositories.ProductRepository,
+	client *http.Client,
+	env *infrastructure.WebhookEnv,
+	logger *slog.Logger,
+) WebhookService {
+	return &WebhookServiceImpl{
+		WebhookRepository: webhookRepository,
+		ProductRepository: productRepository,
+		Client:            client,
+		MaxAttempts:       env.MaxAttempts,
+		RetryDelay:        env.RetryDelay,
+		DisableAfter:      env.DisableAfter,
+		Timeout:           env.Timeout,
+		Logger:            logger,
+	}
+}
+
+// webhookBody is the JSON body of every webhook request. Data is the payload
+// of the event, as defined in the events package.
+type webhookBody struct {
+	EventID    uint            `json:"eventID,omitempty"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func (service *WebhookServiceImpl) Save(ctx context.Context, endpoint *entities.WebhookEndpoint) (*entities.WebhookEndpoint, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Save")
+
+	err := service.save(ctx, endpoint)
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	service.Logger.InfoContext(ctx, "saved webhook endpoint", "webhook_id", endpoint.ID, "user_id", endpoint.UserID)
+
+	return endpoint, nil
+}
+
+func (service *WebhookServiceImpl) save(ctx context.Context, endpoint *entities.WebhookEndpoint) error {
+	secret, err := newWebhookSecret()
+
+	if err != nil {
+		return err
+	}
+
+	endpoint.Secret = secret
+	endpoint.Enabled = true
+	endpoint.ConsecutiveFailures = 0
+	endpoint.DisabledAt = nil
+
+	_, err = service.WebhookRepository.SaveEndpoint(ctx, endpoint)
+
+	return err
+}
+
+func (service *WebhookServiceImpl) FindByID(ctx context.Context, ID uint) (*entities.WebhookEndpoint, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.FindByID")
+
+	endpoint, err := service.WebhookRepository.FindEndpointByID(ctx, ID)
+	endSpan(span, err)
+
+	return endpoint, translateError(err, ErrWebhookNotFound)
+}
+
+func (service *WebhookServiceImpl) FindByUserID(ctx context.Context, userID uint) []entities.WebhookEndpoint {
+	ctx, span := tracer.Start(ctx, "WebhookService.FindByUserID")
+	defer span.End()
+
+	return service.WebhookRepository.FindEndpointsByUserID(ctx, userID)
+}
+
+func (service *WebhookServiceImpl) UpdateByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.UpdateByID")
+
+	err := service.updateByID(ctx, ID, updatedEndpoint)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "updated webhook endpoint", "webhook_id", ID, "enabled", updatedEndpoint.Enabled)
+	}
+
+	return err
+}
+
+func (service *WebhookServiceImpl) updateByID(ctx context.Context, ID uint, updatedEndpoint *entities.WebhookEndpoint) error {
+	endpoint, err := service.WebhookRepository.FindEndpointByID(ctx, ID)
+
+	if err != nil {
+		return translateError(err, ErrWebhookNotFound)
+	}
+
+	updatedEndpoint.ConsecutiveFailures = endpoint.ConsecutiveFailures
+	updatedEndpoint.DisabledAt = endpoint.DisabledAt
+
+	switch {
+	case updatedEndpoint.Enabled && !endpoint.Enabled:
+		updatedEndpoint.ConsecutiveFailures = 0
+		updatedEndpoint.DisabledAt = nil
+	case !updatedEndpoint.Enabled && endpoint.Enabled:
+		now := time.Now()
+		updatedEndpoint.DisabledAt = &now
+	}
+
+	err = service.WebhookRepository.UpdateEndpointByID(ctx, ID, updatedEndpoint)
+
+	return translateError(err, ErrWebhookNotFound)
+}
+
+func (service *WebhookServiceImpl) DeleteByID(ctx context.Context, ID uint) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.DeleteByID")
+
+	err := service.WebhookRepository.DeleteEndpointByID(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "deleted webhook endpoint", "webhook_id", ID)
+	}
+
+	return translateError(err, ErrWebhookNotFound)
+}
+
+func (service *WebhookServiceImpl) FindDeliveries(ctx context.Context, ID uint, page paging.Page) ([]entities.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.FindDeliveries")
+
+	_, err := service.WebhookRepository.FindEndpointByID(ctx, ID)
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, translateError(err, ErrWebhookNotFound)
+	}
+
+	return service.WebhookRepository.FindDeliveriesByEndpointID(ctx, ID, page), nil
+}
+
+func (service *WebhookServiceImpl) SendTest(ctx context.Context, ID uint) (*entities.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.SendTest")
+
+	delivery, err := service.sendTest(ctx, ID)
+	endSpan(span, err)
+
+	if err == nil {
+		service.Logger.InfoContext(ctx, "sent webhook test event",
+			"webhook_id", ID, "delivered", delivery.DeliveredAt != nil, "status_code", delivery.LastStatusCode)
+	}
+
+	return delivery, err
+}
+
+func (service *WebhookServiceImpl) sendTest(ctx context.Context, ID uint) (*entities.WebhookDelivery, error) {
+	endpoint, err := service.WebhookRepository.FindEndpointByID(ctx, ID)
+
+	if err != nil {
+		return nil, translateError(err, ErrWebhookNotFound)
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"webhookID": endpoint.ID,
+		"message":   "This is a test event, your endpoint is set up correctly",
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&webhookBody{
+		Type:       WebhookTestEventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// The delivery is saved as finished, so the dispatcher does not pick it
+	// up while it is being sent here.
+	delivery := &entities.WebhookDelivery{
+		EndpointID:    endpoint.ID,
+		EventType:     WebhookTestEventType,
+		Payload:       string(payload),
+		NextAttemptAt: now,
+		FailedAt:      &now,
+	}
+
+	err = service.WebhookRepository.SaveDelivery(ctx, delivery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	attempt, err := service.attempt(ctx, endpoint, delivery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if attempt.Error == "" {
+		delivery.DeliveredAt = &attempt.CreatedAt
+		delivery.FailedAt = nil
+	}
+
+	err = service.WebhookRepository.UpdateDelivery(ctx, delivery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Attempts = []entities.WebhookAttempt{*attempt}
+
+	return delivery, nil
+}
+
+/* Enqueue creates a delivery of the event to every enabled endpoint of the
+* seller of the product the event is about which subscribes to it. Comments are
+* only forwarded once published, and comments of sellers on their own products
+* are left out. An event delivered again does not create duplicate
+* deliveries. */
+func (service *WebhookServiceImpl) Enqueue(ctx context.Context, event *events.Event) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.Enqueue")
+
+	err := service.enqueue(ctx, event)
+	endSpan(span, err)
+
+	return err
+}
+
+func (service *WebhookServiceImpl) enqueue(ctx context.Context, event *events.Event) error {
+	sellerID, ok, err := service.sellerOf(ctx, event)
+
+	if err != nil || !ok {
+		return err
+	}
+
+	payload, err := json.Marshal(&webhookBody{
+		EventID:    event.ID,
+		Type:       string(event.Type),
+		OccurredAt: event.OccurredAt.UTC(),
+		Data:       event.Payload,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	eventID := event.ID
+
+	for _, endpoint := range service.WebhookRepository.FindEndpointsByUserID(ctx, sellerID) {
+		if !endpoint.Enabled || !endpoint.Subscribes(string(event.Type)) {
+			continue
+		}
+
+		err := service.WebhookRepository.SaveDelivery(ctx, &entities.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       &eventID,
+			EventType:     string(event.Type),
+			Payload:       string(payload),
+			NextAttemptAt: time.Now(),
+		})
+
+		if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sellerOf returns the ID of the seller whose endpoints receive the event, or
+// false when the event is not forwarded at all.
+func (service *WebhookServiceImpl) sellerOf(ctx context.Context, event *events.Event) (uint, bool, error) {
+	switch event.Type {
+	case events.ProductCreated, events.ProductUpdated, events.ProductDeleted, events.ProductRestored:
+		var payload events.ProductPayload
+
+		err := event.Decode(&payload)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		return payload.UserID, true, nil
+	case events.CommentPosted, events.CommentUpdated, events.CommentDeleted, events.CommentRestored:
+		var payload events.CommentPayload
+
+		err := event.Decode(&payload)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		if payload.Status != string(entities.CommentStatusPublished) {
+			return 0, false, nil
+		}
+
+		product, err := service.ProductRepository.FindByID(ctx, payload.ProductID)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, nil
+		}
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		return product.UserID, product.UserID != payload.UserID, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+func (service *WebhookServiceImpl) Dispatch(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Dispatch")
+
+	delivered, err := service.dispatch(ctx)
+	endSpan(span, err)
+
+	if delivered > 0 {
+		service.Logger.DebugContext(ctx, "dispatched webhooks", "count", delivered)
+	}
+
+	return delivered, err
+}
+
+func (service *WebhookServiceImpl) dispatch(ctx context.Context) (int, error) {
+	// The deliveries of a batch are sent one after the other, so the lease
+	// has to outlast every one of them timing out.
+	lease := dispatchLease + webhookDispatchBatchSize*service.Timeout
+	delivered := 0
+
+	for {
+		claimed, err := service.WebhookRepository.ClaimDueDeliveries(ctx, time.Now(), lease, webhookDispatchBatchSize)
+
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, delivery := range claimed {
+			ok, err := service.deliver(ctx, &delivery)
+
+			if err != nil {
+				return delivered, err
+			}
+
+			if ok {
+				delivered++
+			}
+		}
+
+		if len(claimed) < webhookDispatchBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+/* deliver sends a claimed delivery to its endpoint and records the attempt. A
+* failed delivery is retried with an exponential backoff until it runs out of
+* attempts, and every failed attempt counts towards disabling the endpoint.
+* Deliveries to endpoints which were disabled or deleted in the meantime fail
+* without being sent. */
+func (service *WebhookServiceImpl) deliver(ctx context.Context, delivery *entities.WebhookDelivery) (bool, error) {
+	endpoint, err := service.WebhookRepository.FindEndpointByID(ctx, delivery.EndpointID)
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if err != nil || !endpoint.Enabled {
+		now := time.Now()
+
+		delivery.FailedAt = &now
+		delivery.LastError = "endpoint was disabled or deleted"
+
+		return false, service.WebhookRepository.UpdateDelivery(ctx, delivery)
+	}
+
+	attempt, err := service.attempt(ctx, endpoint, delivery)
+
+	if err != nil {
+		return false, err
+	}
+
+	if attempt.Error == "" {
+		delivery.DeliveredAt = &attempt.CreatedAt
+
+		if endpoint.ConsecutiveFailures > 0 {
+			err = service.WebhookRepository.ResetEndpointFailures(ctx, endpoint.ID)
+
+			if err != nil {
+				return true, err
+			}
+		}
+
+		return true, service.WebhookRepository.UpdateDelivery(ctx, delivery)
+	}
+
+	if delivery.AttemptCount >= service.MaxAttempts {
+		delivery.FailedAt = &attempt.CreatedAt
+
+		service.Logger.WarnContext(ctx, "webhook delivery ran out of attempts",
+			"delivery_id", delivery.ID, "webhook_id", endpoint.ID, "attempts", delivery.AttemptCount, "error", attempt.Error)
+	} else {
+		delivery.NextAttemptAt = attempt.CreatedAt.Add(retryDelay(service.RetryDelay, delivery.AttemptCount))
+	}
+
+	err = service.WebhookRepository.UpdateDelivery(ctx, delivery)
+
+	if err != nil {
+		return false, err
+	}
+
+	disabled, err := service.WebhookRepository.RecordEndpointFailure(ctx, endpoint.ID, service.DisableAfter, attempt.CreatedAt)
+
+	if disabled {
+		service.Logger.WarnContext(ctx, "disabled failing webhook endpoint",
+			"webhook_id", endpoint.ID, "user_id", endpoint.UserID, "failures", endpoint.ConsecutiveFailures+1)
+	}
+
+	return false, err
+}
+
+// attempt sends the payload of a delivery to the endpoint, saves the attempt
+// and updates the delivery with its outcome, leaving it to the caller to save.
+func (service *WebhookServiceImpl) attempt(
+	ctx context.Context,
+	endpoint *entities.WebhookEndpoint,
+	delivery *entities.WebhookDelivery,
+) (*entities.WebhookAttempt, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Attempt")
+
+	start := time.Now()
+	statusCode, sendErr := service.send(ctx, endpoint, delivery)
+	endSpan(span, sendErr)
+
+	attempt := &entities.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		StatusCode: statusCode,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+
+	err := service.WebhookRepository.SaveAttempt(ctx, attempt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.AttemptCount++
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+
+	return attempt, nil
+}
+
+func (service *WebhookServiceImpl) send(
+	ctx context.Context,
+	endpoint *entities.WebhookEndpoint,
+	delivery *entities.WebhookDelivery,
+) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(endpoint.Secret, time.Now(), body))
+
+	res, err := service.Client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, webhookResponseLimit))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+/* SignWebhookPayload returns the signature header of a webhook body sent at
+* timestamp, in the form t=<unix seconds>,v1=<hex HMAC-SHA256>. The HMAC is
+* computed with the secret of the endpoint over the timestamp and the body
+* joined by a dot, so receivers can reject old requests being replayed. */
+func SignWebhookPayload(secret string, timestamp time.Time, body []byte) string {
+	unix := fmt.Sprintf("%d", timestamp.Unix())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	_, err := rand.Read(secret)
+
+	if err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// RunWebhookDispatcher sends due webhook deliveries every interval until ctx is
+// done.
+func RunWebhookDispatcher(ctx context.Context, service WebhookService, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := service.Dispatch(ctx)
+
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.ErrorContext(ctx, "could not dispatch webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+/* BlobStore stores binary objects, such as product images, under slash
+* separated keys. URL returns the address clients use to download an object,
+* which may point at the application itself or directly at the storage
+* service. */
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+type BlobInfo struct {
+	Size        int64
+	ContentType string
+}
+
+/* PresignedBlobStore is a BlobStore which clients can upload to directly.
+* PresignPut returns a URL accepting a single HTTP PUT of the object until the
+* expiry passes. Stat reports on an object without downloading it, so that an
+* upload can be checked before it is used. */
+type PresignedBlobStore interface {
+	BlobStore
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+}
+
+// validKey reports whether key is a relative path which can not escape the
+// root of a store.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
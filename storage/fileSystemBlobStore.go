@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const contentTypeSuffix = ".content-type"
+
+/* FileSystemBlobStore keeps blobs as files below Root. The content type of a
+* blob is stored next to it, so that it can be served back unchanged. */
+type FileSystemBlobStore struct {
+	Root    string
+	BaseURL string
+}
+
+func InitFileSystemBlobStore(root string, baseURL string) (BlobStore, error) {
+	err := os.MkdirAll(root, 0o755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSystemBlobStore{
+		Root:    root,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (store *FileSystemBlobStore) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	path := store.path(key)
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+
+	if err != nil {
+		return err
+	}
+
+	/* Written to a temporary file first, so that readers never observe a
+	* partially written blob. */
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, content)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path+contentTypeSuffix, []byte(contentType), 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (store *FileSystemBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	if !validKey(key) || strings.HasSuffix(key, contentTypeSuffix) {
+		return nil, "", ErrBlobNotFound
+	}
+
+	path := store.path(key)
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrBlobNotFound
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType, err := os.ReadFile(path + contentTypeSuffix)
+
+	if err != nil {
+		contentType = []byte("application/octet-stream")
+	}
+
+	return file, string(contentType), nil
+}
+
+func (store *FileSystemBlobStore) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	path := store.path(key)
+
+	err := os.Remove(path)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.Remove(path + contentTypeSuffix)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *FileSystemBlobStore) URL(key string) string {
+	return store.BaseURL + "/" + key
+}
+
+func (store *FileSystemBlobStore) path(key string) string {
+	return filepath.Join(store.Root, filepath.FromSlash(key))
+}
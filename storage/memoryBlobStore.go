@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+type memoryBlob struct {
+	content     []byte
+	contentType string
+}
+
+// MemoryBlobStore keeps blobs in memory. It is meant for tests and for running
+// the application without persistent storage.
+type MemoryBlobStore struct {
+	mu      sync.RWMutex
+	blobs   map[string]*memoryBlob
+	BaseURL string
+}
+
+func InitMemoryBlobStore(baseURL string) BlobStore {
+	return &MemoryBlobStore{
+		blobs:   make(map[string]*memoryBlob),
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (store *MemoryBlobStore) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	data, err := io.ReadAll(content)
+
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.blobs[key] = &memoryBlob{content: data, contentType: contentType}
+
+	return nil
+}
+
+func (store *MemoryBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	blob, found := store.blobs[key]
+
+	if !found {
+		return nil, "", ErrBlobNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(blob.content)), blob.contentType, nil
+}
+
+func (store *MemoryBlobStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.blobs, key)
+
+	return nil
+}
+
+func (store *MemoryBlobStore) URL(key string) string {
+	return store.BaseURL + "/" + key
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	// BaseURL is the public address of the bucket, such as a CDN in front of
+	// it. Objects are addressed through the endpoint when it is empty.
+	BaseURL string
+}
+
+/* S3BlobStore keeps blobs in a bucket of an S3 compatible object storage.
+* Besides the BlobStore operations it can presign uploads, so that clients
+* send large files straight to the bucket instead of through the API. */
+type S3BlobStore struct {
+	Client  *minio.Client
+	Bucket  string
+	BaseURL string
+}
+
+func InitS3BlobStore(ctx context.Context, config *S3Config) (PresignedBlobStore, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("bucket %q does not exist", config.Bucket)
+	}
+
+	baseURL := config.BaseURL
+
+	if baseURL == "" {
+		baseURL = client.EndpointURL().String() + "/" + config.Bucket
+	}
+
+	return &S3BlobStore{
+		Client:  client,
+		Bucket:  config.Bucket,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (store *S3BlobStore) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	// Objects of unknown size are sent as a multipart upload, which buffers
+	// whole parts in memory, so the size is passed on when it is known.
+	size := int64(-1)
+
+	if sized, ok := content.(interface{ Len() int }); ok {
+		size = int64(sized.Len())
+	}
+
+	_, err := store.Client.PutObject(ctx, store.Bucket, key, content, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		// Streaming payload signatures are not understood by every S3
+		// compatible service.
+		DisableContentSha256: true,
+	})
+
+	return err
+}
+
+func (store *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	if !validKey(key) {
+		return nil, "", ErrBlobNotFound
+	}
+
+	object, err := store.Client.GetObject(ctx, store.Bucket, key, minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, "", translateS3Error(err)
+	}
+
+	// GetObject is lazy, the object is only requested by Stat or Read.
+	info, err := object.Stat()
+
+	if err != nil {
+		object.Close()
+		return nil, "", translateS3Error(err)
+	}
+
+	return object, info.ContentType, nil
+}
+
+func (store *S3BlobStore) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	return store.Client.RemoveObject(ctx, store.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (store *S3BlobStore) URL(key string) string {
+	return store.BaseURL + "/" + key
+}
+
+func (store *S3BlobStore) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	presignedURL, err := store.Client.PresignedPutObject(ctx, store.Bucket, key, expiry)
+
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.String(), nil
+}
+
+func (store *S3BlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	if !validKey(key) {
+		return nil, ErrBlobNotFound
+	}
+
+	info, err := store.Client.StatObject(ctx, store.Bucket, key, minio.StatObjectOptions{})
+
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+
+	return &BlobInfo{
+		Size:        info.Size,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+func translateS3Error(err error) error {
+	var response minio.ErrorResponse
+
+	if errors.As(err, &response) && (response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey") {
+		return ErrBlobNotFound
+	}
+
+	return err
+}
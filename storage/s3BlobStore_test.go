@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+const testBucket = "webstore-test"
+
+// newTestS3BlobStore starts an in-process S3 stand-in and connects a store to
+// it.
+func newTestS3BlobStore(t *testing.T) PresignedBlobStore {
+	t.Helper()
+
+	backend := s3mem.New()
+
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	endpoint, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := InitS3BlobStore(context.Background(), &S3Config{
+		Endpoint:        endpoint.Host,
+		Region:          "us-east-1",
+		Bucket:          testBucket,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test-secret",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestS3BlobStore(t *testing.T) {
+	store := newTestS3BlobStore(t)
+	ctx := context.Background()
+
+	err := store.Put(ctx, "products/1/a.png", strings.NewReader("png"), "image/png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, contentType, err := store.Get(ctx, "products/1/a.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(content)
+	content.Close()
+
+	if err != nil || string(data) != "png" || contentType != "image/png" {
+		t.Errorf("unexpected blob %q of type %q: %v", data, contentType, err)
+	}
+
+	if err := store.Delete(ctx, "products/1/a.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Get(ctx, "products/1/a.png"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound after delete, got %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader(""), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestS3BlobStorePresignedPut(t *testing.T) {
+	store := newTestS3BlobStore(t)
+	ctx := context.Background()
+
+	if _, err := store.Stat(ctx, "uploads/1/x"); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("expected ErrBlobNotFound before upload, got %v", err)
+	}
+
+	presignedURL, err := store.PresignPut(ctx, "uploads/1/x", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, presignedURL, strings.NewReader("uploaded"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "image/jpeg")
+
+	response, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("presigned upload failed with status %d", response.StatusCode)
+	}
+
+	info, err := store.Stat(ctx, "uploads/1/x")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size != int64(len("uploaded")) || info.ContentType != "image/jpeg" {
+		t.Errorf("unexpected blob info %+v", info)
+	}
+}